@@ -0,0 +1,843 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kimdre/doco-cd/internal/archive"
+	"github.com/kimdre/doco-cd/internal/config"
+	"github.com/kimdre/doco-cd/internal/docker"
+	"github.com/kimdre/doco-cd/internal/git"
+	"github.com/kimdre/doco-cd/internal/logger"
+	"github.com/kimdre/doco-cd/internal/webhook"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// requireApiKey wraps a handler and only calls it if the request contains the correct API secret
+func (h *handlerData) requireApiKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(apiKeyHeader)
+		if key == "" {
+			errMsg = "missing api key"
+			h.log.Debug(errMsg, slog.String("ip", r.RemoteAddr))
+			JSONError(w, errMsg, "", "", http.StatusUnauthorized)
+
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(key), []byte(h.appConfig.ApiSecret)) != 1 {
+			errMsg = "incorrect api key"
+			h.log.Debug(errMsg, slog.String("ip", r.RemoteAddr))
+			JSONError(w, errMsg, "", "", http.StatusUnauthorized)
+
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// MaintenanceApiHandler returns the current maintenance mode state (GET) or
+// enables/disables it with the `enabled` query parameter (POST)
+func (h *handlerData) MaintenanceApiHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+		if err != nil {
+			errMsg = "invalid value for query parameter 'enabled'"
+			JSONError(w, errMsg, err.Error(), "", http.StatusBadRequest)
+
+			return
+		}
+
+		if h.maintenance.Swap(enabled) != enabled {
+			h.log.Info("maintenance mode changed", slog.Bool("maintenance", enabled))
+		}
+	default:
+		JSONError(w, "invalid http method", "", "", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	JSONMaintenanceResponse(w, h.maintenance.Load(), http.StatusOK)
+}
+
+// VersionApiHandler returns the running version of doco-cd and the latest available release from the last update check
+func (h *handlerData) VersionApiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		JSONError(w, "invalid http method", "", "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.appConfig.UpdateCheck {
+		JSONData(w, versionInfo{Current: Version, Details: "update check is disabled"}, http.StatusOK)
+		return
+	}
+
+	info, err := h.versions.get()
+	if info != nil {
+		JSONData(w, info, http.StatusOK)
+		return
+	}
+
+	if err != nil {
+		errMsg = "failed to check for updates"
+		JSONError(w, errMsg, err.Error(), "", http.StatusBadGateway)
+
+		return
+	}
+
+	JSONData(w, versionInfo{Current: Version, Details: "update check has not finished yet"}, http.StatusOK)
+}
+
+// StacksApiHandler returns the stacks deployed by doco-cd, optionally filtered by the `repository` and `reference`
+// query parameters. With `managed_by_doco_cd=false`, stacks that were not deployed by doco-cd are included as well.
+func (h *handlerData) StacksApiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		JSONError(w, "invalid http method", "", "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	managedOnly := true
+
+	if value := query.Get("managed_by_doco_cd"); value != "" {
+		var err error
+
+		managedOnly, err = strconv.ParseBool(value)
+		if err != nil {
+			errMsg = "invalid value for query parameter 'managed_by_doco_cd'"
+			JSONError(w, errMsg, err.Error(), "", http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	stacks, err := docker.GetStacks(r.Context(), h.dockerCli.Client(), !managedOnly)
+	if err != nil {
+		errMsg = "failed to get deployed stacks"
+		h.log.Error(errMsg, logger.ErrAttr(err))
+		JSONError(w, errMsg, err.Error(), "", http.StatusInternalServerError)
+
+		return
+	}
+
+	JSONData(w, docker.FilterStacks(stacks, query.Get("repository"), query.Get("reference")), http.StatusOK)
+}
+
+// repositoryUsage is an entry in the response of the RepositoryUsageApiHandler
+type repositoryUsage struct {
+	Repository    string `json:"repository"`
+	SizeBytes     int64  `json:"size_bytes"`
+	QuotaBytes    int64  `json:"quota_bytes,omitempty"`
+	QuotaExceeded bool   `json:"quota_exceeded"`
+}
+
+// RepositoryUsageApiHandler returns the disk usage of the repositories in the repository cache as of its last update
+func (h *handlerData) RepositoryUsageApiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		JSONError(w, "invalid http method", "", "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.repoUsage == nil {
+		JSONError(w, "repository cache is disabled", "", "", http.StatusNotFound)
+		return
+	}
+
+	quota := int64(h.appConfig.RepoCacheQuota)
+	usage := h.repoUsage.All()
+	result := make([]repositoryUsage, 0, len(usage))
+
+	for repository, size := range usage {
+		result = append(result, repositoryUsage{
+			Repository:    repository,
+			SizeBytes:     size,
+			QuotaBytes:    quota,
+			QuotaExceeded: quota > 0 && size > quota,
+		})
+	}
+
+	slices.SortFunc(result, func(a, b repositoryUsage) int {
+		return strings.Compare(a.Repository, b.Repository)
+	})
+
+	JSONData(w, result, http.StatusOK)
+}
+
+// exportBundle is the response of the ExportApiHandler
+type exportBundle struct {
+	Version     string                `json:"version"`
+	ExportedAt  string                `json:"exported_at"`
+	Maintenance bool                  `json:"maintenance"`
+	Stacks      []docker.ManagedStack `json:"stacks"`
+}
+
+// ExportApiHandler returns the inventory of the stacks deployed by doco-cd as a portable JSON bundle,
+// e.g. to move doco-cd to another host. It contains no secrets and repository URLs are exported without credentials.
+func (h *handlerData) ExportApiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		JSONError(w, "invalid http method", "", "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stacks, err := docker.GetManagedStacks(r.Context(), h.dockerCli.Client())
+	if err != nil {
+		errMsg = "failed to get deployed stacks"
+		h.log.Error(errMsg, logger.ErrAttr(err))
+		JSONError(w, errMsg, err.Error(), "", http.StatusInternalServerError)
+
+		return
+	}
+
+	JSONData(w, exportBundle{
+		Version:     Version,
+		ExportedAt:  time.Now().UTC().Format(time.RFC3339),
+		Maintenance: h.maintenance.Load(),
+		Stacks:      stacks,
+	}, http.StatusOK)
+}
+
+/*
+ImportApiHandler redeploys the stacks of a bundle of the ExportApiHandler, e.g. on a new host after a migration.
+Each stack is deployed from the head of the repository and reference it was deployed from in the background,
+stacks that are deployed by the same deployment job (same repository, reference and custom target) only once.
+*/
+func (h *handlerData) ImportApiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		JSONError(w, "invalid http method", "", "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobID := uuid.Must(uuid.NewRandom()).String()
+	jobLog := h.log.With(slog.String("job_id", jobID))
+
+	var bundle exportBundle
+
+	err := json.NewDecoder(r.Body).Decode(&bundle)
+	if err != nil {
+		errMsg = "invalid request body"
+		JSONError(w, errMsg, err.Error(), jobID, http.StatusBadRequest)
+
+		return
+	}
+
+	stacks, err := getImportStacks(bundle)
+	if err != nil {
+		errMsg = "invalid request body"
+		JSONError(w, errMsg, err.Error(), jobID, http.StatusBadRequest)
+
+		return
+	}
+
+	if h.maintenance.Load() {
+		msg := "maintenance mode is active, import skipped"
+		jobLog.Info(msg)
+		JSONResponse(w, msg, jobID, http.StatusAccepted)
+
+		return
+	}
+
+	jobLog.Info("importing stacks", slog.Int("stacks", len(stacks)), slog.String("exported_version", bundle.Version))
+	JSONResponse(w, fmt.Sprintf("import of %d stacks started", len(stacks)), jobID, http.StatusAccepted)
+
+	// redeployStack waits for a background job slot, so the stacks are not deployed all at once
+	for _, stack := range stacks {
+		go h.redeployStack(context.Background(), stack, getCustomTarget(stack.ConfigSource), triggerImport)
+	}
+}
+
+// getImportStacks returns the stacks of an export bundle that have to be redeployed, one per deployment job
+func getImportStacks(bundle exportBundle) ([]docker.ManagedStack, error) {
+	var (
+		stacks []docker.ManagedStack
+		jobs   []string
+	)
+
+	for _, stack := range bundle.Stacks {
+		if stack.Repository == "" || stack.URL == "" || stack.Reference == "" {
+			return nil, fmt.Errorf("stack %q is missing its repository, url or reference", stack.Name)
+		}
+
+		job := stack.URL + "@" + stack.Reference + "#" + getCustomTarget(stack.ConfigSource)
+		if slices.Contains(jobs, job) {
+			continue
+		}
+
+		jobs = append(jobs, job)
+		stacks = append(stacks, stack)
+	}
+
+	if len(stacks) == 0 {
+		return nil, errors.New("bundle contains no stacks")
+	}
+
+	return stacks, nil
+}
+
+// projectDiff is the response of the ProjectDiffApiHandler
+type projectDiff struct {
+	Project    string                      `json:"project"`
+	Repository string                      `json:"repository"`
+	Reference  string                      `json:"reference"`
+	Source     string                      `json:"config_source"`
+	Services   []docker.ServiceDiff        `json:"services"`
+	Issues     []docker.CompatibilityIssue `json:"compatibility_issues,omitempty"`
+	Notices    []string                    `json:"migration_notices,omitempty"`
+}
+
+// ProjectDiffApiHandler compares the running containers of a project with the
+// desired state at the head of the deployed reference in its repository
+func (h *handlerData) ProjectDiffApiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		JSONError(w, "invalid http method", "", "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	projectName := r.PathValue("projectName")
+	customTarget := r.URL.Query().Get("target")
+
+	jobID := uuid.Must(uuid.NewRandom()).String()
+	jobLog := h.log.With(slog.String("job_id", jobID), slog.String("project", projectName))
+
+	containers, err := docker.GetProjectContainers(ctx, h.dockerCli.Client(), projectName)
+	if err != nil {
+		errMsg = "failed to get project containers"
+		jobLog.Error(errMsg, logger.ErrAttr(err))
+		JSONError(w, errMsg, err.Error(), jobID, http.StatusInternalServerError)
+
+		return
+	}
+
+	if len(containers) == 0 {
+		JSONError(w, "project not found", "", jobID, http.StatusNotFound)
+		return
+	}
+
+	labels := containers[0].Labels
+
+	cloneUrl := labels["cd.doco.repository.url"]
+	if cloneUrl == "" {
+		JSONError(w, "project is not managed by doco-cd", "", jobID, http.StatusBadRequest)
+		return
+	}
+
+	diff := projectDiff{
+		Project:    projectName,
+		Repository: labels["cd.doco.repository.name"],
+		Reference:  labels["cd.doco.repository.reference"],
+	}
+
+	repoDir, err := fetchRepository(ctx, h.appConfig, jobID, cloneUrl, diff.Reference)
+	if err != nil {
+		errMsg = "failed to fetch repository"
+		jobLog.Error(errMsg, logger.ErrAttr(err))
+		JSONError(w, errMsg, err.Error(), jobID, http.StatusInternalServerError)
+
+		return
+	}
+
+	defer func() {
+		err = os.RemoveAll(repoDir)
+		if err != nil {
+			jobLog.Error("failed to remove temporary directory", logger.ErrAttr(err))
+		}
+	}()
+
+	deployConfigs, err := config.GetDeployConfigs(repoDir, projectName, customTarget)
+	if err != nil && !errors.Is(err, config.ErrDeprecatedConfig) {
+		errMsg = "failed to get deploy configuration"
+		JSONError(w, errMsg, err.Error(), jobID, http.StatusInternalServerError)
+
+		return
+	}
+
+	var deployConfig *config.DeployConfig
+
+	for _, c := range deployConfigs {
+		if c.Name == projectName {
+			deployConfig = c
+			break
+		}
+	}
+
+	if deployConfig == nil {
+		JSONError(w, "no deploy configuration found for project", "", jobID, http.StatusNotFound)
+		return
+	}
+
+	diff.Source = deployConfig.Source()
+	diff.Notices = deployConfig.MigrationNotices
+
+	// The desired state is loaded like a deployment would load it, without the contents of the external secrets
+	p := webhook.ParsedPayload{
+		Ref:      diff.Reference,
+		Name:     path.Base(diff.Repository),
+		FullName: diff.Repository,
+		CloneURL: cloneUrl,
+	}
+
+	if head, err := git.GetHeadCommit(repoDir); err == nil {
+		p.CommitSHA = head.Hash.String()
+	}
+
+	project, cleanup, err := loadStack(ctx, jobLog.With(slog.String("stack", deployConfig.Name)), h.appConfig, h.dockerCli, repoDir, customTarget, p, deployConfig, secretsSkip)
+
+	// loadStack resolves the patterns of the compose files, so the files are checked afterwards
+	var checkErr error
+
+	diff.Issues, checkErr = docker.CheckComposeCompatibility(path.Join(repoDir, deployConfig.WorkingDirectory), deployConfig.ComposeFiles)
+	if checkErr != nil {
+		jobLog.Warn("failed to check compose compatibility", logger.ErrAttr(checkErr))
+	}
+
+	if err != nil {
+		details := err.Error()
+		for _, issue := range diff.Issues {
+			details += "; " + issue.String()
+		}
+
+		errMsg = "failed to load compose config"
+		JSONError(w, errMsg, details, jobID, http.StatusInternalServerError)
+
+		return
+	}
+
+	defer cleanup()
+
+	diff.Services, err = docker.DiffProject(ctx, h.dockerCli.Client(), project)
+	if err != nil {
+		errMsg = "failed to compare project"
+		jobLog.Error(errMsg, logger.ErrAttr(err))
+		JSONError(w, errMsg, err.Error(), jobID, http.StatusInternalServerError)
+
+		return
+	}
+
+	JSONData(w, diff, http.StatusOK)
+}
+
+/*
+ProjectLogsApiHandler streams the logs of all containers of a project as plain text, each line is prefixed with the
+service and replica of its container. The `tail`, `since` and `follow` query parameters are passed to the docker daemon,
+with `follow=true` the response is kept open and new lines are sent until the client disconnects.
+*/
+func (h *handlerData) ProjectLogsApiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		JSONError(w, "invalid http method", "", "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	projectName := r.PathValue("projectName")
+
+	opts := docker.LogOptions{
+		Tail:  query.Get("tail"),
+		Since: query.Get("since"),
+	}
+
+	if v := query.Get("follow"); v != "" {
+		var err error
+
+		opts.Follow, err = strconv.ParseBool(v)
+		if err != nil {
+			errMsg = "invalid value for query parameter 'follow'"
+			JSONError(w, errMsg, err.Error(), "", http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	err := opts.Validate()
+	if err != nil {
+		errMsg = "invalid value for query parameter 'tail'"
+		JSONError(w, errMsg, err.Error(), "", http.StatusBadRequest)
+
+		return
+	}
+
+	logs, err := docker.GetProjectLogs(r.Context(), h.dockerCli.Client(), projectName, opts)
+	if err != nil {
+		errMsg = "failed to get project logs"
+		h.log.Error(errMsg, slog.String("project", projectName), logger.ErrAttr(err))
+		JSONError(w, errMsg, err.Error(), "", http.StatusInternalServerError)
+
+		return
+	}
+
+	defer func() {
+		_ = logs.Close()
+	}()
+
+	if logs.Len() == 0 {
+		JSONError(w, "project not found", "", "", http.StatusNotFound)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+
+	if opts.Follow {
+		// The write timeout of the server would end the stream while it is followed
+		_ = rc.SetWriteDeadline(time.Time{})
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	err = logs.Copy(w, func() {
+		_ = rc.Flush()
+	})
+	if err != nil && r.Context().Err() == nil {
+		h.log.Debug("failed to stream project logs", slog.String("project", projectName), logger.ErrAttr(err))
+	}
+}
+
+// projectScale is the response of the ProjectScaleApiHandler
+type projectScale struct {
+	Project          string `json:"project"`
+	Service          string `json:"service"`
+	Replicas         int    `json:"replicas"`
+	PreviousReplicas int    `json:"previous_replicas"`
+}
+
+/*
+ProjectScaleApiHandler sets the number of containers of the service in the `service` query parameter to the number in
+the `replicas` query parameter (POST), without a commit to the repository of the project. The project is loaded from the
+commit it was deployed from, so docker compose only adds or removes containers of the service. The next deployment of the
+stack applies the scale of its deploy config again.
+*/
+func (h *handlerData) ProjectScaleApiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		JSONError(w, "invalid http method", "", "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	projectName := r.PathValue("projectName")
+
+	service := query.Get("service")
+	if service == "" {
+		JSONError(w, "missing query parameter 'service'", "", "", http.StatusBadRequest)
+		return
+	}
+
+	replicas, err := strconv.Atoi(query.Get("replicas"))
+	if err != nil || replicas < 0 {
+		errMsg = "invalid value for query parameter 'replicas'"
+		JSONError(w, errMsg, "replicas must be a non-negative number", "", http.StatusBadRequest)
+
+		return
+	}
+
+	ctx := r.Context()
+
+	jobID := uuid.Must(uuid.NewRandom()).String()
+	jobLog := h.log.With(slog.String("job_id", jobID), slog.String("project", projectName), slog.String("service", service))
+
+	stacks, err := docker.GetManagedStacks(ctx, h.dockerCli.Client())
+	if err != nil {
+		errMsg = "failed to get stacks"
+		jobLog.Error(errMsg, logger.ErrAttr(err))
+		JSONError(w, errMsg, err.Error(), jobID, http.StatusInternalServerError)
+
+		return
+	}
+
+	i := slices.IndexFunc(stacks, func(s docker.ManagedStack) bool { return s.Name == projectName })
+	if i < 0 {
+		JSONError(w, "project not found", "project does not exist or is not managed by doco-cd", jobID, http.StatusNotFound)
+		return
+	}
+
+	stack := stacks[i]
+
+	repoDir, err := fetchCommit(ctx, h.appConfig, jobID, stack.URL, stack.Commit)
+	if err != nil {
+		errMsg = "failed to fetch deployed commit"
+		jobLog.Error(errMsg, logger.ErrAttr(err))
+		JSONError(w, errMsg, err.Error(), jobID, http.StatusInternalServerError)
+
+		return
+	}
+
+	defer func() {
+		err = os.RemoveAll(repoDir)
+		if err != nil {
+			jobLog.Error("failed to remove temporary directory", logger.ErrAttr(err))
+		}
+	}()
+
+	customTarget := getCustomTarget(stack.ConfigSource)
+
+	p := getRedeployPayload(stack)
+	p.CommitSHA = stack.Commit
+
+	deployConfigs, err := config.GetDeployConfigs(repoDir, p.Name, customTarget)
+	if err != nil && !errors.Is(err, config.ErrDeprecatedConfig) {
+		errMsg = "failed to get deploy configuration"
+		JSONError(w, errMsg, err.Error(), jobID, http.StatusInternalServerError)
+
+		return
+	}
+
+	i = slices.IndexFunc(deployConfigs, func(d *config.DeployConfig) bool { return d.Name == projectName })
+	if i < 0 {
+		JSONError(w, "no deploy configuration found for project", "", jobID, http.StatusNotFound)
+		return
+	}
+
+	deployConfig := deployConfigs[i]
+
+	// The containers of the service are compared with the deployed ones, so the project needs the contents of the external secrets
+	project, cleanup, err := loadStack(ctx, jobLog, h.appConfig, h.dockerCli, repoDir, customTarget, p, deployConfig, secretsResolve)
+	if err != nil {
+		errMsg = "failed to load compose config"
+		JSONError(w, errMsg, err.Error(), jobID, http.StatusInternalServerError)
+
+		return
+	}
+
+	defer cleanup()
+
+	previous, err := docker.ScaleService(ctx, h.dockerCli, project, deployConfig, p, service, replicas)
+	if err != nil {
+		errMsg = "failed to scale service"
+
+		if errors.Is(err, docker.ErrInvalidScale) {
+			JSONError(w, errMsg, err.Error(), jobID, http.StatusBadRequest)
+			return
+		}
+
+		jobLog.Error(errMsg, logger.ErrAttr(err))
+		JSONError(w, errMsg, err.Error(), jobID, http.StatusInternalServerError)
+
+		return
+	}
+
+	jobLog.Info("service scaled", slog.Int("replicas", replicas), slog.Int("previous_replicas", previous))
+
+	JSONData(w, projectScale{
+		Project:          projectName,
+		Service:          service,
+		Replicas:         replicas,
+		PreviousReplicas: previous,
+	}, http.StatusOK)
+}
+
+// fetchRepository clones the repository (or downloads the archive) of a deployed project to a temporary directory
+func fetchRepository(ctx context.Context, c *config.AppConfig, name, cloneUrl, ref string) (string, error) {
+	if archive.IsArchiveURL(cloneUrl) {
+		repoDir, _, err := archive.Download(ctx, name, cloneUrl, c.ArchiveHeaders)
+		return repoDir, err
+	}
+
+	if c.GitAccessToken != "" {
+		cloneUrl = git.GetAuthUrl(cloneUrl, c.AuthType, c.GitAccessToken)
+	}
+
+	repo, err := git.CloneRepository(name, cloneUrl, ref, c.SkipTLSVerification, "", c.GitHeaders)
+	if err != nil {
+		return "", err
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return "", err
+	}
+
+	return worktree.Filesystem.Root(), nil
+}
+
+// fetchCommit fetches the commit a project was deployed from to a temporary directory, archives are downloaded again
+// and must still have the checksum that takes the place of the commit
+func fetchCommit(ctx context.Context, c *config.AppConfig, name, cloneUrl, commitSHA string) (string, error) {
+	if archive.IsArchiveURL(cloneUrl) {
+		repoDir, checksum, err := archive.Download(ctx, name, cloneUrl, c.ArchiveHeaders)
+		if err != nil {
+			return "", err
+		}
+
+		if checksum != commitSHA {
+			_ = os.RemoveAll(repoDir)
+			return "", fmt.Errorf("archive changed since it was deployed, got checksum %s", checksum)
+		}
+
+		return repoDir, nil
+	}
+
+	if c.GitAccessToken != "" {
+		cloneUrl = git.GetAuthUrl(cloneUrl, c.AuthType, c.GitAccessToken)
+	}
+
+	repoDir, err := git.CloneCommitWorktree(name, cloneUrl, commitSHA, c.SkipTLSVerification, "", c.GitHeaders)
+	if err != nil {
+		if repoDir != "" {
+			_ = os.RemoveAll(repoDir)
+		}
+
+		return "", err
+	}
+
+	return repoDir, nil
+}
+
+// deployRequest is the body of a request to the DeployApiHandler
+type deployRequest struct {
+	CloneURL     string `json:"clone_url"`
+	Ref          string `json:"ref"`                     // Ref is the reference to deploy, e.g. refs/heads/main, branch names like main are expanded to refs/heads/main
+	CommitSHA    string `json:"commit_sha,omitempty"`    // CommitSHA is the commit of the reference that triggered the deployment, the head of the reference is used if empty
+	CustomTarget string `json:"custom_target,omitempty"` // CustomTarget selects the deploy config of a custom target, e.g. prod for .doco-cd.prod.yaml
+	Private      bool   `json:"private,omitempty"`
+}
+
+// getDeployPayload validates a deploy request and returns the payload that the deployment job is handled with,
+// the name of the repository is the path of the clone URL, e.g. kimdre/doco-cd for https://github.com/kimdre/doco-cd.git
+func getDeployPayload(req deployRequest) (webhook.ParsedPayload, error) {
+	if req.CloneURL == "" {
+		return webhook.ParsedPayload{}, errors.New("clone_url is required")
+	}
+
+	if req.Ref == "" {
+		return webhook.ParsedPayload{}, errors.New("ref is required")
+	}
+
+	u, err := url.Parse(req.CloneURL)
+	if err != nil || u.Host == "" {
+		return webhook.ParsedPayload{}, fmt.Errorf("clone_url must be an absolute URL, got %s", git.GetUrlWithoutAuth(req.CloneURL))
+	}
+
+	fullName := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if fullName == "" {
+		return webhook.ParsedPayload{}, fmt.Errorf("clone_url does not contain a repository name: %s", git.GetUrlWithoutAuth(req.CloneURL))
+	}
+
+	ref := req.Ref
+	if !strings.HasPrefix(ref, "refs/") {
+		ref = "refs/heads/" + ref
+	}
+
+	return webhook.ParsedPayload{
+		Ref:       ref,
+		CommitSHA: req.CommitSHA,
+		Name:      path.Base(fullName),
+		FullName:  fullName,
+		CloneURL:  req.CloneURL,
+		Private:   req.Private,
+	}, nil
+}
+
+/*
+DeployApiHandler starts a deployment job for the repository and reference in the JSON body of the request (POST),
+like a webhook event of a push, so that CI systems can trigger deployments without forging a webhook payload.
+The response is sent when the job has finished, with `wait=false` the job runs in the background once a background
+job slot is free and the response only contains its job id. The `dry_run` query parameter is supported as for webhooks.
+*/
+func (h *handlerData) DeployApiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		JSONError(w, "invalid http method", "", "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobID := uuid.Must(uuid.NewRandom()).String()
+	jobLog := h.log.With(slog.String("job_id", jobID))
+
+	wait := true
+
+	if v := r.URL.Query().Get("wait"); v != "" {
+		var err error
+
+		wait, err = strconv.ParseBool(v)
+		if err != nil {
+			errMsg = "invalid value for query parameter 'wait'"
+			JSONError(w, errMsg, err.Error(), jobID, http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	var req deployRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		errMsg = "invalid request body"
+		JSONError(w, errMsg, err.Error(), jobID, http.StatusBadRequest)
+
+		return
+	}
+
+	payload, err := getDeployPayload(req)
+	if err != nil {
+		errMsg = "invalid request body"
+		JSONError(w, errMsg, err.Error(), jobID, http.StatusBadRequest)
+
+		return
+	}
+
+	if h.maintenance.Load() {
+		msg := "maintenance mode is active, deployment skipped"
+		jobLog.Info(msg, slog.String("repository", payload.FullName), slog.String("reference", payload.Ref))
+		JSONResponse(w, msg, jobID, http.StatusAccepted)
+
+		return
+	}
+
+	if !h.checkRepoQuota(jobLog, w, payload, jobID) {
+		return
+	}
+
+	jobLog = jobLog.With(triggerAttr(triggerApi, payload))
+	dryRun := isDryRun(r)
+
+	// The job is registered before it waits for a job slot, so that a shutdown waits for queued jobs as well
+	done, ok := startDeployment(jobLog, w, jobID)
+	if !ok {
+		return
+	}
+
+	if wait {
+		defer done()
+
+		HandleEvent(context.Background(), jobLog, w, h.appConfig, payload, req.CustomTarget, jobID, triggerApi, nil, dryRun, h.dockerCli)
+		return
+	}
+
+	JSONResponse(w, "deployment started", jobID, http.StatusAccepted)
+
+	go func() {
+		defer done()
+
+		release, err := acquireBackgroundJobSlot(context.Background())
+		if err != nil {
+			jobLog.Error("deployment canceled", logger.ErrAttr(err))
+			return
+		}
+
+		defer release()
+
+		// The client does not wait for the job, so its response is only logged
+		rr := newJobRecorder()
+		HandleEvent(context.Background(), jobLog, rr, h.appConfig, payload, req.CustomTarget, jobID, triggerApi, nil, dryRun, h.dockerCli)
+
+		if rr.failed() {
+			jobLog.Error("deployment failed", slog.Int("status", rr.status), slog.String("response", strings.TrimSpace(rr.body.String())))
+		}
+	}()
+}
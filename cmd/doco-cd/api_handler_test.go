@@ -0,0 +1,513 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kimdre/doco-cd/internal/config"
+	"github.com/kimdre/doco-cd/internal/docker"
+	"github.com/kimdre/doco-cd/internal/git"
+	"github.com/kimdre/doco-cd/internal/logger"
+	"github.com/kimdre/doco-cd/internal/webhook"
+)
+
+const testApiSecret = "test_ApiSecret1"
+
+func TestHandlerData_MaintenanceApiHandler(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		method               string
+		query                string
+		apiKey               string
+		expectedStatusCode   int
+		expectedResponseBody string
+		expectedMaintenance  bool
+	}{
+		{
+			name:                 "Get State",
+			method:               http.MethodGet,
+			apiKey:               testApiSecret,
+			expectedStatusCode:   http.StatusOK,
+			expectedResponseBody: `{"maintenance":false}`,
+			expectedMaintenance:  false,
+		},
+		{
+			name:                 "Enable Maintenance",
+			method:               http.MethodPost,
+			query:                "?enabled=true",
+			apiKey:               testApiSecret,
+			expectedStatusCode:   http.StatusOK,
+			expectedResponseBody: `{"maintenance":true}`,
+			expectedMaintenance:  true,
+		},
+		{
+			name:                 "Invalid Value",
+			method:               http.MethodPost,
+			query:                "?enabled=maybe",
+			apiKey:               testApiSecret,
+			expectedStatusCode:   http.StatusBadRequest,
+			expectedResponseBody: `{"error":"invalid value for query parameter 'enabled'","details":"strconv.ParseBool: parsing \"maybe\": invalid syntax"}`,
+			expectedMaintenance:  false,
+		},
+		{
+			name:                 "Missing Api Key",
+			method:               http.MethodPost,
+			query:                "?enabled=true",
+			expectedStatusCode:   http.StatusUnauthorized,
+			expectedResponseBody: `{"error":"missing api key"}`,
+			expectedMaintenance:  false,
+		},
+		{
+			name:                 "Incorrect Api Key",
+			method:               http.MethodPost,
+			query:                "?enabled=true",
+			apiKey:               "invalid",
+			expectedStatusCode:   http.StatusUnauthorized,
+			expectedResponseBody: `{"error":"incorrect api key"}`,
+			expectedMaintenance:  false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := handlerData{
+				appConfig: &config.AppConfig{ApiSecret: testApiSecret},
+				log:       logger.New(12),
+			}
+
+			req, err := http.NewRequest(tc.method, apiPath+"/maintenance"+tc.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.apiKey != "" {
+				req.Header.Set(apiKeyHeader, tc.apiKey)
+			}
+
+			rr := httptest.NewRecorder()
+			handler := h.requireApiKey(h.MaintenanceApiHandler)
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tc.expectedStatusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.expectedStatusCode)
+			}
+
+			expectedReturnMessage := fmt.Sprintln(tc.expectedResponseBody)
+			if rr.Body.String() != expectedReturnMessage {
+				t.Errorf("handler returned unexpected body: got '%v' want '%v'", rr.Body.String(), expectedReturnMessage)
+			}
+
+			if h.maintenance.Load() != tc.expectedMaintenance {
+				t.Errorf("expected maintenance to be %v, got %v", tc.expectedMaintenance, h.maintenance.Load())
+			}
+		})
+	}
+}
+
+func TestHandlerData_VersionApiHandler(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		updateCheck          bool
+		info                 *versionInfo
+		expectedResponseBody string
+	}{
+		{"Disabled", false, nil, `{"current":"v0.11.0","latest":"","update_available":false,"details":"update check is disabled"}`},
+		{"Pending", true, nil, `{"current":"v0.11.0","latest":"","update_available":false,"details":"update check has not finished yet"}`},
+		{"Cached", true, &versionInfo{Current: "v0.11.0", Latest: "v0.12.0", UpdateAvailable: true}, `{"current":"v0.11.0","latest":"v0.12.0","update_available":true}`},
+	}
+
+	defaultVersion := Version
+	Version = "v0.11.0"
+
+	t.Cleanup(func() {
+		Version = defaultVersion
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := handlerData{
+				appConfig: &config.AppConfig{ApiSecret: testApiSecret, UpdateCheck: tc.updateCheck},
+				log:       logger.New(12),
+			}
+			h.versions.info = tc.info
+
+			req, err := http.NewRequest(http.MethodGet, apiPath+"/version", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set(apiKeyHeader, testApiSecret)
+
+			rr := httptest.NewRecorder()
+			handler := h.requireApiKey(h.VersionApiHandler)
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+			}
+
+			if rr.Body.String() != tc.expectedResponseBody+"\n" {
+				t.Errorf("handler returned unexpected body: got '%v' want '%v'", rr.Body.String(), tc.expectedResponseBody)
+			}
+		})
+	}
+}
+
+func TestHandlerData_StacksApiHandler_InvalidQuery(t *testing.T) {
+	h := handlerData{
+		appConfig: &config.AppConfig{ApiSecret: testApiSecret},
+		log:       logger.New(12),
+	}
+
+	req, err := http.NewRequest(http.MethodGet, apiPath+"/stacks?managed_by_doco_cd=maybe", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set(apiKeyHeader, testApiSecret)
+
+	rr := httptest.NewRecorder()
+	handler := h.requireApiKey(h.StacksApiHandler)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	expectedReturnMessage := fmt.Sprintln(`{"error":"invalid value for query parameter 'managed_by_doco_cd'","details":"strconv.ParseBool: parsing \"maybe\": invalid syntax"}`)
+	if rr.Body.String() != expectedReturnMessage {
+		t.Errorf("handler returned unexpected body: got '%v' want '%v'", rr.Body.String(), expectedReturnMessage)
+	}
+}
+
+func TestHandlerData_RepositoryUsageApiHandler(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	err := os.MkdirAll(filepath.Join(cacheDir, "kimdre", "doco-cd@heads-main"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(cacheDir, "kimdre", "doco-cd@heads-main", "compose.yaml"), make([]byte, 2048), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := handlerData{
+		appConfig: &config.AppConfig{ApiSecret: testApiSecret, RepoCacheQuota: 1024},
+		log:       logger.New(12),
+		repoUsage: git.NewCacheUsage(cacheDir),
+	}
+
+	_, err = h.repoUsage.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, apiPath+"/repositories/usage", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set(apiKeyHeader, testApiSecret)
+
+	rr := httptest.NewRecorder()
+	handler := h.requireApiKey(h.RepositoryUsageApiHandler)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expectedReturnMessage := fmt.Sprintln(`[{"repository":"kimdre/doco-cd","size_bytes":2048,"quota_bytes":1024,"quota_exceeded":true}]`)
+	if rr.Body.String() != expectedReturnMessage {
+		t.Errorf("handler returned unexpected body: got '%v' want '%v'", rr.Body.String(), expectedReturnMessage)
+	}
+}
+
+func TestGetDeployPayload(t *testing.T) {
+	testCases := []struct {
+		name          string
+		req           deployRequest
+		expected      webhook.ParsedPayload
+		expectedError string
+	}{
+		{
+			name: "Branch Name",
+			req:  deployRequest{CloneURL: "https://github.com/kimdre/doco-cd.git", Ref: "main", CommitSHA: "abc123"},
+			expected: webhook.ParsedPayload{
+				Ref: "refs/heads/main", CommitSHA: "abc123", Name: "doco-cd", FullName: "kimdre/doco-cd",
+				CloneURL: "https://github.com/kimdre/doco-cd.git",
+			},
+		},
+		{
+			name: "Full Reference",
+			req:  deployRequest{CloneURL: "https://gitlab.example.com/group/sub/app", Ref: "refs/tags/v1.0.0", Private: true},
+			expected: webhook.ParsedPayload{
+				Ref: "refs/tags/v1.0.0", Name: "app", FullName: "group/sub/app",
+				CloneURL: "https://gitlab.example.com/group/sub/app", Private: true,
+			},
+		},
+		{
+			name:          "Missing Clone URL",
+			req:           deployRequest{Ref: "main"},
+			expectedError: "clone_url is required",
+		},
+		{
+			name:          "Missing Reference",
+			req:           deployRequest{CloneURL: "https://github.com/kimdre/doco-cd.git"},
+			expectedError: "ref is required",
+		},
+		{
+			name:          "Relative URL",
+			req:           deployRequest{CloneURL: "kimdre/doco-cd", Ref: "main"},
+			expectedError: "clone_url must be an absolute URL, got kimdre/doco-cd",
+		},
+		{
+			name:          "Missing Repository Name",
+			req:           deployRequest{CloneURL: "https://github.com/", Ref: "main"},
+			expectedError: "clone_url does not contain a repository name: https://github.com/",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := getDeployPayload(tc.req)
+			if tc.expectedError != "" {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(p, tc.expected) {
+				t.Errorf("expected payload %+v, got %+v", tc.expected, p)
+			}
+		})
+	}
+}
+
+func TestHandlerData_DeployApiHandler_InvalidRequest(t *testing.T) {
+	testCases := []struct {
+		name               string
+		method             string
+		query              string
+		body               string
+		maintenance        bool
+		expectedStatusCode int
+		expectedDetails    string
+	}{
+		{"Invalid Method", http.MethodGet, "", "", false, http.StatusMethodNotAllowed, "invalid http method"},
+		{"Invalid Wait", http.MethodPost, "?wait=maybe", `{}`, false, http.StatusBadRequest, "invalid value for query parameter 'wait'"},
+		{"Malformed Body", http.MethodPost, "", `{"clone_url":`, false, http.StatusBadRequest, "invalid request body"},
+		{"Missing Reference", http.MethodPost, "", `{"clone_url":"https://github.com/kimdre/doco-cd.git"}`, false, http.StatusBadRequest, "invalid request body"},
+		{"Maintenance", http.MethodPost, "", `{"clone_url":"https://github.com/kimdre/doco-cd.git","ref":"main"}`, true, http.StatusAccepted, "maintenance mode is active, deployment skipped"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := handlerData{
+				appConfig: &config.AppConfig{ApiSecret: testApiSecret},
+				log:       logger.New(12),
+			}
+
+			h.maintenance.Store(tc.maintenance)
+
+			req, err := http.NewRequest(tc.method, apiPath+"/deploy"+tc.query, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set(apiKeyHeader, testApiSecret)
+
+			rr := httptest.NewRecorder()
+			handler := h.requireApiKey(h.DeployApiHandler)
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tc.expectedStatusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.expectedStatusCode)
+			}
+
+			if !strings.Contains(rr.Body.String(), tc.expectedDetails) {
+				t.Errorf("expected response to contain %q, got %q", tc.expectedDetails, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerData_ImportApiHandler_InvalidRequest(t *testing.T) {
+	stack := `{"name":"web","repository":"kimdre/doco-cd","url":"https://github.com/kimdre/doco-cd.git","reference":"refs/heads/main"}`
+
+	testCases := []struct {
+		name               string
+		method             string
+		body               string
+		maintenance        bool
+		expectedStatusCode int
+		expectedDetails    string
+	}{
+		{"Invalid Method", http.MethodGet, "", false, http.StatusMethodNotAllowed, "invalid http method"},
+		{"Malformed Body", http.MethodPost, `{"stacks":`, false, http.StatusBadRequest, "invalid request body"},
+		{"No Stacks", http.MethodPost, `{"stacks":[]}`, false, http.StatusBadRequest, "bundle contains no stacks"},
+		{"Missing Reference", http.MethodPost, `{"stacks":[{"name":"web","repository":"kimdre/doco-cd","url":"https://github.com/kimdre/doco-cd.git"}]}`, false, http.StatusBadRequest, "invalid request body"},
+		{"Maintenance", http.MethodPost, `{"stacks":[` + stack + `]}`, true, http.StatusAccepted, "maintenance mode is active, import skipped"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := handlerData{
+				appConfig: &config.AppConfig{ApiSecret: testApiSecret},
+				log:       logger.New(12),
+			}
+
+			h.maintenance.Store(tc.maintenance)
+
+			req, err := http.NewRequest(tc.method, apiPath+"/import", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set(apiKeyHeader, testApiSecret)
+
+			rr := httptest.NewRecorder()
+			handler := h.requireApiKey(h.ImportApiHandler)
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tc.expectedStatusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.expectedStatusCode)
+			}
+
+			if !strings.Contains(rr.Body.String(), tc.expectedDetails) {
+				t.Errorf("expected response to contain %q, got %q", tc.expectedDetails, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetImportStacks(t *testing.T) {
+	url := "https://github.com/kimdre/doco-cd.git"
+
+	bundle := exportBundle{Stacks: []docker.ManagedStack{
+		{Name: "web", Repository: "kimdre/doco-cd", URL: url, Reference: "refs/heads/main", ConfigSource: ".doco-cd.yaml#0"},
+		{Name: "db", Repository: "kimdre/doco-cd", URL: url, Reference: "refs/heads/main", ConfigSource: ".doco-cd.yaml#1"},
+		{Name: "web-prod", Repository: "kimdre/doco-cd", URL: url, Reference: "refs/heads/main", ConfigSource: ".doco-cd.prod.yaml#0"},
+		{Name: "web-dev", Repository: "kimdre/doco-cd", URL: url, Reference: "refs/heads/dev", ConfigSource: ".doco-cd.yaml#0"},
+	}}
+
+	stacks, err := getImportStacks(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The stacks of the same deployment job are only deployed once
+	expected := []string{"web", "web-prod", "web-dev"}
+
+	var names []string
+
+	for _, stack := range stacks {
+		names = append(names, stack.Name)
+	}
+
+	if !slices.Equal(names, expected) {
+		t.Errorf("expected stacks %v, got %v", expected, names)
+	}
+}
+
+func TestHandlerData_ProjectLogsApiHandler_InvalidRequest(t *testing.T) {
+	testCases := []struct {
+		name               string
+		method             string
+		query              string
+		expectedStatusCode int
+		expectedDetails    string
+	}{
+		{"Invalid Method", http.MethodPost, "", http.StatusMethodNotAllowed, "invalid http method"},
+		{"Invalid Follow", http.MethodGet, "?follow=maybe", http.StatusBadRequest, "invalid value for query parameter 'follow'"},
+		{"Invalid Tail", http.MethodGet, "?tail=-5", http.StatusBadRequest, "invalid value for query parameter 'tail'"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := handlerData{
+				appConfig: &config.AppConfig{ApiSecret: testApiSecret},
+				log:       logger.New(12),
+			}
+
+			req, err := http.NewRequest(tc.method, apiPath+"/project/test/logs"+tc.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.SetPathValue("projectName", "test")
+			req.Header.Set(apiKeyHeader, testApiSecret)
+
+			rr := httptest.NewRecorder()
+			handler := h.requireApiKey(h.ProjectLogsApiHandler)
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tc.expectedStatusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.expectedStatusCode)
+			}
+
+			if !strings.Contains(rr.Body.String(), tc.expectedDetails) {
+				t.Errorf("expected response to contain %q, got %q", tc.expectedDetails, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerData_ProjectScaleApiHandler_InvalidRequest(t *testing.T) {
+	testCases := []struct {
+		name               string
+		method             string
+		query              string
+		expectedStatusCode int
+		expectedDetails    string
+	}{
+		{"Invalid Method", http.MethodGet, "?service=worker&replicas=3", http.StatusMethodNotAllowed, "invalid http method"},
+		{"Missing Service", http.MethodPost, "?replicas=3", http.StatusBadRequest, "missing query parameter 'service'"},
+		{"Missing Replicas", http.MethodPost, "?service=worker", http.StatusBadRequest, "invalid value for query parameter 'replicas'"},
+		{"Negative Replicas", http.MethodPost, "?service=worker&replicas=-1", http.StatusBadRequest, "replicas must be a non-negative number"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := handlerData{
+				appConfig: &config.AppConfig{ApiSecret: testApiSecret},
+				log:       logger.New(12),
+			}
+
+			req, err := http.NewRequest(tc.method, apiPath+"/project/test/scale"+tc.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.SetPathValue("projectName", "test")
+			req.Header.Set(apiKeyHeader, testApiSecret)
+
+			rr := httptest.NewRecorder()
+			handler := h.requireApiKey(h.ProjectScaleApiHandler)
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tc.expectedStatusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.expectedStatusCode)
+			}
+
+			if !strings.Contains(rr.Body.String(), tc.expectedDetails) {
+				t.Errorf("expected response to contain %q, got %q", tc.expectedDetails, rr.Body.String())
+			}
+		})
+	}
+}
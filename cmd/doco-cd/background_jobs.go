@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kimdre/doco-cd/internal/prometheus"
+)
+
+// defaultMaxBackgroundJobs is the number of background deployment jobs that run at the same time if setMaxBackgroundJobs is not called
+const defaultMaxBackgroundJobs = 2
+
+// backgroundJobSlots limits the number of deployment jobs without a waiting client that run at the same time,
+// so that redeployments of many stacks do not all clone repositories and pull images at once
+var backgroundJobSlots = make(chan struct{}, defaultMaxBackgroundJobs)
+
+// setMaxBackgroundJobs sets the number of background deployment jobs that run at the same time,
+// it has to be called before the first job is started
+func setMaxBackgroundJobs(n int) {
+	backgroundJobSlots = make(chan struct{}, max(n, 1))
+}
+
+// acquireBackgroundJobSlot waits until a job slot is free and returns the function that releases it again.
+// Jobs triggered by webhooks and synchronous API requests do not need a job slot.
+func acquireBackgroundJobSlot(ctx context.Context) (func(), error) {
+	slots := backgroundJobSlots
+	start := time.Now()
+
+	select {
+	case slots <- struct{}{}:
+		prometheus.BackgroundJobQueueWait.Observe(time.Since(start).Seconds())
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	prometheus.BackgroundJobsInFlight.Inc()
+
+	return func() {
+		prometheus.BackgroundJobsInFlight.Dec()
+		<-slots
+	}, nil
+}
+
+// periodicJob records the state of a background loop that runs periodically, e.g. the image update check
+type periodicJob struct {
+	name     string
+	interval time.Duration // interval is the time between the end of a run and the start of the next one, 0 if the job only runs once
+
+	mu          sync.Mutex
+	running     bool
+	lastRun     time.Time
+	lastSuccess time.Time
+	nextRun     time.Time
+	lastError   string
+}
+
+// periodicJobStatus is the state of a periodic job in the verbose health check
+type periodicJobStatus struct {
+	Name        string     `json:"name"`
+	Running     bool       `json:"running"` // Running is true while the job is executing a run
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	NextRun     *time.Time `json:"next_run,omitempty"`
+	LastError   string     `json:"last_error,omitempty"` // LastError is the error of the last run, empty if it was successful
+}
+
+// addPeriodicJob registers a periodic job whose first run is scheduled after the interval, so that the verbose health check reports it
+func (h *handlerData) addPeriodicJob(name string, interval time.Duration) *periodicJob {
+	j := &periodicJob{name: name, interval: interval}
+	if interval > 0 {
+		j.nextRun = time.Now().Add(interval)
+	}
+
+	h.periodicJobs = append(h.periodicJobs, j)
+
+	return j
+}
+
+// run executes a run of the job and records its outcome, a nil job only executes the run
+func (j *periodicJob) run(fn func() error) {
+	if j == nil {
+		_ = fn()
+		return
+	}
+
+	j.mu.Lock()
+	j.running = true
+	j.lastRun = time.Now()
+	j.mu.Unlock()
+
+	err := fn()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.running = false
+	j.lastError = ""
+
+	if err != nil {
+		j.lastError = err.Error()
+	} else {
+		j.lastSuccess = time.Now()
+	}
+
+	j.nextRun = time.Time{}
+	if j.interval > 0 {
+		j.nextRun = time.Now().Add(j.interval)
+	}
+}
+
+// status returns the current state of the job
+func (j *periodicJob) status() periodicJobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	timeOrNil := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+
+		return &t
+	}
+
+	return periodicJobStatus{
+		Name:        j.name,
+		Running:     j.running,
+		LastRun:     timeOrNil(j.lastRun),
+		LastSuccess: timeOrNil(j.lastSuccess),
+		NextRun:     timeOrNil(j.nextRun),
+		LastError:   j.lastError,
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAcquireBackgroundJobSlot(t *testing.T) {
+	setMaxBackgroundJobs(1)
+	t.Cleanup(func() {
+		setMaxBackgroundJobs(defaultMaxBackgroundJobs)
+	})
+
+	release, err := acquireBackgroundJobSlot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// All job slots are taken, so the second job waits until the context expires
+	if _, err = acquireBackgroundJobSlot(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected error %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	release()
+
+	release, err = acquireBackgroundJobSlot(context.Background())
+	if err != nil {
+		t.Fatalf("expected a free job slot after the release, got %v", err)
+	}
+
+	release()
+}
+
+func TestPeriodicJob(t *testing.T) {
+	h := handlerData{}
+	job := h.addPeriodicJob("image_update", time.Hour)
+
+	status := job.status()
+	if status.Running || status.LastRun != nil || status.NextRun == nil {
+		t.Fatalf("expected a job that did not run yet with a scheduled run, got %+v", status)
+	}
+
+	job.run(func() error {
+		if !job.status().Running {
+			t.Error("expected job to be running during its run")
+		}
+
+		return errors.New("failed to get deployed stacks")
+	})
+
+	status = job.status()
+	if status.Running || status.LastRun == nil || status.LastSuccess != nil || status.LastError != "failed to get deployed stacks" {
+		t.Errorf("expected a failed run, got %+v", status)
+	}
+
+	job.run(func() error {
+		return nil
+	})
+
+	status = job.status()
+	if status.LastSuccess == nil || status.LastError != "" {
+		t.Errorf("expected a successful run to reset the error, got %+v", status)
+	}
+
+	if status.NextRun == nil || status.NextRun.Before(*status.LastRun) {
+		t.Errorf("expected the next run to be scheduled after the last run, got %+v", status)
+	}
+
+	if len(h.periodicJobs) != 1 {
+		t.Errorf("expected job to be registered, got %d jobs", len(h.periodicJobs))
+	}
+
+	// Jobs that are not recorded still run
+	var unrecorded *periodicJob
+
+	ran := false
+
+	unrecorded.run(func() error {
+		ran = true
+		return nil
+	})
+
+	if !ran {
+		t.Error("expected run of nil job to be executed")
+	}
+}
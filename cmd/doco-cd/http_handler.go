@@ -8,94 +8,241 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/compose-spec/compose-go/v2/cli"
+	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/docker/cli/cli/command"
+	"github.com/docker/docker/client"
 	"github.com/google/uuid"
+	"github.com/kimdre/doco-cd/internal/archive"
 	"github.com/kimdre/doco-cd/internal/config"
 	"github.com/kimdre/doco-cd/internal/docker"
 	"github.com/kimdre/doco-cd/internal/git"
 	"github.com/kimdre/doco-cd/internal/logger"
+	"github.com/kimdre/doco-cd/internal/notification"
+	"github.com/kimdre/doco-cd/internal/prometheus"
+	"github.com/kimdre/doco-cd/internal/secretprovider"
+	"github.com/kimdre/doco-cd/internal/semver"
 	"github.com/kimdre/doco-cd/internal/webhook"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	triggerWebhook       = "webhook"        // triggerWebhook is a deployment job triggered by a webhook event
+	triggerImageUpdate   = "image_update"   // triggerImageUpdate is a redeployment of a stack whose pulled images changed
+	triggerRegistryWatch = "registry_watch" // triggerRegistryWatch is a redeployment of a stack whose image digests changed in the registry
+	triggerApi           = "api"            // triggerApi is a deployment job triggered by a request to the deploy API
+	triggerImport        = "import"         // triggerImport is a redeployment of a stack from a bundle of the import API
+)
+
+const (
+	stackDeployed  = "deployed"    // stackDeployed means the stack was deployed and at least one service changed
+	stackUnchanged = "unchanged"   // stackUnchanged means the stack was deployed without changing any service
+	stackRefused   = "refused"     // stackRefused means the deployment of the stack was refused, e.g. because of the commit author
+	stackFailed    = "failed"      // stackFailed means the deployment of the stack failed
+	stackSkipped   = "skipped"     // stackSkipped means the stack was not deployed because a previous stack of the job failed
+	stackDryRun    = "dry_run"     // stackDryRun means the stack was rendered without deploying it
+	stackRollback  = "rolled_back" // stackRollback means the deployment of the stack failed and the previously deployed commit was deployed again
+	stackLooping   = "looping"     // stackLooping means the deployment was suppressed, as the stack was deployed at the same commit in a loop
 )
 
 type handlerData struct {
-	dockerCli command.Cli
-	appConfig *config.AppConfig
-	log       *logger.Logger
+	dockerCli   command.Cli
+	appConfig   *config.AppConfig
+	log         *logger.Logger
+	maintenance atomic.Bool     // maintenance skips all deployments while it is enabled
+	repoUsage   *git.CacheUsage // repoUsage is the disk usage of the repository cache, nil if the cache is disabled
+	versions    versionCache    // versions is the result of the last update check
+
+	periodicJobs []*periodicJob // periodicJobs are the background loops that the verbose health check reports
 }
 
-// HandleEvent handles the incoming webhook event
-func HandleEvent(ctx context.Context, jobLog *slog.Logger, w http.ResponseWriter, c *config.AppConfig, p webhook.ParsedPayload, customTarget, jobID string, dockerCli command.Cli) {
+// HandleEvent handles the incoming event from the given trigger source. If filterPaths is not nil the stacks are only deployed
+// if the event changed one of the paths or a file that the compose files inside the paths reference.
+// With dryRun all stacks of the event are rendered without deploying them, like with the dry_run deploy config option
+func HandleEvent(
+	ctx context.Context, jobLog *slog.Logger, w http.ResponseWriter, c *config.AppConfig, p webhook.ParsedPayload,
+	customTarget, jobID, trigger string, filterPaths []string, dryRun bool, dockerCli command.Cli,
+) {
 	jobLog = jobLog.With(slog.String("repository", p.FullName))
 
 	if customTarget != "" {
 		jobLog = jobLog.With(slog.String("custom_target", customTarget))
 	}
 
+	// Files outside the filter paths can only change the stacks inside them if they are compose files referenced
+	// with extends or include, which requires the repository to resolve. Without such a change the clone is skipped.
+	if filterPaths != nil && !p.HasChangesIn(filterPaths) && !hasComposeFileChanges(p) {
+		msg := "no changes in filtered paths, deployment skipped"
+		jobLog.Info(msg, slog.Any("paths", filterPaths))
+		JSONResponse(w, msg, jobID, http.StatusOK)
+
+		return
+	}
+
 	jobLog.Info("preparing stack deployment")
 
-	// Clone the repository
-	jobLog.Debug(
-		"cloning repository to temporary directory",
-		slog.String("url", p.CloneURL))
+	var (
+		repoDir string
+		cached  *git.CachedRepository
+		err     error
+	)
+
+	cloneName, err := git.GetCloneName(c.CloneLayout, p.FullName, p.CloneURL)
+	if err != nil {
+		errMsg = "invalid repository"
+		jobLog.Error(errMsg, logger.ErrAttr(err))
+		JSONError(w,
+			errMsg,
+			err.Error(),
+			jobID,
+			http.StatusBadRequest)
+
+		return
+	}
+
+	if archive.IsArchiveURL(p.CloneURL) {
+		jobLog.Debug(
+			"downloading archive to temporary directory",
+			slog.String("url", p.CloneURL))
 
-	if p.Private {
-		jobLog.Debug("repository is private")
+		var checksum string
 
-		if c.GitAccessToken == "" {
-			errMsg = "missing access token for private repository"
-			jobLog.Error(errMsg)
+		repoDir, checksum, err = archive.Download(ctx, cloneName, p.CloneURL, c.ArchiveHeaders)
+		if err != nil {
+			errMsg = "failed to download archive"
+			jobLog.Error(errMsg, logger.ErrAttr(err))
 			JSONError(w,
 				errMsg,
-				"",
+				err.Error(),
 				jobID,
 				http.StatusInternalServerError)
 
 			return
 		}
 
-		p.CloneURL = git.GetAuthUrl(p.CloneURL, c.AuthType, c.GitAccessToken)
-	} else if c.GitAccessToken != "" {
-		// Always use the access token for public repositories if it is set to avoid rate limiting
-		p.CloneURL = git.GetAuthUrl(p.CloneURL, c.AuthType, c.GitAccessToken)
-	}
+		// The checksum of the archive takes the place of the commit SHA
+		p.CommitSHA = checksum
 
-	repo, err := git.CloneRepository(p.FullName, p.CloneURL, p.Ref, c.SkipTLSVerification)
-	if err != nil {
-		errMsg = "failed to clone repository"
-		jobLog.Error(errMsg, logger.ErrAttr(err))
-		JSONError(w,
-			errMsg,
-			err.Error(),
-			jobID,
-			http.StatusInternalServerError)
+		jobLog.Debug("archive extracted", slog.String("path", repoDir), slog.String("checksum", checksum))
+	} else {
+		// Clone the repository
+		jobLog.Debug(
+			"cloning repository to temporary directory",
+			slog.String("url", p.CloneURL))
 
-		return
-	}
+		if p.Private {
+			jobLog.Debug("repository is private")
 
-	// Get the worktree from the repository
-	worktree, err := repo.Worktree()
-	if err != nil {
-		errMsg = "failed to get worktree"
-		jobLog.Error(errMsg, logger.ErrAttr(err))
-		JSONError(w,
-			errMsg,
-			err.Error(),
-			jobID,
-			http.StatusInternalServerError)
+			if c.GitAccessToken == "" {
+				errMsg = "missing access token for private repository"
+				jobLog.Error(errMsg)
+				JSONError(w,
+					errMsg,
+					"",
+					jobID,
+					http.StatusInternalServerError)
 
-		return
-	}
+				return
+			}
+
+			p.CloneURL = git.GetAuthUrl(p.CloneURL, c.AuthType, c.GitAccessToken)
+		} else if c.GitAccessToken != "" {
+			// Always use the access token for public repositories if it is set to avoid rate limiting
+			p.CloneURL = git.GetAuthUrl(p.CloneURL, c.AuthType, c.GitAccessToken)
+		}
+
+		if c.RepoCacheDir != "" && c.RepoCacheReadOnly {
+			cached, err = git.OpenCachedRepository(c.RepoCacheDir, cloneName, p.Ref, p.CommitSHA)
+			if err != nil {
+				// Fall back to cloning the repository to the scratch directory
+				jobLog.Debug("repository not found in read-only cache", logger.ErrAttr(err))
+			} else {
+				repoDir = cached.Dir
+
+				jobLog.Debug("using read-only cached repository", slog.String("path", repoDir))
+			}
+		} else if c.RepoCacheDir != "" {
+			cached, err = git.CheckoutCachedRepository(c.RepoCacheDir, cloneName, p.CloneURL, p.Ref, p.CommitSHA, c.SkipTLSVerification, c.GitHeaders)
+			if err != nil {
+				errMsg = "failed to update cached repository"
+				jobLog.Error(errMsg, logger.ErrAttr(err))
+				JSONError(w,
+					errMsg,
+					err.Error(),
+					jobID,
+					http.StatusInternalServerError)
+
+				return
+			}
 
-	fs := worktree.Filesystem
-	repoDir := fs.Root()
+			repoDir = cached.Dir
 
-	jobLog.Debug("repository cloned", slog.String("path", repoDir))
+			jobLog.Debug("cached repository updated", slog.String("path", repoDir))
+		}
+
+		if repoDir == "" {
+			repo, err := git.CloneRepository(cloneName, p.CloneURL, p.Ref, c.SkipTLSVerification, "", c.GitHeaders)
+			if err != nil {
+				errMsg = "failed to clone repository"
+				jobLog.Error(errMsg, logger.ErrAttr(err))
+				JSONError(w,
+					errMsg,
+					err.Error(),
+					jobID,
+					http.StatusInternalServerError)
+
+				return
+			}
+
+			// Get the worktree from the repository
+			worktree, err := repo.Worktree()
+			if err != nil {
+				errMsg = "failed to get worktree"
+				jobLog.Error(errMsg, logger.ErrAttr(err))
+				JSONError(w,
+					errMsg,
+					err.Error(),
+					jobID,
+					http.StatusInternalServerError)
+
+				return
+			}
+
+			repoDir = worktree.Filesystem.Root()
+
+			jobLog.Debug("repository cloned", slog.String("path", repoDir))
+		}
+	}
+
+	if p.CommitSHA == "" {
+		// Deployments that are not triggered by a push (e.g. image updates) deploy the head of the reference
+		head, err := git.GetHeadCommit(repoDir)
+		if err != nil {
+			jobLog.Warn("failed to get head commit of repository", logger.ErrAttr(err))
+		} else {
+			p.CommitSHA = head.Hash.String()
+		}
+	}
 
 	// Defer removal of the repository
 	defer func(workDir string) {
+		if cached != nil {
+			// The cached repository is kept for the next deployment
+			if err := cached.Release(); err != nil {
+				jobLog.Error("failed to release cached repository", logger.ErrAttr(err))
+			}
+
+			return
+		}
+
 		jobLog.Debug("cleaning up", slog.String("path", workDir))
 
 		err = os.RemoveAll(workDir)
@@ -115,9 +262,35 @@ func HandleEvent(ctx context.Context, jobLog *slog.Logger, w http.ResponseWriter
 	// Get the deployment configs from the repository
 	deployConfigs, err := config.GetDeployConfigs(repoDir, p.Name, customTarget)
 	if err != nil {
-		if errors.Is(err, config.ErrDeprecatedConfig) {
+		switch {
+		case errors.Is(err, config.ErrDeprecatedConfig):
 			jobLog.Warn(err.Error())
-		} else {
+		case errors.Is(err, config.ErrConfigFileNotFound) && customTarget != "" && c.MissingTargetPolicy == config.MissingTargetNotFound:
+			errMsg = "no deploy configuration for custom target"
+			jobLog.Info(errMsg)
+			JSONError(w, errMsg, err.Error(), jobID, http.StatusNotFound)
+
+			return
+		case errors.Is(err, config.ErrConfigFileNotFound) && customTarget != "" && c.MissingTargetPolicy == config.MissingTargetIgnore:
+			jobLog.Info("no deploy configuration for custom target, skipping deployment")
+			w.WriteHeader(http.StatusNoContent)
+
+			return
+		case errors.Is(err, config.ErrInvalidConfig):
+			errMsg = "invalid deploy configuration"
+			jobLog.Error(errMsg, logger.ErrAttr(err))
+
+			// Notify the config authors, as the deployment of all stacks of the repository is blocked
+			notify(jobLog, c, notification.Failure, fmt.Sprintf("deploy configuration of %s is invalid, no stacks were deployed: %v", p.FullName, err),
+				getCommitMetadata(jobLog, repoDir, p, notification.Metadata{JobID: jobID, Repository: p.FullName, Revision: p.CommitSHA}))
+			JSONError(w,
+				errMsg,
+				err.Error(),
+				jobID,
+				http.StatusInternalServerError)
+
+			return
+		default:
 			errMsg = "failed to get deploy configuration"
 			jobLog.Error(errMsg, logger.ErrAttr(err))
 			JSONError(w,
@@ -130,147 +303,1531 @@ func HandleEvent(ctx context.Context, jobLog *slog.Logger, w http.ResponseWriter
 		}
 	}
 
-	for _, deployConfig := range deployConfigs {
-		err = deployStack(jobLog, repoDir, &ctx, &dockerCli, &p, deployConfig)
+	deployConfigs = filterSemverRange(jobLog, deployConfigs, p.Ref)
+	if len(deployConfigs) == 0 {
+		msg := "reference is not in the version range of any stack, deployment skipped"
+		jobLog.Info(msg, slog.String("reference", p.Ref))
+		JSONResponse(w, msg, jobID, http.StatusOK)
+
+		return
+	}
+
+	if filterPaths != nil {
+		referenced, err := getReferencedPaths(repoDir, deployConfigs, filterPaths)
 		if err != nil {
-			msg := "deployment failed"
-			jobLog.Error(msg)
-			JSONError(w, err, msg, jobID, http.StatusInternalServerError)
+			// Deploy the stacks if it is unknown which files they depend on
+			jobLog.Warn("failed to get files referenced by compose files", logger.ErrAttr(err))
+		} else if !p.HasChangesIn(slices.Concat(filterPaths, referenced)) {
+			msg := "no changes in filtered paths, deployment skipped"
+			jobLog.Info(msg, slog.Any("paths", filterPaths))
+			JSONResponse(w, msg, jobID, http.StatusOK)
 
 			return
 		}
 	}
 
-	msg := "deployment successful"
-	jobLog.Info(msg)
-	JSONResponse(w, msg, jobID, http.StatusCreated)
-}
+	if dryRun {
+		for _, deployConfig := range deployConfigs {
+			deployConfig.DryRun = true
+		}
+	}
 
-func (h *handlerData) WebhookHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	if len(c.DeployConfigOverrides) > 0 {
+		fields := make([]string, 0, len(c.DeployConfigOverrides))
+		for k := range c.DeployConfigOverrides {
+			fields = append(fields, k)
+		}
 
-	customTarget := r.PathValue("customTarget")
+		slices.Sort(fields)
 
-	// Add job id to the context to track deployments in the logs
-	jobID := uuid.Must(uuid.NewRandom()).String()
-	jobLog := h.log.With(slog.String("job_id", jobID))
+		jobLog.Info("deploy config fields overridden by application config", slog.Any("fields", fields))
+	}
 
-	jobLog.Debug("received webhook event")
+	for _, deployConfig := range deployConfigs {
+		for _, notice := range deployConfig.MigrationNotices {
+			jobLog.Warn("deprecated deploy configuration", slog.String("stack", deployConfig.Name),
+				slog.String("config_source", deployConfig.Source()), slog.String("notice", notice))
+		}
 
-	payload, err := webhook.Parse(r, h.appConfig.WebhookSecret)
-	if err != nil {
-		switch {
-		case errors.Is(err, webhook.ErrHMACVerificationFailed):
-			errMsg = "incorrect webhook secret"
-			jobLog.Debug(errMsg, slog.String("ip", r.RemoteAddr), logger.ErrAttr(err))
-			JSONError(w, errMsg, err.Error(), jobID, http.StatusUnauthorized)
-		case errors.Is(err, webhook.ErrGitlabTokenVerificationFailed):
-			errMsg = webhook.ErrGitlabTokenVerificationFailed.Error()
-			jobLog.Debug(errMsg, slog.String("ip", r.RemoteAddr), logger.ErrAttr(err))
-			JSONError(w, errMsg, err.Error(), jobID, http.StatusUnauthorized)
-		case errors.Is(err, webhook.ErrMissingSecurityHeader):
-			errMsg = webhook.ErrMissingSecurityHeader.Error()
-			jobLog.Debug(errMsg, slog.String("ip", r.RemoteAddr), logger.ErrAttr(err))
-			JSONError(w, errMsg, err.Error(), jobID, http.StatusBadRequest)
-		case errors.Is(err, webhook.ErrParsingPayload):
-			errMsg = webhook.ErrParsingPayload.Error()
-			jobLog.Debug(errMsg, slog.String("ip", r.RemoteAddr), logger.ErrAttr(err))
-			JSONError(w, errMsg, err.Error(), jobID, http.StatusInternalServerError)
-		case errors.Is(err, webhook.ErrInvalidHTTPMethod):
-			errMsg = webhook.ErrInvalidHTTPMethod.Error()
-			jobLog.Debug(errMsg, slog.String("ip", r.RemoteAddr), logger.ErrAttr(err))
-			JSONError(w, errMsg, "", jobID, http.StatusMethodNotAllowed)
-		default:
-			jobLog.Debug(webhook.ErrParsingPayload.Error(), slog.String("ip", r.RemoteAddr), logger.ErrAttr(err))
-			JSONError(w, errMsg, err.Error(), jobID, http.StatusInternalServerError)
+		if len(deployConfig.StrippedFields) > 0 {
+			jobLog.Warn("deploy config fields removed by field policy", slog.String("stack", deployConfig.Name),
+				slog.String("config_source", deployConfig.Source()), slog.Any("fields", deployConfig.StrippedFields))
 		}
+	}
 
-		return
+	// Stacks that are pinned to other references than the one of the event get their own worktree
+	worktrees := map[string]referenceWorktree{p.Ref: {dir: repoDir, commitSHA: p.CommitSHA}}
+
+	if !archive.IsArchiveURL(p.CloneURL) && hasMultipleReferences(deployConfigs) {
+		for _, deployConfig := range deployConfigs {
+			if _, ok := worktrees[deployConfig.Reference]; ok {
+				continue
+			}
+
+			jobLog.Debug("cloning separate worktree for reference", slog.String("reference", deployConfig.Reference))
+
+			skipTLSVerify, proxyURL := getStackGitOptions(c, deployConfig)
+
+			dir, commitSHA, err := git.CloneReferenceWorktree(cloneName, p.CloneURL, deployConfig.Reference, skipTLSVerify, proxyURL, c.GitHeaders)
+			if err != nil {
+				errMsg = "failed to clone repository"
+				jobLog.Error(errMsg, logger.ErrAttr(err), slog.String("reference", deployConfig.Reference))
+				JSONError(w,
+					errMsg,
+					err.Error(),
+					jobID,
+					http.StatusInternalServerError)
+
+				return
+			}
+
+			defer func(workDir string) {
+				jobLog.Debug("cleaning up", slog.String("path", workDir))
+
+				if err := os.RemoveAll(workDir); err != nil {
+					jobLog.Error("failed to remove temporary directory", logger.ErrAttr(err))
+				}
+			}(dir)
+
+			worktrees[deployConfig.Reference] = referenceWorktree{dir: dir, commitSHA: commitSHA}
+		}
 	}
 
-	HandleEvent(ctx, jobLog, w, h.appConfig, payload, customTarget, jobID, h.dockerCli)
-}
+	if c.MaxParallelBuilds > 1 {
+		prebuildStacks(ctx, jobLog, c, dockerCli, worktrees, p, customTarget, deployConfigs)
+	}
 
-func (h *handlerData) HealthCheckHandler(w http.ResponseWriter, _ *http.Request) {
-	err := docker.VerifySocketConnection()
-	if err != nil {
-		h.log.Error(docker.ErrDockerSocketConnectionFailed.Error(), logger.ErrAttr(err))
-		JSONError(w, "unhealthy", err.Error(), "", http.StatusServiceUnavailable)
+	// summaries maps the deployed stacks to the summary of their deployment
+	summaries := make(map[string]string)
 
-		return
+	// dryRuns maps the stacks with dry run to their rendered project and the actions their deployment would take
+	dryRuns := make(map[string]*docker.DryRun)
+
+	// outcomes maps all stacks of the job to the outcome of their deployment
+	outcomes := make(map[string]string, len(deployConfigs))
+	for _, deployConfig := range deployConfigs {
+		outcomes[deployConfig.Name] = stackSkipped
 	}
 
-	h.log.Debug("health check successful")
-	JSONResponse(w, "healthy", "", http.StatusOK)
-}
+	defer func() {
+		jobLog.Info("deployment job finished", slog.Any("stacks", outcomes))
+	}()
 
-func deployStack(
-	jobLog *slog.Logger, repoDir string, ctx *context.Context,
-	dockerCli *command.Cli, p *webhook.ParsedPayload, deployConfig *config.DeployConfig,
-) error {
-	stackLog := jobLog.
-		With(slog.String("stack", deployConfig.Name)).
-		With(slog.String("reference", deployConfig.Reference))
+	// triggeredBy maps the stacks whose redeployment was triggered to the stack that triggered it,
+	// each stack is redeployed at most once per job and the deploy configs can not contain trigger cycles
+	triggeredBy := make(map[string]string)
+	deployed := make(map[string]bool, len(deployConfigs))
+	queue := slices.Clone(deployConfigs)
 
-	stackLog.Debug("deployment configuration retrieved", slog.Any("config", deployConfig))
+	for i := 0; i < len(queue); i++ {
+		deployConfig := queue[i]
 
-	workingDir := path.Join(repoDir, deployConfig.WorkingDirectory)
+		if source, ok := triggeredBy[deployConfig.Name]; ok {
+			jobLog.Info("redeploying stack triggered by another stack",
+				slog.String("stack", deployConfig.Name), slog.String("triggered_by", source))
+			prometheus.TriggeredRedeploys.WithLabelValues(deployConfig.Name).Inc()
 
-	err := os.Chdir(workingDir)
-	if err != nil {
-		errMsg = "failed to change working directory"
-		jobLog.Error(errMsg, logger.ErrAttr(err), slog.String("path", workingDir))
+			deployConfig = getTriggeredDeployConfig(deployConfig)
+		}
 
-		return fmt.Errorf("%s: %w", errMsg, err)
-	}
+		stackPayload, wt := getStackWorktree(worktrees, p, deployConfig)
 
-	// Check if the default compose files are used
-	if reflect.DeepEqual(deployConfig.ComposeFiles, cli.DefaultFileNames) {
-		var tmpComposeFiles []string
+		metadata := getCommitMetadata(jobLog, wt.dir, stackPayload, notification.Metadata{
+			JobID:      jobID,
+			Repository: p.FullName,
+			Stack:      deployConfig.Name,
+			Revision:   stackPayload.CommitSHA,
+		})
 
-		jobLog.Debug("checking for default compose files")
+		if len(deployConfig.AllowedAuthors) > 0 {
+			err = verifyCommitAuthor(wt.dir, deployConfig.AllowedAuthors)
+			if err != nil {
+				errMsg = "deployment refused"
+				jobLog.Error(errMsg, logger.ErrAttr(err), slog.String("stack", deployConfig.Name))
+				outcomes[deployConfig.Name] = stackRefused
+				JSONError(w, err, errMsg, jobID, http.StatusForbidden)
+				notify(jobLog, c, notification.Failure, err.Error(), metadata)
+				reportCommitStatus(jobLog, c, stackPayload, deployConfig, notification.Failure, errMsg+": "+err.Error())
+
+				return
+			}
+		}
+
+		if deployConfig.DryRun {
+			result, err := dryRunStack(ctx, jobLog, c, dockerCli, wt.dir, customTarget, stackPayload, deployConfig)
+			if err != nil {
+				msg := "dry run failed"
+				jobLog.Error(msg)
+				outcomes[deployConfig.Name] = stackFailed
+				JSONError(w, err, msg, jobID, http.StatusInternalServerError)
+
+				return
+			}
+
+			// Nothing was deployed, so there is nothing to notify about and the stack does not trigger other stacks
+			outcomes[deployConfig.Name] = stackDryRun
+			dryRuns[deployConfig.Name] = result
+
+			continue
+		}
+
+		// Only automatic deployments can loop, redeployments triggered by another stack are limited to one per job
+		_, triggered := triggeredBy[deployConfig.Name]
+		guarded := trigger != triggerApi && trigger != triggerImport && !triggered
+		guardKey := p.FullName + "/" + deployConfig.Name
+
+		if guarded {
+			allowed, detected := deployGuard.Allow(guardKey, stackPayload.CommitSHA)
+			if !allowed {
+				outcomes[deployConfig.Name] = stackLooping
+				prometheus.SuppressedRedeploys.WithLabelValues(deployConfig.Name).Inc()
+
+				if detected {
+					msg := fmt.Sprintf("stack %s was deployed %d times in a row at commit %s, further deployments of the commit are suppressed until it changes or %s have passed since the last deployment",
+						deployConfig.Name, c.RedeployLoopThreshold, stackPayload.CommitSHA, c.RedeployLoopWindow)
+					jobLog.Warn("redeploy loop detected: "+msg, slog.String("stack", deployConfig.Name))
+					notify(jobLog, c, notification.Failure, msg, metadata)
+				} else {
+					jobLog.Info("deployment suppressed because of a redeploy loop", slog.String("stack", deployConfig.Name))
+				}
 
-		// Check if the default compose files exist
-		for _, f := range deployConfig.ComposeFiles {
-			if _, err = os.Stat(path.Join(workingDir, f)); errors.Is(err, os.ErrNotExist) {
 				continue
 			}
+		}
 
-			tmpComposeFiles = append(tmpComposeFiles, f)
+		notifyOn := deployConfig.NotifyOn
+		if notifyOn == "" {
+			notifyOn = c.NotifyOn
 		}
 
-		if len(tmpComposeFiles) == 0 {
-			errMsg = "no compose files found"
-			stackLog.Error(errMsg,
-				slog.Group("compose_files", slog.Any("files", deployConfig.ComposeFiles)))
+		// The first deployment can only be detected before the stack gets deployed
+		firstDeploy := false
 
-			return fmt.Errorf("%s: %w", errMsg, err)
+		if notifyOn == config.NotifyOnFirstDeploy {
+			firstDeploy, err = docker.IsFirstDeploy(ctx, dockerCli.Client(), deployConfig.Name)
+			if err != nil {
+				jobLog.Warn("failed to check if stack was deployed before", logger.ErrAttr(err), slog.String("stack", deployConfig.Name))
+
+				firstDeploy = true
+			}
 		}
 
-		deployConfig.ComposeFiles = tmpComposeFiles
-	}
+		reportCommitStatus(jobLog, c, stackPayload, deployConfig, notification.Pending, "deployment started")
 
-	project, err := docker.LoadCompose(*ctx, workingDir, deployConfig.Name, deployConfig.ComposeFiles)
-	if err != nil {
-		errMsg = "failed to load compose config"
-		stackLog.Error(errMsg,
-			logger.ErrAttr(err),
-			slog.Group("compose_files", slog.Any("files", deployConfig.ComposeFiles)))
+		if c.NotifyOnStart {
+			notify(jobLog, c, notification.Started, "deployment started", metadata)
+		}
+
+		// The commit to roll back to can only be detected before the stack gets deployed
+		var previousCommit string
+
+		if deployConfig.RollbackOnFailure {
+			previousCommit, err = docker.GetDeployedCommit(ctx, dockerCli.Client(), deployConfig.Name)
+			if err != nil {
+				jobLog.Warn("failed to get deployed commit of stack, it can not be rolled back", logger.ErrAttr(err), slog.String("stack", deployConfig.Name))
+			}
+		}
+
+		deployCtx, cancel := withDeployTimeout(ctx, deployConfig)
+		summary, err := deployStack(jobLog, c, jobID, wt.dir, customTarget, &deployCtx, &dockerCli, &stackPayload, deployConfig)
+
+		if err != nil && errors.Is(deployCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("%w after %s: %w", errDeployTimeout, deployConfig.DeployTimeout, err)
+		}
+
+		cancel()
+
+		if err != nil {
+			msg := "deployment failed"
+			jobLog.Error(msg)
+			outcomes[deployConfig.Name] = stackFailed
+
+			// The error of the deployment is reported in any case, the outcome of the rollback is added to it
+			failure := err.Error()
+
+			if previousCommit != "" && previousCommit != stackPayload.CommitSHA {
+				rollbackErr := rollbackStack(ctx, jobLog, c, jobID, cloneName, customTarget, dockerCli, stackPayload, deployConfig, previousCommit)
+				if rollbackErr == nil {
+					outcomes[deployConfig.Name] = stackRollback
+				}
+
+				msg += ", " + getRollbackResult(previousCommit, rollbackErr)
+				failure += "; " + getRollbackResult(previousCommit, rollbackErr)
+			}
+
+			JSONError(w, err, msg, jobID, http.StatusInternalServerError)
+			notify(jobLog, c, notification.Failure, failure, metadata)
+			reportCommitStatus(jobLog, c, stackPayload, deployConfig, notification.Failure, msg+": "+err.Error())
+
+			return
+		}
+
+		outcomes[deployConfig.Name] = stackDeployed
+		if summary != nil && summary.Unchanged() {
+			outcomes[deployConfig.Name] = stackUnchanged
+		}
+
+		msg := "deployment successful"
+		if summary != nil {
+			msg += ": " + summary.String()
+			summaries[deployConfig.Name] = summary.String()
+		}
+
+		if shouldNotifySuccess(notifyOn, firstDeploy) {
+			notify(jobLog, c, notification.Success, msg, metadata)
+		}
+
+		reportCommitStatus(jobLog, c, stackPayload, deployConfig, notification.Success, msg)
+
+		deployed[deployConfig.Name] = true
+
+		if guarded {
+			deployGuard.Record(guardKey, stackPayload.CommitSHA)
+		}
 
-		return fmt.Errorf("%s: %w", errMsg, err)
+		if summary == nil || !summary.Unchanged() {
+			queue = append(queue, getTriggeredStacks(jobLog, deployConfig, deployConfigs, triggeredBy, deployed)...)
+		}
 	}
 
-	stackLog.Info("deploying stack")
+	msg, code := "deployment successful", http.StatusCreated
+	if len(deployed) == 0 && len(dryRuns) > 0 {
+		msg, code = "dry run successful, no stack was deployed", http.StatusOK
+	}
 
-	err = docker.DeployCompose(*ctx, *dockerCli, project, deployConfig, *p)
-	if err != nil {
-		errMsg = "failed to deploy stack"
-		stackLog.Error(errMsg,
-			logger.ErrAttr(err),
-			slog.Group("compose_files", slog.Any("files", deployConfig.ComposeFiles)))
+	jobLog.Info(msg)
+	JSONDeployResponse(w, msg, jobID, summaries, dryRuns, code)
+}
+
+/*
+getTriggeredStacks marks the stacks that the deployed stack triggers as triggered and returns the ones that were already
+deployed in the job, so that they get deployed again. Triggered stacks that were not deployed yet are redeployed in their
+turn. Stacks that were already triggered by another stack and stacks that are not deployed by the job are skipped.
+*/
+func getTriggeredStacks(
+	jobLog *slog.Logger, deployConfig *config.DeployConfig, deployConfigs []*config.DeployConfig,
+	triggeredBy map[string]string, deployed map[string]bool,
+) []*config.DeployConfig {
+	var redeploy []*config.DeployConfig
+
+	for _, name := range deployConfig.Triggers {
+		if _, ok := triggeredBy[name]; ok {
+			continue
+		}
+
+		i := slices.IndexFunc(deployConfigs, func(c *config.DeployConfig) bool {
+			return c.Name == name
+		})
+		if i < 0 {
+			jobLog.Debug("triggered stack is not deployed by this job", slog.String("stack", name))
+			continue
+		}
+
+		triggeredBy[name] = deployConfig.Name
 
-		return fmt.Errorf("%s: %w", errMsg, err)
+		if deployed[name] {
+			redeploy = append(redeploy, deployConfigs[i])
+		}
 	}
 
-	return nil
+	return redeploy
+}
+
+// getTriggeredDeployConfig returns a copy of the deploy config that recreates all containers of the stack,
+// as a stack is triggered by changes of other stacks (e.g. a recreated network) that its own config does not show
+func getTriggeredDeployConfig(deployConfig *config.DeployConfig) *config.DeployConfig {
+	triggered := *deployConfig
+	triggered.RecreateStrategy = config.RecreateForce
+
+	return &triggered
+}
+
+/*
+filterSemverRange removes the deploy configs with a reference_semver_range that does not contain the version of the
+pushed tag and sets the reference of the others to the pushed tag. Pushes of branches or tags that are not a semantic
+version are skipped by all stacks with a version range.
+*/
+func filterSemverRange(jobLog *slog.Logger, deployConfigs []*config.DeployConfig, ref string) []*config.DeployConfig {
+	var filtered []*config.DeployConfig
+
+	for _, deployConfig := range deployConfigs {
+		if deployConfig.ReferenceSemverRange == "" {
+			filtered = append(filtered, deployConfig)
+			continue
+		}
+
+		stackLog := jobLog.With(slog.String("stack", deployConfig.Name), slog.String("reference", ref))
+
+		tag, ok := strings.CutPrefix(ref, "refs/tags/")
+		if !ok {
+			stackLog.Debug("reference is not a tag, skipping stack with version range")
+			continue
+		}
+
+		version, err := semver.Parse(tag)
+		if err != nil {
+			stackLog.Debug("tag is not a semantic version, skipping stack with version range", logger.ErrAttr(err))
+			continue
+		}
+
+		// The range was validated with the deploy config
+		versionRange, _ := semver.ParseRange(deployConfig.ReferenceSemverRange)
+		if !versionRange.Contains(version) {
+			stackLog.Debug("tag is not in the version range of the stack, skipping stack",
+				slog.String("range", deployConfig.ReferenceSemverRange))
+
+			continue
+		}
+
+		deployConfig.Reference = ref
+		filtered = append(filtered, deployConfig)
+	}
+
+	return filtered
+}
+
+// verifyCommitAuthor checks if the author or committer of the checked out commit matches one of the allowed patterns
+func verifyCommitAuthor(dir string, allowedAuthors []string) error {
+	commit, err := git.GetHeadCommit(dir)
+	if err != nil {
+		return fmt.Errorf("failed to get commit: %w", err)
+	}
+
+	return git.VerifyCommitAuthor(commit, allowedAuthors)
+}
+
+// referenceWorktree is the checkout of a single reference of a repository
+type referenceWorktree struct {
+	dir       string
+	commitSHA string
+}
+
+// getStackWorktree returns the payload and the worktree of the reference that a stack is deployed from
+func getStackWorktree(worktrees map[string]referenceWorktree, p webhook.ParsedPayload, deployConfig *config.DeployConfig) (webhook.ParsedPayload, referenceWorktree) {
+	wt, ok := worktrees[deployConfig.Reference]
+	if !ok {
+		return p, worktrees[p.Ref]
+	}
+
+	p.Ref = deployConfig.Reference
+	p.CommitSHA = wt.commitSHA
+
+	return p, wt
+}
+
+/*
+prebuildStacks builds the images of the stacks of a job in parallel (at most MaxParallelBuilds at a time), so that the
+stacks only have to be deployed one after another in their configured order afterward. The stacks are loaded one after
+another, as loading changes the working directory of the process. Stacks that fail to load or build here are built
+again during their deployment, which reports the error.
+*/
+func prebuildStacks(
+	ctx context.Context, jobLog *slog.Logger, c *config.AppConfig, dockerCli command.Cli, worktrees map[string]referenceWorktree,
+	p webhook.ParsedPayload, customTarget string, deployConfigs []*config.DeployConfig,
+) {
+	var g errgroup.Group
+
+	g.SetLimit(c.MaxParallelBuilds)
+
+	for _, deployConfig := range deployConfigs {
+		stackPayload, wt := getStackWorktree(worktrees, p, deployConfig)
+		stackLog := jobLog.With(slog.String("stack", deployConfig.Name))
+
+		// Stacks from refused commits and stacks with dry run are never built
+		if deployConfig.DryRun {
+			continue
+		}
+
+		if len(deployConfig.AllowedAuthors) > 0 && verifyCommitAuthor(wt.dir, deployConfig.AllowedAuthors) != nil {
+			continue
+		}
+
+		project, cleanup, err := loadStack(ctx, stackLog, c, dockerCli, wt.dir, customTarget, stackPayload, deployConfig, secretsSkip)
+		if err != nil {
+			continue
+		}
+
+		if !docker.HasBuild(project) {
+			cleanup()
+			continue
+		}
+
+		g.Go(func() error {
+			defer cleanup()
+
+			var err error
+
+			buildCli := dockerCli
+
+			if !deployConfig.BuildOpts.Quiet {
+				output := logger.NewWriter(stackLog, slog.LevelInfo, "docker output")
+				defer output.Close()
+
+				buildCli, err = docker.CreateJobDockerCli(dockerCli, output)
+				if err != nil {
+					stackLog.Warn("failed to create docker client for parallel build", logger.ErrAttr(err))
+					return nil
+				}
+			}
+
+			buildCli, err = getRegistryAuthCli(ctx, c, buildCli, deployConfig)
+			if err != nil {
+				stackLog.Warn("failed to get registry credentials for parallel build", logger.ErrAttr(err))
+				return nil
+			}
+
+			stackLog.Info("building images of stack")
+
+			err = docker.BuildCompose(ctx, buildCli, project, deployConfig)
+			if err != nil {
+				stackLog.Warn("parallel build failed, building again during deployment", logger.ErrAttr(err))
+				return nil
+			}
+
+			deployConfig.Prebuilt = true
+
+			return nil
+		})
+	}
+
+	// The builds never return an error, failed stacks are built again during their deployment
+	_ = g.Wait()
+}
+
+// hasMultipleReferences checks if the deploy configs are pinned to more than one reference
+func hasMultipleReferences(deployConfigs []*config.DeployConfig) bool {
+	for _, deployConfig := range deployConfigs {
+		if deployConfig.Reference != deployConfigs[0].Reference {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getStackGitOptions returns the TLS verification and proxy settings for the git operations of a stack,
+// the settings of the deploy config take precedence over the ones of the application
+func getStackGitOptions(c *config.AppConfig, deployConfig *config.DeployConfig) (bool, string) {
+	skipTLSVerify := c.SkipTLSVerification
+	if deployConfig.SkipTLSVerification != nil {
+		skipTLSVerify = *deployConfig.SkipTLSVerification
+	}
+
+	return skipTLSVerify, deployConfig.GitProxy
+}
+
+// shouldNotifySuccess checks if a successful deployment sends a notification
+func shouldNotifySuccess(notifyOn string, firstDeploy bool) bool {
+	switch notifyOn {
+	case config.NotifyOnFailure:
+		return false
+	case config.NotifyOnFirstDeploy:
+		return firstDeploy
+	default:
+		return true
+	}
+}
+
+/*
+getCommitMetadata adds the author, the first line of the message and the time of the commit that is checked out in the
+directory to the metadata of a notification. Repositories that are downloaded as archives have no commits.
+*/
+func getCommitMetadata(jobLog *slog.Logger, dir string, p webhook.ParsedPayload, metadata notification.Metadata) notification.Metadata {
+	if archive.IsArchiveURL(p.CloneURL) {
+		return metadata
+	}
+
+	commit, err := git.GetHeadCommit(dir)
+	if err != nil {
+		jobLog.Warn("failed to get commit for notifications", logger.ErrAttr(err))
+
+		return metadata
+	}
+
+	commitTime := commit.Author.When.UTC()
+
+	metadata.CommitAuthor = commit.Author.Name
+	metadata.CommitMessage = git.GetCommitSubject(commit)
+	metadata.CommitTime = &commitTime
+
+	return metadata
+}
+
+// deployGuard suppresses redeployment loops of stacks at the same commit, it is configured on startup
+var deployGuard = newRedeployGuard(0, 0)
+
+// notifyThrottle coalesces repeated failure notifications, it is configured on startup
+var notifyThrottle = notification.NewThrottle(0, notification.ThrottleKeyError)
+
+// notify sends a deployment notification to the notification channels if any are configured,
+// the message is prefixed with the stack and the deployed commit, e.g. web: abc1234 'fix nginx config' by Jane
+func notify(jobLog *slog.Logger, c *config.AppConfig, level notification.Level, message string, metadata notification.Metadata) {
+	if len(c.NotificationChannels) == 0 {
+		return
+	}
+
+	message, send := notifyThrottle.Filter(level, message, metadata)
+	if !send {
+		jobLog.Debug("repeated failure notification suppressed", slog.String("stack", metadata.Stack))
+		prometheus.SuppressedNotifications.Inc()
+
+		return
+	}
+
+	if summary := metadata.CommitSummary(); summary != "" {
+		if metadata.Stack != "" {
+			summary = metadata.Stack + ": " + summary
+		}
+
+		message = fmt.Sprintf("%s: %s", summary, message)
+	}
+
+	err := notification.Send(c.NotificationChannels, level, message, metadata)
+	if err != nil {
+		jobLog.Error("failed to send notification", logger.ErrAttr(err))
+	}
+}
+
+// reportCommitStatus reports the deployment state of a stack as a commit status if enabled for the git provider of the payload
+func reportCommitStatus(jobLog *slog.Logger, c *config.AppConfig, p webhook.ParsedPayload, deployConfig *config.DeployConfig, level notification.Level, description string) {
+	if !slices.Contains(c.CommitStatusProviders, p.Provider) {
+		return
+	}
+
+	stackLog := jobLog.With(slog.String("stack", deployConfig.Name))
+
+	if c.GitAccessToken == "" {
+		stackLog.Warn("commit statuses require a git access token, skipping commit status")
+		return
+	}
+
+	err := notification.SendCommitStatus(p, c.GitAccessToken, notification.CommitStatus{
+		Level:       level,
+		Name:        "doco-cd/" + deployConfig.Name,
+		Description: description,
+		TargetURL:   deployConfig.DeployURL,
+	})
+	if err != nil {
+		stackLog.Error("failed to send commit status", logger.ErrAttr(err))
+	}
+}
+
+func (h *handlerData) WebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	w = getResponseWriter(w, r, h.appConfig.WebhookResponseMode)
+
+	customTarget := r.PathValue("customTarget")
+
+	// Add job id to the context to track deployments in the logs
+	jobID := uuid.Must(uuid.NewRandom()).String()
+	jobLog := h.log.With(slog.String("job_id", jobID))
+
+	jobLog.Debug("received webhook event")
+
+	done, ok := startDeployment(jobLog, w, jobID)
+	if !ok {
+		return
+	}
+
+	defer done()
+
+	secret := h.appConfig.WebhookSecret
+
+	// Repository scoped webhooks use their own secret instead of the global one
+	if repoKey := r.PathValue("repoKey"); repoKey != "" {
+		var ok bool
+
+		secret, ok = h.appConfig.RepoWebhookSecrets[repoKey]
+		if !ok {
+			errMsg = "unknown repository key"
+			jobLog.Debug(errMsg, slog.String("ip", r.RemoteAddr), slog.String("repo_key", repoKey))
+			JSONError(w, errMsg, "", jobID, http.StatusNotFound)
+
+			return
+		}
+
+		if customTarget == "" {
+			customTarget = h.appConfig.RepoWebhookTargets[repoKey]
+		}
+
+		jobLog = jobLog.With(slog.String("repo_key", repoKey))
+	}
+
+	payload, err := webhook.Parse(r, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, webhook.ErrHMACVerificationFailed):
+			errMsg = "incorrect webhook secret"
+			jobLog.Debug(errMsg, slog.String("ip", r.RemoteAddr), logger.ErrAttr(err))
+			JSONError(w, errMsg, err.Error(), jobID, http.StatusUnauthorized)
+		case errors.Is(err, webhook.ErrGitlabTokenVerificationFailed):
+			errMsg = webhook.ErrGitlabTokenVerificationFailed.Error()
+			jobLog.Debug(errMsg, slog.String("ip", r.RemoteAddr), logger.ErrAttr(err))
+			JSONError(w, errMsg, err.Error(), jobID, http.StatusUnauthorized)
+		case errors.Is(err, webhook.ErrMissingSecurityHeader):
+			errMsg = webhook.ErrMissingSecurityHeader.Error()
+			jobLog.Debug(errMsg, slog.String("ip", r.RemoteAddr), logger.ErrAttr(err))
+			JSONError(w, errMsg, err.Error(), jobID, http.StatusBadRequest)
+		case errors.Is(err, webhook.ErrParsingPayload):
+			errMsg = webhook.ErrParsingPayload.Error()
+			jobLog.Debug(errMsg, slog.String("ip", r.RemoteAddr), logger.ErrAttr(err))
+			JSONError(w, errMsg, err.Error(), jobID, http.StatusInternalServerError)
+		case errors.Is(err, webhook.ErrUnsupportedEvent):
+			msg := "webhook event is not a push, deployment skipped"
+			jobLog.Debug(msg, slog.String("ip", r.RemoteAddr), logger.ErrAttr(err))
+			JSONResponse(w, msg, jobID, http.StatusOK)
+		case errors.Is(err, webhook.ErrInvalidHTTPMethod):
+			errMsg = webhook.ErrInvalidHTTPMethod.Error()
+			jobLog.Debug(errMsg, slog.String("ip", r.RemoteAddr), logger.ErrAttr(err))
+			JSONError(w, errMsg, "", jobID, http.StatusMethodNotAllowed)
+		default:
+			jobLog.Debug(webhook.ErrParsingPayload.Error(), slog.String("ip", r.RemoteAddr), logger.ErrAttr(err))
+			JSONError(w, errMsg, err.Error(), jobID, http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	if payload.IsBranchOrTagDeletionEvent() {
+		msg := "branch or tag was deleted, deployment skipped"
+		jobLog.Info(msg, slog.String("repository", payload.FullName), slog.String("reference", payload.Ref))
+		JSONResponse(w, msg, jobID, http.StatusOK)
+
+		return
+	}
+
+	if h.maintenance.Load() {
+		msg := "maintenance mode is active, deployment skipped"
+		jobLog.Info(msg, slog.String("repository", payload.FullName), slog.String("reference", payload.Ref))
+		JSONResponse(w, msg, jobID, http.StatusAccepted)
+
+		return
+	}
+
+	if !h.checkRepoQuota(jobLog, w, payload, jobID) {
+		return
+	}
+
+	jobLog = jobLog.With(triggerAttr(triggerWebhook, payload))
+
+	HandleEvent(ctx, jobLog, w, h.appConfig, payload, customTarget, jobID, triggerWebhook, getFilterPaths(r, customTarget), isDryRun(r), h.dockerCli)
+}
+
+// checkRepoQuota checks if the repository of the payload is within its disk quota in the repository cache,
+// otherwise the deployment is refused with an error response
+func (h *handlerData) checkRepoQuota(jobLog *slog.Logger, w http.ResponseWriter, p webhook.ParsedPayload, jobID string) bool {
+	if h.repoUsage == nil {
+		return true
+	}
+
+	// Invalid repositories are rejected by HandleEvent
+	cloneName, err := git.GetCloneName(h.appConfig.CloneLayout, p.FullName, p.CloneURL)
+	if err != nil {
+		return true
+	}
+
+	err = h.repoUsage.CheckQuota(cloneName, int64(h.appConfig.RepoCacheQuota))
+	if err != nil {
+		errMsg = "repository exceeds its disk quota, deployment refused"
+		jobLog.Error(errMsg, logger.ErrAttr(err), slog.String("repository", p.FullName))
+		JSONError(w, errMsg, err.Error(), jobID, http.StatusInsufficientStorage)
+
+		return false
+	}
+
+	return true
+}
+
+// triggerAttr returns the log group that describes the event that triggered a deployment job
+func triggerAttr(source string, p webhook.ParsedPayload) slog.Attr {
+	attrs := []any{slog.String("source", source), slog.String("reference", p.Ref)}
+	if p.CommitSHA != "" {
+		attrs = append(attrs, slog.String("commit", p.CommitSHA))
+	}
+
+	return slog.Group("trigger", attrs...)
+}
+
+/*
+getReferencedPaths returns the files (relative to the repository root) that the compose files of the stacks inside the
+filter paths reference with extends and include, including the files referenced by these files, so that changes to shared
+base files (e.g. common/compose.yaml) also deploy the stacks that extend them. Files outside the repository are ignored.
+*/
+func getReferencedPaths(repoDir string, deployConfigs []*config.DeployConfig, filterPaths []string) ([]string, error) {
+	var referenced []string
+
+	for _, deployConfig := range deployConfigs {
+		workingDir := path.Join(repoDir, deployConfig.WorkingDirectory)
+
+		inFilter := false
+
+		for _, f := range deployConfig.ComposeFiles {
+			for _, filterPath := range filterPaths {
+				if isSubPath(path.Join(repoDir, filterPath), path.Join(workingDir, f)) {
+					inFilter = true
+				}
+			}
+		}
+
+		if !inFilter {
+			continue
+		}
+
+		files, err := docker.GetComposeReferences(workingDir, deployConfig.ComposeFiles)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get files referenced by stack %s: %w", deployConfig.Name, err)
+		}
+
+		for _, f := range files {
+			if rel, err := filepath.Rel(repoDir, f); err == nil && isSubPath(repoDir, f) {
+				referenced = append(referenced, rel)
+			}
+		}
+	}
+
+	return referenced, nil
+}
+
+// hasComposeFileChanges checks if the event changed a YAML file anywhere in the repository that compose files could
+// reference with extends or include, or if the changed files are unknown
+func hasComposeFileChanges(p webhook.ParsedPayload) bool {
+	if p.ChangedFiles == nil {
+		return true
+	}
+
+	for _, f := range p.ChangedFiles {
+		switch strings.ToLower(path.Ext(f)) {
+		case ".yml", ".yaml":
+			return true
+		}
+	}
+
+	return false
+}
+
+// isDryRun checks if the dry_run query parameter of a webhook request is set to true
+func isDryRun(r *http.Request) bool {
+	dryRun, err := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	return err == nil && dryRun
+}
+
+// getFilterPaths returns the paths of the comma-separated paths query parameter of a webhook request
+// together with the deploy config files of the target, or nil if the request is not filtered
+func getFilterPaths(r *http.Request, customTarget string) []string {
+	query := r.URL.Query().Get("paths")
+	if query == "" {
+		return nil
+	}
+
+	var paths []string
+
+	for _, p := range strings.Split(query, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+
+	// Changes to the deploy config can affect any stack
+	if customTarget != "" {
+		for _, f := range config.CustomDeploymentConfigFileNames {
+			paths = append(paths, fmt.Sprintf(f, customTarget))
+		}
+	} else {
+		paths = append(paths, config.DefaultDeploymentConfigFileNames...)
+		paths = append(paths, config.DeprecatedDeploymentConfigFileNames...)
+	}
+
+	return paths
+}
+
+func (h *handlerData) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	// An instance that is shutting down rejects new deployments, so load balancers should stop sending it webhooks
+	if deployments.isDraining() {
+		JSONError(w, "unhealthy", "application is shutting down", "", http.StatusServiceUnavailable)
+		return
+	}
+
+	err := docker.VerifySocketConnection()
+	if err != nil {
+		h.log.Error(docker.ErrDockerSocketConnectionFailed.Error(), logger.ErrAttr(err))
+		JSONError(w, "unhealthy", err.Error(), "", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	var jobs []periodicJobStatus
+
+	if verbose, _ := strconv.ParseBool(r.URL.Query().Get("verbose")); verbose {
+		jobs = make([]periodicJobStatus, 0, len(h.periodicJobs))
+		for _, j := range h.periodicJobs {
+			jobs = append(jobs, j.status())
+		}
+	}
+
+	h.log.Debug("health check successful")
+	JSONHealthResponse(w, "healthy", h.maintenance.Load(), jobs, http.StatusOK)
+}
+
+// secretMode controls how loadStack handles the external secrets and the external env of a stack
+type secretMode int
+
+const (
+	secretsResolve secretMode = iota // secretsResolve resolves the external secrets and the external env
+	secretsSkip                      // secretsSkip only resolves the external env, as its variables are needed to load the project correctly
+	secretsRedact                    // secretsRedact loads the project with [redacted] as value of the external env, e.g. to show the rendered project
+)
+
+/*
+loadStack loads the compose project of a stack from the repository and handles its external secrets and env according
+to the secret mode. The returned cleanup function removes the rendered compose templates and must be called after the deployment.
+Loading changes the working directory of the process, so stacks can not be loaded concurrently.
+*/
+func loadStack(
+	ctx context.Context, stackLog *slog.Logger, c *config.AppConfig, dockerCli command.Cli, repoDir, customTarget string,
+	p webhook.ParsedPayload, deployConfig *config.DeployConfig, secrets secretMode,
+) (_ *types.Project, _ func(), err error) {
+	cleanup := func() {}
+
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+
+	workingDir := path.Join(repoDir, deployConfig.WorkingDirectory)
+
+	err = os.Chdir(workingDir)
+	if err != nil {
+		errMsg = "failed to change working directory"
+		stackLog.Error(errMsg, logger.ErrAttr(err), slog.String("path", workingDir))
+
+		return nil, nil, fmt.Errorf("%s: %w", errMsg, err)
+	}
+
+	deployConfig.ComposeFiles, err = resolveComposeFiles(stackLog, workingDir, deployConfig.ComposeFiles)
+	if err != nil {
+		stackLog.Error(err.Error(),
+			slog.Group("compose_files", slog.Any("files", cli.DefaultFileNames)))
+
+		return nil, nil, err
+	}
+
+	contextRoot := path.Join(repoDir, deployConfig.ContextRoot)
+	if !isSubPath(repoDir, contextRoot) {
+		errMsg = "invalid deploy configuration"
+		err = fmt.Errorf("context_root must be inside the repository: %s", deployConfig.ContextRoot)
+		stackLog.Error(errMsg, logger.ErrAttr(err))
+
+		return nil, nil, fmt.Errorf("%s: %w", errMsg, err)
+	}
+
+	err = docker.CheckComposeReferences(workingDir, deployConfig.ComposeFiles, contextRoot)
+	if err != nil {
+		errMsg = "compose files reference paths outside of the context root"
+		stackLog.Error(errMsg, logger.ErrAttr(err), slog.String("context_root", deployConfig.ContextRoot))
+
+		return nil, nil, fmt.Errorf("%s: %w", errMsg, err)
+	}
+
+	deployedProfiles, found, err := docker.GetDeployedProfiles(ctx, dockerCli.Client(), deployConfig.Name)
+	if err != nil {
+		stackLog.Warn("failed to get profiles of deployed stack", logger.ErrAttr(err))
+	} else if found {
+		var dropped []string
+
+		deployConfig.Profiles, dropped = docker.ResolveProfiles(deployConfig.Profiles, deployedProfiles)
+		if len(dropped) > 0 {
+			stackLog.Warn("profiles of deployed stack are no longer active", slog.Any("profiles", dropped))
+		}
+	}
+
+	loadOpts, err := getLoadOptions(repoDir, deployConfig)
+	if err != nil {
+		errMsg = "invalid deploy configuration"
+		stackLog.Error(errMsg, logger.ErrAttr(err))
+
+		return nil, nil, fmt.Errorf("%s: %w", errMsg, err)
+	}
+
+	composeFiles := deployConfig.ComposeFiles
+
+	if deployConfig.EnableTemplating {
+		var renderDir string
+
+		composeFiles, renderDir, err = docker.RenderComposeTemplates(workingDir, deployConfig.ComposeFiles, docker.TemplateData{
+			Repository: p.FullName,
+			Reference:  p.Ref,
+			CommitSHA:  p.CommitSHA,
+			Stack:      deployConfig.Name,
+			Target:     customTarget,
+		})
+		if err != nil {
+			errMsg = "failed to render compose templates"
+			stackLog.Error(errMsg, logger.ErrAttr(err))
+
+			return nil, nil, fmt.Errorf("%s: %w", errMsg, err)
+		}
+
+		cleanup = func() {
+			if err := os.RemoveAll(renderDir); err != nil {
+				stackLog.Error("failed to remove rendered compose files", logger.ErrAttr(err))
+			}
+		}
+	}
+
+	if len(deployConfig.ExternalEnv) > 0 {
+		env := make(map[string]string, len(deployConfig.ExternalEnv))
+		for k := range deployConfig.ExternalEnv {
+			env[k] = docker.RedactedValue
+		}
+
+		if secrets != secretsRedact {
+			env, err = resolveExternalSecrets(ctx, c, deployConfig.ExternalEnv)
+		}
+
+		if err != nil {
+			errMsg = "failed to get external env"
+			stackLog.Error(errMsg, logger.ErrAttr(err))
+
+			return nil, nil, fmt.Errorf("%s: %w", errMsg, err)
+		}
+
+		loadOpts = append(loadOpts, cli.WithEnv(getEnvList(env)))
+	}
+
+	issues, err := docker.CheckComposeCompatibility(workingDir, composeFiles)
+	if err != nil {
+		stackLog.Warn("failed to check compose compatibility", logger.ErrAttr(err))
+	}
+
+	for _, issue := range issues {
+		stackLog.Warn("compose compatibility issue",
+			slog.String("file", issue.File),
+			slog.String("field", issue.Field),
+			slog.String("message", issue.Message))
+	}
+
+	project, err := docker.LoadCompose(ctx, workingDir, deployConfig.Name, composeFiles, loadOpts...)
+	if err != nil {
+		errMsg = "failed to load compose config"
+		stackLog.Error(errMsg,
+			logger.ErrAttr(err),
+			slog.Group("compose_files", slog.Any("files", deployConfig.ComposeFiles)))
+
+		return nil, nil, fmt.Errorf("%s: %w", errMsg, err)
+	}
+
+	docker.SetDefaultNetworkDriverOpts(project, c.NetworkDriverOpts)
+
+	err = docker.CheckActiveServices(project)
+	if err != nil {
+		if deployConfig.FailOnNoServices {
+			errMsg = "stack would not deploy any services"
+			stackLog.Error(errMsg, logger.ErrAttr(err), slog.Any("profiles", deployConfig.Profiles))
+
+			return nil, nil, fmt.Errorf("%s: %w", errMsg, err)
+		}
+
+		stackLog.Warn("stack will not deploy any services", logger.ErrAttr(err), slog.Any("profiles", deployConfig.Profiles))
+	}
+
+	if deployConfig.RequirePinnedImages {
+		err = docker.CheckPinnedImages(project)
+		if err != nil {
+			errMsg = "stack uses images that are not pinned to a digest"
+			stackLog.Error(errMsg, logger.ErrAttr(err))
+
+			return nil, nil, fmt.Errorf("%s: %w", errMsg, err)
+		}
+	}
+
+	if secrets == secretsResolve && len(deployConfig.ExternalSecrets) > 0 {
+		err = setExternalSecrets(ctx, c, project, deployConfig.ExternalSecrets)
+		if err != nil {
+			errMsg = "failed to get external secrets"
+			stackLog.Error(errMsg, logger.ErrAttr(err))
+
+			return nil, nil, fmt.Errorf("%s: %w", errMsg, err)
+		}
+	}
+
+	return project, cleanup, nil
+}
+
+// checkStackResources checks the resources of the stack against the resource budget, the checks only fail
+// the deployment if they are enforced
+func checkStackResources(stackLog *slog.Logger, c *config.AppConfig, project *types.Project, deployConfig *config.DeployConfig) error {
+	if c.ResourceChecks == config.ResourceChecksOff {
+		return nil
+	}
+
+	err := docker.CheckResources(project, deployConfig.Scale, docker.ResourceBudget{
+		CPUs:        c.ResourceBudgetCPUs,
+		MemoryBytes: int64(c.ResourceBudgetMemory),
+	})
+	if err != nil {
+		if c.ResourceChecks == config.ResourceChecksEnforce {
+			errMsg = "resource checks failed"
+			stackLog.Error(errMsg, logger.ErrAttr(err))
+
+			return fmt.Errorf("%s: %w", errMsg, err)
+		}
+
+		stackLog.Warn("resource checks failed", logger.ErrAttr(err))
+	}
+
+	return nil
+}
+
+/*
+dryRunStack loads the stack like deployStack, including its secrets, and returns the rendered compose project and the
+actions its deployment would take. Nothing is built, pulled or deployed and the labels are only added to the rendered
+project, the running containers of the stack are left untouched.
+*/
+func dryRunStack(
+	ctx context.Context, jobLog *slog.Logger, c *config.AppConfig, dockerCli command.Cli, repoDir, customTarget string,
+	p webhook.ParsedPayload, deployConfig *config.DeployConfig,
+) (*docker.DryRun, error) {
+	stackLog := jobLog.
+		With(slog.String("stack", deployConfig.Name)).
+		With(slog.String("reference", deployConfig.Reference)).
+		With(slog.String("config_source", deployConfig.Source()))
+
+	stackLog.Debug("deployment configuration retrieved", slog.Any("config", deployConfig))
+
+	project, cleanup, err := loadStack(ctx, stackLog, c, dockerCli, repoDir, customTarget, p, deployConfig, secretsResolve)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rendered templates and other files created while loading the stack must not outlive the dry run
+	defer cleanup()
+
+	err = checkStackResources(stackLog, c, project, deployConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// The variables of the external env are secrets that can be interpolated anywhere in the compose files,
+	// so the project that gets shown is loaded again without them
+	rendered := project
+
+	if len(deployConfig.ExternalEnv) > 0 {
+		var renderedCleanup func()
+
+		rendered, renderedCleanup, err = loadStack(ctx, stackLog, c, dockerCli, repoDir, customTarget, p, deployConfig, secretsRedact)
+		if err != nil {
+			return nil, err
+		}
+
+		defer renderedCleanup()
+	}
+
+	result, err := docker.DryRunCompose(ctx, dockerCli.Client(), project, rendered, deployConfig, p)
+	if err != nil {
+		errMsg = "failed to render stack"
+		stackLog.Error(errMsg, logger.ErrAttr(err))
+
+		return nil, fmt.Errorf("%s: %w", errMsg, err)
+	}
+
+	stackLog.Info("stack rendered without deploying it", slog.Any("actions", result.Actions))
+
+	return result, nil
+}
+
+// errDeployTimeout is returned if the deployment of a stack takes longer than its deploy_timeout
+var errDeployTimeout = errors.New("deployment timed out")
+
+// withDeployTimeout returns a context that is canceled after the deploy_timeout of the stack, so that a hanging pull or
+// build does not block the job, and the job slot of background jobs. Without a deploy_timeout the context has no deadline.
+func withDeployTimeout(ctx context.Context, deployConfig *config.DeployConfig) (context.Context, context.CancelFunc) {
+	timeout, err := time.ParseDuration(deployConfig.DeployTimeout)
+	if err != nil || timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+/*
+rollbackStack deploys a stack again from the commit it was deployed from before its deployment failed.
+The commit is fetched into its own worktree and deployed with the deploy config of the stack at that commit,
+the rollback gets its own deploy_timeout, as the one of the failed deployment may have expired.
+*/
+func rollbackStack(
+	ctx context.Context, jobLog *slog.Logger, c *config.AppConfig, jobID, cloneName, customTarget string,
+	dockerCli command.Cli, p webhook.ParsedPayload, deployConfig *config.DeployConfig, commitSHA string,
+) error {
+	stackLog := jobLog.With(slog.String("stack", deployConfig.Name), slog.String("rollback_commit", commitSHA))
+
+	if archive.IsArchiveURL(p.CloneURL) {
+		return errors.New("stacks deployed from archives can not be rolled back")
+	}
+
+	stackLog.Warn("rolling back stack to previously deployed commit")
+
+	skipTLSVerify, proxyURL := getStackGitOptions(c, deployConfig)
+
+	dir, err := git.CloneCommitWorktree(cloneName, p.CloneURL, commitSHA, skipTLSVerify, proxyURL, c.GitHeaders)
+	if dir != "" {
+		defer func() {
+			if err := os.RemoveAll(dir); err != nil {
+				stackLog.Error("failed to remove temporary directory", logger.ErrAttr(err))
+			}
+		}()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	deployConfigs, err := config.GetDeployConfigs(dir, p.Name, customTarget)
+	if err != nil && !errors.Is(err, config.ErrDeprecatedConfig) {
+		return fmt.Errorf("failed to get deploy configuration: %w", err)
+	}
+
+	i := slices.IndexFunc(deployConfigs, func(d *config.DeployConfig) bool { return d.Name == deployConfig.Name })
+	if i < 0 {
+		return fmt.Errorf("stack %s does not exist at commit %s", deployConfig.Name, commitSHA)
+	}
+
+	rollbackConfig := deployConfigs[i]
+	rollbackConfig.RollbackOnFailure = false
+
+	p.CommitSHA = commitSHA
+
+	deployCtx, cancel := withDeployTimeout(ctx, rollbackConfig)
+	defer cancel()
+
+	_, err = deployStack(stackLog, c, jobID, dir, customTarget, &deployCtx, &dockerCli, &p, rollbackConfig)
+	if err != nil {
+		stackLog.Error("rollback failed", logger.ErrAttr(err))
+		return err
+	}
+
+	stackLog.Info("stack rolled back to previously deployed commit")
+
+	return nil
+}
+
+// getRollbackResult describes the outcome of the rollback of a stack for the error of its failed deployment
+func getRollbackResult(commitSHA string, rollbackErr error) string {
+	if rollbackErr != nil {
+		return fmt.Sprintf("rollback to %s failed: %v", commitSHA, rollbackErr)
+	}
+
+	return "rolled back to " + commitSHA
+}
+
+func deployStack(
+	jobLog *slog.Logger, c *config.AppConfig, jobID, repoDir, customTarget string, ctx *context.Context,
+	dockerCli *command.Cli, p *webhook.ParsedPayload, deployConfig *config.DeployConfig,
+) (docker.DeploySummary, error) {
+	stackLog := jobLog.
+		With(slog.String("stack", deployConfig.Name)).
+		With(slog.String("reference", deployConfig.Reference)).
+		With(slog.String("config_source", deployConfig.Source()))
+
+	prometheus.ActiveDeployments.Inc()
+	defer prometheus.ActiveDeployments.Dec()
+
+	stackLog.Debug("deployment configuration retrieved", slog.Any("config", deployConfig))
+
+	project, cleanup, err := loadStack(*ctx, stackLog, c, *dockerCli, repoDir, customTarget, *p, deployConfig, secretsResolve)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cleanup()
+
+	err = checkStackResources(stackLog, c, project, deployConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var previousImages []string
+
+	if deployConfig.PruneImages {
+		previousImages, err = docker.GetProjectImageIDs(*ctx, (*dockerCli).Client(), project.Name)
+		if err != nil {
+			errMsg = "failed to get images of stack"
+			stackLog.Error(errMsg, logger.ErrAttr(err))
+
+			return nil, fmt.Errorf("%s: %w", errMsg, err)
+		}
+	}
+
+	var plan *docker.DeploymentPlan
+
+	if c.DeploymentPlanDir != "" {
+		plan, err = docker.NewDeploymentPlan(*ctx, (*dockerCli).Client(), project)
+		if err != nil {
+			errMsg = "failed to compute deployment plan"
+			stackLog.Error(errMsg, logger.ErrAttr(err))
+
+			return nil, fmt.Errorf("%s: %w", errMsg, err)
+		}
+
+		plan.JobID = jobID
+		plan.Repository = p.FullName
+		plan.Reference = p.Ref
+		plan.CommitSHA = p.CommitSHA
+	}
+
+	stackLog.Info("deploying stack")
+
+	deployCli := *dockerCli
+
+	// Log the build output of the stack with the job id instead of interleaving it on stdout
+	if !deployConfig.BuildOpts.Quiet && docker.HasBuild(project) {
+		output := logger.NewWriter(stackLog, slog.LevelInfo, "docker output")
+		defer output.Close()
+
+		deployCli, err = docker.CreateJobDockerCli(*dockerCli, output)
+		if err != nil {
+			errMsg = "failed to create docker client"
+			stackLog.Error(errMsg, logger.ErrAttr(err))
+
+			return nil, fmt.Errorf("%s: %w", errMsg, err)
+		}
+	}
+
+	deployCli, err = getRegistryAuthCli(*ctx, c, deployCli, deployConfig)
+	if err != nil {
+		errMsg = "failed to get registry credentials"
+		stackLog.Error(errMsg, logger.ErrAttr(err))
+
+		return nil, fmt.Errorf("%s: %w", errMsg, err)
+	}
+
+	before, err := docker.GetProjectState(*ctx, (*dockerCli).Client(), project.Name)
+	if err != nil {
+		stackLog.Warn("failed to get containers of stack, deployment can not be summarized", logger.ErrAttr(err))
+	}
+
+	err = docker.DeployCompose(*ctx, deployCli, project, deployConfig, *p)
+	if docker.IsConnectionLost(err) {
+		err = recoverDeployment(*ctx, stackLog, c, (*dockerCli).Client(), project, err)
+	}
+
+	if err != nil {
+		errMsg = "failed to deploy stack"
+		stackLog.Error(errMsg,
+			logger.ErrAttr(err),
+			slog.Group("compose_files", slog.Any("files", deployConfig.ComposeFiles)))
+
+		return nil, fmt.Errorf("%s: %w", errMsg, err)
+	}
+
+	if deployConfig.PruneImages {
+		err = docker.PruneImages(*ctx, stackLog, (*dockerCli).Client(), previousImages)
+		if err != nil {
+			// The deployment itself was successful, so only log the error
+			stackLog.Error("failed to prune images", logger.ErrAttr(err))
+		}
+	}
+
+	if deployConfig.PruneBuildCache && docker.HasBuild(project) {
+		reclaimed, err := docker.PruneBuildCache(*ctx, (*dockerCli).Client(), deployConfig.BuildCacheMaxAge, int64(deployConfig.BuildCacheKeepStorage))
+		if err != nil {
+			// The deployment itself was successful, so only log the error
+			stackLog.Error("failed to prune build cache", logger.ErrAttr(err))
+		} else {
+			prometheus.BuildCacheReclaimedBytes.Add(float64(reclaimed))
+			stackLog.Debug("pruned build cache", slog.Uint64("reclaimed_bytes", reclaimed))
+		}
+	}
+
+	if plan != nil {
+		planFile, err := plan.Write(c.DeploymentPlanDir)
+		if err != nil {
+			// The deployment itself was successful, so only log the error
+			stackLog.Error("failed to write deployment plan", logger.ErrAttr(err))
+		} else {
+			stackLog.Debug("deployment plan written", slog.String("path", planFile))
+		}
+	}
+
+	prometheus.SetStackDeployedInfo(deployConfig.Name, p.CommitSHA, docker.GetProjectImages(project))
+
+	if before == nil {
+		return nil, nil
+	}
+
+	after, err := docker.GetProjectState(*ctx, (*dockerCli).Client(), project.Name)
+	if err != nil {
+		stackLog.Warn("failed to get containers of stack, deployment can not be summarized", logger.ErrAttr(err))
+
+		return nil, nil
+	}
+
+	summary := docker.SummarizeDeployment(before, after)
+	stackLog.Info("stack deployed", slog.String("summary", summary.String()), slog.Any("services", summary))
+
+	return summary, nil
+}
+
+// resolveExternalSecrets retrieves the contents of the references from the external secret provider
+func resolveExternalSecrets(ctx context.Context, c *config.AppConfig, refs map[string]string) (map[string]string, error) {
+	if c.SecretProvider == "" {
+		return nil, errors.New("no secret provider configured, set SECRET_PROVIDER")
+	}
+
+	provider, err := secretprovider.New(c.SecretProvider, c.VaultAddr, c.VaultToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return secretprovider.ResolveSecrets(ctx, provider, refs, c.SecretProviderTimeout, c.SecretProviderRetries)
+}
+
+// setExternalSecrets retrieves the contents of the secrets from the external secret provider and sets them in the project
+func setExternalSecrets(ctx context.Context, c *config.AppConfig, project *types.Project, refs map[string]string) error {
+	contents, err := resolveExternalSecrets(ctx, c, refs)
+	if err != nil {
+		return err
+	}
+
+	return docker.SetSecretContents(project, contents)
+}
+
+// getRegistryAuthCli returns a docker cli that uses the registry credentials of the stack, the passwords that are
+// references to the external secret provider are resolved first
+func getRegistryAuthCli(ctx context.Context, c *config.AppConfig, dockerCli command.Cli, deployConfig *config.DeployConfig) (command.Cli, error) {
+	auths := slices.Clone(deployConfig.RegistryAuth)
+	refs := make(map[string]string)
+
+	for _, auth := range auths {
+		if auth.PasswordSecret != "" {
+			refs[auth.Registry] = auth.PasswordSecret
+		}
+	}
+
+	if len(refs) > 0 {
+		passwords, err := resolveExternalSecrets(ctx, c, refs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve registry passwords: %w", err)
+		}
+
+		for i, auth := range auths {
+			if auth.PasswordSecret != "" {
+				auths[i].Password = passwords[auth.Registry]
+			}
+		}
+	}
+
+	return docker.WithRegistryAuth(dockerCli, auths), nil
+}
+
+// getEnvList returns the variables as a sorted list of KEY=value entries
+func getEnvList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for k, v := range env {
+		list = append(list, k+"="+v)
+	}
+
+	slices.Sort(list)
+
+	return list
+}
+
+// recoverDeployment waits for the docker daemon to come back after the connection was lost during a deployment
+// and checks if the stack was deployed anyway before deciding whether the deployment failed
+func recoverDeployment(ctx context.Context, stackLog *slog.Logger, c *config.AppConfig, apiClient client.APIClient, project *types.Project, deployErr error) error {
+	stackLog.Warn("lost connection to docker daemon during deployment", logger.ErrAttr(deployErr))
+
+	err := docker.WaitForDaemon(ctx, stackLog, apiClient, c.DockerReconnectTimeout)
+	if err != nil {
+		return fmt.Errorf("%w: %v", err, deployErr)
+	}
+
+	err = docker.VerifyProjectState(ctx, apiClient, project)
+	if err != nil {
+		return fmt.Errorf("%w: %v", err, deployErr)
+	}
+
+	stackLog.Info("stack is in the desired state after reconnecting to docker daemon")
+
+	return nil
+}
+
+// resolveComposeFiles returns the default compose files that exist in the working directory
+// if the default compose files are used, otherwise the configured compose files
+func resolveComposeFiles(jobLog *slog.Logger, workingDir string, composeFiles []string) ([]string, error) {
+	if !reflect.DeepEqual(composeFiles, cli.DefaultFileNames) {
+		return composeFiles, nil
+	}
+
+	var (
+		tmpComposeFiles []string
+		err             error
+	)
+
+	jobLog.Debug("checking for default compose files")
+
+	// Check if the default compose files exist
+	for _, f := range composeFiles {
+		if _, err = os.Stat(path.Join(workingDir, f)); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		tmpComposeFiles = append(tmpComposeFiles, f)
+	}
+
+	if len(tmpComposeFiles) == 0 {
+		return nil, fmt.Errorf("no compose files found: %w", err)
+	}
+
+	return tmpComposeFiles, nil
+}
+
+// getLoadOptions returns the additional project options for loading the compose files of a deploy config
+func getLoadOptions(repoDir string, deployConfig *config.DeployConfig) ([]cli.ProjectOptionsFn, error) {
+	var opts []cli.ProjectOptionsFn
+
+	if deployConfig.ProjectDirectory != "" {
+		projectDir := path.Join(repoDir, deployConfig.ProjectDirectory)
+		if !isSubPath(repoDir, projectDir) {
+			return nil, fmt.Errorf("project_dir must be inside the repository: %s", deployConfig.ProjectDirectory)
+		}
+
+		opts = append(opts, cli.WithWorkingDirectory(projectDir))
+	}
+
+	if len(deployConfig.Profiles) > 0 {
+		opts = append(opts, cli.WithProfiles(deployConfig.Profiles))
+	}
+
+	if len(deployConfig.EnvFiles) > 0 {
+		workingDir := path.Join(repoDir, deployConfig.WorkingDirectory)
+		envFiles := make([]string, len(deployConfig.EnvFiles))
+
+		for i, f := range deployConfig.EnvFiles {
+			envFiles[i] = path.Join(workingDir, f)
+			if !isSubPath(repoDir, envFiles[i]) {
+				return nil, fmt.Errorf("env_files must be inside the repository: %s", f)
+			}
+		}
+
+		opts = append(opts, cli.WithEnvFiles(envFiles...))
+	}
+
+	if deployConfig.DotEnvPrecedence != "" {
+		opts = append(opts, docker.WithDotEnvPrecedence(deployConfig.DotEnvPrecedence))
+	}
+
+	return opts, nil
+}
+
+// isSubPath checks if the path is equal to or inside the base directory
+func isSubPath(base, p string) bool {
+	rel, err := filepath.Rel(base, p)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, "../")
 }
@@ -4,12 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/compose/v2/pkg/api"
 	"github.com/docker/compose/v2/pkg/compose"
@@ -69,10 +73,60 @@ func TestHandlerData_HealthCheckHandler(t *testing.T) {
 	if rr.Body.String() != expectedResponse {
 		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expectedResponse)
 	}
+
+	h.addPeriodicJob("image_update", time.Hour)
+
+	req, err = http.NewRequest("GET", healthPath+"?verbose=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	expectedJobs := `"jobs":[{"name":"image_update","running":false,"next_run":`
+	if !strings.Contains(rr.Body.String(), expectedJobs) {
+		t.Errorf("expected verbose health check to contain %s, got %v", expectedJobs, rr.Body.String())
+	}
+}
+
+func TestHandlerData_HealthCheckHandler_Draining(t *testing.T) {
+	deployments.mu.Lock()
+	deployments.draining = true
+	deployments.mu.Unlock()
+
+	t.Cleanup(func() {
+		deployments.mu.Lock()
+		deployments.draining = false
+		deployments.mu.Unlock()
+	})
+
+	h := handlerData{
+		appConfig: &config.AppConfig{},
+		log:       logger.New(12),
+	}
+
+	req, err := http.NewRequest("GET", healthPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.HealthCheckHandler)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusServiceUnavailable)
+	}
+
+	expectedDetails := "application is shutting down"
+	if !strings.Contains(rr.Body.String(), expectedDetails) {
+		t.Errorf("expected response to contain %q, got %q", expectedDetails, rr.Body.String())
+	}
 }
 
 func TestHandlerData_WebhookHandler(t *testing.T) {
-	expectedResponse := `{"details":"deployment successful","job_id":"[a-f0-9-]{36}"}`
+	expectedResponse := `{"details":"deployment successful","job_id":"[a-f0-9-]{36}","summary":{"[^"]+":"[0-9a-z, ]+"}}`
 	expectedStatusCode := http.StatusCreated
 
 	payload, err := os.ReadFile(githubPayloadFile)
@@ -155,3 +209,357 @@ func TestHandlerData_WebhookHandler(t *testing.T) {
 		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expectedResponse)
 	}
 }
+
+func TestHandlerData_WebhookHandler_RepoKey(t *testing.T) {
+	payload, err := os.ReadFile(githubPayloadFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := handlerData{
+		appConfig: &config.AppConfig{
+			WebhookSecret:      "global",
+			RepoWebhookSecrets: map[string]string{"team-a": "secret1"},
+		},
+		log: logger.New(12),
+	}
+
+	testCases := []struct {
+		name               string
+		repoKey            string
+		secret             string
+		expectedStatusCode int
+	}{
+		{"Unknown Repository Key", "team-b", "secret1", http.StatusNotFound},
+		{"Global Secret", "team-a", "global", http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc(webhookPath+"/repo/{repoKey}", h.WebhookHandler)
+
+			req, err := http.NewRequest("POST", webhookPath+"/repo/"+tc.repoKey, bytes.NewReader(payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set(webhook.GithubSignatureHeader, "sha256="+webhook.GenerateHMAC(payload, tc.secret))
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tc.expectedStatusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.expectedStatusCode)
+			}
+		})
+	}
+}
+
+func TestIsSubPath(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected bool
+	}{
+		{"/tmp/repo", true},
+		{"/tmp/repo/compose", true},
+		{"/tmp/repo/../other", false},
+		{"/tmp/repository", false},
+		{"/etc", false},
+	}
+
+	for _, tc := range testCases {
+		if got := isSubPath("/tmp/repo", tc.path); got != tc.expected {
+			t.Errorf("expected isSubPath(%s) to be %v, got %v", tc.path, tc.expected, got)
+		}
+	}
+}
+
+func TestShouldNotifySuccess(t *testing.T) {
+	testCases := []struct {
+		notifyOn    string
+		firstDeploy bool
+		expected    bool
+	}{
+		{config.NotifyOnAll, false, true},
+		{config.NotifyOnFirstDeploy, true, true},
+		{config.NotifyOnFirstDeploy, false, false},
+		{config.NotifyOnFailure, true, false},
+	}
+
+	for _, tc := range testCases {
+		if got := shouldNotifySuccess(tc.notifyOn, tc.firstDeploy); got != tc.expected {
+			t.Errorf("expected shouldNotifySuccess(%s, %v) to be %v, got %v", tc.notifyOn, tc.firstDeploy, tc.expected, got)
+		}
+	}
+}
+
+func TestGetFilterPaths(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, webhookPath, nil)
+	if paths := getFilterPaths(r, ""); paths != nil {
+		t.Errorf("expected no filter without paths query parameter, got %v", paths)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, webhookPath+"/prod?paths=stacks/web,%20shared/", nil)
+
+	expected := []string{"stacks/web", "shared/", ".doco-cd.prod.yaml", ".doco-cd.prod.yml"}
+
+	paths := getFilterPaths(r, "prod")
+	if fmt.Sprint(paths) != fmt.Sprint(expected) {
+		t.Errorf("expected paths %v, got %v", expected, paths)
+	}
+}
+
+func TestHasComposeFileChanges(t *testing.T) {
+	testCases := []struct {
+		name         string
+		changedFiles []string
+		expected     bool
+	}{
+		{"Unknown Changes", nil, true},
+		{"No YAML Files", []string{"README.md", "docs/setup.md"}, false},
+		{"Compose File", []string{"README.md", "common/compose.yaml"}, true},
+		{"YML Extension", []string{"base/services.YML"}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := webhook.ParsedPayload{ChangedFiles: tc.changedFiles}
+			if got := hasComposeFileChanges(p); got != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestIsDryRun(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected bool
+	}{
+		{"", false},
+		{"?dry_run=true", true},
+		{"?dry_run=1", true},
+		{"?dry_run=false", false},
+		{"?dry_run=yes", false},
+	}
+
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodPost, webhookPath+tc.query, nil)
+		if got := isDryRun(r); got != tc.expected {
+			t.Errorf("expected dry run %v for query %q, got %v", tc.expected, tc.query, got)
+		}
+	}
+}
+
+func TestGetReferencedPaths(t *testing.T) {
+	repoDir := t.TempDir()
+
+	for _, dir := range []string{"stacks/app/prod", "stacks/web", "common"} {
+		if err := os.MkdirAll(filepath.Join(repoDir, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{
+		"common/compose.yaml": "services:\n  base:\n    image: nginx:latest\n",
+		"stacks/app/prod/compose.yaml": "services:\n  test:\n    extends:\n      file: ../../../common/compose.yaml\n" +
+			"      service: base\n",
+		"stacks/web/compose.yaml": "services:\n  web:\n    extends:\n      file: /etc/compose.yaml\n      service: web\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(repoDir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deployConfigs := []*config.DeployConfig{
+		{Name: "app", WorkingDirectory: "stacks/app/prod", ComposeFiles: []string{"compose.yaml"}},
+		{Name: "web", WorkingDirectory: "stacks/web", ComposeFiles: []string{"compose.yaml"}},
+	}
+
+	testCases := []struct {
+		name        string
+		filterPaths []string
+		expected    []string
+	}{
+		{"Extended Base File", []string{"stacks/app"}, []string{"common/compose.yaml", "stacks/app/prod/compose.yaml"}},
+		{"Reference Outside Repository", []string{"stacks/web"}, []string{"stacks/web/compose.yaml"}},
+		{"Stack Outside Filter", []string{"common"}, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			paths, err := getReferencedPaths(repoDir, deployConfigs, tc.filterPaths)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if fmt.Sprint(paths) != fmt.Sprint(tc.expected) {
+				t.Errorf("expected paths %v, got %v", tc.expected, paths)
+			}
+		})
+	}
+}
+
+func TestGetTriggeredStacks(t *testing.T) {
+	deployConfigs := []*config.DeployConfig{
+		{Name: "app"},
+		{Name: "network", Triggers: []string{"app", "worker", "missing"}},
+		{Name: "worker"},
+		{Name: "proxy", Triggers: []string{"app"}},
+	}
+
+	triggeredBy := make(map[string]string)
+	deployed := map[string]bool{"app": true, "network": true}
+
+	redeploy := getTriggeredStacks(logger.New(12).Logger, deployConfigs[1], deployConfigs, triggeredBy, deployed)
+
+	if len(redeploy) != 1 || redeploy[0].Name != "app" {
+		t.Fatalf("expected only the deployed stack app to be redeployed, got %v", redeploy)
+	}
+
+	expected := map[string]string{"app": "network", "worker": "network"}
+	if fmt.Sprint(triggeredBy) != fmt.Sprint(expected) {
+		t.Errorf("expected triggered stacks %v, got %v", expected, triggeredBy)
+	}
+
+	// Stacks are redeployed at most once per job
+	if redeploy = getTriggeredStacks(logger.New(12).Logger, deployConfigs[3], deployConfigs, triggeredBy, deployed); len(redeploy) != 0 {
+		t.Errorf("expected app not to be redeployed twice, got %v", redeploy)
+	}
+
+	triggered := getTriggeredDeployConfig(deployConfigs[0])
+	if triggered.RecreateStrategy != config.RecreateForce || deployConfigs[0].RecreateStrategy != "" {
+		t.Errorf("expected only the copy of the deploy config to force recreation, got %s and %s",
+			triggered.RecreateStrategy, deployConfigs[0].RecreateStrategy)
+	}
+}
+
+func TestFilterSemverRange(t *testing.T) {
+	testCases := []struct {
+		ref      string
+		expected []string
+	}{
+		{"refs/tags/v1.4.0", []string{"always", "v1"}},
+		{"refs/tags/v2.1.0", []string{"always"}},
+		{"refs/tags/v1.5.0-rc.1", []string{"always"}},
+		{"refs/tags/nightly", []string{"always"}},
+		{"refs/heads/main", []string{"always"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ref, func(t *testing.T) {
+			deployConfigs := []*config.DeployConfig{
+				{Name: "always", Reference: "refs/heads/main"},
+				{Name: "v1", Reference: "refs/heads/main", ReferenceSemverRange: ">=1.2.0 <2.0.0"},
+			}
+
+			filtered := filterSemverRange(logger.New(12).Logger, deployConfigs, tc.ref)
+
+			var names []string
+			for _, c := range filtered {
+				names = append(names, c.Name)
+			}
+
+			if fmt.Sprint(names) != fmt.Sprint(tc.expected) {
+				t.Fatalf("expected stacks %v, got %v", tc.expected, names)
+			}
+
+			if len(filtered) == 2 && filtered[1].Reference != tc.ref {
+				t.Errorf("expected reference of stack with version range to be %s, got %s", tc.ref, filtered[1].Reference)
+			}
+		})
+	}
+}
+
+func TestGetStackWorktree(t *testing.T) {
+	p := webhook.ParsedPayload{Ref: mainBranch, CommitSHA: validCommitSHA}
+
+	worktrees := map[string]referenceWorktree{
+		mainBranch:           {dir: "/tmp/repo", commitSHA: validCommitSHA},
+		"refs/heads/staging": {dir: "/tmp/repo@heads-staging", commitSHA: "staging"},
+	}
+
+	stackPayload, wt := getStackWorktree(worktrees, p, &config.DeployConfig{Reference: "refs/heads/staging"})
+	if wt.dir != "/tmp/repo@heads-staging" || stackPayload.Ref != "refs/heads/staging" || stackPayload.CommitSHA != "staging" {
+		t.Errorf("expected staging worktree, got %+v and %+v", wt, stackPayload)
+	}
+
+	stackPayload, wt = getStackWorktree(worktrees, p, &config.DeployConfig{Reference: "refs/tags/v1.0.0"})
+	if wt.dir != "/tmp/repo" || stackPayload.Ref != p.Ref || stackPayload.CommitSHA != p.CommitSHA {
+		t.Errorf("expected worktree of the event, got %+v and %+v", wt, stackPayload)
+	}
+}
+
+func TestGetStackGitOptions(t *testing.T) {
+	c := &config.AppConfig{SkipTLSVerification: true}
+
+	skipTLSVerify, proxyURL := getStackGitOptions(c, &config.DeployConfig{})
+	if !skipTLSVerify || proxyURL != "" {
+		t.Errorf("expected settings of the application, got %t and %q", skipTLSVerify, proxyURL)
+	}
+
+	skip := false
+
+	skipTLSVerify, proxyURL = getStackGitOptions(c, &config.DeployConfig{SkipTLSVerification: &skip, GitProxy: "http://proxy:3128"})
+	if skipTLSVerify || proxyURL != "http://proxy:3128" {
+		t.Errorf("expected settings of the deploy config, got %t and %q", skipTLSVerify, proxyURL)
+	}
+}
+
+func TestTriggerAttr(t *testing.T) {
+	attr := triggerAttr(triggerWebhook, webhook.ParsedPayload{Ref: "refs/heads/main", CommitSHA: "abc"})
+
+	expected := "trigger=[source=webhook reference=refs/heads/main commit=abc]"
+	if attr.String() != expected {
+		t.Errorf("expected %s, got %s", expected, attr.String())
+	}
+
+	attr = triggerAttr(triggerImageUpdate, webhook.ParsedPayload{Ref: "refs/heads/main"})
+
+	expected = "trigger=[source=image_update reference=refs/heads/main]"
+	if attr.String() != expected {
+		t.Errorf("expected %s, got %s", expected, attr.String())
+	}
+}
+
+func TestWithDeployTimeout(t *testing.T) {
+	deployConfig := config.DefaultDeployConfig("test")
+
+	ctx, cancel := withDeployTimeout(context.Background(), deployConfig)
+	defer cancel()
+
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("expected no deadline without deploy_timeout")
+	}
+
+	deployConfig.DeployTimeout = "10ms"
+
+	ctx, cancel = withDeployTimeout(context.Background(), deployConfig)
+	defer cancel()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected the context to be canceled after the deploy_timeout")
+	}
+
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Errorf("expected deadline to be exceeded, got %v", ctx.Err())
+	}
+}
+
+func TestGetRollbackResult(t *testing.T) {
+	commit := "0123456789abcdef0123456789abcdef01234567"
+
+	if result := getRollbackResult(commit, nil); result != "rolled back to "+commit {
+		t.Errorf("unexpected result of successful rollback: %s", result)
+	}
+
+	result := getRollbackResult(commit, errors.New("service app is unhealthy"))
+	if result != "rollback to "+commit+" failed: service app is unhealthy" {
+		t.Errorf("unexpected result of failed rollback: %s", result)
+	}
+}
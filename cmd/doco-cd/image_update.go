@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/kimdre/doco-cd/internal/config"
+	"github.com/kimdre/doco-cd/internal/docker"
+	"github.com/kimdre/doco-cd/internal/logger"
+	"github.com/kimdre/doco-cd/internal/prometheus"
+	"github.com/kimdre/doco-cd/internal/webhook"
+)
+
+/*
+checkImageUpdates pulls the images of the stacks deployed by doco-cd and records the services whose image changed.
+If ImageUpdateRedeploy is enabled, the stacks with changed images are redeployed from the repository and reference
+they were deployed from, even if the repository did not change. Stacks that are deployed by the same deployment job
+(same repository, reference and custom target) are only redeployed once.
+The returned error is only set if the deployed stacks could not be listed, errors of single stacks are logged.
+*/
+func (h *handlerData) checkImageUpdates(ctx context.Context) error {
+	stacks, err := docker.GetManagedStacks(ctx, h.dockerCli.Client())
+	if err != nil {
+		h.log.Error("failed to get deployed stacks", logger.ErrAttr(err))
+		return err
+	}
+
+	redeployed := make(map[string]bool)
+
+	for _, stack := range stacks {
+		if len(h.appConfig.ImageUpdateStacks) > 0 && !slices.Contains(h.appConfig.ImageUpdateStacks, stack.Name) {
+			continue
+		}
+
+		stackLog := h.log.With(slog.String("stack", stack.Name))
+
+		updates, err := docker.PullProjectImages(ctx, h.dockerCli, stack.Name)
+		if err != nil {
+			stackLog.Error("failed to pull images of stack", logger.ErrAttr(err))
+			continue
+		}
+
+		digests := make(map[string]string)
+
+		for _, u := range updates {
+			digests[u.Service] = u.Digest
+
+			stackLog.Info("image of service changed", slog.String("service", u.Service),
+				slog.String("image", u.Image), slog.String("digest", u.Digest))
+		}
+
+		prometheus.SetImageUpdates(stack.Name, digests)
+
+		if len(updates) == 0 || !h.appConfig.ImageUpdateRedeploy {
+			continue
+		}
+
+		if h.maintenance.Load() {
+			stackLog.Info("maintenance mode is active, redeployment skipped")
+			continue
+		}
+
+		customTarget := getCustomTarget(stack.ConfigSource)
+
+		job := stack.URL + "@" + stack.Reference + "#" + customTarget
+		if redeployed[job] {
+			continue
+		}
+
+		redeployed[job] = true
+
+		prometheus.ImageUpdateRedeploys.WithLabelValues(stack.Name).Inc()
+
+		if h.redeployStack(ctx, stack, customTarget, triggerImageUpdate) {
+			prometheus.SetImageUpdates(stack.Name, nil)
+		}
+	}
+
+	return nil
+}
+
+// redeployStack redeploys a stack, e.g. with changed images, from the repository and reference it was deployed from
+// and returns whether the deployment was successful, the trigger is the source of the job in the logs
+func (h *handlerData) redeployStack(ctx context.Context, stack docker.ManagedStack, customTarget, trigger string) bool {
+	p := getRedeployPayload(stack)
+
+	jobID := uuid.Must(uuid.NewRandom()).String()
+	jobLog := h.log.With(slog.String("job_id", jobID), triggerAttr(trigger, p))
+
+	done, ok := deployments.start()
+	if !ok {
+		jobLog.Info("application is shutting down, redeployment skipped", slog.String("stack", stack.Name))
+		return false
+	}
+
+	defer done()
+
+	release, err := acquireBackgroundJobSlot(ctx)
+	if err != nil {
+		jobLog.Error("redeployment canceled", slog.String("stack", stack.Name), logger.ErrAttr(err))
+		return false
+	}
+
+	defer release()
+
+	jobLog.Info("redeploying stack", slog.String("stack", stack.Name))
+
+	// The redeployment is not triggered by a request, so its response is only logged
+	rr := newJobRecorder()
+	HandleEvent(ctx, jobLog, rr, h.appConfig, p, customTarget, jobID, trigger, nil, false, h.dockerCli)
+
+	if rr.failed() {
+		jobLog.Error("redeployment failed", slog.String("stack", stack.Name),
+			slog.Int("status", rr.status), slog.String("response", strings.TrimSpace(rr.body.String())))
+
+		return false
+	}
+
+	return true
+}
+
+// getRedeployPayload returns the payload to redeploy a stack from the repository and reference it was deployed from
+func getRedeployPayload(stack docker.ManagedStack) webhook.ParsedPayload {
+	return webhook.ParsedPayload{
+		Ref:      stack.Reference,
+		Name:     path.Base(stack.Repository),
+		FullName: stack.Repository,
+		CloneURL: stack.URL,
+		Private:  stack.Private,
+	}
+}
+
+// getCustomTarget returns the custom target of the deploy config source of a stack, e.g. prod for .doco-cd.prod.yaml#0
+func getCustomTarget(configSource string) string {
+	file, _, _ := strings.Cut(configSource, "#")
+
+	for _, pattern := range config.CustomDeploymentConfigFileNames {
+		prefix, suffix, _ := strings.Cut(pattern, "%s")
+
+		target, ok := strings.CutPrefix(file, prefix)
+		if ok && len(target) > len(suffix) && strings.HasSuffix(target, suffix) {
+			return strings.TrimSuffix(target, suffix)
+		}
+	}
+
+	return ""
+}
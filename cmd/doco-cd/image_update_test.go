@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/kimdre/doco-cd/internal/docker"
+)
+
+func TestGetCustomTarget(t *testing.T) {
+	testCases := []struct {
+		configSource string
+		expected     string
+	}{
+		{".doco-cd.yaml#0", ""},
+		{".doco-cd.yml#1", ""},
+		{"default", ""},
+		{".doco-cd.prod.yaml#0", "prod"},
+		{".doco-cd.staging.yml#2", "staging"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.configSource, func(t *testing.T) {
+			if target := getCustomTarget(tc.configSource); target != tc.expected {
+				t.Errorf("expected custom target %q, got %q", tc.expected, target)
+			}
+		})
+	}
+}
+
+func TestGetRedeployPayload(t *testing.T) {
+	p := getRedeployPayload(docker.ManagedStack{
+		Name:       "test",
+		Repository: "kimdre/doco-cd",
+		URL:        "https://github.com/kimdre/doco-cd.git",
+		Reference:  "refs/heads/main",
+		Private:    true,
+	})
+
+	if p.Name != "doco-cd" || p.FullName != "kimdre/doco-cd" || p.Ref != "refs/heads/main" ||
+		p.CloneURL != "https://github.com/kimdre/doco-cd.git" || !p.Private {
+		t.Errorf("unexpected redeploy payload: %+v", p)
+	}
+}
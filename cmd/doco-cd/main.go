@@ -1,20 +1,29 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/docker/docker/client"
 	"github.com/kimdre/doco-cd/internal/docker"
+	"github.com/kimdre/doco-cd/internal/git"
 
 	"github.com/kimdre/doco-cd/internal/config"
 	"github.com/kimdre/doco-cd/internal/logger"
+	"github.com/kimdre/doco-cd/internal/notification"
+	"github.com/kimdre/doco-cd/internal/prometheus"
 )
 
 const (
 	webhookPath = "/v1/webhook"
 	healthPath  = "/v1/health"
+	apiPath     = "/v1/api"
 )
 
 var (
@@ -41,8 +50,32 @@ func main() {
 	// Set the actual log level
 	log = logger.New(logLevel)
 
+	config.MaxDocumentsPerFile = c.MaxDeployConfigs
+	config.MaxDeployConfigsPerRepository = c.MaxRepositoryDeployConfigs
+	config.DeployConfigOverrides = c.DeployConfigOverrides
+	config.LogFullDeployConfigs = c.LogFullDeployConfigs
+	config.DeployConfigFieldPolicy = config.FieldPolicy{
+		Allowed: c.DeployConfigAllowedFields,
+		Denied:  c.DeployConfigDeniedFields,
+		Mode:    c.DeployConfigFieldPolicy,
+	}
+
 	log.Info("starting application", slog.String("version", Version), slog.String("log_level", c.LogLevel))
 
+	if c.ScratchDir != "" {
+		// Clones, extracted archives and rendered templates are written to the temporary directory
+		err = os.Setenv("TMPDIR", c.ScratchDir)
+		if err != nil {
+			log.Critical("failed to set scratch directory", logger.ErrAttr(err))
+		}
+	}
+
+	err = checkWritable(os.TempDir())
+	if err != nil {
+		log.Critical("scratch directory is not writable, set SCRATCH_DIR to a writable directory",
+			slog.String("path", os.TempDir()), logger.ErrAttr(err))
+	}
+
 	// Test/verify the connection to the docker socket
 	err = docker.VerifySocketConnection()
 	if err != nil {
@@ -67,25 +100,187 @@ func main() {
 
 	log.Debug("docker client created")
 
+	docker.SetMaxConcurrentBuilds(c.MaxConcurrentBuilds)
+	git.SetRetryPolicy(c.GitRetryMaxAttempts, c.GitRetryBaseDelay)
+	git.SetCloneDepth(c.GitCloneDepth)
+	setMaxBackgroundJobs(c.MaxBackgroundJobs)
+	notifyThrottle = notification.NewThrottle(c.NotificationThrottleWindow, c.NotificationThrottleKey)
+	deployGuard = newRedeployGuard(c.RedeployLoopThreshold, c.RedeployLoopWindow)
+
 	h := handlerData{
 		dockerCli: dockerCli,
 		appConfig: c,
 		log:       log,
 	}
 
+	h.maintenance.Store(c.MaintenanceMode)
+
+	if c.RepoCacheDir != "" {
+		h.repoUsage = git.NewCacheUsage(c.RepoCacheDir)
+		usageJob := h.addPeriodicJob("repository_usage", c.RepoCacheUsageInterval)
+
+		go func() {
+			for {
+				usageJob.run(func() error {
+					usage, err := h.repoUsage.Update()
+					if err != nil {
+						log.Warn("failed to compute repository cache usage", logger.ErrAttr(err))
+						return err
+					}
+
+					prometheus.SetRepositoryDiskUsage(usage)
+
+					return nil
+				})
+
+				if c.RepoCacheUsageInterval <= 0 {
+					return
+				}
+
+				time.Sleep(c.RepoCacheUsageInterval)
+			}
+		}()
+	}
+
+	if c.UpdateCheck {
+		updateCheckJob := h.addPeriodicJob("update_check", updateCheckInterval)
+
+		go func() {
+			for {
+				updateCheckJob.run(func() error {
+					info, err := h.versions.update(context.Background(), Version)
+					if err != nil {
+						log.Debug("failed to check for updates", logger.ErrAttr(err))
+						return err
+					}
+
+					if info.UpdateAvailable {
+						log.Warn("a new version of doco-cd is available",
+							slog.String("version", info.Latest), slog.String("release", info.ReleaseURL))
+					}
+
+					return nil
+				})
+
+				time.Sleep(updateCheckInterval)
+			}
+		}()
+	}
+
+	if c.ImageUpdateInterval > 0 {
+		imageUpdateJob := h.addPeriodicJob("image_update", c.ImageUpdateInterval)
+
+		go func() {
+			for {
+				time.Sleep(c.ImageUpdateInterval)
+				imageUpdateJob.run(func() error {
+					return h.checkImageUpdates(context.Background())
+				})
+			}
+		}()
+	}
+
+	watcher := newRegistryWatcher(&h)
+	watcher.job = h.addPeriodicJob("registry_watch", registryWatchTick)
+
+	go watcher.run(context.Background())
+
+	if c.MaintenanceMode {
+		log.Warn("maintenance mode is enabled, deployments will be skipped")
+	}
+
 	http.HandleFunc(webhookPath, h.WebhookHandler)
 	http.HandleFunc(webhookPath+"/{customTarget}", h.WebhookHandler)
+	http.HandleFunc(webhookPath+"/repo/{repoKey}", h.WebhookHandler)
+	http.HandleFunc(webhookPath+"/repo/{repoKey}/{customTarget}", h.WebhookHandler)
 
 	http.HandleFunc(healthPath, h.HealthCheckHandler)
+	http.Handle(prometheus.MetricsPath, prometheus.Handler())
+
+	if c.ApiSecret != "" {
+		http.HandleFunc(apiPath+"/maintenance", h.requireApiKey(h.MaintenanceApiHandler))
+		http.HandleFunc(apiPath+"/deploy", h.requireApiKey(h.DeployApiHandler))
+		http.HandleFunc(apiPath+"/project/{projectName}/diff", h.requireApiKey(h.ProjectDiffApiHandler))
+		http.HandleFunc(apiPath+"/project/{projectName}/logs", h.requireApiKey(h.ProjectLogsApiHandler))
+		http.HandleFunc(apiPath+"/project/{projectName}/scale", h.requireApiKey(h.ProjectScaleApiHandler))
+		http.HandleFunc(apiPath+"/version", h.requireApiKey(h.VersionApiHandler))
+		http.HandleFunc(apiPath+"/export", h.requireApiKey(h.ExportApiHandler))
+		http.HandleFunc(apiPath+"/import", h.requireApiKey(h.ImportApiHandler))
+		http.HandleFunc(apiPath+"/stacks", h.requireApiKey(h.StacksApiHandler))
+		http.HandleFunc(apiPath+"/repositories/usage", h.requireApiKey(h.RepositoryUsageApiHandler))
+	} else {
+		log.Debug("api is disabled, set API_SECRET to enable it")
+	}
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", c.HttpPort),
+		ReadHeaderTimeout: c.HttpReadHeaderTimeout,
+		ReadTimeout:       c.HttpReadTimeout,
+		WriteTimeout:      c.HttpWriteTimeout,
+		IdleTimeout:       c.HttpIdleTimeout,
+	}
 
 	log.Info(
 		"listening for events",
 		slog.Int("http_port", int(c.HttpPort)),
+		slog.Bool("tls", c.TLSCertFile != ""),
 		slog.String("path", webhookPath),
 	)
 
-	err = http.ListenAndServe(fmt.Sprintf(":%d", c.HttpPort), nil)
+	serverErr := make(chan error, 1)
+
+	go func() {
+		if c.TLSCertFile != "" {
+			serverErr <- server.ListenAndServeTLS(c.TLSCertFile, c.TLSKeyFile)
+		} else {
+			serverErr <- server.ListenAndServe()
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err = <-serverErr:
+		log.Error("http server stopped", logger.ErrAttr(err))
+	case <-ctx.Done():
+		shutdown(log, server, c.ShutdownTimeout)
+	}
+}
+
+// shutdown rejects new deployments, waits for the running ones to finish and stops the http server.
+// Deployments that are still running after the timeout are interrupted when the application exits.
+func shutdown(log *logger.Logger, server *http.Server, timeout time.Duration) {
+	log.Info("shutting down, waiting for running deployments to finish", slog.Duration("timeout", timeout))
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := deployments.drain(ctx)
 	if err != nil {
-		return
+		log.Warn("running deployments did not finish before the shutdown timeout", logger.ErrAttr(err))
+	}
+
+	// Shutdown waits for the requests that are still being handled, e.g. responses of finished deployments
+	err = server.Shutdown(ctx)
+	if err != nil {
+		log.Error("failed to stop http server", logger.ErrAttr(err))
+	}
+
+	log.Info("shutdown complete")
+}
+
+// checkWritable checks if files can be created in the directory
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".doco-cd-*")
+	if err != nil {
+		return err
 	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(f.Name())
 }
@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"regexp"
 	"testing"
 
 	"github.com/docker/compose/v2/pkg/api"
@@ -47,7 +48,7 @@ func TestHandleEvent(t *testing.T) {
 				Private:   false,
 			},
 			expectedStatusCode:   http.StatusCreated,
-			expectedResponseBody: `{"details":"deployment successful","job_id":"%s"}`,
+			expectedResponseBody: `{"details":"deployment successful","job_id":"%s","summary":{"[^"]+":"[0-9a-z, ]+"}}`,
 			overrideEnv:          nil,
 			customTarget:         "",
 		},
@@ -62,7 +63,7 @@ func TestHandleEvent(t *testing.T) {
 				Private:   false,
 			},
 			expectedStatusCode:   http.StatusCreated,
-			expectedResponseBody: `{"details":"deployment successful","job_id":"%s"}`,
+			expectedResponseBody: `{"details":"deployment successful","job_id":"%s","summary":{"[^"]+":"[0-9a-z, ]+"}}`,
 			overrideEnv:          nil,
 			customTarget:         "test",
 		},
@@ -77,7 +78,7 @@ func TestHandleEvent(t *testing.T) {
 				Private:   false,
 			},
 			expectedStatusCode:   http.StatusInternalServerError,
-			expectedResponseBody: `{"error":"failed to clone repository","details":"couldn't find remote ref \"` + invalidBranch + `\"","job_id":"%s"}`,
+			expectedResponseBody: `{"error":"failed to clone repository","details":"couldn't find remote ref \\"` + invalidBranch + `\\"","job_id":"%s"}`,
 			overrideEnv:          nil,
 			customTarget:         "",
 		},
@@ -92,7 +93,7 @@ func TestHandleEvent(t *testing.T) {
 				Private:   true,
 			},
 			expectedStatusCode:   http.StatusCreated,
-			expectedResponseBody: `{"details":"deployment successful","job_id":"%s"}`,
+			expectedResponseBody: `{"details":"deployment successful","job_id":"%s","summary":{"[^"]+":"[0-9a-z, ]+"}}`,
 			overrideEnv:          nil,
 			customTarget:         "",
 		},
@@ -197,6 +198,9 @@ func TestHandleEvent(t *testing.T) {
 				tc.payload,
 				tc.customTarget,
 				jobID,
+				triggerWebhook,
+				nil,
+				false,
 				dockerCli,
 			)
 
@@ -205,11 +209,39 @@ func TestHandleEvent(t *testing.T) {
 					status, tc.expectedStatusCode)
 			}
 
-			expectedReturnMessage := fmt.Sprintf(tc.expectedResponseBody, jobID) + "\n"
-			if rr.Body.String() != expectedReturnMessage {
+			// The response body is matched as a pattern, as the summary of deployed stacks depends on their previous state
+			regex, err := regexp.Compile("^" + fmt.Sprintf(tc.expectedResponseBody, jobID) + "\n$")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !regex.MatchString(rr.Body.String()) {
 				t.Errorf("handler returned unexpected body: got '%v' want '%v'",
-					rr.Body.String(), expectedReturnMessage)
+					rr.Body.String(), regex)
 			}
 		})
 	}
 }
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+
+	err := checkWritable(dir)
+	if err != nil {
+		t.Fatalf("expected directory to be writable, got %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("expected test file to be removed, got %v", entries)
+	}
+
+	err = checkWritable(filepath.Join(dir, "missing"))
+	if err == nil {
+		t.Error("expected missing directory not to be writable")
+	}
+}
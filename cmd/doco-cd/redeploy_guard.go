@@ -0,0 +1,81 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// redeployGuard detects stacks that are deployed again and again at the same commit, e.g. because a service writes
+// to a file in the repository that triggers the next deployment, and suppresses their deployments until the commit changes
+type redeployGuard struct {
+	threshold int
+	window    time.Duration
+	now       func() time.Time
+
+	mu     sync.Mutex
+	stacks map[string]*stackDeploys
+}
+
+// stackDeploys are the consecutive successful deployments of a stack at the same commit
+type stackDeploys struct {
+	commit     string
+	count      int       // count is the number of successful deployments at the commit
+	suppressed int       // suppressed is the number of deployments that were suppressed since the loop was detected
+	last       time.Time // last is the time of the last successful deployment
+}
+
+// newRedeployGuard returns a redeployGuard that suppresses the deployments of a stack after threshold successful deployments
+// at the same commit that each followed the previous one within the window, a threshold of 0 disables the guard
+func newRedeployGuard(threshold int, window time.Duration) *redeployGuard {
+	return &redeployGuard{
+		threshold: threshold,
+		window:    window,
+		now:       time.Now,
+		stacks:    make(map[string]*stackDeploys),
+	}
+}
+
+/*
+Allow returns false if the deployment of the stack at the commit has to be suppressed.
+detected is true for the first suppressed deployment of a loop, so that it is only reported once.
+Suppressed deployments do not extend the loop, it ends when the commit changes or the window since the last
+successful deployment has passed.
+*/
+func (g *redeployGuard) Allow(stack, commit string) (allowed, detected bool) {
+	if g == nil || g.threshold <= 0 || commit == "" {
+		return true, false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	d, ok := g.stacks[stack]
+	if !ok || d.commit != commit || g.now().Sub(d.last) > g.window || d.count < g.threshold {
+		return true, false
+	}
+
+	d.suppressed++
+
+	return false, d.suppressed == 1
+}
+
+// Record counts a successful deployment of the stack at the commit
+func (g *redeployGuard) Record(stack, commit string) {
+	if g == nil || g.threshold <= 0 || commit == "" {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+
+	d, ok := g.stacks[stack]
+	if !ok || d.commit != commit || now.Sub(d.last) > g.window {
+		d = &stackDeploys{commit: commit}
+		g.stacks[stack] = d
+	}
+
+	d.count++
+	d.last = now
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRedeployGuard(t *testing.T) {
+	now := time.Now()
+
+	g := newRedeployGuard(3, time.Minute)
+	g.now = func() time.Time { return now }
+
+	for i := range 3 {
+		if allowed, _ := g.Allow("repo/app", "abc"); !allowed {
+			t.Fatalf("expected deployment %d to be allowed", i+1)
+		}
+
+		g.Record("repo/app", "abc")
+
+		now = now.Add(10 * time.Second)
+	}
+
+	allowed, detected := g.Allow("repo/app", "abc")
+	if allowed || !detected {
+		t.Fatalf("expected loop to be detected, got allowed=%t detected=%t", allowed, detected)
+	}
+
+	allowed, detected = g.Allow("repo/app", "abc")
+	if allowed || detected {
+		t.Fatalf("expected deployment to be suppressed without detecting the loop again, got allowed=%t detected=%t", allowed, detected)
+	}
+
+	if allowed, _ = g.Allow("repo/db", "abc"); !allowed {
+		t.Fatal("expected deployment of another stack to be allowed")
+	}
+
+	if allowed, _ = g.Allow("repo/app", "def"); !allowed {
+		t.Fatal("expected deployment of a new commit to be allowed")
+	}
+
+	for range 3 {
+		g.Record("repo/app", "def")
+	}
+
+	if allowed, _ = g.Allow("repo/app", "def"); allowed {
+		t.Fatal("expected deployment to be suppressed")
+	}
+
+	// Suppressed deployments do not extend the window
+	for range 5 {
+		now = now.Add(30 * time.Second)
+		g.Allow("repo/app", "def")
+	}
+
+	if allowed, _ = g.Allow("repo/app", "def"); !allowed {
+		t.Fatal("expected deployment after the window to be allowed")
+	}
+}
+
+func TestRedeployGuard_FailedDeployments(t *testing.T) {
+	g := newRedeployGuard(3, time.Minute)
+
+	// Deployments that are not recorded as successful do not count
+	for range 10 {
+		if allowed, _ := g.Allow("repo/app", "abc"); !allowed {
+			t.Fatal("expected deployment to be allowed")
+		}
+	}
+}
+
+func TestRedeployGuard_Disabled(t *testing.T) {
+	g := newRedeployGuard(0, time.Minute)
+
+	for range 10 {
+		if allowed, _ := g.Allow("repo/app", "abc"); !allowed {
+			t.Fatal("expected deployment to be allowed")
+		}
+
+		g.Record("repo/app", "abc")
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/kimdre/doco-cd/internal/docker"
+	"github.com/kimdre/doco-cd/internal/logger"
+	"github.com/kimdre/doco-cd/internal/prometheus"
+)
+
+// registryWatchTick is the interval in which the watch intervals of the deployed stacks are checked
+const registryWatchTick = time.Minute
+
+// registryWatcher queries the registries for the digests of the image tags of the deployed stacks
+type registryWatcher struct {
+	h           *handlerData
+	job         *periodicJob         // job records the checks for the verbose health check, nil if they are not recorded
+	lastChecked map[string]time.Time // lastChecked maps the stacks to the time their images were last checked
+	lastSeen    map[string]string    // lastSeen maps stack/service to the last digest seen in the registry
+}
+
+func newRegistryWatcher(h *handlerData) *registryWatcher {
+	return &registryWatcher{
+		h:           h,
+		lastChecked: make(map[string]time.Time),
+		lastSeen:    make(map[string]string),
+	}
+}
+
+// run checks the deployed stacks whose watch interval elapsed until the context is canceled
+func (w *registryWatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(registryWatchTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			w.job.run(func() error {
+				return w.check(ctx, now)
+			})
+		}
+	}
+}
+
+/*
+check compares the digests of the image tags in the registries with the images the services of the deployed stacks run
+and redeploys the stacks whose images changed. Each image tag is only queried once per check, and the remaining stacks
+are skipped until the next check if a registry rate limits the requests.
+The returned error is set if the deployed stacks could not be listed or a registry rate limits the requests.
+*/
+func (w *registryWatcher) check(ctx context.Context, now time.Time) error {
+	stacks, err := docker.GetManagedStacks(ctx, w.h.dockerCli.Client())
+	if err != nil {
+		w.h.log.Error("failed to get deployed stacks", logger.ErrAttr(err))
+		return err
+	}
+
+	digests := make(map[string]string)
+	redeployed := make(map[string]bool)
+
+	for _, stack := range stacks {
+		interval := getWatchInterval(stack, w.h.appConfig.RegistryWatchInterval)
+		if interval <= 0 || now.Sub(w.lastChecked[stack.Name]) < interval {
+			continue
+		}
+
+		w.lastChecked[stack.Name] = now
+
+		stackLog := w.h.log.With(slog.String("stack", stack.Name))
+
+		images, err := docker.GetDeployedImages(ctx, w.h.dockerCli.Client(), stack.Name)
+		if err != nil {
+			stackLog.Error("failed to get images of stack", logger.ErrAttr(err))
+			continue
+		}
+
+		updates := make(map[string]string)
+
+		for _, i := range images {
+			if strings.Contains(i.Image, "@") || len(i.RepoDigests) == 0 {
+				// Images pinned to a digest can not change and locally built images are not in a registry
+				continue
+			}
+
+			digest, ok := digests[i.Image]
+			if !ok {
+				digest, err = docker.GetRegistryDigest(ctx, w.h.dockerCli, i.Image)
+				if errors.Is(err, docker.ErrRegistryRateLimited) {
+					stackLog.Warn("registry rate limit exceeded, skipping the remaining stacks until the next check", logger.ErrAttr(err))
+					return err
+				}
+
+				if err != nil {
+					stackLog.Warn("failed to get digest from registry", logger.ErrAttr(err), slog.String("image", i.Image))
+					continue
+				}
+
+				digests[i.Image] = digest
+			}
+
+			if i.HasDigest(digest) {
+				continue
+			}
+
+			updates[i.Service] = digest
+
+			key := stack.Name + "/" + i.Service
+			if w.lastSeen[key] != digest {
+				w.lastSeen[key] = digest
+
+				prometheus.RegistryImageUpdates.WithLabelValues(stack.Name).Inc()
+				stackLog.Info("image of service changed in registry", slog.String("service", i.Service),
+					slog.String("image", i.Image), slog.String("digest", digest))
+			}
+		}
+
+		prometheus.SetImageUpdates(stack.Name, updates)
+
+		if len(updates) == 0 {
+			continue
+		}
+
+		if w.h.maintenance.Load() {
+			stackLog.Info("maintenance mode is active, redeployment skipped")
+			continue
+		}
+
+		customTarget := getCustomTarget(stack.ConfigSource)
+
+		job := stack.URL + "@" + stack.Reference + "#" + customTarget
+		if redeployed[job] {
+			continue
+		}
+
+		redeployed[job] = true
+
+		// Compose only pulls missing images, so the changed tags have to be pulled before the redeployment
+		_, err = docker.PullProjectImages(ctx, w.h.dockerCli, stack.Name)
+		if err != nil {
+			stackLog.Error("failed to pull images of stack", logger.ErrAttr(err))
+			continue
+		}
+
+		prometheus.ImageUpdateRedeploys.WithLabelValues(stack.Name).Inc()
+
+		if w.h.redeployStack(ctx, stack, customTarget, triggerRegistryWatch) {
+			prometheus.SetImageUpdates(stack.Name, nil)
+		}
+	}
+
+	return nil
+}
+
+// getWatchInterval returns the registry watch interval of a stack, which overrides the interval of the application
+func getWatchInterval(stack docker.ManagedStack, defaultInterval time.Duration) time.Duration {
+	if stack.RegistryWatchInterval == "" {
+		return defaultInterval
+	}
+
+	interval, err := time.ParseDuration(stack.RegistryWatchInterval)
+	if err != nil {
+		return defaultInterval
+	}
+
+	return interval
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kimdre/doco-cd/internal/docker"
+)
+
+func TestGetWatchInterval(t *testing.T) {
+	testCases := []struct {
+		name     string
+		interval string
+		expected time.Duration
+	}{
+		{"Default", "", 15 * time.Minute},
+		{"Stack Interval", "1h", time.Hour},
+		{"Disabled", "0s", 0},
+		{"Invalid", "often", 15 * time.Minute},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			interval := getWatchInterval(docker.ManagedStack{RegistryWatchInterval: tc.interval}, 15*time.Minute)
+			if interval != tc.expected {
+				t.Errorf("expected interval %s, got %s", tc.expected, interval)
+			}
+		})
+	}
+}
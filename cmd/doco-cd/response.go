@@ -1,9 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+
+	"github.com/kimdre/doco-cd/internal/docker"
+)
+
+const (
+	responseModeRestful   = "restful"    // responseModeRestful responds with the status code matching the result
+	responseModeAlways200 = "always_200" // responseModeAlways200 always responds with 200 OK and adds the real status code to the response
+	responseModeHeader    = "X-Doco-CD-Response-Mode"
+	statusHeader          = "X-Doco-CD-Status"
 )
 
 type jsonResponse struct {
@@ -56,3 +67,188 @@ func JSONResponse(w http.ResponseWriter, details, jobId string, code int) {
 		return
 	}
 }
+
+// jsonDeployResponse inherits from jsonResponse and adds the summaries of the deployed stacks and the results of dry runs
+type jsonDeployResponse struct {
+	jsonResponse
+	Summary map[string]string         `json:"summary,omitempty"`
+	DryRun  map[string]*docker.DryRun `json:"dry_run,omitempty"`
+}
+
+// JSONDeployResponse writes the result of a deployment job with the summary of each deployed stack
+// (e.g. 2 recreated, 1 started) and the result of each stack with dry run to the client in JSON format
+func JSONDeployResponse(w http.ResponseWriter, details, jobId string, summary map[string]string, dryRuns map[string]*docker.DryRun, code int) {
+	resp := jsonDeployResponse{
+		jsonResponse: jsonResponse{
+			Details: details,
+			JobID:   jobId,
+		},
+		Summary: summary,
+		DryRun:  dryRuns,
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		return
+	}
+}
+
+type jsonMaintenanceResponse struct {
+	Maintenance bool `json:"maintenance"`
+}
+
+// JSONMaintenanceResponse writes the current maintenance mode state to the client in JSON format
+func JSONMaintenanceResponse(w http.ResponseWriter, maintenance bool, code int) {
+	resp := jsonMaintenanceResponse{
+		Maintenance: maintenance,
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		return
+	}
+}
+
+// jsonHealthResponse inherits from jsonResponse and adds the maintenance mode state and the state of the periodic jobs
+type jsonHealthResponse struct {
+	jsonResponse
+	Maintenance bool                `json:"maintenance,omitempty"`
+	Jobs        []periodicJobStatus `json:"jobs,omitempty"`
+}
+
+// JSONHealthResponse writes a health check response to the client in JSON format,
+// jobs is only set for verbose health checks
+func JSONHealthResponse(w http.ResponseWriter, details string, maintenance bool, jobs []periodicJobStatus, code int) {
+	resp := jsonHealthResponse{
+		jsonResponse: jsonResponse{
+			Details: details,
+		},
+		Maintenance: maintenance,
+		Jobs:        jobs,
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		return
+	}
+}
+
+// JSONData writes arbitrary data to the client in JSON format
+func JSONData(w http.ResponseWriter, data interface{}, code int) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		return
+	}
+}
+
+// always200ResponseWriter responds with 200 OK for every status code, for clients that retry
+// webhooks on non-2xx responses. The real status code is sent in the X-Doco-CD-Status header
+// and added to the status field of JSON responses.
+type always200ResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *always200ResponseWriter) WriteHeader(code int) {
+	if w.status != 0 {
+		return
+	}
+
+	w.status = code
+	w.Header().Set(statusHeader, strconv.Itoa(code))
+	w.ResponseWriter.WriteHeader(http.StatusOK)
+}
+
+func (w *always200ResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if !bytes.HasPrefix(b, []byte("{")) {
+		return w.ResponseWriter.Write(b)
+	}
+
+	status := []byte(`{"status":` + strconv.Itoa(w.status))
+	if !bytes.HasPrefix(bytes.TrimSpace(b[1:]), []byte("}")) {
+		status = append(status, ',')
+	}
+
+	_, err := w.ResponseWriter.Write(append(status, b[1:]...))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// getResponseWriter returns a response writer for the response mode of the request, which can be set with the
+// X-Doco-CD-Response-Mode header or the response_mode query parameter and defaults to the configured mode
+func getResponseWriter(w http.ResponseWriter, r *http.Request, defaultMode string) http.ResponseWriter {
+	mode := r.Header.Get(responseModeHeader)
+	if mode == "" {
+		mode = r.URL.Query().Get("response_mode")
+	}
+
+	if mode == "" {
+		mode = defaultMode
+	}
+
+	if mode == responseModeAlways200 {
+		return &always200ResponseWriter{ResponseWriter: w}
+	}
+
+	return w
+}
+
+// jobRecorder records the response of a job that runs in the background without a client waiting for it,
+// so that the result of the job can be logged
+type jobRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newJobRecorder() *jobRecorder {
+	return &jobRecorder{header: make(http.Header)}
+}
+
+func (r *jobRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *jobRecorder) WriteHeader(code int) {
+	if r.status != 0 {
+		return
+	}
+
+	r.status = code
+}
+
+func (r *jobRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+
+	return r.body.Write(b)
+}
+
+// failed checks if the job responded with an error status code
+func (r *jobRecorder) failed() bool {
+	return r.status > 299
+}
@@ -7,6 +7,8 @@ import (
 	"testing"
 
 	"github.com/google/uuid"
+
+	"github.com/kimdre/doco-cd/internal/docker"
 )
 
 func TestJSONResponse(t *testing.T) {
@@ -28,6 +30,51 @@ func TestJSONResponse(t *testing.T) {
 	}
 }
 
+func TestJSONDeployResponse(t *testing.T) {
+	rr := httptest.NewRecorder()
+
+	jobId := uuid.Must(uuid.NewRandom()).String()
+
+	JSONDeployResponse(rr, "deployment successful", jobId, map[string]string{"test": "1 recreated, 2 unchanged"}, nil, http.StatusCreated)
+
+	if rr.Code != http.StatusCreated {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			rr.Code, http.StatusCreated)
+	}
+
+	expectedReturnMessage := fmt.Sprintf(`{"details":"deployment successful","job_id":"%s","summary":{"test":"1 recreated, 2 unchanged"}}%s`, jobId, "\n")
+	if rr.Body.String() != expectedReturnMessage {
+		t.Errorf("handler returned unexpected body: got '%v' want '%v'",
+			rr.Body.String(), expectedReturnMessage)
+	}
+}
+
+func TestJSONDeployResponse_DryRun(t *testing.T) {
+	rr := httptest.NewRecorder()
+
+	jobId := uuid.Must(uuid.NewRandom()).String()
+
+	dryRuns := map[string]*docker.DryRun{
+		"test": {
+			Compose: "name: test\n",
+			Actions: []docker.DryRunAction{{Service: "web", Action: docker.ActionCreate}},
+		},
+	}
+
+	JSONDeployResponse(rr, "dry run successful, no stack was deployed", jobId, map[string]string{}, dryRuns, http.StatusOK)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			rr.Code, http.StatusOK)
+	}
+
+	expectedReturnMessage := fmt.Sprintf(`{"details":"dry run successful, no stack was deployed","job_id":"%s","dry_run":{"test":{"compose":"name: test\n","actions":[{"service":"web","action":"create"}]}}}%s`, jobId, "\n")
+	if rr.Body.String() != expectedReturnMessage {
+		t.Errorf("handler returned unexpected body: got '%v' want '%v'",
+			rr.Body.String(), expectedReturnMessage)
+	}
+}
+
 func TestJSONError(t *testing.T) {
 	rr := httptest.NewRecorder()
 
@@ -46,3 +93,71 @@ func TestJSONError(t *testing.T) {
 			rr.Body.String(), expectedReturnMessage)
 	}
 }
+
+func TestGetResponseWriter(t *testing.T) {
+	testCases := []struct {
+		name               string
+		header             string
+		query              string
+		defaultMode        string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{"Restful", "", "", responseModeRestful, http.StatusUnauthorized, `{"error":"incorrect webhook secret","job_id":"1234"}` + "\n"},
+		{"Default Always 200", "", "", responseModeAlways200, http.StatusOK, `{"status":401,"error":"incorrect webhook secret","job_id":"1234"}` + "\n"},
+		{"Header", responseModeAlways200, "", responseModeRestful, http.StatusOK, `{"status":401,"error":"incorrect webhook secret","job_id":"1234"}` + "\n"},
+		{"Query", "", "?response_mode=always_200", responseModeRestful, http.StatusOK, `{"status":401,"error":"incorrect webhook secret","job_id":"1234"}` + "\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, webhookPath+tc.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.header != "" {
+				req.Header.Set(responseModeHeader, tc.header)
+			}
+
+			rr := httptest.NewRecorder()
+
+			JSONError(getResponseWriter(rr, req, tc.defaultMode), "incorrect webhook secret", "", "1234", http.StatusUnauthorized)
+
+			if rr.Code != tc.expectedStatusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatusCode)
+			}
+
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got '%v' want '%v'", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestJobRecorder(t *testing.T) {
+	rr := newJobRecorder()
+
+	JSONError(rr, "deployment failed", "", "1234", http.StatusInternalServerError)
+
+	if !rr.failed() || rr.status != http.StatusInternalServerError {
+		t.Errorf("expected status %d to be recorded as failed", rr.status)
+	}
+
+	if rr.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Errorf("expected content type header to be recorded, got %s", rr.Header().Get("Content-Type"))
+	}
+
+	expectedBody := `{"error":"deployment failed","job_id":"1234"}` + "\n"
+	if rr.body.String() != expectedBody {
+		t.Errorf("expected body %q, got %q", expectedBody, rr.body.String())
+	}
+
+	rr = newJobRecorder()
+
+	JSONResponse(rr, "deployment started", "1234", http.StatusAccepted)
+
+	if rr.failed() {
+		t.Errorf("expected status %d not to be recorded as failed", rr.status)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// deployments tracks the running deployment jobs, so that the application can wait for them when it shuts down
+var deployments deploymentTracker
+
+// deploymentTracker counts the running deployment jobs and rejects new ones while the application shuts down
+type deploymentTracker struct {
+	mu       sync.Mutex
+	draining bool
+	wg       sync.WaitGroup
+}
+
+// start registers a deployment job and returns the function that marks it as finished,
+// it returns false if the application is shutting down and the job must not be started
+func (t *deploymentTracker) start() (func(), bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.draining {
+		return nil, false
+	}
+
+	t.wg.Add(1)
+
+	return t.wg.Done, true
+}
+
+// isDraining checks if the application is shutting down
+func (t *deploymentTracker) isDraining() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.draining
+}
+
+// drain rejects all new deployment jobs and waits until the running ones have finished or the context is done
+func (t *deploymentTracker) drain(ctx context.Context) error {
+	t.mu.Lock()
+	t.draining = true
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startDeployment registers a deployment job before it waits for a job slot or starts and returns the function that
+// marks it as finished, it responds with 503 Service Unavailable if the application is shutting down
+func startDeployment(jobLog *slog.Logger, w http.ResponseWriter, jobID string) (func(), bool) {
+	done, ok := deployments.start()
+	if !ok {
+		errMsg = "application is shutting down"
+		jobLog.Info(errMsg + ", deployment skipped")
+		JSONError(w, errMsg, "", jobID, http.StatusServiceUnavailable)
+
+		return nil, false
+	}
+
+	return done, true
+}
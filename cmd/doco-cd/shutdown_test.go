@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDeploymentTracker(t *testing.T) {
+	var tracker deploymentTracker
+
+	done, ok := tracker.start()
+	if !ok {
+		t.Fatal("expected deployment to be started")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := tracker.drain(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected drain to time out while a deployment is running, got %v", err)
+	}
+
+	if !tracker.isDraining() {
+		t.Error("expected tracker to be draining")
+	}
+
+	if _, ok = tracker.start(); ok {
+		t.Error("expected new deployments to be rejected while draining")
+	}
+
+	done()
+
+	err = tracker.drain(context.Background())
+	if err != nil {
+		t.Fatalf("expected drain to finish after the deployment, got %v", err)
+	}
+}
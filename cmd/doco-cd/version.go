@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// updateCheckInterval is the time between two checks for a newer release of doco-cd
+const updateCheckInterval = 24 * time.Hour
+
+// latestReleaseURL is the GitHub API endpoint of the latest doco-cd release
+var latestReleaseURL = "https://api.github.com/repos/kimdre/doco-cd/releases/latest"
+
+// versionInfo is the response of the VersionApiHandler
+type versionInfo struct {
+	Current         string `json:"current"`
+	Latest          string `json:"latest"`
+	UpdateAvailable bool   `json:"update_available"`
+	ReleaseURL      string `json:"release_url,omitempty"`
+	Details         string `json:"details,omitempty"` // Details explains why the latest release is unknown, e.g. if the update check is disabled
+}
+
+// versionCache holds the result of the last update check, so that the VersionApiHandler does not query GitHub on every request
+type versionCache struct {
+	mu   sync.Mutex
+	info *versionInfo // info is the result of the last successful check, nil before the first one
+	err  error        // err is the error of the last check, nil if it was successful
+}
+
+// update checks for a newer release and caches the result, the result of a previous check is kept if the check fails
+func (v *versionCache) update(ctx context.Context, current string) (versionInfo, error) {
+	info, err := getVersionInfo(ctx, current)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.err = err
+	if err == nil {
+		v.info = &info
+	}
+
+	return info, err
+}
+
+// get returns the result of the last successful check and the error of the last check
+func (v *versionCache) get() (*versionInfo, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.info, v.err
+}
+
+// getVersionInfo compares the running version with the latest release of doco-cd
+func getVersionInfo(ctx context.Context, current string) (versionInfo, error) {
+	info := versionInfo{Current: current}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return info, err
+	}
+
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return info, fmt.Errorf("failed to get latest release: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return info, fmt.Errorf("failed to get latest release: %s", resp.Status)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+		HtmlURL string `json:"html_url"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&release)
+	if err != nil {
+		return info, fmt.Errorf("failed to decode latest release: %w", err)
+	}
+
+	info.Latest = release.TagName
+	info.ReleaseURL = release.HtmlURL
+	info.UpdateAvailable = isNewerVersion(current, release.TagName)
+
+	return info, nil
+}
+
+// parseVersion parses a version like v1.2.3 or 1.2.3-rc.1 into its numeric major, minor and patch parts
+func parseVersion(version string) ([3]int, bool) {
+	var parts [3]int
+
+	version = strings.TrimPrefix(version, "v")
+	version, _, _ = strings.Cut(version, "-")
+
+	fields := strings.Split(version, ".")
+	if len(fields) != len(parts) {
+		return parts, false
+	}
+
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return parts, false
+		}
+
+		parts[i] = n
+	}
+
+	return parts, true
+}
+
+// isNewerVersion checks if latest is a newer version than current.
+// Development builds without a valid version are never considered outdated.
+func isNewerVersion(current, latest string) bool {
+	c, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+
+	l, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+
+	for i := range c {
+		if l[i] != c[i] {
+			return l[i] > c[i]
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestIsNewerVersion(t *testing.T) {
+	testCases := []struct {
+		current  string
+		latest   string
+		expected bool
+	}{
+		{"v0.10.0", "v0.11.0", true},
+		{"v0.10.0", "v0.10.1", true},
+		{"0.10.0", "v1.0.0", true},
+		{"v0.10.0", "v0.10.0", false},
+		{"v0.11.0", "v0.10.5", false},
+		{"v0.11.0-rc.1", "v0.11.0", false},
+		{"dev", "v0.11.0", false},
+		{"", "v0.11.0", false},
+		{"v0.10.0", "latest", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.current+"->"+tc.latest, func(t *testing.T) {
+			if result := isNewerVersion(tc.current, tc.latest); result != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestGetVersionInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"tag_name":"v0.12.0","html_url":"https://github.com/kimdre/doco-cd/releases/tag/v0.12.0"}`))
+	}))
+	defer server.Close()
+
+	defaultURL := latestReleaseURL
+	latestReleaseURL = server.URL
+
+	t.Cleanup(func() {
+		latestReleaseURL = defaultURL
+	})
+
+	info, err := getVersionInfo(context.Background(), "v0.11.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := versionInfo{
+		Current:         "v0.11.0",
+		Latest:          "v0.12.0",
+		UpdateAvailable: true,
+		ReleaseURL:      "https://github.com/kimdre/doco-cd/releases/tag/v0.12.0",
+	}
+
+	if info != expected {
+		t.Errorf("expected %+v, got %+v", expected, info)
+	}
+}
+
+func TestVersionCache(t *testing.T) {
+	var failing atomic.Bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"tag_name":"v0.12.0","html_url":"https://github.com/kimdre/doco-cd/releases/tag/v0.12.0"}`))
+	}))
+	defer server.Close()
+
+	defaultURL := latestReleaseURL
+	latestReleaseURL = server.URL
+
+	t.Cleanup(func() {
+		latestReleaseURL = defaultURL
+	})
+
+	var cache versionCache
+
+	if info, err := cache.get(); info != nil || err != nil {
+		t.Fatalf("expected no result before the first check, got %+v and %v", info, err)
+	}
+
+	_, err := cache.update(context.Background(), "v0.11.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failing.Store(true)
+
+	_, err = cache.update(context.Background(), "v0.11.0")
+	if err == nil {
+		t.Fatal("expected check to fail")
+	}
+
+	// The result of the previous check is kept if a check fails
+	info, err := cache.get()
+	if err == nil {
+		t.Error("expected error of the last check")
+	}
+
+	if info == nil || info.Latest != "v0.12.0" {
+		t.Errorf("expected previous result to be kept, got %+v", info)
+	}
+}
@@ -0,0 +1,160 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDownloadFailed = errors.New("failed to download archive")
+	ErrInvalidArchive = errors.New("invalid archive")
+	ErrIllegalPath    = errors.New("archive entry escapes the target directory")
+)
+
+// downloadTimeout is the maximum time to download and extract an archive
+const downloadTimeout = 10 * time.Minute
+
+// supportedExtensions are the file extensions of archives that can be deployed
+var supportedExtensions = []string{".tar.gz", ".tgz"}
+
+// IsArchiveURL checks if the URL points to a supported archive instead of a git repository
+func IsArchiveURL(url string) bool {
+	// Ignore query parameters, e.g. signed download URLs
+	url, _, _ = strings.Cut(url, "?")
+
+	for _, ext := range supportedExtensions {
+		if strings.HasSuffix(strings.ToLower(url), ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Download downloads a tar.gz archive from the given URL and extracts it to a new temporary directory.
+// It returns the path to the directory and the sha256 checksum of the archive,
+// which is used in place of the commit SHA.
+func Download(ctx context.Context, name, url string, headers map[string]string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrDownloadFailed, err)
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{Timeout: downloadTimeout}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrDownloadFailed, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("%w: unexpected status code %d", ErrDownloadFailed, resp.StatusCode)
+	}
+
+	// Every download gets a new directory, so no files of a previous download or a concurrent job remain
+	parent := filepath.Join(os.TempDir(), filepath.Dir(name))
+
+	err = os.MkdirAll(parent, os.ModePerm)
+	if err != nil {
+		return "", "", err
+	}
+
+	path, err := os.MkdirTemp(parent, filepath.Base(name)+"-*")
+	if err != nil {
+		return "", "", err
+	}
+
+	hash := sha256.New()
+
+	err = extract(io.TeeReader(resp.Body, hash), path)
+	if err != nil {
+		_ = os.RemoveAll(path)
+		return "", "", err
+	}
+
+	return path, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// extract extracts a gzip compressed tar stream to the target directory
+func extract(r io.Reader, target string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+
+		dest := filepath.Join(target, header.Name) // #nosec G305 -- checked below
+		if dest != target && !strings.HasPrefix(dest, target+string(os.PathSeparator)) {
+			return fmt.Errorf("%w: %s", ErrIllegalPath, header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(dest, os.ModePerm)
+			if err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			err = writeFile(tr, dest, header.FileInfo().Mode().Perm())
+			if err != nil {
+				return err
+			}
+		default:
+			// Links and special files are not supported
+			continue
+		}
+	}
+
+	// Read the remaining data so that the checksum covers the whole archive
+	_, err = io.Copy(io.Discard, r)
+
+	return err
+}
+
+func writeFile(r io.Reader, dest string, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(dest), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	_, err = io.Copy(f, r) // #nosec G110 -- the archive source is trusted like a git repository
+
+	return err
+}
@@ -0,0 +1,184 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const testToken = "Bearer test"
+
+func createArchive(t *testing.T, files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+
+	for name, content := range files {
+		err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0o600,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = tw.Write([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestIsArchiveURL(t *testing.T) {
+	testCases := []struct {
+		url      string
+		expected bool
+	}{
+		{"https://example.com/artifact.tar.gz", true},
+		{"https://example.com/artifact.TGZ", true},
+		{"https://example.com/artifact.tar.gz?token=abc", true},
+		{"https://github.com/kimdre/doco-cd.git", false},
+		{"https://github.com/kimdre/doco-cd", false},
+	}
+
+	for _, tc := range testCases {
+		if got := IsArchiveURL(tc.url); got != tc.expected {
+			t.Errorf("expected IsArchiveURL(%s) to be %v, got %v", tc.url, tc.expected, got)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	composeContents := "services:\n  test:\n    image: nginx:latest\n"
+
+	data := createArchive(t, map[string]string{
+		"compose.yaml":   composeContents,
+		"nested/.env":    "TZ=Europe/Berlin\n",
+		"../outside.txt": "should never be written",
+	})
+
+	validData := createArchive(t, map[string]string{
+		"compose.yaml": composeContents,
+		"nested/.env":  "TZ=Europe/Berlin\n",
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/valid.tar.gz":
+			_, _ = w.Write(validData)
+		case "/traversal.tar.gz":
+			_, _ = w.Write(data)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	headers := map[string]string{"Authorization": testToken}
+
+	t.Run("Valid Archive", func(t *testing.T) {
+		dir, checksum, err := Download(context.Background(), uuid.New().String(), server.URL+"/valid.tar.gz", headers)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() {
+			err = os.RemoveAll(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		sum := sha256.Sum256(validData)
+		if checksum != hex.EncodeToString(sum[:]) {
+			t.Errorf("expected checksum to be %s, got %s", hex.EncodeToString(sum[:]), checksum)
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, "compose.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(content) != composeContents {
+			t.Errorf("expected file content to be %q, got %q", composeContents, string(content))
+		}
+
+		if _, err = os.Stat(filepath.Join(dir, "nested", ".env")); err != nil {
+			t.Errorf("expected nested file to exist: %v", err)
+		}
+	})
+
+	t.Run("New Directory", func(t *testing.T) {
+		name := uuid.New().String()
+
+		first, _, err := Download(context.Background(), name, server.URL+"/valid.tar.gz", headers)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { _ = os.RemoveAll(first) })
+
+		// A file of a previous download must not show up in the next one
+		err = os.WriteFile(filepath.Join(first, "stale.yaml"), []byte("stale"), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		second, _, err := Download(context.Background(), name, server.URL+"/valid.tar.gz", headers)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { _ = os.RemoveAll(second) })
+
+		if first == second {
+			t.Fatalf("expected downloads to use different directories, got %s", first)
+		}
+
+		if _, err = os.Stat(filepath.Join(second, "stale.yaml")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected stale file not to exist, got %v", err)
+		}
+	})
+
+	t.Run("Path Traversal", func(t *testing.T) {
+		_, _, err := Download(context.Background(), uuid.New().String(), server.URL+"/traversal.tar.gz", headers)
+		if !errors.Is(err, ErrIllegalPath) {
+			t.Fatalf("expected error to be %v, got %v", ErrIllegalPath, err)
+		}
+	})
+
+	t.Run("Missing Auth Header", func(t *testing.T) {
+		_, _, err := Download(context.Background(), uuid.New().String(), server.URL+"/valid.tar.gz", nil)
+		if !errors.Is(err, ErrDownloadFailed) {
+			t.Fatalf("expected error to be %v, got %v", ErrDownloadFailed, err)
+		}
+	})
+}
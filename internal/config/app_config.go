@@ -2,24 +2,131 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v11"
+	"github.com/docker/go-units"
 	"gopkg.in/validator.v2"
+
+	"github.com/kimdre/doco-cd/internal/notification"
+)
+
+const (
+	ResourceChecksOff     = "off"     // ResourceChecksOff disables the resource checks
+	ResourceChecksWarn    = "warn"    // ResourceChecksWarn logs a warning if a check fails
+	ResourceChecksEnforce = "enforce" // ResourceChecksEnforce refuses the deployment if a check fails
+)
+
+const (
+	NotifyOnAll         = "all"          // NotifyOnAll sends a notification for every deployment
+	NotifyOnFirstDeploy = "first_deploy" // NotifyOnFirstDeploy only sends a notification for the first deployment of a stack and for failures
+	NotifyOnFailure     = "failure"      // NotifyOnFailure only sends a notification for failed deployments
+)
+
+const (
+	MissingTargetError    = "error"     // MissingTargetError fails the webhook request
+	MissingTargetNotFound = "not_found" // MissingTargetNotFound responds with 404 Not Found
+	MissingTargetIgnore   = "ignore"    // MissingTargetIgnore responds with 204 No Content
 )
 
+// ByteSize is an amount of bytes that can be parsed from a human-readable string like 512m or 4g
+type ByteSize int64
+
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	size, err := units.RAMInBytes(string(text))
+	if err != nil {
+		return err
+	}
+
+	*b = ByteSize(size)
+
+	return nil
+}
+
+// NotifyChannels are notification channels that can be parsed from a JSON array
+type NotifyChannels = notification.Channels
+
 // AppConfig is used to configure this application
 type AppConfig struct {
-	LogLevel            string `env:"LOG_LEVEL,required" envDefault:"info"`                          // LogLevel is the log level for the application
-	HttpPort            uint16 `env:"HTTP_PORT,required" envDefault:"80" validate:"min=1,max=65535"` // HttpPort is the port the HTTP server will listen on
-	WebhookSecret       string `env:"WEBHOOK_SECRET,required"`                                       // WebhookSecret is the secret used to authenticate the webhook
-	GitAccessToken      string `env:"GIT_ACCESS_TOKEN"`                                              // GitAccessToken is the access token used to authenticate with the Git server (e.g. GitHub) for private repositories
-	AuthType            string `env:"AUTH_TYPE" envDefault:"oauth2"`                                 // AuthType is the type of authentication to use when cloning repositories
-	SkipTLSVerification bool   `env:"SKIP_TLS_VERIFICATION" envDefault:"false"`                      // SkipTLSVerification skips the TLS verification when cloning repositories.
-	DockerQuietDeploy   bool   `env:"DOCKER_QUIET_DEPLOY" envDefault:"true"`                         // DockerQuietDeploy suppresses the status output of dockerCli in deployments (e.g. pull, create, start)
+	LogLevel                   string            `env:"LOG_LEVEL,required" envDefault:"info"`                                                  // LogLevel is the log level for the application
+	LogFullDeployConfigs       bool              `env:"LOG_FULL_DEPLOY_CONFIGS" envDefault:"false"`                                            // LogFullDeployConfigs logs deploy configs in debug logs without redacting secret references and build args and without truncating large lists
+	HttpPort                   uint16            `env:"HTTP_PORT,required" envDefault:"80" validate:"min=1,max=65535"`                         // HttpPort is the port the HTTP server will listen on
+	WebhookSecret              string            `env:"WEBHOOK_SECRET,required"`                                                               // WebhookSecret is the secret used to authenticate the webhook
+	GitAccessToken             string            `env:"GIT_ACCESS_TOKEN"`                                                                      // GitAccessToken is the access token used to authenticate with the Git server (e.g. GitHub) for private repositories
+	AuthType                   string            `env:"AUTH_TYPE" envDefault:"oauth2"`                                                         // AuthType is the type of authentication to use when cloning repositories
+	GitHeaders                 map[string]string `env:"GIT_HEADERS"`                                                                           // GitHeaders are additional HTTP headers (e.g. X-Tenant-Id:team-a) sent with all requests to the Git server when cloning repositories
+	CloneLayout                string            `env:"CLONE_LAYOUT" envDefault:"name" validate:"regexp=^(name|host|hash)$"`                   // CloneLayout is the directory layout repositories are cloned to, one of name (e.g. kimdre/doco-cd), host (e.g. github.com/kimdre/doco-cd) or hash (hash of the clone URL)
+	RepoCacheDir               string            `env:"REPO_CACHE_DIR"`                                                                        // RepoCacheDir is a directory (e.g. on a shared volume) that repositories are cached in instead of cloning them for each deployment, it can be shared between multiple instances
+	RepoCacheReadOnly          bool              `env:"REPO_CACHE_READ_ONLY" envDefault:"false"`                                               // RepoCacheReadOnly uses the checkouts in RepoCacheDir without updating them (e.g. a read-only volume that is updated by another instance), repositories that are not cached at the deployed commit are cloned to the ScratchDir
+	ScratchDir                 string            `env:"SCRATCH_DIR"`                                                                           // ScratchDir is the writable directory that repositories are cloned, archives extracted and templates rendered to, defaults to the temporary directory of the system (e.g. a small tmpfs if the data volume is read-only)
+	RepoCacheQuota             ByteSize          `env:"REPO_CACHE_QUOTA" envDefault:"0"`                                                       // RepoCacheQuota is the maximum disk space (e.g. 500m) that the checkouts of a repository may use in RepoCacheDir before its deployments are refused, 0 means unlimited
+	RepoCacheUsageInterval     time.Duration     `env:"REPO_CACHE_USAGE_INTERVAL" envDefault:"5m"`                                             // RepoCacheUsageInterval is the interval in which the disk usage of the repositories in RepoCacheDir is computed, 0 computes it only once at startup
+	DeployConfigOverrides      map[string]string `env:"DEPLOY_CONFIG_OVERRIDES" envSeparator:";"`                                              // DeployConfigOverrides override deploy config fields of all stacks with YAML values (e.g. prune_images:false;build_opts.no_cache:true), they take precedence over the deploy configs in the repositories
+	DeployConfigAllowedFields  []string          `env:"DEPLOY_CONFIG_ALLOWED_FIELDS"`                                                          // DeployConfigAllowedFields are the only deploy config fields (e.g. reference,compose_files,build_opts.args) that repositories can set, all fields are allowed if empty
+	DeployConfigDeniedFields   []string          `env:"DEPLOY_CONFIG_DENIED_FIELDS"`                                                           // DeployConfigDeniedFields are deploy config fields (e.g. build_opts,external_secrets) that repositories can not set
+	DeployConfigFieldPolicy    string            `env:"DEPLOY_CONFIG_FIELD_POLICY" envDefault:"reject" validate:"regexp=^(reject|strip)$"`     // DeployConfigFieldPolicy is the action for deploy configs that set fields that are not allowed, reject (fail the deployment) or strip (remove the fields with a warning)
+	MissingTargetPolicy        string            `env:"MISSING_TARGET_POLICY" envDefault:"error" validate:"regexp=^(error|not_found|ignore)$"` // MissingTargetPolicy is the response if a repository has no deploy config for the custom target of a webhook, one of error (500), not_found (404) or ignore (204)
+	WebhookResponseMode        string            `env:"WEBHOOK_RESPONSE_MODE" envDefault:"restful" validate:"regexp=^(restful|always_200)$"`   // WebhookResponseMode is the default response mode of webhooks, restful (status codes matching the result) or always_200 (for clients that retry on other status codes)
+	SecretProvider             string            `env:"SECRET_PROVIDER"`                                                                       // SecretProvider is the external secret provider that deploy configs can reference secrets in, currently only vault is supported
+	VaultAddr                  string            `env:"VAULT_ADDR"`                                                                            // VaultAddr is the address of the Vault (or OpenBao) server, e.g. https://vault.example.com:8200
+	VaultToken                 string            `env:"VAULT_TOKEN"`                                                                           // VaultToken is the token used to authenticate with Vault
+	SecretProviderTimeout      time.Duration     `env:"SECRET_PROVIDER_TIMEOUT" envDefault:"10s"`                                              // SecretProviderTimeout is the time allowed for each attempt to get a secret from the secret provider
+	SecretProviderRetries      int               `env:"SECRET_PROVIDER_RETRIES" envDefault:"3" validate:"min=0"`                               // SecretProviderRetries is the number of retries if the secret provider is not reachable or returns a transient error
+	SkipTLSVerification        bool              `env:"SKIP_TLS_VERIFICATION" envDefault:"false"`                                              // SkipTLSVerification skips the TLS verification when cloning repositories.
+	GitRetryMaxAttempts        int               `env:"GIT_RETRY_MAX_ATTEMPTS" envDefault:"3" validate:"min=1"`                                // GitRetryMaxAttempts is the number of attempts to clone or fetch a repository if the git server is not reachable or returns a temporary error, 1 disables retries
+	GitRetryBaseDelay          time.Duration     `env:"GIT_RETRY_BASE_DELAY" envDefault:"1s"`                                                  // GitRetryBaseDelay is the delay before the first retry of a clone or fetch, it doubles with each further retry and is randomized
+	GitCloneDepth              int               `env:"GIT_CLONE_DEPTH" envDefault:"1" validate:"min=0"`                                       // GitCloneDepth is the number of commits fetched when a repository is cloned, 0 clones the complete history. Change detection uses the changed files of the webhook payload, so a shallow clone does not affect it
+	DockerQuietDeploy          bool              `env:"DOCKER_QUIET_DEPLOY" envDefault:"true"`                                                 // DockerQuietDeploy suppresses the status output of dockerCli in deployments (e.g. pull, create, start)
+	MaxParallelBuilds          int               `env:"MAX_PARALLEL_BUILDS" envDefault:"1" validate:"min=1"`                                   // MaxParallelBuilds is the number of stacks of a deployment job whose images are built at the same time before the stacks are deployed one after another, 1 builds each stack during its deployment
+	MaxConcurrentBuilds        int               `env:"MAX_CONCURRENT_BUILDS" envDefault:"2" validate:"min=1"`                                 // MaxConcurrentBuilds is the number of image builds that run at the same time across all deployment jobs, further builds wait while pulling images and starting containers of other stacks continues
+	MaxBackgroundJobs          int               `env:"MAX_BACKGROUND_JOBS" envDefault:"2" validate:"min=1"`                                   // MaxBackgroundJobs is the number of deployment jobs without a waiting client (image update and registry watch redeployments, deploy API requests with wait=false) that run at the same time, further jobs queue up
+	ApiSecret                  string            `env:"API_SECRET"`                                                                            // ApiSecret is the secret used to authenticate requests to the REST API, the API is disabled if it is not set
+	MaintenanceMode            bool              `env:"MAINTENANCE_MODE" envDefault:"false"`                                                   // MaintenanceMode skips all deployments until it is disabled again via the API
+	UpdateCheck                bool              `env:"UPDATE_CHECK" envDefault:"true"`                                                        // UpdateCheck checks for a newer release of doco-cd on startup and once a day, logs a warning if one is available and reports the result in the version API
+	ArchiveHeaders             map[string]string `env:"ARCHIVE_HEADERS"`                                                                       // ArchiveHeaders are additional HTTP headers (e.g. Authorization:Bearer <token>) sent when downloading archives instead of cloning a repository
+	HttpReadHeaderTimeout      time.Duration     `env:"HTTP_READ_HEADER_TIMEOUT" envDefault:"3s"`                                              // HttpReadHeaderTimeout is the time allowed to read the request headers
+	HttpReadTimeout            time.Duration     `env:"HTTP_READ_TIMEOUT" envDefault:"30s"`                                                    // HttpReadTimeout is the time allowed to read the entire request, including the body
+	HttpWriteTimeout           time.Duration     `env:"HTTP_WRITE_TIMEOUT" envDefault:"0s"`                                                    // HttpWriteTimeout is the time allowed to write the response, 0 disables it since deployments respond after they have finished
+	HttpIdleTimeout            time.Duration     `env:"HTTP_IDLE_TIMEOUT" envDefault:"120s"`                                                   // HttpIdleTimeout is the time to keep idle keep-alive connections open
+	ShutdownTimeout            time.Duration     `env:"SHUTDOWN_TIMEOUT" envDefault:"5m"`                                                      // ShutdownTimeout is the time running deployments get to finish after SIGTERM or SIGINT before the application exits, the stop timeout of the container has to be longer
+	TLSCertFile                string            `env:"TLS_CERT_FILE"`                                                                         // TLSCertFile is the path to the TLS certificate, the HTTP server uses TLS if it is set together with TLSKeyFile
+	TLSKeyFile                 string            `env:"TLS_KEY_FILE"`                                                                          // TLSKeyFile is the path to the private key of the TLS certificate
+	NotificationURL            string            `env:"NOTIFICATION_URL"`                                                                      // NotificationURL is the endpoint that receives deployment notifications as JSON POST requests
+	NotificationSecret         string            `env:"NOTIFICATION_SECRET"`                                                                   // NotificationSecret is used to sign the notifications with HMAC-SHA256, the signature is sent in the X-Doco-CD-Signature-256 header
+	NotificationChannels       NotifyChannels    `env:"NOTIFICATION_CHANNELS"`                                                                 // NotificationChannels are the channels that deployment notifications are delivered to as a JSON array (e.g. [{"type":"slack","url":"..."},{"type":"ntfy","url":"...","token":"..."}]), a NotificationURL is added as a webhook channel
+	NotifyOn                   string            `env:"NOTIFY_ON" envDefault:"all" validate:"regexp=^(all|first_deploy|failure)$"`             // NotifyOn controls which deployments send a notification, one of all, first_deploy (first deployment of a stack and failures) or failure
+	NotifyOnStart              bool              `env:"NOTIFY_ON_START" envDefault:"false"`                                                    // NotifyOnStart sends an additional notification when the deployment of a stack starts, e.g. to know that a stack with a long build is being deployed
+	NotificationThrottleWindow time.Duration     `env:"NOTIFICATION_THROTTLE_WINDOW" envDefault:"15m"`                                         // NotificationThrottleWindow is the time in which repeated failure notifications of a stack are coalesced into one "still failing" notification, 0 sends every failure
+	NotificationThrottleKey    string            `env:"NOTIFICATION_THROTTLE_KEY" envDefault:"error" validate:"regexp=^(error|stack)$"`        // NotificationThrottleKey controls which failures are coalesced, error (failures of a stack with the same message) or stack (all failures of a stack)
+	RedeployLoopThreshold      int               `env:"REDEPLOY_LOOP_THRESHOLD" envDefault:"0" validate:"min=0"`                               // RedeployLoopThreshold is the number of consecutive successful webhook or image triggered deployments of a stack at the same commit after which further deployments of the commit are suppressed, e.g. if a service writes to a file that triggers the next deployment, 0 (default) disables the detection
+	RedeployLoopWindow         time.Duration     `env:"REDEPLOY_LOOP_WINDOW" envDefault:"10m"`                                                 // RedeployLoopWindow is the time in which the next deployment of a stack at the same commit counts as consecutive, the suppression ends when the commit changes or the window since the last successful deployment has passed
+	CommitStatusProviders      []string          `env:"COMMIT_STATUS_PROVIDERS"`                                                               // CommitStatusProviders are the git providers (github, gitea, gitlab) that deployment results are reported to as commit statuses using the GitAccessToken, disabled if empty
+	MaxDeployConfigs           int               `env:"MAX_DEPLOY_CONFIGS" envDefault:"100" validate:"min=1"`                                  // MaxDeployConfigs is the maximum number of deploy configs (YAML documents) a deploy config file may contain
+	MaxRepositoryDeployConfigs int               `env:"MAX_REPOSITORY_DEPLOY_CONFIGS" envDefault:"500" validate:"min=1"`                       // MaxRepositoryDeployConfigs is the maximum number of deploy configs a repository may contain in total, including the stacks found by auto discovery
+	RepoWebhookSecrets         map[string]string `env:"REPO_WEBHOOK_SECRETS"`                                                                  // RepoWebhookSecrets maps repository keys to their own webhook secret (e.g. team-a:secret1,team-b:secret2), used by the /v1/webhook/repo/{repoKey} endpoints
+	RepoWebhookTargets         map[string]string `env:"REPO_WEBHOOK_TARGETS"`                                                                  // RepoWebhookTargets maps repository keys to the custom target used if the webhook request does not specify one
+	ResourceChecks             string            `env:"RESOURCE_CHECKS" envDefault:"off" validate:"regexp=^(off|warn|enforce)$"`               // ResourceChecks validates the resource reservations and deploy options of stacks before deploying, one of off, warn or enforce
+	ResourceBudgetCPUs         float64           `env:"RESOURCE_BUDGET_CPUS" envDefault:"0" validate:"min=0"`                                  // ResourceBudgetCPUs is the maximum number of CPUs that the services of a stack may reserve in total, 0 means unlimited
+	ResourceBudgetMemory       ByteSize          `env:"RESOURCE_BUDGET_MEMORY" envDefault:"0"`                                                 // ResourceBudgetMemory is the maximum amount of memory (e.g. 4g) that the services of a stack may reserve in total, 0 means unlimited
+	DeploymentPlanDir          string            `env:"DEPLOYMENT_PLAN_DIR"`                                                                   // DeploymentPlanDir is the directory the plan of each deployment is written to as a JSON file, disabled if empty
+	DockerReconnectTimeout     time.Duration     `env:"DOCKER_RECONNECT_TIMEOUT" envDefault:"60s"`                                             // DockerReconnectTimeout is the time to wait for the docker daemon to come back if the connection is lost during a deployment
+	NetworkDriverOpts          map[string]string `env:"NETWORK_DRIVER_OPTS"`                                                                   // NetworkDriverOpts are the default driver options (e.g. com.docker.network.driver.mtu:1400) of the networks created for stacks, networks with driver options in the compose files keep their own options
+	ImageUpdateInterval        time.Duration     `env:"IMAGE_UPDATE_INTERVAL" envDefault:"0s"`                                                 // ImageUpdateInterval is the interval in which the images of the deployed stacks are pulled to detect changed image tags (e.g. latest), 0 disables it
+	ImageUpdateStacks          []string          `env:"IMAGE_UPDATE_STACKS"`                                                                   // ImageUpdateStacks are the names of the stacks whose images are pulled, all stacks deployed by doco-cd if empty
+	ImageUpdateRedeploy        bool              `env:"IMAGE_UPDATE_REDEPLOY" envDefault:"false"`                                              // ImageUpdateRedeploy redeploys stacks from their repository and reference if the image of a service changed
+	RegistryWatchInterval      time.Duration     `env:"REGISTRY_WATCH_INTERVAL" envDefault:"0s"`                                               // RegistryWatchInterval is the interval in which the registries are queried for the digests of the image tags of the deployed stacks, stacks with changed images are redeployed, 0 disables it for stacks without a registry_watch_interval
 }
 
-var ErrInvalidLogLevel = validator.TextErr{Err: errors.New("invalid log level, must be one of debug, info, warn, error")}
+var (
+	ErrInvalidLogLevel             = validator.TextErr{Err: errors.New("invalid log level, must be one of debug, info, warn, error")}
+	ErrInvalidTLSConfig            = errors.New("invalid tls config, TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	ErrInvalidRepoWebhookConfig    = errors.New("invalid repository webhook config")
+	ErrInvalidSecretProvider       = errors.New("invalid secret provider, must be one of: vault")
+	ErrInvalidCommitStatusProvider = errors.New("invalid commit status provider, must be one of: github, gitea, gitlab")
+)
 
 // GetAppConfig returns the configuration
 func GetAppConfig() (*AppConfig, error) {
@@ -33,6 +140,44 @@ func GetAppConfig() (*AppConfig, error) {
 		return nil, ErrInvalidLogLevel
 	}
 
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, ErrInvalidTLSConfig
+	}
+
+	for key, secret := range cfg.RepoWebhookSecrets {
+		if secret == "" {
+			return nil, fmt.Errorf("%w: secret for repository key %s is empty", ErrInvalidRepoWebhookConfig, key)
+		}
+	}
+
+	for key := range cfg.RepoWebhookTargets {
+		if _, ok := cfg.RepoWebhookSecrets[key]; !ok {
+			return nil, fmt.Errorf("%w: repository key %s in REPO_WEBHOOK_TARGETS has no secret in REPO_WEBHOOK_SECRETS", ErrInvalidRepoWebhookConfig, key)
+		}
+	}
+
+	if cfg.SecretProvider != "" && cfg.SecretProvider != "vault" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSecretProvider, cfg.SecretProvider)
+	}
+
+	for _, provider := range cfg.CommitStatusProviders {
+		if !slices.Contains([]string{"github", "gitea", "gitlab"}, provider) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCommitStatusProvider, provider)
+		}
+	}
+
+	if cfg.NotificationURL != "" {
+		cfg.NotificationChannels = append(cfg.NotificationChannels, notification.Channel{
+			Type:   notification.ChannelWebhook,
+			URL:    cfg.NotificationURL,
+			Secret: cfg.NotificationSecret,
+		})
+	}
+
+	if err := validateOverrides(cfg.DeployConfigOverrides); err != nil {
+		return nil, err
+	}
+
 	if err := validator.Validate(cfg); err != nil {
 		return nil, err
 	}
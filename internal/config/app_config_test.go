@@ -33,6 +33,26 @@ func TestGetAppConfig(t *testing.T) {
 			},
 			expectedErr: ErrInvalidLogLevel,
 		},
+		{
+			name: "tls cert without key",
+			envVars: map[string]string{
+				"LOG_LEVEL":      "info",
+				"WEBHOOK_SECRET": "secret",
+				"TLS_CERT_FILE":  "/certs/doco-cd.crt",
+			},
+			expectedErr: ErrInvalidTLSConfig,
+		},
+		{
+			name: "repo webhook target without secret",
+			envVars: map[string]string{
+				"LOG_LEVEL":            "info",
+				"WEBHOOK_SECRET":       "secret",
+				"TLS_CERT_FILE":        "",
+				"REPO_WEBHOOK_SECRETS": "team-a:secret1",
+				"REPO_WEBHOOK_TARGETS": "team-b:staging",
+			},
+			expectedErr: ErrInvalidRepoWebhookConfig,
+		},
 	}
 
 	for _, tt := range tests {
@@ -61,3 +81,21 @@ func TestGetAppConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestByteSize_UnmarshalText(t *testing.T) {
+	var b ByteSize
+
+	err := b.UnmarshalText([]byte("512m"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b != 512*1024*1024 {
+		t.Errorf("expected 536870912 bytes, got %d", b)
+	}
+
+	err = b.UnmarshalText([]byte("lots"))
+	if err == nil {
+		t.Error("expected error for invalid size")
+	}
+}
@@ -3,11 +3,20 @@ package config
 import (
 	"errors"
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"gopkg.in/validator.v2"
 
+	"github.com/kimdre/doco-cd/internal/semver"
+
 	"github.com/compose-spec/compose-go/v2/cli"
 )
 
@@ -19,19 +28,119 @@ var (
 	ErrInvalidConfig                    = errors.New("invalid deploy configuration")
 	ErrKeyNotFound                      = errors.New("key not found")
 	ErrDeprecatedConfig                 = errors.New("configuration file name is deprecated, please use .doco-cd.y(a)ml instead")
+	ErrTooManyDeployConfigs             = errors.New("too many deploy configs in repository")
+)
+
+// MaxDeployConfigsPerRepository is the maximum number of deploy configs (stacks) of a repository after auto discovery,
+// which can add a stack for every directory of the repository on top of the documents of the deploy config file
+var MaxDeployConfigsPerRepository = 500
+
+const (
+	RecreateDiverged = "diverged" // RecreateDiverged recreates containers whose configuration or image changed
+	RecreateForce    = "force"    // RecreateForce recreates all containers, even if they did not change
+	RecreateNever    = "never"    // RecreateNever keeps running containers as they are and only creates missing ones
+)
+
+/*
+The precedence of the .env file in the project directory relative to the env_files of a stack. Env files that are loaded
+later override the values of the ones loaded before.
+*/
+const (
+	DotEnvIgnore = "ignore" // DotEnvIgnore never loads the .env file, not even without env_files
+	DotEnvLower  = "lower"  // DotEnvLower loads the .env file before the env_files, so that they override its values
+	DotEnvHigher = "higher" // DotEnvHigher loads the .env file after the env_files, so that its values override theirs
 )
 
+const (
+	NoContainerStart  = "start"  // NoContainerStart starts the stopped containers of the services that are not one-shot services
+	NoContainerIgnore = "ignore" // NoContainerIgnore treats the deployment as successful without starting containers
+	NoContainerFail   = "fail"   // NoContainerFail fails the deployment
+)
+
+// ComposeEnvironmentVariables are the environment variables that compose_environment can set, they change how docker compose
+// builds and deploys a stack (e.g. DOCKER_BUILDKIT=1 or COMPOSE_BAKE=true) and are not added to the environment of the containers
+var ComposeEnvironmentVariables = []string{
+	"BUILDKIT_PROGRESS",       // BUILDKIT_PROGRESS sets the progress output of BuildKit builds, e.g. plain
+	"BUILDX_BUILDER",          // BUILDX_BUILDER selects the buildx builder instance that builds the images
+	"COMPOSE_BAKE",            // COMPOSE_BAKE builds the images with buildx bake
+	"COMPOSE_PARALLEL_LIMIT",  // COMPOSE_PARALLEL_LIMIT limits the number of parallel operations, e.g. image builds
+	"DOCKER_BUILDKIT",         // DOCKER_BUILDKIT enables (1) or disables (0) BuildKit
+	"DOCKER_DEFAULT_PLATFORM", // DOCKER_DEFAULT_PLATFORM is the platform of images without a platform in the compose file, e.g. linux/amd64
+}
+
+// reservedLabelPrefixes are the label prefixes used by doco-cd and docker compose that custom labels can not use
+var reservedLabelPrefixes = []string{"cd.doco.", "com.docker.compose."}
+
+var bindMountOwnerPattern = regexp.MustCompile(`^\d+(:\d+)?$`)
+
+// envVarNamePattern matches the names of variables that can be interpolated in compose files
+var envVarNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// RegistryAuth are the credentials of a registry that the images of a stack are pulled from and built with
+type RegistryAuth struct {
+	Registry       string `yaml:"registry"`        // Registry is the host of the registry, e.g. ghcr.io or docker.io for Docker Hub
+	Username       string `yaml:"username"`        // Username is the user that logs in to the registry
+	Password       string `yaml:"password"`        // Password is the password or access token of the user
+	PasswordSecret string `yaml:"password_secret"` // PasswordSecret is a reference in the external secret provider that the password is read from instead, e.g. secret/data/ghcr#token
+}
+
 // DeployConfig is the structure of the deployment configuration file
 type DeployConfig struct {
-	Name             string   `yaml:"name"`                                                                                                         // Name is the name of the docker-compose deployment / stack
-	Reference        string   `yaml:"reference" default:"refs/heads/main"`                                                                          // Reference is the Git reference to the deployment, e.g. refs/heads/main or refs/tags/v1.0.0
-	WorkingDirectory string   `yaml:"working_dir" default:"."`                                                                                      // WorkingDirectory is the working directory for the deployment
-	ComposeFiles     []string `yaml:"compose_files" default:"[\"compose.yaml\", \"compose.yml\", \"docker-compose.yml\", \"docker-compose.yaml\"]"` // ComposeFiles is the list of docker-compose files to use
-	RemoveOrphans    bool     `yaml:"remove_orphans" default:"true"`                                                                                // RemoveOrphans removes containers for services not defined in the Compose file
-	ForceRecreate    bool     `yaml:"force_recreate" default:"false"`                                                                               // ForceRecreate forces the recreation/redeployment of containers even if the configuration has not changed
-	ForceImagePull   bool     `yaml:"force_image_pull" default:"false"`                                                                             // ForceImagePull always pulls the latest version of the image tags you've specified if a newer version is available
-	Timeout          int      `yaml:"timeout" default:"180"`                                                                                        // Timeout is the time in seconds to wait for the deployment to finish in seconds before timing out
-	BuildOpts        struct {
+	ConfigVersion               int               `yaml:"config_version" default:"1"`                                                                                   // ConfigVersion is the version of the deploy config format, older versions are migrated to the current one
+	Name                        string            `yaml:"name"`                                                                                                         // Name is the name of the docker-compose deployment / stack
+	Reference                   string            `yaml:"reference" default:"refs/heads/main"`                                                                          // Reference is the Git reference to the deployment, e.g. refs/heads/main or refs/tags/v1.0.0
+	ReferenceSemverRange        string            `yaml:"reference_semver_range"`                                                                                       // ReferenceSemverRange (e.g. >=1.2.0 <2.0.0) only deploys the stack on pushes of tags with a version in the range and deploys the pushed tag instead of the reference
+	WorkingDirectory            string            `yaml:"working_dir" default:"."`                                                                                      // WorkingDirectory is the working directory for the deployment
+	ProjectDirectory            string            `yaml:"project_dir"`                                                                                                  // ProjectDirectory is the directory relative paths in the compose files (e.g. bind mounts) are resolved against, defaults to the working directory
+	ContextRoot                 string            `yaml:"context_root"`                                                                                                 // ContextRoot is the directory (relative to the repository root) that the compose files and the files they reference with include and extends must be inside, defaults to the repository root
+	AutoDiscover                bool              `yaml:"auto_discover" default:"false"`                                                                                // AutoDiscover additionally deploys each subdirectory of the working directory that contains a compose file as its own stack named <name>-<subdirectory>
+	ComposeFiles                []string          `yaml:"compose_files" default:"[\"compose.yaml\", \"compose.yml\", \"docker-compose.yml\", \"docker-compose.yaml\"]"` // ComposeFiles is the list of docker-compose files to use, glob patterns like compose.*.yaml are expanded in sorted order
+	EnvFiles                    []string          `yaml:"env_files"`                                                                                                    // EnvFiles are the env files (relative to the working directory) used to interpolate the compose files instead of the .env file in the project directory
+	DotEnvPrecedence            string            `yaml:"dot_env_precedence"`                                                                                           // DotEnvPrecedence is the precedence of the .env file relative to the env_files (ignore, lower or higher), by default the .env file is only loaded if no env_files are set
+	RemoveOrphans               bool              `yaml:"remove_orphans" default:"true"`                                                                                // RemoveOrphans removes containers for services not defined in the Compose file
+	ForceRecreate               bool              `yaml:"force_recreate" default:"false"`                                                                               // ForceRecreate forces the recreation/redeployment of containers even if the configuration has not changed
+	RecreateStrategy            string            `yaml:"recreate_strategy"`                                                                                            // RecreateStrategy controls which containers of the services are recreated, one of diverged (default), force or never, it takes precedence over force_recreate
+	RecreateDependencies        string            `yaml:"recreate_dependencies"`                                                                                        // RecreateDependencies controls which containers of the dependencies of the services are recreated, one of diverged, force or never, defaults to the recreate strategy
+	ForceImagePull              bool              `yaml:"force_image_pull" default:"false"`                                                                             // ForceImagePull always pulls the latest version of the image tags you've specified if a newer version is available
+	Timeout                     int               `yaml:"timeout" default:"180"`                                                                                        // Timeout is the time in seconds to wait for the containers of the deployment to start and become healthy, see deploy_timeout for a limit of the whole deployment
+	DeployTimeout               string            `yaml:"deploy_timeout"`                                                                                               // DeployTimeout is the maximum duration (e.g. 30m) of the whole deployment of the stack including pulls and builds, the deployment is canceled if it takes longer, no limit if empty
+	RollbackOnFailure           bool              `yaml:"rollback_on_failure" default:"false"`                                                                          // RollbackOnFailure deploys the commit the stack was deployed from before again if its deployment fails, e.g. because a service did not get healthy
+	StopGracePeriod             string            `yaml:"stop_grace_period"`                                                                                            // StopGracePeriod is the time (e.g. 2m) to wait for containers to stop before they are killed when they get recreated, overrides the stop_grace_period of the services
+	CheckPortConflicts          bool              `yaml:"check_port_conflicts" default:"false"`                                                                         // CheckPortConflicts checks if the published host ports are already used by other stacks before deploying
+	CreateExternalNetworks      bool              `yaml:"create_external_networks" default:"false"`                                                                     // CreateExternalNetworks creates the external networks of the stack if they don't exist instead of failing the deployment
+	CheckBindMounts             bool              `yaml:"check_bind_mounts" default:"false"`                                                                            // CheckBindMounts checks if the source paths of bind mounts exist before deploying, they have to be accessible at the same path as on the docker host
+	CreateBindMountDirs         bool              `yaml:"create_bind_mount_dirs" default:"false"`                                                                       // CreateBindMountDirs creates missing bind mount sources as directories instead of failing the deployment, requires check_bind_mounts
+	RecreateOnMountedFileChange bool              `yaml:"recreate_on_mounted_file_change" default:"true"`                                                               // RecreateOnMountedFileChange recreates the containers of a service if a single-file bind mount in the repository changed, disable it if the service reloads the file at runtime
+	BindMountOwner              string            `yaml:"bind_mount_owner"`                                                                                             // BindMountOwner is the owner (uid[:gid]) of the bind mount directories created by create_bind_mount_dirs
+	PruneImages                 bool              `yaml:"prune_images" default:"false"`                                                                                 // PruneImages removes the images that were used by the stack before the deployment, images still used by other stacks are never removed
+	PruneBuildCache             bool              `yaml:"prune_build_cache" default:"false"`                                                                            // PruneBuildCache removes the dangling build cache after deployments of stacks that build images
+	BuildCacheMaxAge            string            `yaml:"build_cache_max_age"`                                                                                          // BuildCacheMaxAge only prunes build cache that is older than this duration (e.g. 24h)
+	BuildCacheKeepStorage       ByteSize          `yaml:"build_cache_keep_storage"`                                                                                     // BuildCacheKeepStorage is the amount of build cache (e.g. 5g) that is kept when pruning
+	Scale                       map[string]int    `yaml:"scale"`                                                                                                        // Scale is a map of service names to the number of replicas (containers) to run of the service
+	Profiles                    []string          `yaml:"profiles"`                                                                                                     // Profiles are the compose profiles to activate, if not set the profiles of the currently deployed stack are kept
+	FailOnNoServices            bool              `yaml:"fail_on_no_services" default:"false"`                                                                          // FailOnNoServices fails the deployment if no service of the stack is active, e.g. because all services have profiles that are not activated, instead of only warning about it
+	NoContainerToStart          string            `yaml:"no_container_to_start"`                                                                                        // NoContainerToStart is the behavior if docker compose reports that there is no container to start, one of start (default), ignore or fail
+	RequirePinnedImages         bool              `yaml:"require_pinned_images" default:"false"`                                                                        // RequirePinnedImages fails the deployment if the image of a service is not pinned to a sha256 digest, e.g. nginx:1.27@sha256:..., services that build their image are skipped
+	DryRun                      bool              `yaml:"dry_run" default:"false"`                                                                                      // DryRun renders the compose project and the actions the deployment would take without deploying the stack, e.g. to validate the interpolation and secret resolution
+	Labels                      map[string]string `yaml:"labels"`                                                                                                       // Labels are custom labels added to all containers and volumes of the stack, labels in the compose files take precedence
+	EnableTemplating            bool              `yaml:"enable_templating" default:"false"`                                                                            // EnableTemplating renders the compose files as Go templates before loading them
+	AllowedAuthors              []string          `yaml:"allowed_authors"`                                                                                              // AllowedAuthors is a list of email patterns (e.g. *@example.com), the author or committer of the deployed commit must match one of them
+	ExternalSecrets             map[string]string `yaml:"external_secrets"`                                                                                             // ExternalSecrets maps compose secrets to references in the external secret provider (e.g. db_password: secret/data/app#password), their content replaces the source of the secret in the compose file
+	ExternalEnv                 map[string]string `yaml:"external_env"`                                                                                                 // ExternalEnv maps variables for the interpolation of the compose files to references in the external secret provider (e.g. DB_PASSWORD: secret/data/app#password), they take precedence over env files
+	RegistryAuth                []RegistryAuth    `yaml:"registry_auth"`                                                                                                // RegistryAuth are the credentials of private registries used to pull and build the images of the stack, they take precedence over the docker login of the host
+	NotifyOn                    string            `yaml:"notify_on"`                                                                                                    // NotifyOn overrides the NOTIFY_ON setting of the application for this stack, one of all, first_deploy or failure
+	DeployURL                   string            `yaml:"deploy_url"`                                                                                                   // DeployURL is the URL of the deployed stack, it is linked in the commit statuses of the deployment
+	RegistryWatchInterval       string            `yaml:"registry_watch_interval"`                                                                                      // RegistryWatchInterval overrides REGISTRY_WATCH_INTERVAL of the application for the stack, e.g. 1h, or disables watching the registries for it with 0s
+	SkipTLSVerification         *bool             `yaml:"skip_tls_verification"`                                                                                        // SkipTLSVerification overrides SKIP_TLS_VERIFICATION of the application for the git operations of the stack, e.g. cloning its reference
+	GitProxy                    string            `yaml:"git_proxy"`                                                                                                    // GitProxy is the proxy URL (http, https or socks5) used for the git operations of the stack, defaults to the proxy of the environment (HTTP_PROXY, HTTPS_PROXY and NO_PROXY)
+	ComposeEnvironment          map[string]string `yaml:"compose_environment"`                                                                                          // ComposeEnvironment sets environment variables for docker compose while it builds and deploys the stack, see ComposeEnvironmentVariables for the supported ones
+	Triggers                    []string          `yaml:"triggers"`                                                                                                     // Triggers are the names of other stacks of the deploy configs that are redeployed with recreated containers after this stack was deployed with changes, e.g. because it provides a network they use
+	ConfigFile                  string            `yaml:"-"`                                                                                                            // ConfigFile is the deploy config file in the repository the config was read from, empty for the default config
+	ConfigDocument              int               `yaml:"-"`                                                                                                            // ConfigDocument is the index of the YAML document in the ConfigFile
+	MigrationNotices            []string          `yaml:"-"`                                                                                                            // MigrationNotices lists the deprecations that were migrated when the config was loaded
+	StrippedFields              []string          `yaml:"-"`                                                                                                            // StrippedFields are the fields that were removed from the config because the field policy does not allow them
+	Prebuilt                    bool              `yaml:"-"`                                                                                                            // Prebuilt is set if the images of the stack were already built in the parallel build phase of the deployment job
+	BuildOpts                   struct {
 		ForceImagePull bool              `yaml:"force_image_pull" default:"false"` // ForceImagePull always attempt to pull a newer version of the image
 		Quiet          bool              `yaml:"quiet" default:"false"`            // Quiet suppresses the build output
 		Args           map[string]string `yaml:"args"`                             // BuildArgs is a map of build-time arguments to pass to the build process
@@ -39,6 +148,96 @@ type DeployConfig struct {
 	} `yaml:"build_opts"` // BuildOpts is the build options for the deployment
 }
 
+// Source returns the deploy config file and document the config was read from, e.g. .doco-cd.yaml#1
+func (c *DeployConfig) Source() string {
+	if c.ConfigFile == "" {
+		return "default"
+	}
+
+	return fmt.Sprintf("%s#%d", c.ConfigFile, c.ConfigDocument)
+}
+
+// LogFullDeployConfigs disables the redaction and truncation of deploy configs in the logs
+var LogFullDeployConfigs bool
+
+// maxLogItems is the number of items of lists and maps in deploy configs that are logged
+const maxLogItems = 20
+
+const redacted = "[redacted]"
+
+// LogValue implements slog.LogValuer to log deploy configs without the references to external secrets,
+// the values of build args, the registry passwords and the password of the git proxy, which can contain credentials, and with large lists and maps truncated
+func (c *DeployConfig) LogValue() slog.Value {
+	if LogFullDeployConfigs {
+		return slog.AnyValue((*plainDeployConfig)(c))
+	}
+
+	logged := *c
+	logged.ComposeFiles = truncateList(c.ComposeFiles)
+	logged.Profiles = truncateList(c.Profiles)
+	logged.AllowedAuthors = truncateList(c.AllowedAuthors)
+	logged.Labels = truncateMap(c.Labels, false)
+	logged.ExternalSecrets = truncateMap(c.ExternalSecrets, true)
+	logged.ExternalEnv = truncateMap(c.ExternalEnv, true)
+	logged.BuildOpts.Args = truncateMap(c.BuildOpts.Args, true)
+
+	if len(c.RegistryAuth) > 0 {
+		logged.RegistryAuth = make([]RegistryAuth, len(c.RegistryAuth))
+		for i, auth := range c.RegistryAuth {
+			if auth.Password != "" {
+				auth.Password = redacted
+			}
+
+			logged.RegistryAuth[i] = auth
+		}
+	}
+
+	if u, err := url.Parse(c.GitProxy); err == nil {
+		logged.GitProxy = u.Redacted()
+	}
+
+	return slog.AnyValue((*plainDeployConfig)(&logged))
+}
+
+// truncateList returns the first maxLogItems items of a list and the number of omitted items
+func truncateList(list []string) []string {
+	if len(list) <= maxLogItems {
+		return list
+	}
+
+	return append(slices.Clone(list[:maxLogItems]), fmt.Sprintf("... %d more", len(list)-maxLogItems))
+}
+
+// truncateMap returns a copy of the first maxLogItems keys of a map and optionally redacts the values
+func truncateMap(m map[string]string, redact bool) map[string]string {
+	if m == nil {
+		return nil
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	truncated := make(map[string]string, min(len(keys), maxLogItems+1))
+
+	for i, k := range keys {
+		if i == maxLogItems {
+			truncated["..."] = fmt.Sprintf("%d more", len(keys)-maxLogItems)
+			break
+		}
+
+		truncated[k] = m[k]
+		if redact {
+			truncated[k] = redacted
+		}
+	}
+
+	return truncated
+}
+
 // DefaultDeployConfig creates a DeployConfig with default values
 func DefaultDeployConfig(name string) *DeployConfig {
 	return &DeployConfig{
@@ -46,6 +245,8 @@ func DefaultDeployConfig(name string) *DeployConfig {
 		Reference:        "/ref/heads/main",
 		WorkingDirectory: ".",
 		ComposeFiles:     cli.DefaultFileNames,
+
+		RecreateOnMountedFileChange: true,
 	}
 }
 
@@ -66,6 +267,127 @@ func (c *DeployConfig) validateConfig() error {
 		return fmt.Errorf("%w: compose_files", ErrKeyNotFound)
 	}
 
+	for _, f := range c.ComposeFiles {
+		if _, err := filepath.Match(f, ""); err != nil {
+			return fmt.Errorf("invalid compose_files pattern %s: %w", f, err)
+		}
+	}
+
+	switch c.NotifyOn {
+	case "", NotifyOnAll, NotifyOnFirstDeploy, NotifyOnFailure:
+	default:
+		return fmt.Errorf("notify_on must be one of %s, %s or %s", NotifyOnAll, NotifyOnFirstDeploy, NotifyOnFailure)
+	}
+
+	switch c.NoContainerToStart {
+	case "", NoContainerStart, NoContainerIgnore, NoContainerFail:
+	default:
+		return fmt.Errorf("no_container_to_start must be one of %s, %s or %s", NoContainerStart, NoContainerIgnore, NoContainerFail)
+	}
+
+	switch c.DotEnvPrecedence {
+	case "", DotEnvIgnore, DotEnvLower, DotEnvHigher:
+	default:
+		return fmt.Errorf("dot_env_precedence must be one of %s, %s or %s", DotEnvIgnore, DotEnvLower, DotEnvHigher)
+	}
+
+	for _, strategy := range [][2]string{{"recreate_strategy", c.RecreateStrategy}, {"recreate_dependencies", c.RecreateDependencies}} {
+		switch strategy[1] {
+		case "", RecreateDiverged, RecreateForce, RecreateNever:
+		default:
+			return fmt.Errorf("%s must be one of %s, %s or %s", strategy[0], RecreateDiverged, RecreateForce, RecreateNever)
+		}
+	}
+
+	if c.DeployURL != "" {
+		if u, err := url.Parse(c.DeployURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("deploy_url must be an absolute http(s) URL, got %s", c.DeployURL)
+		}
+	}
+
+	if c.GitProxy != "" {
+		if u, err := url.Parse(c.GitProxy); err != nil || !slices.Contains([]string{"http", "https", "socks5"}, u.Scheme) || u.Host == "" {
+			return fmt.Errorf("git_proxy must be an http(s) or socks5 URL, got %s", c.GitProxy)
+		}
+	}
+
+	if c.RegistryWatchInterval != "" {
+		if d, err := time.ParseDuration(c.RegistryWatchInterval); err != nil || d < 0 {
+			return fmt.Errorf("registry_watch_interval must be a positive duration, got %s", c.RegistryWatchInterval)
+		}
+	}
+
+	for k := range c.ComposeEnvironment {
+		if !slices.Contains(ComposeEnvironmentVariables, k) {
+			return fmt.Errorf("compose_environment does not support %s, supported are %s", k, strings.Join(ComposeEnvironmentVariables, ", "))
+		}
+	}
+
+	for k := range c.ExternalEnv {
+		if !envVarNamePattern.MatchString(k) {
+			return fmt.Errorf("external_env contains an invalid variable name: %s", k)
+		}
+	}
+
+	var registries []string
+
+	for _, auth := range c.RegistryAuth {
+		switch {
+		case auth.Registry == "" || strings.ContainsAny(auth.Registry, "/@"):
+			return fmt.Errorf("registry_auth needs the host of the registry without scheme or path, got %q", auth.Registry)
+		case slices.Contains(registries, auth.Registry):
+			return fmt.Errorf("registry_auth contains the registry %s more than once", auth.Registry)
+		case auth.Username == "":
+			return fmt.Errorf("registry_auth for %s needs a username", auth.Registry)
+		case (auth.Password == "") == (auth.PasswordSecret == ""):
+			return fmt.Errorf("registry_auth for %s needs either a password or a password_secret", auth.Registry)
+		}
+
+		registries = append(registries, auth.Registry)
+	}
+
+	if c.DeployTimeout != "" {
+		if d, err := time.ParseDuration(c.DeployTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("deploy_timeout must be a positive duration, got %s", c.DeployTimeout)
+		}
+	}
+
+	if c.StopGracePeriod != "" {
+		if _, err := time.ParseDuration(c.StopGracePeriod); err != nil {
+			return fmt.Errorf("invalid stop_grace_period: %w", err)
+		}
+	}
+
+	if c.BuildCacheMaxAge != "" {
+		if _, err := time.ParseDuration(c.BuildCacheMaxAge); err != nil {
+			return fmt.Errorf("invalid build_cache_max_age: %w", err)
+		}
+	}
+
+	if c.BindMountOwner != "" && !bindMountOwnerPattern.MatchString(c.BindMountOwner) {
+		return fmt.Errorf("bind_mount_owner must be a numeric uid[:gid], got %s", c.BindMountOwner)
+	}
+
+	if c.ReferenceSemverRange != "" {
+		if _, err := semver.ParseRange(c.ReferenceSemverRange); err != nil {
+			return fmt.Errorf("invalid reference_semver_range: %w", err)
+		}
+	}
+
+	for label := range c.Labels {
+		for _, prefix := range reservedLabelPrefixes {
+			if strings.HasPrefix(label, prefix) {
+				return fmt.Errorf("label %s uses the reserved prefix %s", label, prefix)
+			}
+		}
+	}
+
+	for service, replicas := range c.Scale {
+		if replicas < 0 {
+			return fmt.Errorf("scale of service %s must not be negative", service)
+		}
+	}
+
 	return nil
 }
 
@@ -100,12 +422,34 @@ func GetDeployConfigs(repoDir, name, customTarget string) ([]*DeployConfig, erro
 
 		if configs != nil {
 			if err = validator.Validate(configs); err != nil {
+				return nil, fmt.Errorf("%w in %s: %v", ErrInvalidConfig, configFile, err)
+			}
+
+			configs, err = expandAutoDiscovery(repoDir, configs)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(configs) > MaxDeployConfigsPerRepository {
+				return nil, fmt.Errorf("%w: found %d, limit is %d", ErrTooManyDeployConfigs, len(configs), MaxDeployConfigsPerRepository)
+			}
+
+			if err = expandComposeFiles(repoDir, configs); err != nil {
+				return nil, err
+			}
+
+			if err = validateTriggers(configs); err != nil {
 				return nil, err
 			}
 
 			// Check if the config file name is deprecated
 			for _, deprecatedConfigFile := range DeprecatedDeploymentConfigFileNames {
 				if configFile == deprecatedConfigFile {
+					for _, c := range configs {
+						c.MigrationNotices = append(c.MigrationNotices,
+							fmt.Sprintf("config file name %s is deprecated, use %s instead", configFile, DefaultDeploymentConfigFileNames[0]))
+					}
+
 					return configs, fmt.Errorf("%w: %s", ErrDeprecatedConfig, configFile)
 				}
 			}
@@ -118,7 +462,126 @@ func GetDeployConfigs(repoDir, name, customTarget string) ([]*DeployConfig, erro
 		return nil, ErrConfigFileNotFound
 	}
 
-	return []*DeployConfig{DefaultDeployConfig(name)}, nil
+	c := DefaultDeployConfig(name)
+	if err = c.applyOverrides(DeployConfigOverrides); err != nil {
+		return nil, err
+	}
+
+	return []*DeployConfig{c}, nil
+}
+
+// isComposeFilePattern checks if a compose file of a deploy config is a glob pattern, e.g. compose.*.yaml
+func isComposeFilePattern(file string) bool {
+	return strings.ContainsAny(file, "*?[")
+}
+
+/*
+expandComposeFiles replaces the glob patterns in the compose files of the deploy configs with the files they match in the
+working directory of the stack. The matches of a pattern are sorted, so that the compose files are always merged in the
+same order, and files that are already in the list are not added again. Patterns that match no files and matches that
+are outside the working directory are rejected.
+*/
+func expandComposeFiles(repoDir string, configs []*DeployConfig) error {
+	for _, c := range configs {
+		if !slices.ContainsFunc(c.ComposeFiles, isComposeFilePattern) {
+			continue
+		}
+
+		workingDir := filepath.Join(repoDir, c.WorkingDirectory)
+		files := make([]string, 0, len(c.ComposeFiles))
+
+		for _, f := range c.ComposeFiles {
+			if !isComposeFilePattern(f) {
+				if !slices.Contains(files, f) {
+					files = append(files, f)
+				}
+
+				continue
+			}
+
+			matches, err := filepath.Glob(filepath.Join(workingDir, f))
+			if err != nil {
+				return fmt.Errorf("%w in %s: invalid compose_files pattern %s: %v", ErrInvalidConfig, c.Source(), f, err)
+			}
+
+			if len(matches) == 0 {
+				return fmt.Errorf("%w in %s: compose_files pattern %s matches no files in %s", ErrInvalidConfig, c.Source(), f, c.WorkingDirectory)
+			}
+
+			slices.Sort(matches)
+
+			for _, m := range matches {
+				rel, err := filepath.Rel(workingDir, m)
+				if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+					return fmt.Errorf("%w in %s: compose_files pattern %s matches %s outside of the working directory", ErrInvalidConfig, c.Source(), f, rel)
+				}
+
+				if !slices.Contains(files, rel) {
+					files = append(files, rel)
+				}
+			}
+		}
+
+		c.ComposeFiles = files
+	}
+
+	return nil
+}
+
+// validateTriggers checks that the triggers of the deploy configs name other stacks of the configs and do not form a cycle
+func validateTriggers(configs []*DeployConfig) error {
+	byName := make(map[string]*DeployConfig, len(configs))
+	for _, c := range configs {
+		byName[c.Name] = c
+	}
+
+	for _, c := range configs {
+		for _, name := range c.Triggers {
+			if _, ok := byName[name]; !ok {
+				return fmt.Errorf("%w in %s: triggers unknown stack %s", ErrInvalidConfig, c.Source(), name)
+			}
+		}
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := make(map[string]int, len(configs))
+
+	var visit func(c *DeployConfig, path []string) error
+
+	visit = func(c *DeployConfig, path []string) error {
+		switch state[c.Name] {
+		case visited:
+			return nil
+		case visiting:
+			cycle := append(path[slices.Index(path, c.Name):], c.Name)
+
+			return fmt.Errorf("%w in %s: triggers form a cycle: %s", ErrInvalidConfig, c.Source(), strings.Join(cycle, " -> "))
+		}
+
+		state[c.Name] = visiting
+
+		for _, name := range c.Triggers {
+			if err := visit(byName[name], append(path, c.Name)); err != nil {
+				return err
+			}
+		}
+
+		state[c.Name] = visited
+
+		return nil
+	}
+
+	for _, c := range configs {
+		if err := visit(c, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // getDeployConfigsFromFile returns the deployment configurations from the repository or nil if not found
@@ -132,14 +595,29 @@ func getDeployConfigsFromFile(dir string, files []os.DirEntry, configFile string
 			// Get contents of deploy config file
 			configs, err := FromYAML(path.Join(dir, f.Name()))
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("%w in %s: %w", ErrInvalidConfig, configFile, err)
 			}
 
+			names := make(map[string]string)
+
 			// Validate all deploy configs
-			for _, c := range configs {
+			for i, c := range configs {
+				c.ConfigFile = configFile
+				c.ConfigDocument = i
+
+				if err = c.applyOverrides(DeployConfigOverrides); err != nil {
+					return nil, err
+				}
+
 				if err = c.validateConfig(); err != nil {
-					return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+					return nil, fmt.Errorf("%w in %s: %v", ErrInvalidConfig, c.Source(), err)
 				}
+
+				if source, ok := names[c.Name]; ok {
+					return nil, fmt.Errorf("%w in %s: name %s is already used in %s", ErrInvalidConfig, c.Source(), c.Name, source)
+				}
+
+				names[c.Name] = c.Source()
 			}
 
 			if configs != nil {
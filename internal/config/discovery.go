@@ -0,0 +1,218 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var invalidProjectNameChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// hasComposeFile checks if at least one of the compose files exists in the directory
+func hasComposeFile(dir string, composeFiles []string) bool {
+	for _, f := range composeFiles {
+		if isComposeFilePattern(f) {
+			if matches, err := filepath.Glob(path.Join(dir, f)); err == nil && len(matches) > 0 {
+				return true
+			}
+
+			continue
+		}
+
+		if info, err := os.Stat(path.Join(dir, f)); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// uniqueName returns the name or the name with a numeric suffix if it is already taken
+func uniqueName(name string, taken []string) string {
+	unique := name
+
+	for i := 2; slices.Contains(taken, unique); i++ {
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+
+	return unique
+}
+
+/*
+applyLocalConfig replaces the fields of a discovered stack with the fields that are set in the deploy config file with the
+same name as the file of the stack in its working directory, e.g. app/.doco-cd.yaml, and returns the names of the fields.
+Fields that are not set in the file keep the values inherited from the auto_discover config. The file must contain a single
+deploy config and can not set working_dir or auto_discover. It returns no fields if the directory has no deploy config file.
+*/
+func applyLocalConfig(repoDir string, stack *DeployConfig) ([]string, error) {
+	configFile := DefaultDeploymentConfigFileNames[0]
+	if stack.ConfigFile != "" {
+		configFile = path.Base(stack.ConfigFile)
+	}
+
+	file := path.Join(stack.WorkingDirectory, configFile)
+
+	b, err := os.ReadFile(path.Join(repoDir, file))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+
+	var doc yaml.Node
+
+	err = dec.Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w in %s: failed to decode yaml: %v", ErrInvalidConfig, file, err)
+	}
+
+	var next yaml.Node
+	if err = dec.Decode(&next); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w in %s: a deploy config in a discovered directory must be a single yaml document", ErrInvalidConfig, file)
+	}
+
+	if len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%w in %s: deploy config must be a mapping", ErrInvalidConfig, file)
+	}
+
+	node := doc.Content[0]
+
+	// Decoding migrates the document and applies the field policy to it, so the keys are read afterwards
+	var local DeployConfig
+
+	err = node.Decode(&local)
+	if err != nil {
+		return nil, fmt.Errorf("%w in %s: %w", ErrInvalidConfig, file, err)
+	}
+
+	var fields []string
+
+	for i := 0; i < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		if key == "working_dir" || key == "auto_discover" {
+			return nil, fmt.Errorf("%w in %s: %s can not be set in a discovered directory", ErrInvalidConfig, file, key)
+		}
+
+		fields = append(fields, key)
+	}
+
+	dst := reflect.ValueOf(stack).Elem()
+	src := reflect.ValueOf(&local).Elem()
+
+	for i := range dst.NumField() {
+		name, _, _ := strings.Cut(dst.Type().Field(i).Tag.Get("yaml"), ",")
+		if name != "-" && slices.Contains(fields, name) {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+
+	stack.MigrationNotices = append(slices.Clone(stack.MigrationNotices), local.MigrationNotices...)
+	stack.StrippedFields = append(slices.Clone(stack.StrippedFields), local.StrippedFields...)
+
+	// The overrides of the application take precedence over the deploy configs in the repository
+	err = stack.applyOverrides(DeployConfigOverrides)
+	if err != nil {
+		return nil, err
+	}
+
+	err = stack.validateConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%w in %s: %v", ErrInvalidConfig, file, err)
+	}
+
+	return fields, nil
+}
+
+/*
+expandAutoDiscovery replaces each deploy config that has auto_discover enabled with a stack for its working directory
+(if it contains a compose file) and a stack for each subdirectory of the working directory that contains a compose file.
+The stacks of subdirectories are named <name>-<subdirectory> and get a numeric suffix if the name is already taken.
+A deploy config file in a subdirectory overrides the inherited fields of its stack, see applyLocalConfig.
+*/
+func expandAutoDiscovery(repoDir string, configs []*DeployConfig) ([]*DeployConfig, error) {
+	var (
+		expanded []*DeployConfig
+		names    []string
+	)
+
+	for _, c := range configs {
+		if !c.AutoDiscover {
+			names = append(names, c.Name)
+		}
+	}
+
+	for _, c := range configs {
+		if !c.AutoDiscover {
+			expanded = append(expanded, c)
+			continue
+		}
+
+		rootDir := path.Join(repoDir, c.WorkingDirectory)
+
+		if hasComposeFile(rootDir, c.ComposeFiles) {
+			root := *c
+			root.AutoDiscover = false
+			root.Name = uniqueName(c.Name, names)
+
+			names = append(names, root.Name)
+			expanded = append(expanded, &root)
+		}
+
+		entries, err := os.ReadDir(rootDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover stacks in %s: %w", c.WorkingDirectory, err)
+		}
+
+		for _, e := range entries {
+			if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+
+			stack := *c
+			stack.AutoDiscover = false
+			stack.WorkingDirectory = path.Join(c.WorkingDirectory, e.Name())
+
+			localFields, err := applyLocalConfig(repoDir, &stack)
+			if err != nil {
+				return nil, err
+			}
+
+			if !hasComposeFile(path.Join(repoDir, stack.WorkingDirectory), stack.ComposeFiles) {
+				continue
+			}
+
+			if slices.Contains(localFields, "name") {
+				// A name set in the directory is used as it is, so that it does not silently change
+				if slices.Contains(names, stack.Name) {
+					return nil, fmt.Errorf("%w in %s: name %s is already used by another stack", ErrInvalidConfig, stack.WorkingDirectory, stack.Name)
+				}
+			} else {
+				suffix := strings.Trim(invalidProjectNameChars.ReplaceAllString(strings.ToLower(e.Name()), "-"), "-_")
+				if suffix == "" {
+					continue
+				}
+
+				stack.Name = uniqueName(c.Name+"-"+suffix, names)
+			}
+
+			names = append(names, stack.Name)
+			expanded = append(expanded, &stack)
+		}
+	}
+
+	return expanded, nil
+}
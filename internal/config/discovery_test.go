@@ -0,0 +1,182 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExpandAutoDiscovery(t *testing.T) {
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	composeContent := "services:\n  test:\n    image: nginx:latest\n"
+
+	// Root stack, two nested stacks (one with a colliding name), a directory without compose file and a hidden directory
+	for _, dir := range []string{".", "app", "db", "docs", ".github"} {
+		err := os.MkdirAll(filepath.Join(dirName, dir), 0o700)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if dir == "docs" {
+			continue
+		}
+
+		err = createTestFile(filepath.Join(dirName, dir, "compose.yaml"), composeContent)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configs := []*DeployConfig{
+		{Name: "test", WorkingDirectory: ".", ComposeFiles: []string{"compose.yaml"}, AutoDiscover: true},
+		{Name: "test-db", WorkingDirectory: "db", ComposeFiles: []string{"compose.yaml"}},
+	}
+
+	expanded, err := expandAutoDiscovery(dirName, configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"test":      ".",
+		"test-app":  "app",
+		"test-db":   "db",
+		"test-db-2": "db",
+	}
+
+	if len(expanded) != len(expected) {
+		t.Fatalf("expected %d stacks, got %d", len(expected), len(expanded))
+	}
+
+	for _, c := range expanded {
+		workingDir, ok := expected[c.Name]
+		if !ok {
+			t.Errorf("unexpected stack %s", c.Name)
+			continue
+		}
+
+		if c.WorkingDirectory != workingDir {
+			t.Errorf("expected stack %s to have working directory %s, got %s", c.Name, workingDir, c.WorkingDirectory)
+		}
+
+		if c.AutoDiscover {
+			t.Errorf("expected auto discovery to be disabled for stack %s", c.Name)
+		}
+
+		delete(expected, c.Name)
+	}
+}
+
+func TestExpandAutoDiscovery_LocalConfig(t *testing.T) {
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	composeContent := "services:\n  test:\n    image: nginx:latest\n"
+
+	for _, dir := range []string{"app", "db"} {
+		err := os.MkdirAll(filepath.Join(dirName, dir), 0o700)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = createTestFile(filepath.Join(dirName, dir, "compose.yaml"), composeContent)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := createTestFile(filepath.Join(dirName, "app", DefaultDeploymentConfigFileNames[0]), "name: frontend\nprofiles: [web]\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configs := []*DeployConfig{
+		{
+			Name:             "test",
+			Reference:        "refs/heads/main",
+			WorkingDirectory: ".",
+			ComposeFiles:     []string{"compose.yaml"},
+			Profiles:         []string{"default"},
+			AutoDiscover:     true,
+			ConfigFile:       DefaultDeploymentConfigFileNames[0],
+		},
+	}
+
+	expanded, err := expandAutoDiscovery(dirName, configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"frontend": {"web"},
+		"test-db":  {"default"},
+	}
+
+	if len(expanded) != len(expected) {
+		t.Fatalf("expected %d stacks, got %d", len(expected), len(expanded))
+	}
+
+	for _, c := range expanded {
+		profiles, ok := expected[c.Name]
+		if !ok {
+			t.Errorf("unexpected stack %s", c.Name)
+			continue
+		}
+
+		if !slices.Equal(c.Profiles, profiles) {
+			t.Errorf("expected stack %s to have profiles %v, got %v", c.Name, profiles, c.Profiles)
+		}
+
+		if c.ConfigFile != DefaultDeploymentConfigFileNames[0] {
+			t.Errorf("expected stack %s to keep config file %s, got %s", c.Name, DefaultDeploymentConfigFileNames[0], c.ConfigFile)
+		}
+	}
+}
+
+func TestExpandAutoDiscovery_LocalConfigWorkingDir(t *testing.T) {
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	err := os.MkdirAll(filepath.Join(dirName, "app"), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = createTestFile(filepath.Join(dirName, "app", "compose.yaml"), "services:\n  test:\n    image: nginx:latest\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = createTestFile(filepath.Join(dirName, "app", DefaultDeploymentConfigFileNames[0]), "working_dir: ../other\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configs := []*DeployConfig{
+		{Name: "test", WorkingDirectory: ".", ComposeFiles: []string{"compose.yaml"}, AutoDiscover: true},
+	}
+
+	_, err = expandAutoDiscovery(dirName, configs)
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected error %v, got %v", ErrInvalidConfig, err)
+	}
+}
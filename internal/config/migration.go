@@ -0,0 +1,139 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentConfigVersion is the version of the deploy config format supported by this version of doco-cd.
+// Deploy configs without a config_version are treated as version 1.
+const CurrentConfigVersion = 1
+
+var ErrUnsupportedConfigVersion = errors.New("unsupported config_version")
+
+// deprecatedKey is a deploy config key that was replaced by another key
+type deprecatedKey struct {
+	Key         string // Key is the dotted path of the deprecated key, e.g. build_opts.pull
+	Replacement string // Replacement is the dotted path of the key that replaces it
+	Version     int    // Version is the config version that no longer supports the deprecated key
+}
+
+// deprecatedKeys are moved to their replacements when a deploy config with an older config_version is loaded
+var deprecatedKeys []deprecatedKey
+
+// migrateConfig upgrades the mapping node of a deploy config document to the current config version
+// and returns notices about the deprecated keys that were migrated
+func migrateConfig(node *yaml.Node) ([]string, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	version := 1
+
+	if _, v := getKey(node, "config_version"); v != nil {
+		var err error
+
+		version, err = strconv.Atoi(v.Value)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedConfigVersion, v.Value)
+		}
+
+		if version > CurrentConfigVersion {
+			return nil, fmt.Errorf("%w: %d, the latest version supported by this version of doco-cd is %d",
+				ErrUnsupportedConfigVersion, version, CurrentConfigVersion)
+		}
+	}
+
+	var notices []string
+
+	for _, d := range deprecatedKeys {
+		if version >= d.Version {
+			continue
+		}
+
+		parent, key, value := findKey(node, d.Key)
+		if value == nil {
+			continue
+		}
+
+		removeKey(parent, key)
+
+		if _, _, existing := findKey(node, d.Replacement); existing != nil {
+			notices = append(notices, fmt.Sprintf("%s is deprecated and ignored because %s is set", d.Key, d.Replacement))
+			continue
+		}
+
+		setKey(node, d.Replacement, key, value)
+
+		notices = append(notices, fmt.Sprintf("%s is deprecated, use %s instead", d.Key, d.Replacement))
+	}
+
+	return notices, nil
+}
+
+// getKey returns the key and value nodes of a key in a mapping node
+func getKey(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+
+	return nil, nil
+}
+
+// findKey returns the parent mapping node and the key and value nodes of a dotted key path, e.g. build_opts.args
+func findKey(node *yaml.Node, path string) (*yaml.Node, *yaml.Node, *yaml.Node) {
+	parts := strings.Split(path, ".")
+
+	for i, part := range parts {
+		if node.Kind != yaml.MappingNode {
+			return nil, nil, nil
+		}
+
+		key, value := getKey(node, part)
+		if value == nil {
+			return nil, nil, nil
+		}
+
+		if i == len(parts)-1 {
+			return node, key, value
+		}
+
+		node = value
+	}
+
+	return nil, nil, nil
+}
+
+// removeKey removes a key and its value from a mapping node
+func removeKey(node, key *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i] == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// setKey sets the value of a dotted key path in a mapping node and creates the missing parent mappings
+func setKey(node *yaml.Node, path string, key, value *yaml.Node) {
+	parts := strings.Split(path, ".")
+
+	for _, part := range parts[:len(parts)-1] {
+		_, child := getKey(node, part)
+		if child == nil {
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: part}, child)
+		}
+
+		node = child
+	}
+
+	key.Value = parts[len(parts)-1]
+	node.Content = append(node.Content, key, value)
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMigrateConfig(t *testing.T) {
+	defaultDeprecatedKeys := deprecatedKeys
+	deprecatedKeys = []deprecatedKey{
+		{Key: "pull", Replacement: "force_image_pull", Version: 2},
+		{Key: "build_args", Replacement: "build_opts.args", Version: 2},
+		{Key: "recreate", Replacement: "force_recreate", Version: 2},
+	}
+
+	t.Cleanup(func() {
+		deprecatedKeys = defaultDeprecatedKeys
+	})
+
+	testCases := []struct {
+		name            string
+		content         string
+		expectedErr     error
+		expectedNotices []string
+		check           func(t *testing.T, c *DeployConfig)
+	}{
+		{
+			name:    "Current Version",
+			content: "name: test\nforce_image_pull: true\n",
+			check: func(t *testing.T, c *DeployConfig) {
+				if c.ConfigVersion != 1 || !c.ForceImagePull {
+					t.Errorf("expected config to be loaded unchanged, got %+v", c)
+				}
+			},
+		},
+		{
+			name:    "Deprecated Keys",
+			content: "name: test\npull: true\nbuild_args:\n  VERSION: \"1.0\"\n",
+			expectedNotices: []string{
+				"pull is deprecated, use force_image_pull instead",
+				"build_args is deprecated, use build_opts.args instead",
+			},
+			check: func(t *testing.T, c *DeployConfig) {
+				if !c.ForceImagePull {
+					t.Error("expected pull to be migrated to force_image_pull")
+				}
+
+				if c.BuildOpts.Args["VERSION"] != "1.0" {
+					t.Errorf("expected build_args to be migrated to build_opts.args, got %v", c.BuildOpts.Args)
+				}
+			},
+		},
+		{
+			name:            "Replacement Already Set",
+			content:         "name: test\nrecreate: true\nforce_recreate: false\n",
+			expectedNotices: []string{"recreate is deprecated and ignored because force_recreate is set"},
+			check: func(t *testing.T, c *DeployConfig) {
+				if c.ForceRecreate {
+					t.Error("expected force_recreate to take precedence over recreate")
+				}
+			},
+		},
+		{
+			name:        "Unsupported Version",
+			content:     "config_version: 99\nname: test\n",
+			expectedErr: ErrUnsupportedConfigVersion,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), ".doco-cd.yaml")
+
+			err := os.WriteFile(filePath, []byte(tc.content), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			configs, err := FromYAML(filePath)
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("expected error %v, got %v", tc.expectedErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c := configs[0]
+
+			if !reflect.DeepEqual(c.MigrationNotices, tc.expectedNotices) {
+				t.Errorf("expected notices %v, got %v", tc.expectedNotices, c.MigrationNotices)
+			}
+
+			tc.check(t, c)
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FieldPolicyReject = "reject" // FieldPolicyReject rejects deploy configs that set a field that is not allowed
+	FieldPolicyStrip  = "strip"  // FieldPolicyStrip removes the fields that are not allowed from deploy configs
+)
+
+// FieldPolicy limits the deploy config fields that repositories can set, e.g. to keep tenant repositories
+// on a shared host from building images. Fields are dotted keys (e.g. build_opts or build_opts.args),
+// a field also matches all of its sub-fields. The name and config_version fields are always allowed.
+type FieldPolicy struct {
+	Allowed []string // Allowed are the only fields that can be set if it is not empty
+	Denied  []string // Denied are the fields that can not be set, they take precedence over Allowed
+	Mode    string   // Mode is either FieldPolicyReject or FieldPolicyStrip
+}
+
+// DeployConfigFieldPolicy is the policy applied to all deploy configs read from repositories
+var DeployConfigFieldPolicy FieldPolicy
+
+var ErrFieldNotAllowed = errors.New("deploy config field not allowed by policy")
+
+// matchesField checks if the field or one of its parents is in the list
+func matchesField(fields []string, field string) bool {
+	for _, f := range fields {
+		if field == f || strings.HasPrefix(field, f+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasSubField checks if the list contains a sub-field of the field
+func hasSubField(fields []string, field string) bool {
+	for _, f := range fields {
+		if strings.HasPrefix(f, field+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apply checks the fields of the mapping node of a deploy config document against the policy.
+// Fields that are not allowed are removed and returned in strip mode, otherwise an error is returned.
+func (p FieldPolicy) apply(node *yaml.Node) ([]string, error) {
+	if len(p.Allowed) == 0 && len(p.Denied) == 0 {
+		return nil, nil
+	}
+
+	err := checkMergeKeys(node, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return p.applyFields(node, "")
+}
+
+/*
+checkMergeKeys rejects merge keys (<<) and aliases in a deploy config document. They are resolved when the document
+is decoded and could set fields that are not checked by the policy, e.g. a denied field merged from an anchor.
+*/
+func checkMergeKeys(node *yaml.Node, field string) error {
+	in := ""
+	if field != "" {
+		in = " in " + field
+	}
+
+	switch node.Kind {
+	case yaml.AliasNode:
+		return fmt.Errorf("%w: alias *%s%s, aliases can not be used with a field policy", ErrFieldNotAllowed, node.Value, in)
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+
+			if key.Kind == yaml.AliasNode || key.Value == "<<" || key.Tag == "!!merge" {
+				return fmt.Errorf("%w: merge key or alias key%s, they can not be used with a field policy", ErrFieldNotAllowed, in)
+			}
+
+			child := key.Value
+			if field != "" {
+				child = field + "." + key.Value
+			}
+
+			err := checkMergeKeys(value, child)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		for _, child := range node.Content {
+			err := checkMergeKeys(child, field)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p FieldPolicy) applyFields(node *yaml.Node, prefix string) ([]string, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	var (
+		stripped []string
+		content  []*yaml.Node
+	)
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		field := prefix + key.Value
+
+		restricted := len(p.Allowed) > 0 && !matchesField(p.Allowed, field)
+
+		switch {
+		case prefix == "" && (field == "name" || field == "config_version"):
+		case matchesField(p.Denied, field), restricted && !hasSubField(p.Allowed, field):
+			if p.Mode != FieldPolicyStrip {
+				return nil, fmt.Errorf("%w: %s", ErrFieldNotAllowed, field)
+			}
+
+			stripped = append(stripped, field)
+
+			continue
+		case restricted || hasSubField(p.Denied, field):
+			s, err := p.applyFields(value, field+".")
+			if err != nil {
+				return nil, err
+			}
+
+			stripped = append(stripped, s...)
+		}
+
+		content = append(content, key, value)
+	}
+
+	node.Content = content
+
+	return stripped, nil
+}
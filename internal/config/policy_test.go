@@ -0,0 +1,154 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFieldPolicy(t *testing.T) {
+	content := `name: test
+reference: refs/heads/main
+prune_images: true
+build_opts:
+  no_cache: true
+  args:
+    VERSION: "1.0"
+`
+
+	testCases := []struct {
+		name             string
+		policy           FieldPolicy
+		expectedErr      error
+		expectedStripped []string
+	}{
+		{
+			name:   "No Policy",
+			policy: FieldPolicy{},
+		},
+		{
+			name:        "Denied Field",
+			policy:      FieldPolicy{Denied: []string{"build_opts"}, Mode: FieldPolicyReject},
+			expectedErr: ErrFieldNotAllowed,
+		},
+		{
+			name:             "Denied Sub-Field Stripped",
+			policy:           FieldPolicy{Denied: []string{"build_opts.args"}, Mode: FieldPolicyStrip},
+			expectedStripped: []string{"build_opts.args"},
+		},
+		{
+			name:        "Field Not Allowed",
+			policy:      FieldPolicy{Allowed: []string{"reference", "build_opts"}, Mode: FieldPolicyReject},
+			expectedErr: ErrFieldNotAllowed,
+		},
+		{
+			name:             "Allowed Fields Stripped",
+			policy:           FieldPolicy{Allowed: []string{"reference", "build_opts.no_cache"}, Mode: FieldPolicyStrip},
+			expectedStripped: []string{"prune_images", "build_opts.args"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defaultPolicy := DeployConfigFieldPolicy
+			DeployConfigFieldPolicy = tc.policy
+
+			t.Cleanup(func() {
+				DeployConfigFieldPolicy = defaultPolicy
+			})
+
+			filePath := filepath.Join(t.TempDir(), ".doco-cd.yaml")
+
+			err := os.WriteFile(filePath, []byte(content), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			configs, err := FromYAML(filePath)
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("expected error %v, got %v", tc.expectedErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c := configs[0]
+
+			if !reflect.DeepEqual(c.StrippedFields, tc.expectedStripped) {
+				t.Errorf("expected stripped fields %v, got %v", tc.expectedStripped, c.StrippedFields)
+			}
+
+			for _, field := range tc.expectedStripped {
+				switch field {
+				case "prune_images":
+					if c.PruneImages {
+						t.Error("expected prune_images to keep its default value")
+					}
+				case "build_opts.args":
+					if len(c.BuildOpts.Args) != 0 {
+						t.Errorf("expected build_opts.args to be removed, got %v", c.BuildOpts.Args)
+					}
+				}
+			}
+
+			if c.Name != "test" || c.Reference != "refs/heads/main" {
+				t.Errorf("expected name and reference to be kept, got %s and %s", c.Name, c.Reference)
+			}
+		})
+	}
+}
+
+func TestFieldPolicy_MergeKeys(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+	}{
+		{"Merge Key With Anchor", `name: test
+x-base: &base
+  build_opts:
+    no_cache: true
+<<: *base
+`},
+		{"Inline Merge Key", `name: test
+<<:
+  build_opts:
+    no_cache: true
+`},
+		{"Alias Value", `name: test
+x-args: &args
+  VERSION: "1.0"
+build_opts:
+  args: *args
+`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defaultPolicy := DeployConfigFieldPolicy
+			DeployConfigFieldPolicy = FieldPolicy{Denied: []string{"build_opts"}, Mode: FieldPolicyStrip}
+
+			t.Cleanup(func() {
+				DeployConfigFieldPolicy = defaultPolicy
+			})
+
+			filePath := filepath.Join(t.TempDir(), ".doco-cd.yaml")
+
+			err := os.WriteFile(filePath, []byte(tc.content), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = FromYAML(filePath)
+			if !errors.Is(err, ErrFieldNotAllowed) {
+				t.Fatalf("expected error %v, got %v", ErrFieldNotAllowed, err)
+			}
+		})
+	}
+}
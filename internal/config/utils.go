@@ -6,27 +6,48 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/creasty/defaults"
 
 	"gopkg.in/yaml.v3"
 )
 
-func (c *DeployConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+func (c *DeployConfig) UnmarshalYAML(value *yaml.Node) error {
 	err := defaults.Set(c)
 	if err != nil {
 		return err
 	}
 
+	// Upgrade older config versions before decoding them into the current structure
+	notices, err := migrateConfig(value)
+	if err != nil {
+		return err
+	}
+
+	stripped, err := DeployConfigFieldPolicy.apply(value)
+	if err != nil {
+		return err
+	}
+
 	type Plain DeployConfig
 
-	if err := unmarshal((*Plain)(c)); err != nil {
+	if err := value.Decode((*Plain)(c)); err != nil {
 		return err
 	}
 
+	c.MigrationNotices = notices
+	c.StrippedFields = stripped
+
 	return nil
 }
 
+// MaxDocumentsPerFile is the maximum number of YAML documents (deploy configs) a single config file may contain
+var MaxDocumentsPerFile = 100
+
+var ErrTooManyDocuments = errors.New("too many yaml documents in file")
+
+// FromYAML reads all deploy configs from the YAML documents in a file
 func FromYAML(f string) ([]*DeployConfig, error) {
 	b, err := os.ReadFile(f)
 	if err != nil {
@@ -41,13 +62,23 @@ func FromYAML(f string) ([]*DeployConfig, error) {
 	for {
 		var c DeployConfig
 
+		if len(configs) == MaxDocumentsPerFile {
+			// Check if there is another document without expanding it
+			var next yaml.Node
+			if err = dec.Decode(&next); errors.Is(err, io.EOF) {
+				break
+			}
+
+			return nil, fmt.Errorf("%w: limit is %d", ErrTooManyDocuments, MaxDocumentsPerFile)
+		}
+
 		err = dec.Decode(&c)
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
 
-			return nil, fmt.Errorf("failed to decode yaml: %v", err)
+			return nil, fmt.Errorf("failed to decode yaml: %w", err)
 		}
 
 		configs = append(configs, &c)
@@ -59,3 +90,62 @@ func FromYAML(f string) ([]*DeployConfig, error) {
 
 	return configs, nil
 }
+
+// plainDeployConfig is a DeployConfig without the UnmarshalYAML method that sets the default values
+type plainDeployConfig DeployConfig
+
+// DeployConfigOverrides are deploy config fields (e.g. prune_images or build_opts.no_cache) with YAML values that
+// override the values of all deploy configs. They take precedence over the values in the repositories and the defaults.
+var DeployConfigOverrides map[string]string
+
+var ErrInvalidOverride = errors.New("invalid deploy config override")
+
+// applyOverrides sets the overridden fields of the deploy config
+func (c *DeployConfig) applyOverrides(overrides map[string]string) error {
+	for key, value := range overrides {
+		var v any
+
+		err := yaml.Unmarshal([]byte(value), &v)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidOverride, key, err)
+		}
+
+		// Nest the value for dotted keys, e.g. build_opts.no_cache
+		parts := strings.Split(key, ".")
+		for i := len(parts) - 1; i >= 0; i-- {
+			v = map[string]any{parts[i]: v}
+		}
+
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidOverride, key, err)
+		}
+
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+
+		err = dec.Decode((*plainDeployConfig)(c))
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidOverride, key, err)
+		}
+	}
+
+	return nil
+}
+
+// validateOverrides checks if the overrides can be applied to a deploy config
+func validateOverrides(overrides map[string]string) error {
+	c := DefaultDeployConfig("validate")
+
+	err := c.applyOverrides(overrides)
+	if err != nil {
+		return err
+	}
+
+	err = c.validateConfig()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidOverride, err)
+	}
+
+	return nil
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"errors"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -48,3 +50,95 @@ func TestFromYAML(t *testing.T) {
 		})
 	}
 }
+
+func TestFromYAML_MaxDocuments(t *testing.T) {
+	dirName, err := os.MkdirTemp(os.TempDir(), "test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		err = os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	defaultMax := MaxDocumentsPerFile
+	MaxDocumentsPerFile = 2
+
+	t.Cleanup(func() {
+		MaxDocumentsPerFile = defaultMax
+	})
+
+	document := "name: test\nreference: refs/heads/main\n"
+
+	testCases := []struct {
+		name          string
+		documents     int
+		expectedError error
+	}{
+		{"Below Limit", 1, nil},
+		{"At Limit", 2, nil},
+		{"Above Limit", 3, ErrTooManyDocuments},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filePath := filepath.Join(dirName, ".doco-cd.yaml")
+
+			err = createTestFile(filePath, strings.Repeat("---\n"+document, tc.documents))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			configs, err := FromYAML(filePath)
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("expected error to be %v, got %v", tc.expectedError, err)
+			}
+
+			if tc.expectedError == nil && len(configs) != tc.documents {
+				t.Errorf("expected %d configs, got %d", tc.documents, len(configs))
+			}
+		})
+	}
+}
+
+func TestDeployConfig_ApplyOverrides(t *testing.T) {
+	testCases := []struct {
+		name          string
+		overrides     map[string]string
+		expectedError error
+	}{
+		{"Valid Overrides", map[string]string{"prune_images": "false", "remove_orphans": "false", "build_opts.no_cache": "true"}, nil},
+		{"Unknown Field", map[string]string{"prune_everything": "true"}, ErrInvalidOverride},
+		{"Invalid Value", map[string]string{"timeout": "forever"}, ErrInvalidOverride},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := DefaultDeployConfig("test")
+			c.PruneImages = true
+			c.RemoveOrphans = true
+			c.Timeout = 60
+
+			err := c.applyOverrides(tc.overrides)
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("expected error to be %v, got %v", tc.expectedError, err)
+			}
+
+			if tc.expectedError != nil {
+				return
+			}
+
+			if c.PruneImages || c.RemoveOrphans || !c.BuildOpts.NoCache {
+				t.Errorf("expected overrides to be applied, got %+v", c)
+			}
+
+			// Fields that are not overridden must not be reset to their defaults
+			if c.Timeout != 60 || c.Name != "test" {
+				t.Errorf("expected other fields to be unchanged, got %+v", c)
+			}
+		})
+	}
+}
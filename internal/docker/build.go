@@ -0,0 +1,43 @@
+package docker
+
+import (
+	"context"
+
+	"github.com/kimdre/doco-cd/internal/prometheus"
+)
+
+// defaultMaxConcurrentBuilds is the number of image builds that run at the same time if SetMaxConcurrentBuilds is not called
+const defaultMaxConcurrentBuilds = 2
+
+// buildSlots limits the number of image builds that run at the same time across all deployment jobs
+var buildSlots = make(chan struct{}, defaultMaxConcurrentBuilds)
+
+// SetMaxConcurrentBuilds sets the number of image builds that run at the same time across all deployment jobs,
+// it has to be called before the first deployment
+func SetMaxConcurrentBuilds(n int) {
+	buildSlots = make(chan struct{}, max(n, 1))
+}
+
+// acquireBuildSlot waits until a build slot is free and returns the function that releases it again.
+// The other steps of a deployment (e.g. pulling images and starting containers) do not need a build slot.
+func acquireBuildSlot(ctx context.Context) (func(), error) {
+	slots := buildSlots
+
+	prometheus.QueuedBuilds.Inc()
+
+	select {
+	case slots <- struct{}{}:
+		prometheus.QueuedBuilds.Dec()
+	case <-ctx.Done():
+		prometheus.QueuedBuilds.Dec()
+
+		return nil, ctx.Err()
+	}
+
+	prometheus.RunningBuilds.Inc()
+
+	return func() {
+		prometheus.RunningBuilds.Dec()
+		<-slots
+	}, nil
+}
@@ -0,0 +1,69 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+
+	"github.com/kimdre/doco-cd/internal/config"
+)
+
+func TestAcquireBuildSlot(t *testing.T) {
+	SetMaxConcurrentBuilds(1)
+	t.Cleanup(func() {
+		SetMaxConcurrentBuilds(defaultMaxConcurrentBuilds)
+	})
+
+	release, err := acquireBuildSlot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// All build slots are taken, so the second build waits until the context expires
+	if _, err = acquireBuildSlot(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected error %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	release()
+
+	release, err = acquireBuildSlot(context.Background())
+	if err != nil {
+		t.Fatalf("expected a free build slot after the release, got %v", err)
+	}
+
+	release()
+}
+
+func TestBuildCompose_NoBuild(t *testing.T) {
+	SetMaxConcurrentBuilds(1)
+	t.Cleanup(func() {
+		SetMaxConcurrentBuilds(defaultMaxConcurrentBuilds)
+	})
+
+	release, err := acquireBuildSlot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer release()
+
+	project := &types.Project{
+		Name:     "test",
+		Services: types.Services{"web": types.ServiceConfig{Name: "web", Image: "nginx:latest"}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// All build slots are taken, a project without builds must not wait for one
+	err = BuildCompose(ctx, nil, project, config.DefaultDeployConfig("test"))
+	if err != nil {
+		t.Fatalf("expected project without builds to skip the build slot, got %v", err)
+	}
+}
@@ -0,0 +1,419 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-units"
+)
+
+var (
+	ErrPortConflict           = errors.New("port already in use")
+	ErrResourceBudgetExceeded = errors.New("resource budget exceeded")
+	ErrSwarmOnlyOption        = errors.New("option is only supported in swarm mode")
+	ErrNetworkNotFound        = errors.New("external network not found")
+	ErrBindMountNotFound      = errors.New("bind mount source not found")
+	ErrUnpinnedImage          = errors.New("image is not pinned to a digest")
+)
+
+// pinnedImagePattern matches image references that are pinned to a digest, e.g. nginx:1.27@sha256:...
+var pinnedImagePattern = regexp.MustCompile(`@sha256:[a-f0-9]{64}$`)
+
+// publishedPort is a host port published by a service
+type publishedPort struct {
+	Service  string
+	HostIP   string // HostIP is the host address the port is bound to, empty for all addresses
+	Port     uint16
+	Protocol string
+}
+
+// String returns the port with its host address and protocol, e.g. 127.0.0.1:8080/tcp
+func (p publishedPort) String() string {
+	port := strconv.Itoa(int(p.Port))
+	if p.HostIP != "" {
+		port = net.JoinHostPort(p.HostIP, port)
+	}
+
+	return port + "/" + p.Protocol
+}
+
+// hostIPsOverlap checks if ports bound to the two host addresses conflict,
+// an empty or unspecified address (e.g. 0.0.0.0 or ::) binds all addresses and overlaps with every other one
+func hostIPsOverlap(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil || ipA.IsUnspecified() || ipB.IsUnspecified() {
+		return true
+	}
+
+	return ipA.Equal(ipB)
+}
+
+// getPublishedPorts returns all host ports that are published by the services of a project
+func getPublishedPorts(project *types.Project) ([]publishedPort, error) {
+	var ports []publishedPort
+
+	for _, s := range project.Services {
+		for _, p := range s.Ports {
+			if p.Published == "" {
+				continue
+			}
+
+			protocol := p.Protocol
+			if protocol == "" {
+				protocol = "tcp"
+			}
+
+			// Published ports can either be a single port or a range (e.g. 8000-8010)
+			start, end, _ := strings.Cut(p.Published, "-")
+			if end == "" {
+				end = start
+			}
+
+			first, err := strconv.ParseUint(start, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid published port %s of service %s: %w", p.Published, s.Name, err)
+			}
+
+			last, err := strconv.ParseUint(end, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid published port %s of service %s: %w", p.Published, s.Name, err)
+			}
+
+			for port := first; port <= last; port++ {
+				ports = append(ports, publishedPort{
+					Service:  s.Name,
+					HostIP:   p.HostIP,
+					Port:     uint16(port),
+					Protocol: protocol,
+				})
+			}
+		}
+	}
+
+	return ports, nil
+}
+
+// CheckPortConflicts checks if the host ports published by the project are already bound by containers of other stacks
+func CheckPortConflicts(ctx context.Context, apiClient client.APIClient, project *types.Project) error {
+	ports, err := getPublishedPorts(project)
+	if err != nil {
+		return err
+	}
+
+	if len(ports) == 0 {
+		return nil
+	}
+
+	containers, err := apiClient.ContainerList(ctx, container.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	for _, c := range containers {
+		// Containers of the same project get recreated and release their ports
+		owner := c.Labels[api.ProjectLabel]
+		if owner == project.Name {
+			continue
+		}
+
+		if owner == "" && len(c.Names) > 0 {
+			owner = strings.TrimPrefix(c.Names[0], "/")
+		}
+
+		for _, bound := range c.Ports {
+			if bound.PublicPort == 0 {
+				continue
+			}
+
+			for _, p := range ports {
+				if p.Port == bound.PublicPort && p.Protocol == bound.Type && hostIPsOverlap(p.HostIP, bound.IP) {
+					return fmt.Errorf("%w: port %s of service %s is already used by stack %s",
+						ErrPortConflict, p, p.Service, owner)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// ResourceBudget is the amount of resources the services of a stack may reserve in total, zero values are unlimited
+type ResourceBudget struct {
+	CPUs        float64
+	MemoryBytes int64
+}
+
+// getReplicas returns the number of containers a service runs, taking the scale of the deploy config into account
+func getReplicas(s types.ServiceConfig, scale map[string]int) int {
+	if replicas, ok := scale[s.Name]; ok {
+		return replicas
+	}
+
+	if s.Scale != nil {
+		return *s.Scale
+	}
+
+	if s.Deploy != nil && s.Deploy.Replicas != nil {
+		return *s.Deploy.Replicas
+	}
+
+	return 1
+}
+
+// getResourceReservations returns the sum of the CPU and memory reservations of all containers of a project
+func getResourceReservations(project *types.Project, scale map[string]int) (float64, int64) {
+	var (
+		cpus   float64
+		memory int64
+	)
+
+	for _, s := range project.Services {
+		var (
+			serviceCPUs   float64
+			serviceMemory = int64(s.MemReservation)
+		)
+
+		if s.Deploy != nil && s.Deploy.Resources.Reservations != nil {
+			serviceCPUs = float64(s.Deploy.Resources.Reservations.NanoCPUs)
+
+			if s.Deploy.Resources.Reservations.MemoryBytes > 0 {
+				serviceMemory = int64(s.Deploy.Resources.Reservations.MemoryBytes)
+			}
+		}
+
+		replicas := getReplicas(s, scale)
+
+		cpus += serviceCPUs * float64(replicas)
+		memory += serviceMemory * int64(replicas)
+	}
+
+	return cpus, memory
+}
+
+// checkSwarmOnlyOptions returns an error for each deploy option of a service that is ignored outside of swarm mode
+func checkSwarmOnlyOptions(project *types.Project) error {
+	var errs []error
+
+	for _, name := range project.ServiceNames() {
+		d := project.Services[name].Deploy
+		if d == nil {
+			continue
+		}
+
+		var options []string
+
+		if d.Placement.Constraints != nil || d.Placement.Preferences != nil || d.Placement.MaxReplicas != 0 {
+			options = append(options, "deploy.placement")
+		}
+
+		if d.UpdateConfig != nil {
+			options = append(options, "deploy.update_config")
+		}
+
+		if d.RollbackConfig != nil {
+			options = append(options, "deploy.rollback_config")
+		}
+
+		if d.EndpointMode != "" {
+			options = append(options, "deploy.endpoint_mode")
+		}
+
+		if d.RestartPolicy != nil && (d.RestartPolicy.Delay != nil || d.RestartPolicy.Window != nil) {
+			options = append(options, "deploy.restart_policy.delay/window")
+		}
+
+		for _, o := range options {
+			errs = append(errs, fmt.Errorf("%w: %s of service %s", ErrSwarmOnlyOption, o, name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// CheckResources checks that the resource reservations of the project fit into the budget
+// and that the services don't use deploy options that only work in swarm mode
+func CheckResources(project *types.Project, scale map[string]int, budget ResourceBudget) error {
+	errs := []error{checkSwarmOnlyOptions(project)}
+
+	cpus, memory := getResourceReservations(project, scale)
+
+	if budget.CPUs > 0 && cpus > budget.CPUs {
+		errs = append(errs, fmt.Errorf("%w: stack reserves %.2f CPUs, budget is %.2f CPUs", ErrResourceBudgetExceeded, cpus, budget.CPUs))
+	}
+
+	if budget.MemoryBytes > 0 && memory > budget.MemoryBytes {
+		errs = append(errs, fmt.Errorf("%w: stack reserves %s memory, budget is %s",
+			ErrResourceBudgetExceeded, units.BytesSize(float64(memory)), units.BytesSize(float64(budget.MemoryBytes))))
+	}
+
+	return errors.Join(errs...)
+}
+
+// getMissingNetworks returns the external networks of a project that don't exist on the host
+func getMissingNetworks(project *types.Project, existing []string) []types.NetworkConfig {
+	var missing []types.NetworkConfig
+
+	keys := make([]string, 0, len(project.Networks))
+	for key := range project.Networks {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		n := project.Networks[key]
+		if !n.External {
+			continue
+		}
+
+		if n.Name == "" {
+			n.Name = key
+		}
+
+		if !slices.Contains(existing, n.Name) {
+			missing = append(missing, n)
+		}
+	}
+
+	return missing
+}
+
+// CheckExternalNetworks checks if the external networks of the project exist and optionally creates the missing ones
+func CheckExternalNetworks(ctx context.Context, apiClient client.APIClient, project *types.Project, create bool) error {
+	networks, err := apiClient.NetworkList(ctx, network.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list networks: %w", err)
+	}
+
+	existing := make([]string, 0, len(networks))
+	for _, n := range networks {
+		existing = append(existing, n.Name)
+	}
+
+	for _, n := range getMissingNetworks(project, existing) {
+		if !create {
+			return fmt.Errorf("%w: network %s must be created before deploying the stack", ErrNetworkNotFound, n.Name)
+		}
+
+		_, err = apiClient.NetworkCreate(ctx, n.Name, network.CreateOptions{Driver: n.Driver})
+		if err != nil {
+			return fmt.Errorf("failed to create external network %s: %w", n.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// bindMount is a bind mount source path of a service
+type bindMount struct {
+	Service string
+	Source  string
+}
+
+// getMissingBindMounts returns the bind mounts of the project whose source path does not exist
+func getMissingBindMounts(project *types.Project) []bindMount {
+	var missing []bindMount
+
+	for _, name := range project.ServiceNames() {
+		for _, v := range project.Services[name].Volumes {
+			if v.Type != types.VolumeTypeBind || v.Source == "" {
+				continue
+			}
+
+			if _, err := os.Stat(v.Source); errors.Is(err, os.ErrNotExist) {
+				missing = append(missing, bindMount{Service: name, Source: v.Source})
+			}
+		}
+	}
+
+	return missing
+}
+
+// parseOwner parses an owner in the format uid[:gid], the gid defaults to the uid
+func parseOwner(owner string) (int, int, error) {
+	u, g, found := strings.Cut(owner, ":")
+	if !found {
+		g = u
+	}
+
+	uid, err := strconv.Atoi(u)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid owner %s: %w", owner, err)
+	}
+
+	gid, err := strconv.Atoi(g)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid owner %s: %w", owner, err)
+	}
+
+	return uid, gid, nil
+}
+
+/*
+CheckBindMounts checks if the source paths of the bind mounts of the project exist, as docker would otherwise create
+an empty directory owned by root in place of a missing file. If create is set, the missing sources are created as
+directories instead and owned by owner (uid[:gid]) if it is not empty.
+The source paths have to be accessible at the same location as on the docker host.
+*/
+func CheckBindMounts(project *types.Project, create bool, owner string) error {
+	for _, m := range getMissingBindMounts(project) {
+		if !create {
+			return fmt.Errorf("%w: %s of service %s", ErrBindMountNotFound, m.Source, m.Service)
+		}
+
+		err := os.MkdirAll(m.Source, 0o755)
+		if err != nil {
+			return fmt.Errorf("failed to create bind mount directory %s: %w", m.Source, err)
+		}
+
+		if owner != "" {
+			uid, gid, err := parseOwner(owner)
+			if err != nil {
+				return err
+			}
+
+			err = os.Chown(m.Source, uid, gid)
+			if err != nil {
+				return fmt.Errorf("failed to change owner of bind mount directory %s: %w", m.Source, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+CheckPinnedImages checks that the images of all services are pinned to a sha256 digest, e.g. nginx:1.27@sha256:...,
+so that a moved tag can not change what gets deployed. Services that build their image are skipped, as their image
+is not pulled from a registry. The error lists each service with an unpinned image.
+*/
+func CheckPinnedImages(project *types.Project) error {
+	var unpinned []string
+
+	for _, name := range project.ServiceNames() {
+		s := project.Services[name]
+		if s.Build != nil || pinnedImagePattern.MatchString(s.Image) {
+			continue
+		}
+
+		unpinned = append(unpinned, fmt.Sprintf("%s (%s)", name, s.Image))
+	}
+
+	if len(unpinned) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnpinnedImage, strings.Join(unpinned, ", "))
+	}
+
+	return nil
+}
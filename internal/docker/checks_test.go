@@ -0,0 +1,326 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+func TestGetPublishedPorts(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+
+	createComposeFile(t, filePath, `services:
+  test:
+    image: nginx:latest
+    ports:
+      - "8080:80"
+      - "9000-9001:9000-9001/udp"
+      - "127.0.0.1:5432:5432"
+      - "443"
+`)
+
+	project, err := LoadCompose(ctx, dirName, projectName, []string{filePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ports, err := getPublishedPorts(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []publishedPort{
+		{Service: "test", Port: 8080, Protocol: "tcp"},
+		{Service: "test", Port: 9000, Protocol: "udp"},
+		{Service: "test", Port: 9001, Protocol: "udp"},
+		{Service: "test", HostIP: "127.0.0.1", Port: 5432, Protocol: "tcp"},
+	}
+
+	if len(ports) != len(expected) {
+		t.Fatalf("expected %d published ports, got %d: %v", len(expected), len(ports), ports)
+	}
+
+	for i, p := range expected {
+		if ports[i] != p {
+			t.Errorf("expected published port %v, got %v", p, ports[i])
+		}
+	}
+}
+
+func TestHostIPsOverlap(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"", "", true},
+		{"", "127.0.0.1", true},
+		{"0.0.0.0", "192.168.1.10", true},
+		{"::", "127.0.0.1", true},
+		{"127.0.0.1", "127.0.0.1", true},
+		{"127.0.0.1", "192.168.1.10", false},
+		{"::1", "127.0.0.1", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.a+"-"+tc.b, func(t *testing.T) {
+			if result := hostIPsOverlap(tc.a, tc.b); result != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestPublishedPort_String(t *testing.T) {
+	testCases := []struct {
+		port     publishedPort
+		expected string
+	}{
+		{publishedPort{Port: 8080, Protocol: "tcp"}, "8080/tcp"},
+		{publishedPort{HostIP: "127.0.0.1", Port: 8080, Protocol: "tcp"}, "127.0.0.1:8080/tcp"},
+		{publishedPort{HostIP: "::1", Port: 53, Protocol: "udp"}, "[::1]:53/udp"},
+	}
+
+	for _, tc := range testCases {
+		if result := tc.port.String(); result != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, result)
+		}
+	}
+}
+
+func TestCheckResources(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+
+	createComposeFile(t, filePath, `services:
+  web:
+    image: nginx:latest
+    deploy:
+      resources:
+        reservations:
+          cpus: "0.5"
+          memory: 256m
+  worker:
+    image: nginx:latest
+    mem_reservation: 128m
+`)
+
+	project, err := LoadCompose(ctx, dirName, projectName, []string{filePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name          string
+		scale         map[string]int
+		budget        ResourceBudget
+		expectedError error
+	}{
+		{"Unlimited", nil, ResourceBudget{}, nil},
+		{"Within Budget", nil, ResourceBudget{CPUs: 1, MemoryBytes: 512 * 1024 * 1024}, nil},
+		{"CPUs Exceeded", map[string]int{"web": 3}, ResourceBudget{CPUs: 1}, ErrResourceBudgetExceeded},
+		{"Memory Exceeded", map[string]int{"worker": 3}, ResourceBudget{MemoryBytes: 512 * 1024 * 1024}, ErrResourceBudgetExceeded},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err = CheckResources(project, tc.scale, tc.budget)
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("expected error to be %v, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestCheckSwarmOnlyOptions(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+
+	createComposeFile(t, filePath, `services:
+  test:
+    image: nginx:latest
+    deploy:
+      placement:
+        constraints:
+          - node.role == manager
+`)
+
+	project, err := LoadCompose(ctx, dirName, projectName, []string{filePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = checkSwarmOnlyOptions(project)
+	if !errors.Is(err, ErrSwarmOnlyOption) {
+		t.Fatalf("expected error to be %v, got %v", ErrSwarmOnlyOption, err)
+	}
+}
+
+func TestCheckPinnedImages(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("0123456789abcdef", 4)
+
+	project := &types.Project{Services: types.Services{
+		"pinned":       {Name: "pinned", Image: "nginx:1.27@" + digest},
+		"digest-only":  {Name: "digest-only", Image: "nginx@" + digest},
+		"built":        {Name: "built", Image: "app:latest", Build: &types.BuildConfig{Context: "."}},
+		"latest":       {Name: "latest", Image: "nginx:latest"},
+		"short-digest": {Name: "short-digest", Image: "redis@sha256:abc"},
+	}}
+
+	err := CheckPinnedImages(project)
+	if !errors.Is(err, ErrUnpinnedImage) {
+		t.Fatalf("expected error to be %v, got %v", ErrUnpinnedImage, err)
+	}
+
+	expected := "image is not pinned to a digest: latest (nginx:latest), short-digest (redis@sha256:abc)"
+	if err.Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, err.Error())
+	}
+
+	delete(project.Services, "latest")
+	delete(project.Services, "short-digest")
+
+	if err = CheckPinnedImages(project); err != nil {
+		t.Errorf("expected pinned images to pass, got %v", err)
+	}
+}
+
+func TestGetMissingNetworks(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+
+	createComposeFile(t, filePath, `services:
+  test:
+    image: nginx:latest
+    networks:
+      - proxy
+      - monitoring
+      - internal
+networks:
+  proxy:
+    external: true
+  monitoring:
+    name: shared-monitoring
+    external: true
+  internal:
+`)
+
+	project, err := LoadCompose(ctx, dirName, projectName, []string{filePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	missing := getMissingNetworks(project, []string{"bridge", "proxy"})
+
+	if len(missing) != 1 || missing[0].Name != "shared-monitoring" {
+		t.Fatalf("expected only network shared-monitoring to be missing, got %v", missing)
+	}
+}
+
+func TestCheckBindMounts(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+
+	createComposeFile(t, filePath, `services:
+  test:
+    image: nginx:latest
+    volumes:
+      - ./test.compose.yaml:/etc/test.yaml:ro
+      - ./data:/data
+      - type: bind
+        source: ./nginx.conf
+        target: /etc/nginx/nginx.conf
+`)
+
+	project, err := LoadCompose(ctx, dirName, projectName, []string{filePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = CheckBindMounts(project, false, "")
+	if !errors.Is(err, ErrBindMountNotFound) {
+		t.Fatalf("expected error %v, got %v", ErrBindMountNotFound, err)
+	}
+
+	missing := getMissingBindMounts(project)
+	if len(missing) != 2 || missing[0].Source != filepath.Join(dirName, "data") || missing[1].Source != filepath.Join(dirName, "nginx.conf") {
+		t.Fatalf("expected data and nginx.conf to be missing, got %v", missing)
+	}
+
+	err = CheckBindMounts(project, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(dirName, "data"))
+	if err != nil || !info.IsDir() {
+		t.Errorf("expected missing bind mount to be created as directory, got %v", err)
+	}
+}
+
+func TestParseOwner(t *testing.T) {
+	uid, gid, err := parseOwner("1000:1001")
+	if err != nil || uid != 1000 || gid != 1001 {
+		t.Errorf("expected 1000:1001, got %d:%d, %v", uid, gid, err)
+	}
+
+	uid, gid, err = parseOwner("1000")
+	if err != nil || uid != 1000 || gid != 1000 {
+		t.Errorf("expected 1000:1000, got %d:%d, %v", uid, gid, err)
+	}
+
+	_, _, err = parseOwner("www-data")
+	if err == nil {
+		t.Error("expected error for non-numeric owner")
+	}
+}
@@ -0,0 +1,128 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CompatibilityIssue is a construct in a compose file that is deprecated or not supported by the bundled compose version
+type CompatibilityIssue struct {
+	File       string `json:"file"`
+	Field      string `json:"field"`
+	Message    string `json:"message"`
+	Deprecated bool   `json:"deprecated"` // Deprecated issues are ignored by compose, all other issues cause the project to fail to load
+}
+
+func (i CompatibilityIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.File, i.Field, i.Message)
+}
+
+var (
+	// knownTopLevelKeys are the top-level elements of the compose specification supported by the bundled compose version
+	knownTopLevelKeys = []string{"version", "name", "include", "services", "networks", "volumes", "secrets", "configs"}
+
+	// knownServiceKeys are the service attributes of the compose specification supported by the bundled compose version
+	knownServiceKeys = []string{
+		"annotations", "attach", "blkio_config", "build", "cap_add", "cap_drop", "cgroup", "cgroup_parent",
+		"command", "configs", "container_name", "cpu_count", "cpu_percent", "cpu_period", "cpu_quota",
+		"cpu_rt_period", "cpu_rt_runtime", "cpu_shares", "cpus", "cpuset", "credential_spec", "depends_on",
+		"deploy", "develop", "device_cgroup_rules", "devices", "dns", "dns_opt", "dns_search", "domainname",
+		"entrypoint", "env_file", "environment", "expose", "extends", "external_links", "extra_hosts", "gpus",
+		"group_add", "healthcheck", "hostname", "image", "init", "ipc", "isolation", "label_file", "labels",
+		"links", "logging", "mac_address", "mem_limit", "mem_reservation", "mem_swappiness", "memswap_limit",
+		"network_mode", "networks", "oom_kill_disable", "oom_score_adj", "pid", "pids_limit", "platform",
+		"ports", "post_start", "pre_stop", "privileged", "profiles", "pull_policy", "read_only", "restart",
+		"runtime", "scale", "secrets", "security_opt", "shm_size", "stdin_open", "stop_grace_period",
+		"stop_signal", "storage_opt", "sysctls", "tmpfs", "tty", "ulimits", "user", "userns_mode", "uts",
+		"volumes", "volumes_from", "working_dir",
+	}
+)
+
+// isExtension checks if a key is an extension field (x-*), which compose ignores
+func isExtension(key string) bool {
+	return strings.HasPrefix(key, "x-")
+}
+
+// CheckComposeCompatibility checks the compose files for deprecated constructs and for elements
+// that are unknown to the bundled compose version, e.g. because they were added in a newer version
+func CheckComposeCompatibility(workingDir string, composeFiles []string) ([]CompatibilityIssue, error) {
+	var issues []CompatibilityIssue
+
+	for _, f := range composeFiles {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(workingDir, f)
+		}
+
+		content, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		var doc map[string]any
+
+		err = yaml.Unmarshal(content, &doc)
+		if err != nil {
+			// Syntax errors are reported when the project gets loaded
+			continue
+		}
+
+		issues = append(issues, checkComposeDocument(filepath.Base(f), doc)...)
+	}
+
+	return issues, nil
+}
+
+// checkComposeDocument returns the compatibility issues of a single parsed compose file
+func checkComposeDocument(file string, doc map[string]any) []CompatibilityIssue {
+	var issues []CompatibilityIssue
+
+	for key := range doc {
+		switch {
+		case key == "version":
+			issues = append(issues, CompatibilityIssue{
+				File:       file,
+				Field:      key,
+				Message:    "the version element is obsolete and ignored, remove it",
+				Deprecated: true,
+			})
+		case !isExtension(key) && !slices.Contains(knownTopLevelKeys, key):
+			issues = append(issues, CompatibilityIssue{
+				File:    file,
+				Field:   key,
+				Message: "unknown top-level element, it may require a newer compose version than the one bundled with doco-cd",
+			})
+		}
+	}
+
+	services, _ := doc["services"].(map[string]any)
+
+	for name, s := range services {
+		service, ok := s.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		for key := range service {
+			if isExtension(key) || slices.Contains(knownServiceKeys, key) {
+				continue
+			}
+
+			issues = append(issues, CompatibilityIssue{
+				File:    file,
+				Field:   "services." + name + "." + key,
+				Message: "unknown service attribute, it may require a newer compose version than the one bundled with doco-cd",
+			})
+		}
+	}
+
+	slices.SortFunc(issues, func(a, b CompatibilityIssue) int {
+		return strings.Compare(a.Field, b.Field)
+	})
+
+	return issues
+}
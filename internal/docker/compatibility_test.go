@@ -0,0 +1,72 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckComposeCompatibility(t *testing.T) {
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	createComposeFile(t, filepath.Join(dirName, "test.compose.yaml"), `version: "3.8"
+x-defaults: &defaults
+  restart: always
+services:
+  test:
+    image: nginx:latest
+    x-custom: true
+    use_api_socket: true
+models:
+  llm:
+    model: ai/smollm2
+`)
+
+	issues, err := CheckComposeCompatibility(dirName, []string{"test.compose.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []CompatibilityIssue{
+		{File: "test.compose.yaml", Field: "models"},
+		{File: "test.compose.yaml", Field: "services.test.use_api_socket"},
+		{File: "test.compose.yaml", Field: "version", Deprecated: true},
+	}
+
+	if len(issues) != len(expected) {
+		t.Fatalf("expected %d issues, got %d: %v", len(expected), len(issues), issues)
+	}
+
+	for i, e := range expected {
+		if issues[i].File != e.File || issues[i].Field != e.Field || issues[i].Deprecated != e.Deprecated {
+			t.Errorf("expected issue %v, got %v", e, issues[i])
+		}
+	}
+}
+
+func TestCheckComposeCompatibility_Supported(t *testing.T) {
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	createComposeFile(t, filepath.Join(dirName, "test.compose.yaml"), composeContents)
+
+	issues, err := CheckComposeCompatibility(dirName, []string{"test.compose.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(issues) != 0 {
+		t.Errorf("expected no issues, got %v", issues)
+	}
+}
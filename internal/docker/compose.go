@@ -3,18 +3,25 @@ package docker
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/kimdre/doco-cd/internal/git"
 	"github.com/kimdre/doco-cd/internal/webhook"
 
 	"github.com/kimdre/doco-cd/internal/config"
@@ -26,6 +33,7 @@ import (
 	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/docker/compose/v2/pkg/api"
 	"github.com/docker/compose/v2/pkg/compose"
+	"github.com/docker/docker/client"
 )
 
 const (
@@ -36,6 +44,7 @@ const (
 var (
 	ErrDockerSocketConnectionFailed = errors.New("failed to connect to docker socket")
 	ErrNoContainerToStart           = errors.New("no container to start")
+	ErrProjectNameMismatch          = errors.New("project name does not match the stack name")
 )
 
 // ConnectToSocket connects to the docker socket
@@ -165,38 +174,491 @@ func CreateDockerCli(quiet, verifyTLS bool) (command.Cli, error) {
 	return dockerCli, nil
 }
 
+// CreateJobDockerCli returns a docker cli that shares the API client of dockerCli, but writes its output
+// (e.g. the build progress) to w, so that it can be attributed to a single deployment
+func CreateJobDockerCli(dockerCli command.Cli, w io.Writer) (command.Cli, error) {
+	jobCli, err := command.NewDockerCli(
+		command.WithAPIClient(dockerCli.Client()),
+		command.WithOutputStream(w),
+		command.WithErrorStream(w),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker cli: %w", err)
+	}
+
+	// The API client is already set, so this only loads the cli configuration, e.g. the registry credentials
+	err = jobCli.Initialize(&flags.ClientOptions{Context: "default", LogLevel: "error"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize docker cli: %w", err)
+	}
+
+	return jobCli, nil
+}
+
+// prepareProject adds the labels of the deployment to the project and applies the scale of the deploy config
+func prepareProject(project *types.Project, deployConfig *config.DeployConfig, payload webhook.ParsedPayload) error {
+	addServiceLabels(project, deployConfig, payload)
+
+	err := addContentHashLabels(project, deployConfig.RecreateOnMountedFileChange)
+	if err != nil {
+		return err
+	}
+
+	return applyScale(project, deployConfig.Scale)
+}
+
 /*
 addServiceLabels adds the labels docker compose expects to exist on services.
 This is required for future compose operations to work, such as finding
 containers that are part of a service.
+The custom labels of the deploy config are added to all services and volumes of the project,
+labels that are set in the compose file take precedence over them.
 */
-func addServiceLabels(project *types.Project, payload webhook.ParsedPayload) {
+func addServiceLabels(project *types.Project, deployConfig *config.DeployConfig, payload webhook.ParsedPayload) {
 	for i, s := range project.Services {
-		s.CustomLabels = map[string]string{
+		s.CustomLabels = make(map[string]string)
+
+		for k, v := range deployConfig.Labels {
+			if _, ok := s.Labels[k]; !ok {
+				s.CustomLabels[k] = v
+			}
+		}
+
+		maps.Copy(s.CustomLabels, map[string]string{
 			"cd.doco.deployedAt":           time.Now().UTC().Format(time.RFC3339),
 			"cd.doco.repository.name":      payload.FullName,
+			"cd.doco.repository.url":       git.GetUrlWithoutAuth(payload.CloneURL),
 			"cd.doco.repository.private":   strconv.FormatBool(payload.Private),
 			"cd.doco.repository.reference": payload.Ref,
 			"cd.doco.repository.commit":    payload.CommitSHA,
+			profilesLabel:                  strings.Join(deployConfig.Profiles, ","),
+			registryWatchIntervalLabel:     deployConfig.RegistryWatchInterval,
+			"cd.doco.config.source":        deployConfig.Source(),
 			api.ProjectLabel:               project.Name,
 			api.ServiceLabel:               s.Name,
 			api.VersionLabel:               api.ComposeVersion,
 			api.WorkingDirLabel:            project.WorkingDir,
 			api.ConfigFilesLabel:           strings.Join(project.ComposeFiles, ","),
 			api.OneoffLabel:                "False", // default, will be overridden by `run` command
-		}
+		})
 		project.Services[i] = s
 	}
+
+	for name, v := range project.Volumes {
+		if v.External || len(deployConfig.Labels) == 0 {
+			continue
+		}
+
+		if v.Labels == nil {
+			v.Labels = types.Labels{}
+		}
+
+		for k, value := range deployConfig.Labels {
+			if _, ok := v.Labels[k]; !ok {
+				v.Labels[k] = value
+			}
+		}
+
+		project.Volumes[name] = v
+	}
+}
+
+const (
+	profilesLabel              = "cd.doco.profiles"
+	registryWatchIntervalLabel = "cd.doco.registry.watchInterval"
+)
+
+// GetDeployedProfiles returns the compose profiles that were active when the project was deployed
+// and whether they were recorded, i.e. the project was deployed by doco-cd before
+func GetDeployedProfiles(ctx context.Context, apiClient client.APIClient, projectName string) ([]string, bool, error) {
+	containers, err := GetProjectContainers(ctx, apiClient, projectName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, c := range containers {
+		value, ok := c.Labels[profilesLabel]
+		if !ok {
+			continue
+		}
+
+		if value == "" {
+			return []string{}, true, nil
+		}
+
+		return strings.Split(value, ","), true, nil
+	}
+
+	return nil, false, nil
+}
+
+// ResolveProfiles returns the profiles to activate for a deployment and the deployed profiles that get deactivated.
+// If no profiles are configured (nil), the deployed profiles are kept, so that a redeployment doesn't remove profiled services.
+func ResolveProfiles(configured, deployed []string) ([]string, []string) {
+	if configured == nil {
+		return deployed, nil
+	}
+
+	var dropped []string
+
+	for _, p := range deployed {
+		if !slices.Contains(configured, p) {
+			dropped = append(dropped, p)
+		}
+	}
+
+	return configured, dropped
+}
+
+var ErrNoActiveServices = errors.New("project has no active services")
+
+/*
+CheckActiveServices checks that the project has services after the profiles were applied, so that its deployment starts containers.
+The error lists the inactive services with the profiles that activate them, e.g. web (profiles: debug, dev).
+*/
+func CheckActiveServices(project *types.Project) error {
+	if len(project.Services) > 0 {
+		return nil
+	}
+
+	if len(project.DisabledServices) == 0 {
+		return fmt.Errorf("%w: the compose files do not define any services", ErrNoActiveServices)
+	}
+
+	names := make([]string, 0, len(project.DisabledServices))
+	for name := range project.DisabledServices {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	inactive := make([]string, 0, len(names))
+
+	for _, name := range names {
+		profiles := slices.Clone(project.DisabledServices[name].Profiles)
+		slices.Sort(profiles)
+
+		inactive = append(inactive, fmt.Sprintf("%s (profiles: %s)", name, strings.Join(profiles, ", ")))
+	}
+
+	return fmt.Errorf("%w: inactive services are %s", ErrNoActiveServices, strings.Join(inactive, ", "))
+}
+
+// IsFirstDeploy checks if a project has never been deployed by doco-cd, i.e. no container of the project has its labels
+func IsFirstDeploy(ctx context.Context, apiClient client.APIClient, projectName string) (bool, error) {
+	containers, err := GetProjectContainers(ctx, apiClient, projectName)
+	if err != nil {
+		return false, err
+	}
+
+	for _, c := range containers {
+		if _, ok := c.Labels["cd.doco.deployedAt"]; ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+const (
+	configsHashLabel    = "cd.doco.configs.hash"
+	secretsHashLabel    = "cd.doco.secrets.hash"
+	bindMountsHashLabel = "cd.doco.bind_mounts.hash"
+)
+
+// hashFileObjects returns a hash of the contents of the file objects (configs or secrets) with the given names
+func hashFileObjects(project *types.Project, objects map[string]types.FileObjectConfig, names []string) (string, error) {
+	slices.Sort(names)
+
+	h := sha256.New()
+
+	for _, name := range names {
+		obj, ok := objects[name]
+		if !ok || obj.External {
+			continue
+		}
+
+		var content []byte
+
+		switch {
+		case obj.File != "":
+			f := obj.File
+			if !filepath.IsAbs(f) {
+				f = filepath.Join(project.WorkingDir, f)
+			}
+
+			data, err := os.ReadFile(f)
+			if err != nil {
+				return "", fmt.Errorf("failed to read %s: %w", name, err)
+			}
+
+			content = data
+		case obj.Environment != "":
+			content = []byte(project.Environment[obj.Environment])
+		default:
+			content = []byte(obj.Content)
+		}
+
+		// Include the name, so that switching the contents of two objects changes the hash
+		_, _ = fmt.Fprintf(h, "%s\x00%d\x00", name, len(content))
+		_, _ = h.Write(content)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+/*
+hashBindMounts returns a hash of the contents of the single-file bind mounts of a service whose source is inside
+the project directory, or an empty string if the service has none. A file bind mount keeps pointing to the
+replaced file after a checkout, so the container has to be recreated to see the new content.
+Directory bind mounts are skipped, as changes to the files inside them are visible in the running container.
+*/
+func hashBindMounts(project *types.Project, s types.ServiceConfig) (string, error) {
+	var mounts []types.ServiceVolumeConfig
+
+	for _, v := range s.Volumes {
+		if v.Type != types.VolumeTypeBind || v.Source == "" {
+			continue
+		}
+
+		source := v.Source
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(project.WorkingDir, source)
+		}
+
+		rel, err := filepath.Rel(project.WorkingDir, source)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		info, err := os.Stat(source)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		v.Source = source
+		mounts = append(mounts, v)
+	}
+
+	if len(mounts) == 0 {
+		return "", nil
+	}
+
+	slices.SortFunc(mounts, func(a, b types.ServiceVolumeConfig) int {
+		return strings.Compare(a.Target, b.Target)
+	})
+
+	h := sha256.New()
+
+	for _, m := range mounts {
+		content, err := os.ReadFile(m.Source)
+		if err != nil {
+			return "", fmt.Errorf("failed to read bind mount %s: %w", m.Source, err)
+		}
+
+		_, _ = fmt.Fprintf(h, "%s\x00%d\x00", m.Target, len(content))
+		_, _ = h.Write(content)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+var ErrUndefinedSecret = errors.New("secret is not defined in the compose project")
+
+var invalidEnvChars = regexp.MustCompile(`[^A-Z0-9_]+`)
+
+/*
+SetSecretContents replaces the source of the secrets in the project with the given contents. The contents are
+passed to compose as environment secrets, so that compose copies them into the containers without writing them to disk.
+*/
+func SetSecretContents(project *types.Project, contents map[string]string) error {
+	for name, content := range contents {
+		secret, ok := project.Secrets[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUndefinedSecret, name)
+		}
+
+		envKey := "DOCO_CD_SECRET_" + invalidEnvChars.ReplaceAllString(strings.ToUpper(name), "_")
+
+		if project.Environment == nil {
+			project.Environment = types.Mapping{}
+		}
+
+		project.Environment[envKey] = content
+
+		secret.File = ""
+		secret.Content = ""
+		secret.External = false
+		secret.Environment = envKey
+
+		project.Secrets[name] = secret
+	}
+
+	return nil
+}
+
+/*
+addContentHashLabels adds labels with a hash of the contents of the configs, secrets and single-file bind mounts
+used by each service. As the labels are part of the service configuration, compose recreates a container when the
+content of one of its configs, secrets or mounted files changes, even if the file path in the compose file stayed the same.
+The bind mounts are only hashed if bindMounts is true.
+*/
+func addContentHashLabels(project *types.Project, bindMounts bool) error {
+	configs := make(map[string]types.FileObjectConfig, len(project.Configs))
+	for name, c := range project.Configs {
+		configs[name] = types.FileObjectConfig(c)
+	}
+
+	secrets := make(map[string]types.FileObjectConfig, len(project.Secrets))
+	for name, s := range project.Secrets {
+		secrets[name] = types.FileObjectConfig(s)
+	}
+
+	for name, s := range project.Services {
+		var configNames, secretNames []string
+
+		for _, c := range s.Configs {
+			configNames = append(configNames, c.Source)
+		}
+
+		for _, c := range s.Secrets {
+			secretNames = append(secretNames, c.Source)
+		}
+
+		var bindMountsHash string
+
+		if bindMounts {
+			var err error
+
+			bindMountsHash, err = hashBindMounts(project, s)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(configNames) == 0 && len(secretNames) == 0 && bindMountsHash == "" {
+			continue
+		}
+
+		if s.Labels == nil {
+			s.Labels = types.Labels{}
+		}
+
+		if len(configNames) > 0 {
+			hash, err := hashFileObjects(project, configs, configNames)
+			if err != nil {
+				return err
+			}
+
+			s.Labels[configsHashLabel] = hash
+		}
+
+		if len(secretNames) > 0 {
+			hash, err := hashFileObjects(project, secrets, secretNames)
+			if err != nil {
+				return err
+			}
+
+			s.Labels[secretsHashLabel] = hash
+		}
+
+		if bindMountsHash != "" {
+			s.Labels[bindMountsHashLabel] = bindMountsHash
+		}
+
+		project.Services[name] = s
+	}
+
+	return nil
+}
+
+/*
+WithDotEnvPrecedence sets the precedence of the .env file in the project directory relative to the env files of the options,
+one of config.DotEnvIgnore, config.DotEnvLower or config.DotEnvHigher. Without a precedence the .env file is only loaded
+if no env files are set. It has to be applied after the env files and the working directory of the options.
+*/
+func WithDotEnvPrecedence(precedence string) cli.ProjectOptionsFn {
+	return func(o *cli.ProjectOptions) error {
+		if precedence == "" {
+			return nil
+		}
+
+		workingDir, err := o.GetWorkingDir()
+		if err != nil {
+			return err
+		}
+
+		dotEnv := filepath.Join(workingDir, ".env")
+		envFiles := slices.DeleteFunc(slices.Clone(o.EnvFiles), func(f string) bool {
+			return f == dotEnv
+		})
+
+		if precedence == config.DotEnvIgnore {
+			o.EnvFiles = append([]string{}, envFiles...)
+
+			return nil
+		}
+
+		if _, err = os.Stat(dotEnv); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+
+			return err
+		}
+
+		switch precedence {
+		case config.DotEnvLower:
+			o.EnvFiles = append([]string{dotEnv}, envFiles...)
+		case config.DotEnvHigher:
+			o.EnvFiles = append(envFiles, dotEnv)
+		}
+
+		return nil
+	}
+}
+
+/*
+loadDotEnv loads the env files (cli.WithEnvFiles) into the environment used for interpolation, like docker compose does.
+If no env files are set (nil), the .env file in the project directory is loaded if it exists.
+Variables that are already set in the environment take precedence, the environment of doco-cd itself is not used.
+*/
+func loadDotEnv(o *cli.ProjectOptions) error {
+	// An empty list of env files means that the .env file is ignored
+	if o.EnvFiles == nil {
+		err := cli.WithEnvFiles()(o)
+		if err != nil {
+			return err
+		}
+	}
+
+	return cli.WithDotEnv(o)
 }
 
-// LoadCompose parses and loads Compose files as specified by the Docker Compose specification
-func LoadCompose(ctx context.Context, workingDir, projectName string, composeFiles []string) (*types.Project, error) {
+// LoadCompose parses and loads Compose files as specified by the Docker Compose specification.
+// Additional project options are applied after the defaults, e.g. cli.WithWorkingDirectory to
+// resolve relative paths against a different project directory than the working directory.
+// The project name is always projectName, it can not be changed by the options, the name field of the
+// compose files or variables like COMPOSE_PROJECT_NAME in the environment or env files.
+func LoadCompose(ctx context.Context, workingDir, projectName string, composeFiles []string, opts ...cli.ProjectOptionsFn) (*types.Project, error) {
+	// Resolve relative compose files against the working directory instead of the current directory
+	configPaths := make([]string, len(composeFiles))
+
+	for i, f := range composeFiles {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(workingDir, f)
+		}
+
+		configPaths[i] = f
+	}
+
 	options, err := cli.NewProjectOptions(
-		composeFiles,
-		cli.WithName(projectName),
-		cli.WithWorkingDirectory(workingDir),
-		cli.WithInterpolation(true),
-		cli.WithResolvedPaths(true),
+		configPaths,
+		append(append([]cli.ProjectOptionsFn{
+			cli.WithWorkingDirectory(workingDir),
+			cli.WithInterpolation(true),
+			cli.WithResolvedPaths(true),
+		}, opts...), loadDotEnv, cli.WithName(projectName))...,
 	)
 	if err != nil {
 		return nil, err
@@ -207,27 +669,194 @@ func LoadCompose(ctx context.Context, workingDir, projectName string, composeFil
 		return nil, err
 	}
 
+	// Managing a stack with another name could replace or remove the containers of an unrelated stack
+	if project.Name != projectName {
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrProjectNameMismatch, projectName, project.Name)
+	}
+
 	return project, nil
 }
 
-// DeployCompose deploys a project as specified by the Docker Compose specification (LoadCompose)
-func DeployCompose(ctx context.Context, dockerCli command.Cli, project *types.Project, deployConfig *config.DeployConfig, payload webhook.ParsedPayload) error {
-	service := compose.NewComposeService(dockerCli)
+// GetProjectImages returns the unique images used by the services of a project
+func GetProjectImages(project *types.Project) []string {
+	var images []string
 
-	addServiceLabels(project, payload)
+	for _, name := range project.ServiceNames() {
+		image := project.Services[name].Image
+		if image == "" || slices.Contains(images, image) {
+			continue
+		}
 
-	if deployConfig.ForceImagePull {
-		err := service.Pull(ctx, project, api.PullOptions{
-			Quiet: true,
-		})
-		if err != nil {
-			return err
+		images = append(images, image)
+	}
+
+	return images
+}
+
+var ErrInvalidScale = errors.New("invalid scale")
+
+// applyScale sets the number of replicas of the services in the project
+func applyScale(project *types.Project, scale map[string]int) error {
+	for name, replicas := range scale {
+		s, ok := project.Services[name]
+		if !ok {
+			return fmt.Errorf("%w: service %s does not exist in project", ErrInvalidScale, name)
 		}
+
+		if replicas > 1 {
+			for _, p := range s.Ports {
+				if p.Published != "" && !strings.Contains(p.Published, "-") {
+					return fmt.Errorf("%w: service %s publishes the fixed host port %s and can't be scaled to %d replicas",
+						ErrInvalidScale, name, p.Published, replicas)
+				}
+			}
+		}
+
+		s.Scale = &replicas
+		if s.Deploy != nil {
+			s.Deploy.Replicas = &replicas
+		}
+
+		project.Services[name] = s
 	}
 
-	recreateType := api.RecreateDiverged
+	return nil
+}
+
+/*
+SetDefaultNetworkDriverOpts sets the driver options (e.g. com.docker.network.driver.mtu) of the networks that get created for
+the project, including its default network. Networks that set driver options in the compose files keep their own options.
+*/
+func SetDefaultNetworkDriverOpts(project *types.Project, opts map[string]string) {
+	if len(opts) == 0 {
+		return
+	}
+
+	for name, n := range project.Networks {
+		if n.External || len(n.DriverOpts) > 0 {
+			continue
+		}
+
+		n.DriverOpts = maps.Clone(opts)
+		project.Networks[name] = n
+	}
+}
+
+// getStopTimeout returns the timeout for stopping containers that get recreated.
+// If no stop grace period is set, nil is returned so that the stop_grace_period of each service is used.
+func getStopTimeout(stopGracePeriod string) (*time.Duration, error) {
+	if stopGracePeriod == "" {
+		return nil, nil
+	}
+
+	timeout, err := time.ParseDuration(stopGracePeriod)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stop grace period: %w", err)
+	}
+
+	return &timeout, nil
+}
+
+// recreateTypes maps the recreate strategies of the deploy config to the recreate types of compose
+var recreateTypes = map[string]string{
+	config.RecreateDiverged: api.RecreateDiverged,
+	config.RecreateForce:    api.RecreateForce,
+	config.RecreateNever:    api.RecreateNever,
+}
+
+/*
+getRecreateTypes returns the compose recreate types for the services and for their dependencies.
+The recreate_strategy of the deploy config takes precedence over force_recreate, the dependencies use
+the recreate type of the services unless recreate_dependencies is set.
+*/
+func getRecreateTypes(deployConfig *config.DeployConfig) (string, string) {
+	recreate := api.RecreateDiverged
 	if deployConfig.ForceRecreate {
-		recreateType = api.RecreateForce
+		recreate = api.RecreateForce
+	}
+
+	if t, ok := recreateTypes[deployConfig.RecreateStrategy]; ok {
+		recreate = t
+	}
+
+	dependencies := recreate
+	if t, ok := recreateTypes[deployConfig.RecreateDependencies]; ok {
+		dependencies = t
+	}
+
+	return recreate, dependencies
+}
+
+// buildKitCli is a docker cli that enables or disables BuildKit as set by DOCKER_BUILDKIT in the compose environment of a stack
+type buildKitCli struct {
+	command.Cli
+	enabled bool
+}
+
+func (c *buildKitCli) BuildKitEnabled() (bool, error) {
+	return c.enabled, nil
+}
+
+/*
+applyComposeEnvironment adds the compose environment of a stack to the project environment, where docker compose reads
+the variables from instead of the process environment, so stacks with different compose environments can be deployed in parallel.
+DOCKER_BUILDKIT is read by the docker cli, the returned cli enables or disables BuildKit accordingly.
+*/
+func applyComposeEnvironment(dockerCli command.Cli, project *types.Project, env map[string]string) (command.Cli, error) {
+	if len(env) == 0 {
+		return dockerCli, nil
+	}
+
+	if project.Environment == nil {
+		project.Environment = make(types.Mapping)
+	}
+
+	maps.Copy(project.Environment, env)
+
+	if v, ok := env["DOCKER_BUILDKIT"]; ok {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid compose environment variable DOCKER_BUILDKIT: %w", err)
+		}
+
+		return &buildKitCli{Cli: dockerCli, enabled: enabled}, nil
+	}
+
+	return dockerCli, nil
+}
+
+// newComposeService returns a compose service for the project with the compose environment of the deploy config
+func newComposeService(dockerCli command.Cli, project *types.Project, deployConfig *config.DeployConfig) (api.Service, error) {
+	dockerCli, err := applyComposeEnvironment(dockerCli, project, deployConfig.ComposeEnvironment)
+	if err != nil {
+		return nil, err
+	}
+
+	service := compose.NewComposeService(dockerCli)
+
+	if v, ok := deployConfig.ComposeEnvironment["COMPOSE_PARALLEL_LIMIT"]; ok {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid compose environment variable COMPOSE_PARALLEL_LIMIT: %w", err)
+		}
+
+		service.MaxConcurrency(limit)
+	}
+
+	return service, nil
+}
+
+// BuildCompose builds the images of the services of a project with the build options of the deploy config,
+// it waits for a free build slot if the maximum number of concurrent builds (SetMaxConcurrentBuilds) is reached
+func BuildCompose(ctx context.Context, dockerCli command.Cli, project *types.Project, deployConfig *config.DeployConfig) error {
+	// Stacks that only pull images do not wait for a build slot behind the builds of other stacks
+	if !HasBuild(project) {
+		return nil
+	}
+
+	service, err := newComposeService(dockerCli, project, deployConfig)
+	if err != nil {
+		return err
 	}
 
 	// Convert deployConfig.BuildOpts.Args to types.MappingWithEquals
@@ -242,9 +871,77 @@ func DeployCompose(ctx context.Context, dockerCli command.Cli, project *types.Pr
 		Progress: "auto",
 		Args:     buildArgs,
 		NoCache:  deployConfig.BuildOpts.NoCache,
+		Builder:  deployConfig.ComposeEnvironment["BUILDX_BUILDER"],
+	}
+
+	if progress, ok := deployConfig.ComposeEnvironment["BUILDKIT_PROGRESS"]; ok {
+		buildOpts.Progress = progress
+	}
+
+	release, err := acquireBuildSlot(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for a free build slot: %w", err)
+	}
+
+	defer release()
+
+	return service.Build(ctx, project, buildOpts)
+}
+
+// DeployCompose deploys a project as specified by the Docker Compose specification (LoadCompose)
+func DeployCompose(ctx context.Context, dockerCli command.Cli, project *types.Project, deployConfig *config.DeployConfig, payload webhook.ParsedPayload) error {
+	// Projects without active services (e.g. all services have inactive profiles) have nothing to create or start,
+	// the containers of services with inactive profiles are not removed as orphans either
+	if len(project.Services) == 0 {
+		return nil
+	}
+
+	err := prepareProject(project, deployConfig, payload)
+	if err != nil {
+		return err
 	}
 
-	err := service.Build(ctx, project, buildOpts)
+	service, err := newComposeService(dockerCli, project, deployConfig)
+	if err != nil {
+		return err
+	}
+
+	if deployConfig.CheckPortConflicts {
+		err = CheckPortConflicts(ctx, dockerCli.Client(), project)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = CheckExternalNetworks(ctx, dockerCli.Client(), project, deployConfig.CreateExternalNetworks)
+	if err != nil {
+		return err
+	}
+
+	if deployConfig.CheckBindMounts {
+		err = CheckBindMounts(project, deployConfig.CreateBindMountDirs, deployConfig.BindMountOwner)
+		if err != nil {
+			return err
+		}
+	}
+
+	if deployConfig.ForceImagePull {
+		err = pullImages(ctx, service, project)
+		if err != nil {
+			return err
+		}
+	}
+
+	recreateType, recreateDependencies := getRecreateTypes(deployConfig)
+
+	if !deployConfig.Prebuilt {
+		err = BuildCompose(ctx, dockerCli, project, deployConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	stopTimeout, err := getStopTimeout(deployConfig.StopGracePeriod)
 	if err != nil {
 		return err
 	}
@@ -252,8 +949,9 @@ func DeployCompose(ctx context.Context, dockerCli command.Cli, project *types.Pr
 	createOpts := api.CreateOptions{
 		RemoveOrphans:        deployConfig.RemoveOrphans,
 		Recreate:             recreateType,
-		RecreateDependencies: recreateType,
+		RecreateDependencies: recreateDependencies,
 		QuietPull:            true,
+		Timeout:              stopTimeout,
 	}
 
 	startOpts := api.StartOptions{
@@ -266,16 +964,61 @@ func DeployCompose(ctx context.Context, dockerCli command.Cli, project *types.Pr
 		Create: createOpts,
 		Start:  startOpts,
 	})
-	if err != nil {
-		if errors.Is(err, ErrNoContainerToStart) {
-			err = service.Start(ctx, project.Name, startOpts)
-			if err != nil {
-				return err
-			}
-		} else {
-			return err
+	if !isNoContainerToStart(err) {
+		return err
+	}
+
+	switch deployConfig.NoContainerToStart {
+	case config.NoContainerIgnore:
+		return nil
+	case config.NoContainerFail:
+		return err
+	}
+
+	// One-shot services are not started again, they already ran when their containers were created
+	startOpts.Services = getStartableServices(project)
+	if len(startOpts.Services) == 0 {
+		return nil
+	}
+
+	return service.Start(ctx, project.Name, startOpts)
+}
+
+// isNoContainerToStart checks if docker compose failed because there was no container to start
+func isNoContainerToStart(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, ErrNoContainerToStart) {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+
+	return strings.Contains(msg, "no container to start") || strings.Contains(msg, "no containers to start")
+}
+
+// isOneShotService checks if the containers of a service are not restarted after they exited, e.g. database migrations
+func isOneShotService(s types.ServiceConfig) bool {
+	if s.Restart == types.RestartPolicyNo {
+		return true
+	}
+
+	return s.Deploy != nil && s.Deploy.RestartPolicy != nil && s.Deploy.RestartPolicy.Condition == "none"
+}
+
+// getStartableServices returns the sorted names of the services of a project that are not one-shot services
+func getStartableServices(project *types.Project) []string {
+	var names []string
+
+	for _, name := range project.ServiceNames() {
+		if !isOneShotService(project.Services[name]) {
+			names = append(names, name)
 		}
 	}
 
-	return nil
+	slices.Sort(names)
+
+	return names
 }
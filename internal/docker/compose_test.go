@@ -2,13 +2,19 @@ package docker
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/kimdre/doco-cd/internal/webhook"
 
+	"github.com/compose-spec/compose-go/v2/cli"
+	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/docker/compose/v2/pkg/api"
 	"github.com/docker/compose/v2/pkg/compose"
 	"github.com/kimdre/doco-cd/internal/config"
@@ -88,6 +94,899 @@ func TestLoadCompose(t *testing.T) {
 	}
 }
 
+func TestLoadCompose_ProjectDirectory(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	workingDir := filepath.Join(dirName, "compose")
+
+	err := os.Mkdir(workingDir, 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createComposeFile(t, filepath.Join(workingDir, "test.compose.yaml"), `services:
+  test:
+    image: nginx:latest
+    volumes:
+      - ./data:/data
+`)
+
+	// Bind mounts are relative to the repository root instead of the directory of the compose file
+	project, err := LoadCompose(ctx, workingDir, projectName, []string{"test.compose.yaml"}, cli.WithWorkingDirectory(dirName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedSource := filepath.Join(dirName, "data")
+
+	volumes := project.Services["test"].Volumes
+	if len(volumes) != 1 {
+		t.Fatalf("expected 1 volume, got %d", len(volumes))
+	}
+
+	if volumes[0].Source != expectedSource {
+		t.Errorf("expected bind mount source to be %s, got %s", expectedSource, volumes[0].Source)
+	}
+}
+
+func TestLoadCompose_EnvFile(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+
+	createComposeFile(t, filePath, `services:
+  test:
+    image: nginx:latest
+    env_file: service.env
+    environment:
+      DOUBLE: ${DOUBLE}
+      SINGLE: ${SINGLE}
+      COMMENT: ${COMMENT}
+      HASH: ${HASH}
+      EXPORTED: ${EXPORTED}
+      INTERPOLATED: ${INTERPOLATED}
+`)
+
+	envContent := `# This is a comment
+DOUBLE="hello world"
+SINGLE='no $interpolation'
+COMMENT=value # trailing comment
+HASH="value # not a comment"
+export EXPORTED=exported
+INTERPOLATED=${DOUBLE}!
+`
+
+	createComposeFile(t, filepath.Join(dirName, ".env"), envContent)
+	createComposeFile(t, filepath.Join(dirName, "service.env"), `SERVICE_VALUE="with spaces" # comment
+`)
+
+	expected := map[string]string{
+		"DOUBLE":        "hello world",
+		"SINGLE":        "no $interpolation",
+		"COMMENT":       "value",
+		"HASH":          "value # not a comment",
+		"EXPORTED":      "exported",
+		"INTERPOLATED":  "hello world!",
+		"SERVICE_VALUE": "with spaces",
+	}
+
+	checkEnvironment := func(t *testing.T, project *types.Project, expected map[string]string) {
+		t.Helper()
+
+		env := project.Services["test"].Environment
+
+		for k, v := range expected {
+			if value := env[k]; value == nil || *value != v {
+				t.Errorf("expected %s=%q, got %v", k, v, valueOrEmpty(value))
+			}
+		}
+	}
+
+	t.Run("Default .env", func(t *testing.T) {
+		project, err := LoadCompose(ctx, dirName, projectName, []string{filePath})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkEnvironment(t, project, expected)
+	})
+
+	t.Run("Explicit env file", func(t *testing.T) {
+		customEnv := filepath.Join(dirName, "custom.env")
+		createComposeFile(t, customEnv, `DOUBLE="custom value"
+`)
+
+		project, err := LoadCompose(ctx, dirName, projectName, []string{filePath}, cli.WithEnvFiles(customEnv))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkEnvironment(t, project, map[string]string{"DOUBLE": "custom value"})
+
+		// The default .env file is not loaded if env files are set explicitly
+		if value := project.Services["test"].Environment["SINGLE"]; value != nil && *value != "" {
+			t.Errorf("expected SINGLE to be empty, got %q", *value)
+		}
+	})
+
+	t.Run("Environment takes precedence", func(t *testing.T) {
+		project, err := LoadCompose(ctx, dirName, projectName, []string{filePath}, cli.WithEnv([]string{"DOUBLE=from environment"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkEnvironment(t, project, map[string]string{"DOUBLE": "from environment"})
+	})
+}
+
+func TestLoadCompose_DotEnvPrecedence(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+	customEnv := filepath.Join(dirName, "custom.env")
+
+	createComposeFile(t, filePath, `services:
+  test:
+    image: nginx:latest
+    environment:
+      VALUE: ${VALUE:-unset}
+`)
+	createComposeFile(t, filepath.Join(dirName, ".env"), "VALUE=dotenv\n")
+	createComposeFile(t, customEnv, "VALUE=custom\n")
+
+	testCases := []struct {
+		name       string
+		precedence string
+		envFiles   []string
+		expected   string
+	}{
+		{"Default Without Env Files", "", nil, "dotenv"},
+		{"Default With Env Files", "", []string{customEnv}, "custom"},
+		{"Ignore Without Env Files", config.DotEnvIgnore, nil, "unset"},
+		{"Ignore With Env Files", config.DotEnvIgnore, []string{customEnv}, "custom"},
+		{"Lower Precedence", config.DotEnvLower, []string{customEnv}, "custom"},
+		{"Higher Precedence", config.DotEnvHigher, []string{customEnv}, "dotenv"},
+		{"Higher Precedence Without Env Files", config.DotEnvHigher, nil, "dotenv"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var opts []cli.ProjectOptionsFn
+			if tc.envFiles != nil {
+				opts = append(opts, cli.WithEnvFiles(tc.envFiles...))
+			}
+
+			opts = append(opts, WithDotEnvPrecedence(tc.precedence))
+
+			project, err := LoadCompose(ctx, dirName, projectName, []string{filePath}, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if value := project.Services["test"].Environment["VALUE"]; value == nil || *value != tc.expected {
+				t.Errorf("expected VALUE=%q, got %v", tc.expected, valueOrEmpty(value))
+			}
+		})
+	}
+}
+
+func TestLoadCompose_ProjectNameFromEnvironment(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Setenv("COMPOSE_PROJECT_NAME", "from-os-env")
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+
+	createComposeFile(t, filePath, `name: from-compose-file
+services:
+  test:
+    image: nginx:latest
+`)
+	createComposeFile(t, filepath.Join(dirName, ".env"), "COMPOSE_PROJECT_NAME=from-env-file\n")
+
+	testCases := []struct {
+		name string
+		opts []cli.ProjectOptionsFn
+	}{
+		{"Environment And Env File", nil},
+		{"Environment Option", []cli.ProjectOptionsFn{cli.WithEnv([]string{"COMPOSE_PROJECT_NAME=from-option"})}},
+		{"Name Option", []cli.ProjectOptionsFn{cli.WithName("from-name-option")}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			project, err := LoadCompose(ctx, dirName, projectName, []string{filePath}, tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if project.Name != projectName {
+				t.Errorf("expected project name %s, got %s", projectName, project.Name)
+			}
+		})
+	}
+}
+
+func TestGetRecreateTypes(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		deployConfig         config.DeployConfig
+		expectedRecreate     string
+		expectedDependencies string
+	}{
+		{"Default", config.DeployConfig{}, api.RecreateDiverged, api.RecreateDiverged},
+		{"Force Recreate", config.DeployConfig{ForceRecreate: true}, api.RecreateForce, api.RecreateForce},
+		{"Strategy Never", config.DeployConfig{RecreateStrategy: config.RecreateNever}, api.RecreateNever, api.RecreateNever},
+		{"Strategy Overrides Force Recreate", config.DeployConfig{ForceRecreate: true, RecreateStrategy: config.RecreateDiverged}, api.RecreateDiverged, api.RecreateDiverged},
+		{"Dependencies", config.DeployConfig{RecreateStrategy: config.RecreateForce, RecreateDependencies: config.RecreateNever}, api.RecreateForce, api.RecreateNever},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recreate, dependencies := getRecreateTypes(&tc.deployConfig)
+			if recreate != tc.expectedRecreate || dependencies != tc.expectedDependencies {
+				t.Errorf("expected %s and %s, got %s and %s", tc.expectedRecreate, tc.expectedDependencies, recreate, dependencies)
+			}
+		})
+	}
+}
+
+func TestApplyComposeEnvironment(t *testing.T) {
+	project := &types.Project{Environment: types.Mapping{"FOO": "bar"}}
+	env := map[string]string{"DOCKER_BUILDKIT": "0", "COMPOSE_BAKE": "true"}
+
+	dockerCli, err := applyComposeEnvironment(nil, project, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range env {
+		if got := project.Environment[k]; got != v {
+			t.Errorf("expected %s to be %s in the project environment, got %s", k, v, got)
+		}
+	}
+
+	if project.Environment["FOO"] != "bar" {
+		t.Error("expected the project environment to be kept")
+	}
+
+	if _, ok := os.LookupEnv("COMPOSE_BAKE"); ok {
+		t.Error("expected COMPOSE_BAKE not to be set in the process environment")
+	}
+
+	enabled, err := dockerCli.BuildKitEnabled()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if enabled {
+		t.Error("expected BuildKit to be disabled")
+	}
+
+	if _, err = applyComposeEnvironment(nil, project, map[string]string{"DOCKER_BUILDKIT": "maybe"}); err == nil {
+		t.Error("expected invalid DOCKER_BUILDKIT value to be rejected")
+	}
+}
+
+func TestCheckActiveServices(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services{},
+		DisabledServices: types.Services{
+			"worker": types.ServiceConfig{Name: "worker", Profiles: []string{"jobs", "debug"}},
+			"web":    types.ServiceConfig{Name: "web", Profiles: []string{"debug"}},
+		},
+	}
+
+	err := CheckActiveServices(project)
+	if !errors.Is(err, ErrNoActiveServices) {
+		t.Fatalf("expected error %v, got %v", ErrNoActiveServices, err)
+	}
+
+	expected := "project has no active services: inactive services are web (profiles: debug), worker (profiles: debug, jobs)"
+	if err.Error() != expected {
+		t.Errorf("expected error message %q, got %q", expected, err.Error())
+	}
+
+	project.Services["web"] = project.DisabledServices["web"]
+
+	if err = CheckActiveServices(project); err != nil {
+		t.Errorf("expected no error with an active service, got %v", err)
+	}
+}
+
+func TestSetDefaultNetworkDriverOpts(t *testing.T) {
+	opts := map[string]string{"com.docker.network.driver.mtu": "1400"}
+
+	project := &types.Project{
+		Networks: types.Networks{
+			"default":  types.NetworkConfig{Name: "test_default"},
+			"explicit": types.NetworkConfig{Name: "test_explicit", DriverOpts: map[string]string{"com.docker.network.driver.mtu": "9000"}},
+			"external": types.NetworkConfig{Name: "proxy", External: true},
+		},
+	}
+
+	SetDefaultNetworkDriverOpts(project, opts)
+
+	expected := map[string]map[string]string{
+		"default":  opts,
+		"explicit": {"com.docker.network.driver.mtu": "9000"},
+		"external": nil,
+	}
+
+	for name, driverOpts := range expected {
+		if !maps.Equal(project.Networks[name].DriverOpts, driverOpts) {
+			t.Errorf("expected driver options of network %s to be %v, got %v", name, driverOpts, project.Networks[name].DriverOpts)
+		}
+	}
+}
+
+func TestApplyScale(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+
+	createComposeFile(t, filePath, `services:
+  worker:
+    image: nginx:latest
+  web:
+    image: nginx:latest
+    ports:
+      - "8080:80"
+`)
+
+	testCases := []struct {
+		name          string
+		scale         map[string]int
+		expectedError error
+	}{
+		{"Scale Worker", map[string]int{"worker": 3}, nil},
+		{"Fixed Host Port", map[string]int{"web": 2}, ErrInvalidScale},
+		{"Unknown Service", map[string]int{"unknown": 2}, ErrInvalidScale},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			project, err := LoadCompose(ctx, dirName, projectName, []string{filePath})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = applyScale(project, tc.scale)
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("expected error to be %v, got %v", tc.expectedError, err)
+			}
+
+			if tc.expectedError != nil {
+				return
+			}
+
+			for name, replicas := range tc.scale {
+				if s := project.Services[name]; s.Scale == nil || *s.Scale != replicas {
+					t.Errorf("expected service %s to have %d replicas, got %v", name, replicas, s.Scale)
+				}
+			}
+		})
+	}
+}
+
+func TestAddContentHashLabels(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+	configPath := filepath.Join(dirName, "app.conf")
+
+	createComposeFile(t, filePath, `services:
+  test:
+    image: nginx:latest
+    configs:
+      - app
+    secrets:
+      - token
+  other:
+    image: nginx:latest
+configs:
+  app:
+    file: ./app.conf
+secrets:
+  token:
+    environment: TOKEN
+`)
+
+	getLabels := func(configContent string) map[string]string {
+		createComposeFile(t, configPath, configContent)
+
+		project, err := LoadCompose(ctx, dirName, projectName, []string{filePath}, cli.WithEnv([]string{"TOKEN=secret"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = addContentHashLabels(project, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := project.Services["other"].Labels[configsHashLabel]; ok {
+			t.Error("expected service without configs to have no config hash label")
+		}
+
+		return project.Services["test"].Labels
+	}
+
+	first := getLabels("foo=bar")
+	if first[configsHashLabel] == "" || first[secretsHashLabel] == "" {
+		t.Fatalf("expected hash labels to be set, got %v", first)
+	}
+
+	if again := getLabels("foo=bar"); again[configsHashLabel] != first[configsHashLabel] {
+		t.Error("expected config hash to be stable for the same content")
+	}
+
+	changed := getLabels("foo=baz")
+	if changed[configsHashLabel] == first[configsHashLabel] {
+		t.Error("expected config hash to change with the file content")
+	}
+
+	if changed[secretsHashLabel] != first[secretsHashLabel] {
+		t.Error("expected secret hash to stay the same")
+	}
+}
+
+func TestAddContentHashLabels_BindMounts(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	err := os.Mkdir(filepath.Join(dirName, "html"), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+
+	createComposeFile(t, filePath, `services:
+  file:
+    image: nginx:latest
+    volumes:
+      - ./nginx.conf:/etc/nginx/nginx.conf
+  readonly:
+    image: nginx:latest
+    volumes:
+      - ./nginx.conf:/etc/nginx/nginx.conf:ro
+  long:
+    image: nginx:latest
+    volumes:
+      - type: bind
+        source: ./nginx.conf
+        target: /etc/nginx/nginx.conf
+        read_only: true
+  directory:
+    image: nginx:latest
+    volumes:
+      - ./html:/usr/share/nginx/html:ro
+`)
+
+	getHashes := func(conf, index string) map[string]string {
+		createComposeFile(t, filepath.Join(dirName, "nginx.conf"), conf)
+		createComposeFile(t, filepath.Join(dirName, "html", "index.html"), index)
+
+		project, err := LoadCompose(ctx, dirName, projectName, []string{filePath})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = addContentHashLabels(project, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hashes := make(map[string]string)
+		for name, s := range project.Services {
+			hashes[name] = s.Labels[bindMountsHashLabel]
+		}
+
+		return hashes
+	}
+
+	first := getHashes("worker_processes 1;", "<h1>v1</h1>")
+
+	for _, name := range []string{"file", "readonly", "long"} {
+		if first[name] == "" {
+			t.Errorf("expected bind mount hash label for service %s", name)
+		}
+	}
+
+	if first["directory"] != "" {
+		t.Error("expected no bind mount hash label for a directory bind mount")
+	}
+
+	// Changes to files in mounted directories are visible in the running container
+	second := getHashes("worker_processes 1;", "<h1>v2</h1>")
+	if second["file"] != first["file"] || second["directory"] != "" {
+		t.Errorf("expected hashes not to change with a file in a mounted directory, got %v and %v", first, second)
+	}
+
+	third := getHashes("worker_processes 2;", "<h1>v2</h1>")
+	for _, name := range []string{"file", "readonly", "long"} {
+		if third[name] == first[name] {
+			t.Errorf("expected bind mount hash of service %s to change with the mounted file", name)
+		}
+	}
+
+	// Mounted files that are reloaded at runtime can be excluded from the hashes
+	project, err := LoadCompose(ctx, dirName, projectName, []string{filePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = addContentHashLabels(project, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, s := range project.Services {
+		if _, ok := s.Labels[bindMountsHashLabel]; ok {
+			t.Errorf("expected no bind mount hash label for service %s", name)
+		}
+	}
+}
+
+func TestResolveProfiles(t *testing.T) {
+	testCases := []struct {
+		name             string
+		configured       []string
+		deployed         []string
+		expectedProfiles []string
+		expectedDropped  []string
+	}{
+		{"Keep Deployed Profiles", nil, []string{"debug"}, []string{"debug"}, nil},
+		{"First Deploy", []string{"debug"}, nil, []string{"debug"}, nil},
+		{"Configured Profiles", []string{"debug", "metrics"}, []string{"debug"}, []string{"debug", "metrics"}, nil},
+		{"Dropped Profiles", []string{}, []string{"debug"}, []string{}, []string{"debug"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			profiles, dropped := ResolveProfiles(tc.configured, tc.deployed)
+			if !slices.Equal(profiles, tc.expectedProfiles) {
+				t.Errorf("expected profiles %v, got %v", tc.expectedProfiles, profiles)
+			}
+
+			if !slices.Equal(dropped, tc.expectedDropped) {
+				t.Errorf("expected dropped profiles %v, got %v", tc.expectedDropped, dropped)
+			}
+		})
+	}
+}
+
+func TestAddServiceLabels_Profiles(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+
+	createComposeFile(t, filePath, `services:
+  test:
+    image: nginx:latest
+  debug:
+    image: nginx:latest
+    profiles:
+      - debug
+`)
+
+	deployConfig := &config.DeployConfig{Profiles: []string{"debug"}}
+
+	project, err := LoadCompose(ctx, dirName, projectName, []string{filePath}, cli.WithProfiles(deployConfig.Profiles))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := project.Services["debug"]; !ok {
+		t.Fatal("expected profiled service to be enabled")
+	}
+
+	addServiceLabels(project, deployConfig, webhook.ParsedPayload{})
+
+	for name, s := range project.Services {
+		if s.CustomLabels[profilesLabel] != "debug" {
+			t.Errorf("expected service %s to have profiles label 'debug', got '%s'", name, s.CustomLabels[profilesLabel])
+		}
+	}
+}
+
+func TestAddServiceLabels_CustomLabels(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+
+	createComposeFile(t, filePath, `services:
+  test:
+    image: nginx:latest
+    labels:
+      backup.enable: "false"
+volumes:
+  data:
+  shared:
+    external: true
+`)
+
+	deployConfig := &config.DeployConfig{Labels: map[string]string{
+		"backup.enable": "true",
+		"team":          "web",
+	}}
+
+	project, err := LoadCompose(ctx, dirName, projectName, []string{filePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addServiceLabels(project, deployConfig, webhook.ParsedPayload{})
+
+	s := project.Services["test"]
+	if s.CustomLabels["team"] != "web" {
+		t.Errorf("expected custom label team=web on service, got %v", s.CustomLabels)
+	}
+
+	if _, ok := s.CustomLabels["backup.enable"]; ok {
+		t.Error("expected label from compose file to take precedence over the custom label")
+	}
+
+	if s.CustomLabels[api.ProjectLabel] != projectName {
+		t.Errorf("expected project label to be set, got %v", s.CustomLabels)
+	}
+
+	if project.Volumes["data"].Labels["team"] != "web" {
+		t.Errorf("expected custom label team=web on volume, got %v", project.Volumes["data"].Labels)
+	}
+
+	if _, ok := project.Volumes["shared"].Labels["team"]; ok {
+		t.Error("expected no custom labels on external volume")
+	}
+}
+
+func TestSetSecretContents(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+
+	createComposeFile(t, filePath, `services:
+  test:
+    image: nginx:latest
+    secrets:
+      - db-password
+secrets:
+  db-password:
+    environment: DB_PASSWORD
+`)
+
+	project, err := LoadCompose(ctx, dirName, projectName, []string{filePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = SetSecretContents(project, map[string]string{"unknown": "value"})
+	if !errors.Is(err, ErrUndefinedSecret) {
+		t.Fatalf("expected error to be %v, got %v", ErrUndefinedSecret, err)
+	}
+
+	err = SetSecretContents(project, map[string]string{"db-password": "s3cr3t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret := project.Secrets["db-password"]
+	if secret.Environment != "DOCO_CD_SECRET_DB_PASSWORD" || project.Environment[secret.Environment] != "s3cr3t" {
+		t.Errorf("expected secret to be provided by environment, got %+v", secret)
+	}
+
+	// The content is part of the secret hash, so that a rotated secret recreates the containers
+	err = addContentHashLabels(project, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := project.Services["test"].Labels[secretsHashLabel]
+
+	err = SetSecretContents(project, map[string]string{"db-password": "r0tated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = addContentHashLabels(project, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if project.Services["test"].Labels[secretsHashLabel] == hash {
+		t.Error("expected secret hash to change with the secret content")
+	}
+}
+
+func TestLoadCompose_Anchors(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+
+	composeTemplate := `x-environment: &environment
+  TZ: %s
+  LOG_LEVEL: info
+
+x-service: &service
+  image: nginx:latest
+  restart: unless-stopped
+  environment: *environment
+
+services:
+  web:
+    <<: *service
+  worker:
+    <<: *service
+    command: ["nginx", "-t"]
+  proxy:
+    image: nginx:latest
+`
+
+	loadHashes := func(tz string) map[string]string {
+		createComposeFile(t, filePath, fmt.Sprintf(composeTemplate, tz))
+
+		project, err := LoadCompose(ctx, dirName, projectName, []string{filePath})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := project.Extensions["x-environment"]; !ok {
+			t.Error("expected x-environment extension to be kept in the project")
+		}
+
+		if _, ok := project.Services["x-service"]; ok {
+			t.Error("expected x-service extension not to be loaded as a service")
+		}
+
+		for _, name := range []string{"web", "worker"} {
+			s := project.Services[name]
+			if s.Image != "nginx:latest" || s.Restart != "unless-stopped" {
+				t.Errorf("expected anchored service config to be merged into %s, got %+v", name, s)
+			}
+
+			if tzValue := s.Environment["TZ"]; tzValue == nil || *tzValue != tz {
+				t.Errorf("expected anchored environment TZ=%s in %s, got %v", tz, name, s.Environment)
+			}
+		}
+
+		hashes := make(map[string]string)
+
+		for name, s := range project.Services {
+			hash, err := compose.ServiceHash(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hashes[name] = hash
+		}
+
+		return hashes
+	}
+
+	before := loadHashes("UTC")
+	after := loadHashes("Europe/Berlin")
+
+	// A change to the anchored block has to recreate all services that reference it
+	for _, name := range []string{"web", "worker"} {
+		if before[name] == after[name] {
+			t.Errorf("expected config hash of %s to change with the anchored environment", name)
+		}
+	}
+
+	if before["proxy"] != after["proxy"] {
+		t.Error("expected config hash of proxy not to change")
+	}
+}
+
+func TestGetStopTimeout(t *testing.T) {
+	timeout, err := getStopTimeout("")
+	if err != nil || timeout != nil {
+		t.Fatalf("expected no timeout to use the stop grace period of the services, got %v, %v", timeout, err)
+	}
+
+	timeout, err = getStopTimeout("2m")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if timeout == nil || *timeout != 2*time.Minute {
+		t.Errorf("expected timeout of 2m, got %v", timeout)
+	}
+
+	_, err = getStopTimeout("forever")
+	if err == nil {
+		t.Error("expected error for invalid stop grace period")
+	}
+}
+
 func TestDeployCompose(t *testing.T) {
 	c, err := config.GetAppConfig()
 	p := webhook.ParsedPayload{
@@ -189,3 +1088,115 @@ compose_files:
 		}
 	}
 }
+
+func TestGetStartableServices(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	testCases := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			"One-Shot Services Only",
+			`services:
+  migrate:
+    image: alpine:latest
+    restart: "no"
+  seed:
+    image: alpine:latest
+    deploy:
+      restart_policy:
+        condition: none
+`,
+			nil,
+		},
+		{
+			"Mixed Services",
+			`services:
+  migrate:
+    image: alpine:latest
+    restart: "no"
+  web:
+    image: nginx:latest
+  worker:
+    image: alpine:latest
+    restart: unless-stopped
+`,
+			[]string{"web", "worker"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filePath := filepath.Join(dirName, "test.compose.yaml")
+			createComposeFile(t, filePath, tc.content)
+
+			project, err := LoadCompose(ctx, dirName, projectName, []string{filePath})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if services := getStartableServices(project); !slices.Equal(services, tc.expected) {
+				t.Errorf("expected startable services %v, got %v", tc.expected, services)
+			}
+		})
+	}
+}
+
+func TestIsNoContainerToStart(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{ErrNoContainerToStart, true},
+		{errors.New("no containers to start"), true},
+		{fmt.Errorf("failed to start: %w", errors.New("No container to start")), true},
+		{errors.New("container web exited (1)"), false},
+	}
+
+	for _, tc := range testCases {
+		if got := isNoContainerToStart(tc.err); got != tc.expected {
+			t.Errorf("expected isNoContainerToStart(%v) to be %v, got %v", tc.err, tc.expected, got)
+		}
+	}
+}
+
+func TestDeployCompose_NoActiveServices(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+	createComposeFile(t, filePath, `services:
+  debug:
+    image: alpine:latest
+    profiles: [debug]
+`)
+
+	project, err := LoadCompose(ctx, dirName, projectName, []string{filePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without active services nothing is deployed, so no docker client is needed
+	err = DeployCompose(ctx, nil, project, config.DefaultDeployConfig(projectName), webhook.ParsedPayload{})
+	if err != nil {
+		t.Errorf("expected deployment of project without active services to succeed, got %v", err)
+	}
+}
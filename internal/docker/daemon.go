@@ -0,0 +1,106 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/client"
+)
+
+var (
+	ErrDaemonUnavailable        = errors.New("docker daemon is unavailable")
+	ErrProjectNotInDesiredState = errors.New("project is not in the desired state after reconnecting to the docker daemon")
+)
+
+// reconnectInterval is the time between two connection attempts to the docker daemon
+var reconnectInterval = 2 * time.Second
+
+// IsConnectionLost checks if an error was caused by a lost connection to the docker daemon, e.g. because it was restarted
+func IsConnectionLost(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if client.IsErrConnectionFailed(err) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ENOENT) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	// Errors from the compose service are not always wrapped
+	msg := err.Error()
+
+	return strings.Contains(msg, "Cannot connect to the Docker daemon") ||
+		strings.Contains(msg, "connection reset by peer") ||
+		strings.Contains(msg, "connection refused")
+}
+
+// WaitForDaemon waits until the docker daemon responds to pings again or the timeout is reached
+func WaitForDaemon(ctx context.Context, log *slog.Logger, apiClient client.APIClient, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(reconnectInterval)
+	defer ticker.Stop()
+
+	for attempt := 1; ; attempt++ {
+		_, err := apiClient.Ping(ctx)
+		if err == nil {
+			log.Info("reconnected to docker daemon", slog.Int("attempt", attempt))
+			return nil
+		}
+
+		log.Warn("docker daemon is not reachable, retrying", slog.Int("attempt", attempt), slog.String("error", err.Error()))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: not reachable within %s", ErrDaemonUnavailable, timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// VerifyProjectState checks if all services of the project are deployed with the desired
+// configuration and their containers are running (or exited successfully)
+func VerifyProjectState(ctx context.Context, apiClient client.APIClient, project *types.Project) error {
+	diffs, err := DiffProject(ctx, apiClient, project)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range diffs {
+		if d.Status == DiffStatusAdded || d.Status == DiffStatusChanged {
+			return fmt.Errorf("%w: service %s is %s", ErrProjectNotInDesiredState, d.Service, d.Status)
+		}
+	}
+
+	containers, err := GetProjectContainers(ctx, apiClient, project.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range containers {
+		if c.State == "running" || strings.HasPrefix(c.Status, "Exited (0)") {
+			continue
+		}
+
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+
+		return fmt.Errorf("%w: container %s is %s", ErrProjectNotInDesiredState, name, c.State)
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func TestIsConnectionLost(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"No Error", nil, false},
+		{"Connection Refused", fmt.Errorf("dial unix /var/run/docker.sock: %w", syscall.ECONNREFUSED), true},
+		{"Daemon Message", errors.New("Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?"), true},
+		{"Other Error", errors.New("no such image"), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsConnectionLost(tc.err); got != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+)
+
+const (
+	DiffStatusAdded     = "added"     // Service exists in the desired project but is not running
+	DiffStatusRemoved   = "removed"   // Service is running but no longer exists in the desired project
+	DiffStatusChanged   = "changed"   // Service is running with a different configuration
+	DiffStatusUnchanged = "unchanged" // Service is running with the desired configuration
+)
+
+// FieldDiff is a difference of a single field between the running and the desired service
+type FieldDiff struct {
+	Field   string `json:"field"`
+	Running string `json:"running,omitempty"`
+	Desired string `json:"desired,omitempty"`
+}
+
+// ServiceDiff contains the differences between the running and the desired state of a service
+type ServiceDiff struct {
+	Service string      `json:"service"`
+	Status  string      `json:"status"`
+	Changes []FieldDiff `json:"changes,omitempty"`
+}
+
+// GetProjectContainers returns all containers (including stopped ones) that belong to a compose project
+func GetProjectContainers(ctx context.Context, apiClient client.APIClient, projectName string) ([]dockertypes.Container, error) {
+	return apiClient.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", api.ProjectLabel, projectName))),
+	})
+}
+
+// DiffProject compares the desired project with the containers that are currently running for it
+func DiffProject(ctx context.Context, apiClient client.APIClient, project *types.Project) ([]ServiceDiff, error) {
+	containers, err := GetProjectContainers(ctx, apiClient, project.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	running := make(map[string]dockertypes.ContainerJSON)
+
+	for _, c := range containers {
+		name := c.Labels[api.ServiceLabel]
+		if _, ok := running[name]; ok {
+			// Only compare the first replica of a service
+			continue
+		}
+
+		inspect, err := apiClient.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect container %s: %w", c.ID, err)
+		}
+
+		running[name] = inspect
+	}
+
+	var diffs []ServiceDiff
+
+	for _, name := range project.ServiceNames() {
+		s := project.Services[name]
+
+		inspect, ok := running[name]
+		if !ok {
+			diffs = append(diffs, ServiceDiff{Service: name, Status: DiffStatusAdded})
+			continue
+		}
+
+		changes := diffService(s, inspect)
+
+		status := DiffStatusUnchanged
+		if len(changes) > 0 {
+			status = DiffStatusChanged
+		}
+
+		diffs = append(diffs, ServiceDiff{Service: name, Status: status, Changes: changes})
+	}
+
+	for name := range running {
+		if _, ok := project.Services[name]; !ok {
+			diffs = append(diffs, ServiceDiff{Service: name, Status: DiffStatusRemoved})
+		}
+	}
+
+	return diffs, nil
+}
+
+// diffService compares the image, environment, published ports and mounts of a service with its running container,
+// changed environment variables are reported without their values
+func diffService(s types.ServiceConfig, inspect dockertypes.ContainerJSON) []FieldDiff {
+	var changes []FieldDiff
+
+	if inspect.Config == nil {
+		return changes
+	}
+
+	if s.Image != "" && s.Image != inspect.Config.Image {
+		changes = append(changes, FieldDiff{Field: "image", Running: inspect.Config.Image, Desired: s.Image})
+	}
+
+	// The container environment also contains variables set by the image,
+	// so only check that the desired variables are set to the desired values
+	for k, v := range s.Environment {
+		desired := k
+		if v != nil {
+			desired = k + "=" + *v
+		}
+
+		// Only the name of a changed variable is reported, as the values can be secrets
+		if !slices.Contains(inspect.Config.Env, desired) {
+			changes = append(changes, FieldDiff{Field: "environment." + k})
+		}
+	}
+
+	var desiredPorts, runningPorts []string
+
+	for _, p := range s.Ports {
+		if p.Published != "" {
+			desiredPorts = append(desiredPorts, fmt.Sprintf("%s:%d/%s", p.Published, p.Target, p.Protocol))
+		}
+	}
+
+	if inspect.HostConfig != nil {
+		for port, bindings := range inspect.HostConfig.PortBindings {
+			for _, b := range bindings {
+				if b.HostPort != "" {
+					runningPorts = append(runningPorts, fmt.Sprintf("%s:%s/%s", b.HostPort, port.Port(), port.Proto()))
+				}
+			}
+		}
+	}
+
+	if d := diffLists("ports", runningPorts, desiredPorts); d != nil {
+		changes = append(changes, *d)
+	}
+
+	var desiredMounts, runningMounts []string
+
+	for _, v := range s.Volumes {
+		desiredMounts = append(desiredMounts, v.Target)
+	}
+
+	for _, m := range inspect.Mounts {
+		// Anonymous volumes of the VOLUME instructions of the image are created for every container
+		if _, ok := inspect.Config.Volumes[m.Destination]; ok && m.Type == mount.TypeVolume && !slices.Contains(desiredMounts, m.Destination) {
+			continue
+		}
+
+		runningMounts = append(runningMounts, m.Destination)
+	}
+
+	if d := diffLists("mounts", runningMounts, desiredMounts); d != nil {
+		changes = append(changes, *d)
+	}
+
+	return changes
+}
+
+// diffLists compares two unordered lists and returns a FieldDiff if they differ
+func diffLists(field string, running, desired []string) *FieldDiff {
+	slices.Sort(running)
+	slices.Sort(desired)
+
+	if slices.Equal(running, desired) {
+		return nil
+	}
+
+	return &FieldDiff{Field: field, Running: strings.Join(running, ","), Desired: strings.Join(desired, ",")}
+}
+
+func valueOrEmpty(v *string) string {
+	if v == nil {
+		return ""
+	}
+
+	return *v
+}
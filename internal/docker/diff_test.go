@@ -0,0 +1,94 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+)
+
+func TestDiffService(t *testing.T) {
+	tz := "Europe/Berlin"
+
+	service := types.ServiceConfig{
+		Name:        "test",
+		Image:       "nginx:latest",
+		Environment: types.MappingWithEquals{"TZ": &tz},
+		Ports: []types.ServicePortConfig{
+			{Published: "8080", Target: 80, Protocol: "tcp"},
+		},
+	}
+
+	t.Run("Unchanged", func(t *testing.T) {
+		inspect := dockertypes.ContainerJSON{
+			ContainerJSONBase: &dockertypes.ContainerJSONBase{
+				HostConfig: &container.HostConfig{
+					PortBindings: nat.PortMap{"80/tcp": []nat.PortBinding{{HostPort: "8080"}}},
+				},
+			},
+			Config: &container.Config{
+				Image: "nginx:latest",
+				Env:   []string{"PATH=/usr/bin", "TZ=Europe/Berlin"},
+			},
+		}
+
+		changes := diffService(service, inspect)
+		if len(changes) != 0 {
+			t.Fatalf("expected no changes, got %v", changes)
+		}
+	})
+
+	t.Run("Changed", func(t *testing.T) {
+		inspect := dockertypes.ContainerJSON{
+			ContainerJSONBase: &dockertypes.ContainerJSONBase{
+				HostConfig: &container.HostConfig{},
+			},
+			Config: &container.Config{
+				Image: "nginx:1.27",
+				Env:   []string{"TZ=UTC"},
+			},
+		}
+
+		changes := diffService(service, inspect)
+
+		expected := []FieldDiff{
+			{Field: "image", Running: "nginx:1.27", Desired: "nginx:latest"},
+			{Field: "environment.TZ"},
+			{Field: "ports", Running: "", Desired: "8080:80/tcp"},
+		}
+
+		if len(changes) != len(expected) {
+			t.Fatalf("expected %d changes, got %d: %v", len(expected), len(changes), changes)
+		}
+
+		for i, c := range expected {
+			if changes[i] != c {
+				t.Errorf("expected change %v, got %v", c, changes[i])
+			}
+		}
+	})
+
+	t.Run("Image volume", func(t *testing.T) {
+		inspect := dockertypes.ContainerJSON{
+			ContainerJSONBase: &dockertypes.ContainerJSONBase{
+				HostConfig: &container.HostConfig{
+					PortBindings: nat.PortMap{"80/tcp": []nat.PortBinding{{HostPort: "8080"}}},
+				},
+			},
+			Mounts: []dockertypes.MountPoint{{Type: mount.TypeVolume, Name: "0123abcd", Destination: "/var/cache/nginx"}},
+			Config: &container.Config{
+				Image:   "nginx:latest",
+				Env:     []string{"TZ=Europe/Berlin"},
+				Volumes: map[string]struct{}{"/var/cache/nginx": {}},
+			},
+		}
+
+		changes := diffService(service, inspect)
+		if len(changes) != 0 {
+			t.Fatalf("expected the anonymous volume of the image to be ignored, got %v", changes)
+		}
+	})
+}
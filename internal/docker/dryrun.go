@@ -0,0 +1,99 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/docker/docker/client"
+
+	"github.com/kimdre/doco-cd/internal/config"
+	"github.com/kimdre/doco-cd/internal/webhook"
+)
+
+const (
+	ActionCreate   = "create"   // ActionCreate means the containers of the service would be created
+	ActionRecreate = "recreate" // ActionRecreate means the containers of the service would be replaced
+	ActionKeep     = "keep"     // ActionKeep means the containers of the service would be kept (and started if they are stopped)
+	ActionRemove   = "remove"   // ActionRemove means the containers of the service would be removed as orphans
+)
+
+// DryRunAction is an action that a deployment would take for a service
+type DryRunAction struct {
+	Service string      `json:"service"`
+	Action  string      `json:"action"`
+	Changes []FieldDiff `json:"changes,omitempty"`
+}
+
+// DryRun is the result of a deployment that was rendered without being applied
+type DryRun struct {
+	Compose string         `json:"compose"` // Compose is the fully interpolated compose project with the labels of the deployment
+	Actions []DryRunAction `json:"actions"`
+}
+
+/*
+DryRunCompose renders the project the way DeployCompose would deploy it and returns it together with the actions
+that the deployment would take, without creating, starting or changing any container.
+The running containers are only inspected to compare them with the project. The rendered project is the one that
+gets returned, it is the project loaded with redacted secrets if the stack has any (or the project itself).
+*/
+func DryRunCompose(
+	ctx context.Context, apiClient client.APIClient, project, rendered *types.Project, deployConfig *config.DeployConfig, payload webhook.ParsedPayload,
+) (*DryRun, error) {
+	// The labels of the deployment are not compared, so the diff is computed before they get added
+	diffs, err := DiffProject(ctx, apiClient, project)
+	if err != nil {
+		return nil, err
+	}
+
+	err = prepareProject(rendered, deployConfig, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	compose, err := rendered.MarshalYAML()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render project: %w", err)
+	}
+
+	recreate, _ := getRecreateTypes(deployConfig)
+
+	return &DryRun{
+		Compose: string(compose),
+		Actions: getDryRunActions(diffs, recreate, deployConfig.RemoveOrphans),
+	}, nil
+}
+
+// RedactedValue replaces the values of secrets in rendered projects
+const RedactedValue = "[redacted]"
+
+// getDryRunActions returns the action that a deployment with the recreate type would take for each service of the diff
+func getDryRunActions(diffs []ServiceDiff, recreate string, removeOrphans bool) []DryRunAction {
+	actions := make([]DryRunAction, 0, len(diffs))
+
+	for _, d := range diffs {
+		action := ActionKeep
+
+		switch d.Status {
+		case DiffStatusAdded:
+			action = ActionCreate
+		case DiffStatusChanged:
+			if recreate != api.RecreateNever {
+				action = ActionRecreate
+			}
+		case DiffStatusUnchanged:
+			if recreate == api.RecreateForce {
+				action = ActionRecreate
+			}
+		case DiffStatusRemoved:
+			if removeOrphans {
+				action = ActionRemove
+			}
+		}
+
+		actions = append(actions, DryRunAction{Service: d.Service, Action: action, Changes: d.Changes})
+	}
+
+	return actions
+}
@@ -0,0 +1,62 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+)
+
+func TestGetDryRunActions(t *testing.T) {
+	diffs := []ServiceDiff{
+		{Service: "added", Status: DiffStatusAdded},
+		{Service: "changed", Status: DiffStatusChanged, Changes: []FieldDiff{{Field: "image", Running: "nginx:1.26", Desired: "nginx:1.27"}}},
+		{Service: "unchanged", Status: DiffStatusUnchanged},
+		{Service: "removed", Status: DiffStatusRemoved},
+	}
+
+	testCases := []struct {
+		name          string
+		recreate      string
+		removeOrphans bool
+		expected      map[string]string
+	}{
+		{
+			name:          "diverged",
+			recreate:      api.RecreateDiverged,
+			removeOrphans: true,
+			expected:      map[string]string{"added": ActionCreate, "changed": ActionRecreate, "unchanged": ActionKeep, "removed": ActionRemove},
+		},
+		{
+			name:          "force",
+			recreate:      api.RecreateForce,
+			removeOrphans: false,
+			expected:      map[string]string{"added": ActionCreate, "changed": ActionRecreate, "unchanged": ActionRecreate, "removed": ActionKeep},
+		},
+		{
+			name:          "never",
+			recreate:      api.RecreateNever,
+			removeOrphans: true,
+			expected:      map[string]string{"added": ActionCreate, "changed": ActionKeep, "unchanged": ActionKeep, "removed": ActionRemove},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actions := getDryRunActions(diffs, tc.recreate, tc.removeOrphans)
+			if len(actions) != len(diffs) {
+				t.Fatalf("expected %d actions, got %d", len(diffs), len(actions))
+			}
+
+			for _, a := range actions {
+				if a.Action != tc.expected[a.Service] {
+					t.Errorf("expected action %s for service %s, got %s", tc.expected[a.Service], a.Service, a.Action)
+				}
+			}
+
+			if len(actions[1].Changes) != 1 {
+				t.Errorf("expected the changes of the changed service to be kept, got %v", actions[1].Changes)
+			}
+		})
+	}
+}
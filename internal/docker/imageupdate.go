@@ -0,0 +1,79 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/cli/cli/command"
+	"github.com/docker/compose/v2/pkg/compose"
+)
+
+// ImageUpdate is a service whose image tag points to another image after pulling it than the one the service runs
+type ImageUpdate struct {
+	Service    string `json:"service"`
+	Image      string `json:"image"`
+	DeployedID string `json:"deployed_id"`
+	PulledID   string `json:"pulled_id"`
+	Digest     string `json:"digest,omitempty"` // Digest is the repository digest of the pulled image, e.g. nginx@sha256:...
+}
+
+/*
+PullProjectImages pulls the images of the running services of a project and returns the services whose image tag
+now points to another image than the one their containers were created from, e.g. because a floating tag like latest moved.
+Images that are pinned to a digest or were built locally (have no repository digest) are skipped.
+*/
+func PullProjectImages(ctx context.Context, dockerCli command.Cli, projectName string) ([]ImageUpdate, error) {
+	apiClient := dockerCli.Client()
+
+	images, err := GetDeployedImages(ctx, apiClient, projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	deployed := make(map[string]ImageUpdate)
+	project := &types.Project{Name: projectName, Services: types.Services{}}
+
+	for _, i := range images {
+		if strings.Contains(i.Image, "@") || len(i.RepoDigests) == 0 {
+			continue
+		}
+
+		deployed[i.Service] = ImageUpdate{Service: i.Service, Image: i.Image, DeployedID: i.ID}
+		project.Services[i.Service] = types.ServiceConfig{Name: i.Service, Image: i.Image}
+	}
+
+	if len(project.Services) == 0 {
+		return nil, nil
+	}
+
+	err = pullImages(ctx, compose.NewComposeService(dockerCli), project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull images: %w", err)
+	}
+
+	var updates []ImageUpdate
+
+	for _, name := range project.ServiceNames() {
+		update := deployed[name]
+
+		image, _, err := apiClient.ImageInspectWithRaw(ctx, update.Image)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect image %s: %w", update.Image, err)
+		}
+
+		if image.ID == update.DeployedID {
+			continue
+		}
+
+		update.PulledID = image.ID
+		if len(image.RepoDigests) > 0 {
+			update.Digest = image.RepoDigests[0]
+		}
+
+		updates = append(updates, update)
+	}
+
+	return updates, nil
+}
@@ -0,0 +1,156 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/docker/compose/v2/pkg/api"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+
+	"github.com/kimdre/doco-cd/internal/git"
+)
+
+// ManagedStack is a stack that was deployed by doco-cd, as recorded in the labels of its containers
+type ManagedStack struct {
+	Name                  string   `json:"name"`
+	Managed               bool     `json:"managed_by_doco_cd"`
+	Repository            string   `json:"repository"`
+	URL                   string   `json:"url"`
+	Private               bool     `json:"private"`
+	Reference             string   `json:"reference"`
+	Commit                string   `json:"commit"`
+	ConfigSource          string   `json:"config_source,omitempty"`
+	Profiles              []string `json:"profiles,omitempty"`
+	DeployedAt            string   `json:"deployed_at"`
+	WorkingDir            string   `json:"working_dir,omitempty"`
+	RegistryWatchInterval string   `json:"registry_watch_interval,omitempty"`
+	Services              []string `json:"services"`
+}
+
+// GetManagedStacks returns the stacks that were deployed by doco-cd
+func GetManagedStacks(ctx context.Context, apiClient client.APIClient) ([]ManagedStack, error) {
+	return GetStacks(ctx, apiClient, false)
+}
+
+// GetStacks returns the compose stacks on the host, including the stacks that were not deployed by doco-cd if all is true
+func GetStacks(ctx context.Context, apiClient client.APIClient, all bool) ([]ManagedStack, error) {
+	label := "cd.doco.repository.url"
+	if all {
+		label = api.ProjectLabel
+	}
+
+	containers, err := apiClient.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", label)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	return groupManagedStacks(containers), nil
+}
+
+// GetDeployedCommit returns the commit that doco-cd deployed the project from the last time, empty if it was not deployed by doco-cd
+func GetDeployedCommit(ctx context.Context, apiClient client.APIClient, projectName string) (string, error) {
+	containers, err := GetProjectContainers(ctx, apiClient, projectName)
+	if err != nil {
+		return "", err
+	}
+
+	for _, stack := range groupManagedStacks(containers) {
+		if stack.Managed {
+			return stack.Commit, nil
+		}
+	}
+
+	return "", nil
+}
+
+/*
+FilterStacks returns the stacks that were deployed from the repository and reference, empty values match all stacks.
+The repository matches the full name (e.g. kimdre/doco-cd) or the URL of the repository, the reference matches
+the full reference (e.g. refs/heads/main) or the name of a branch or tag (e.g. main).
+*/
+func FilterStacks(stacks []ManagedStack, repository, reference string) []ManagedStack {
+	filtered := make([]ManagedStack, 0, len(stacks))
+
+	for _, stack := range stacks {
+		if repository != "" && !strings.EqualFold(stack.Repository, repository) &&
+			!strings.EqualFold(strings.TrimSuffix(stack.URL, ".git"), strings.TrimSuffix(repository, ".git")) {
+			continue
+		}
+
+		if reference != "" && stack.Reference != reference &&
+			stack.Reference != "refs/heads/"+reference && stack.Reference != "refs/tags/"+reference {
+			continue
+		}
+
+		filtered = append(filtered, stack)
+	}
+
+	return filtered
+}
+
+// groupManagedStacks groups the containers by their compose project, the most recently deployed container
+// of a project determines the recorded deployment. Repository URLs are returned without credentials.
+// Containers that were not deployed by doco-cd have no deployment labels and are grouped as unmanaged stacks.
+func groupManagedStacks(containers []dockertypes.Container) []ManagedStack {
+	stacks := make(map[string]*ManagedStack)
+
+	for _, c := range containers {
+		name := c.Labels[api.ProjectLabel]
+		if name == "" {
+			continue
+		}
+
+		stack, ok := stacks[name]
+		if !ok {
+			stack = &ManagedStack{Name: name}
+			stacks[name] = stack
+		}
+
+		if service := c.Labels[api.ServiceLabel]; service != "" && !slices.Contains(stack.Services, service) {
+			stack.Services = append(stack.Services, service)
+		}
+
+		// RFC3339 timestamps in UTC can be compared as strings
+		deployedAt := c.Labels["cd.doco.deployedAt"]
+		if deployedAt < stack.DeployedAt {
+			continue
+		}
+
+		stack.DeployedAt = deployedAt
+		stack.Managed = c.Labels["cd.doco.repository.url"] != ""
+		stack.Repository = c.Labels["cd.doco.repository.name"]
+		stack.URL = git.GetUrlWithoutAuth(c.Labels["cd.doco.repository.url"])
+		stack.Private = c.Labels["cd.doco.repository.private"] == "true"
+		stack.Reference = c.Labels["cd.doco.repository.reference"]
+		stack.Commit = c.Labels["cd.doco.repository.commit"]
+		stack.ConfigSource = c.Labels["cd.doco.config.source"]
+		stack.WorkingDir = c.Labels[api.WorkingDirLabel]
+		stack.RegistryWatchInterval = c.Labels[registryWatchIntervalLabel]
+		stack.Profiles = nil
+
+		if profiles := c.Labels[profilesLabel]; profiles != "" {
+			stack.Profiles = strings.Split(profiles, ",")
+		}
+	}
+
+	result := make([]ManagedStack, 0, len(stacks))
+
+	for _, stack := range stacks {
+		slices.Sort(stack.Services)
+		result = append(result, *stack)
+	}
+
+	slices.SortFunc(result, func(a, b ManagedStack) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return result
+}
@@ -0,0 +1,221 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+var ErrInvalidLogTail = errors.New("tail must be 'all' or a non-negative number")
+
+// LogOptions select the log lines of the containers of a project
+type LogOptions struct {
+	Tail   string // Tail is the number of lines to return from the end of the logs of each container, "all" or empty for all lines
+	Since  string // Since only returns lines after a timestamp (e.g. 2024-01-02T15:04:05Z) or relative to now (e.g. 10m)
+	Follow bool   // Follow keeps the streams open and returns new lines until the context is canceled
+}
+
+// Validate checks that the options can be passed to the docker daemon
+func (o LogOptions) Validate() error {
+	if o.Tail == "" || o.Tail == "all" {
+		return nil
+	}
+
+	if n, err := strconv.Atoi(o.Tail); err != nil || n < 0 {
+		return fmt.Errorf("%w, got %s", ErrInvalidLogTail, o.Tail)
+	}
+
+	return nil
+}
+
+// logStream is the open log stream of a container
+type logStream struct {
+	prefix string
+	tty    bool // tty is true if the container has a terminal, its stream is then not multiplexed into stdout and stderr
+	reader io.ReadCloser
+}
+
+// ProjectLogs are the open log streams of all containers of a project
+type ProjectLogs struct {
+	streams []logStream
+}
+
+/*
+GetProjectLogs opens the log streams of all containers (including stopped ones) of a project.
+The streams are opened before any line is read, so that invalid options are reported before the logs get written.
+They have to be closed with Close.
+*/
+func GetProjectLogs(ctx context.Context, apiClient client.APIClient, projectName string, opts LogOptions) (*ProjectLogs, error) {
+	err := opts.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := GetProjectContainers(ctx, apiClient, projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	logs := &ProjectLogs{}
+
+	for _, c := range containers {
+		inspect, err := apiClient.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			_ = logs.Close()
+			return nil, fmt.Errorf("failed to inspect container %s: %w", c.ID, err)
+		}
+
+		reader, err := apiClient.ContainerLogs(ctx, c.ID, container.LogsOptions{
+			ShowStdout: true,
+			ShowStderr: true,
+			Tail:       opts.Tail,
+			Since:      opts.Since,
+			Follow:     opts.Follow,
+		})
+		if err != nil {
+			_ = logs.Close()
+			return nil, fmt.Errorf("failed to get logs of container %s: %w", c.ID, err)
+		}
+
+		name := strings.TrimPrefix(inspect.Name, "/")
+		if service := c.Labels[api.ServiceLabel]; service != "" {
+			name = service + "-" + c.Labels[api.ContainerNumberLabel]
+		}
+
+		logs.streams = append(logs.streams, logStream{
+			prefix: name + " | ",
+			tty:    inspect.Config != nil && inspect.Config.Tty,
+			reader: reader,
+		})
+	}
+
+	return logs, nil
+}
+
+// Len returns the number of containers whose logs are streamed
+func (l *ProjectLogs) Len() int {
+	return len(l.streams)
+}
+
+// Close closes the log streams of all containers
+func (l *ProjectLogs) Close() error {
+	var errs []error
+
+	for _, s := range l.streams {
+		errs = append(errs, s.reader.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+/*
+Copy writes the log lines of all containers to w, each line is prefixed with the service and replica of its container
+like in `docker compose logs`. The lines of different containers are interleaved in the order they are read,
+flush is called after each line if it is not nil. Copy returns when all streams have ended.
+*/
+func (l *ProjectLogs) Copy(w io.Writer, flush func()) error {
+	out := &syncLineWriter{w: w, flush: flush}
+	errs := make([]error, len(l.streams))
+
+	var wg sync.WaitGroup
+
+	for i, s := range l.streams {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			lw := &lineWriter{prefix: s.prefix, out: out}
+
+			var err error
+			if s.tty {
+				_, err = io.Copy(lw, s.reader)
+			} else {
+				_, err = stdcopy.StdCopy(lw, lw, s.reader)
+			}
+
+			errs[i] = errors.Join(err, lw.Close())
+		}()
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// syncLineWriter writes complete lines of several containers to the same writer
+type syncLineWriter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	flush func()
+}
+
+func (s *syncLineWriter) writeLine(prefix string, line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := io.WriteString(s.w, prefix)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.w.Write(line)
+	if err != nil {
+		return err
+	}
+
+	if s.flush != nil {
+		s.flush()
+	}
+
+	return nil
+}
+
+// lineWriter splits the logs of a container into lines and prefixes them
+type lineWriter struct {
+	prefix string
+	out    *syncLineWriter
+	buf    []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		err := l.out.writeLine(l.prefix, l.buf[:i+1])
+		if err != nil {
+			return 0, err
+		}
+
+		l.buf = l.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Close writes the last line if it was not terminated by a newline
+func (l *lineWriter) Close() error {
+	if len(l.buf) == 0 {
+		return nil
+	}
+
+	line := append(l.buf, '\n')
+	l.buf = nil
+
+	return l.out.writeLine(l.prefix, line)
+}
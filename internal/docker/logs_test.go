@@ -0,0 +1,87 @@
+package docker
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+func TestLogOptions_Validate(t *testing.T) {
+	testCases := []struct {
+		tail        string
+		expectedErr error
+	}{
+		{"", nil},
+		{"all", nil},
+		{"0", nil},
+		{"100", nil},
+		{"-1", ErrInvalidLogTail},
+		{"ten", ErrInvalidLogTail},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.tail, func(t *testing.T) {
+			err := LogOptions{Tail: tc.tail}.Validate()
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestProjectLogs_Copy(t *testing.T) {
+	var multiplexed bytes.Buffer
+
+	_, err := stdcopy.NewStdWriter(&multiplexed, stdcopy.Stdout).Write([]byte("listening on :80\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = stdcopy.NewStdWriter(&multiplexed, stdcopy.Stderr).Write([]byte("warning: no config\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs := &ProjectLogs{streams: []logStream{
+		{prefix: "web-1 | ", reader: io.NopCloser(&multiplexed)},
+		{prefix: "shell-1 | ", tty: true, reader: io.NopCloser(strings.NewReader("first\nsecond"))},
+	}}
+
+	flushes := 0
+
+	var out bytes.Buffer
+
+	err = logs.Copy(&out, func() { flushes++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+
+	// The lines of different containers can be interleaved, but the lines of a container keep their order
+	expected := map[string][]string{
+		"web-1":   {"web-1 | listening on :80", "web-1 | warning: no config"},
+		"shell-1": {"shell-1 | first", "shell-1 | second"},
+	}
+
+	got := make(map[string][]string)
+
+	for _, line := range lines {
+		name, _, _ := strings.Cut(line, " | ")
+		got[name] = append(got[name], line)
+	}
+
+	for name, want := range expected {
+		if strings.Join(got[name], "\n") != strings.Join(want, "\n") {
+			t.Errorf("expected lines %q for %s, got %q", want, name, got[name])
+		}
+	}
+
+	if flushes != len(lines) {
+		t.Errorf("expected %d flushes, got %d", len(lines), flushes)
+	}
+}
@@ -0,0 +1,83 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/client"
+)
+
+// DeploymentPlan is a record of what a deployment changes, computed before the stack is deployed
+type DeploymentPlan struct {
+	JobID       string        `json:"job_id"`
+	Repository  string        `json:"repository"`
+	Reference   string        `json:"reference"`
+	CommitSHA   string        `json:"commit_sha"`
+	Stack       string        `json:"stack"`
+	ProjectHash string        `json:"project_hash"` // ProjectHash is the SHA256 hash of the resolved compose project
+	Images      []string      `json:"images"`
+	Services    []ServiceDiff `json:"services"` // Services contains the services that get added, changed (recreated) or removed
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+// getProjectHash returns the SHA256 hash of the resolved compose project
+func getProjectHash(project *types.Project) (string, error) {
+	data, err := project.MarshalJSON()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// NewDeploymentPlan computes the deployment plan of a project by comparing it with the running containers
+func NewDeploymentPlan(ctx context.Context, apiClient client.APIClient, project *types.Project) (*DeploymentPlan, error) {
+	hash, err := getProjectHash(project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash project: %w", err)
+	}
+
+	services, err := DiffProject(ctx, apiClient, project)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeploymentPlan{
+		Stack:       project.Name,
+		ProjectHash: hash,
+		Images:      GetProjectImages(project),
+		Services:    services,
+		CreatedAt:   time.Now().UTC(),
+	}, nil
+}
+
+// Write writes the deployment plan as a JSON file to the directory and returns the path of the file
+func (p *DeploymentPlan) Write(dir string) (string, error) {
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	filePath := filepath.Join(dir, fmt.Sprintf("%s-%s.json", p.Stack, p.JobID))
+
+	err = os.WriteFile(filePath, data, 0o600)
+	if err != nil {
+		return "", err
+	}
+
+	return filePath, nil
+}
@@ -0,0 +1,92 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetProjectHash(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+
+	getHash := func(content string) string {
+		createComposeFile(t, filePath, content)
+
+		project, err := LoadCompose(ctx, dirName, projectName, []string{filePath})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hash, err := getProjectHash(project)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return hash
+	}
+
+	first := getHash(composeContents)
+
+	if getHash(composeContents) != first {
+		t.Error("expected project hash to be stable")
+	}
+
+	if getHash(composeContents+"    restart: always\n") == first {
+		t.Error("expected project hash to change with the project")
+	}
+}
+
+func TestDeploymentPlan_Write(t *testing.T) {
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	plan := &DeploymentPlan{
+		JobID:     "a1b2c3",
+		CommitSHA: "0123456789abcdef",
+		Stack:     projectName,
+		Images:    []string{"nginx:latest"},
+		Services:  []ServiceDiff{{Service: "test", Status: DiffStatusAdded}},
+	}
+
+	filePath, err := plan.Write(filepath.Join(dirName, "plans"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Base(filePath) != "test-a1b2c3.json" {
+		t.Errorf("unexpected file name %s", filePath)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var written DeploymentPlan
+
+	err = json.Unmarshal(data, &written)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if written.JobID != plan.JobID || written.CommitSHA != plan.CommitSHA || len(written.Services) != 1 {
+		t.Errorf("expected written plan to match, got %+v", written)
+	}
+}
@@ -0,0 +1,137 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+)
+
+// GetProjectImageIDs returns the IDs of the images used by the containers of a project
+func GetProjectImageIDs(ctx context.Context, apiClient client.APIClient, projectName string) ([]string, error) {
+	containers, err := GetProjectContainers(ctx, apiClient, projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+
+	for _, c := range containers {
+		ids = append(ids, c.ImageID)
+	}
+
+	return ids, nil
+}
+
+// getImageUsers returns a map of image IDs to the stacks (or container names) that use them
+func getImageUsers(ctx context.Context, apiClient client.APIClient) (map[string]string, error) {
+	containers, err := apiClient.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	users := make(map[string]string)
+
+	for _, c := range containers {
+		user := c.Labels[api.ProjectLabel]
+		if user == "" && len(c.Names) > 0 {
+			user = strings.TrimPrefix(c.Names[0], "/")
+		}
+
+		users[c.ImageID] = user
+	}
+
+	return users, nil
+}
+
+// getPruneCandidates returns the previously used images that are no longer used by any container
+// and the images that have to be kept together with the stack that still uses them
+func getPruneCandidates(previousImages []string, users map[string]string) ([]string, map[string]string) {
+	var prune []string
+
+	keep := make(map[string]string)
+
+	for _, id := range previousImages {
+		if id == "" || slices.Contains(prune, id) {
+			continue
+		}
+
+		if user, ok := users[id]; ok {
+			keep[id] = user
+			continue
+		}
+
+		prune = append(prune, id)
+	}
+
+	return prune, keep
+}
+
+// PruneImages removes the images that were used by a stack before the deployment,
+// unless they are still used by any container, e.g. by containers of other stacks that share the image
+func PruneImages(ctx context.Context, log *slog.Logger, apiClient client.APIClient, previousImages []string) error {
+	users, err := getImageUsers(ctx, apiClient)
+	if err != nil {
+		return err
+	}
+
+	prune, keep := getPruneCandidates(previousImages, users)
+
+	for id, user := range keep {
+		log.Debug("image still in use, skipping prune", slog.String("image", id), slog.String("used_by", user))
+	}
+
+	for _, id := range prune {
+		_, err = apiClient.ImageRemove(ctx, id, image.RemoveOptions{PruneChildren: true})
+		if err != nil {
+			if client.IsErrNotFound(err) {
+				continue
+			}
+
+			return fmt.Errorf("failed to remove image %s: %w", id, err)
+		}
+
+		log.Debug("pruned unused image", slog.String("image", id))
+	}
+
+	return nil
+}
+
+// HasBuild checks if any service of the project builds its image
+func HasBuild(project *types.Project) bool {
+	for _, s := range project.Services {
+		if s.Build != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PruneBuildCache removes the dangling build cache that is older than maxAge (e.g. 24h, all if empty)
+// while keeping keepStorage bytes of cache and returns the reclaimed disk space in bytes
+func PruneBuildCache(ctx context.Context, apiClient client.APIClient, maxAge string, keepStorage int64) (uint64, error) {
+	args := filters.NewArgs()
+	if maxAge != "" {
+		args.Add("until", maxAge)
+	}
+
+	report, err := apiClient.BuildCachePrune(ctx, dockertypes.BuildCachePruneOptions{
+		KeepStorage: keepStorage,
+		Filters:     args,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune build cache: %w", err)
+	}
+
+	return report.SpaceReclaimed, nil
+}
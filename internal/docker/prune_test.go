@@ -0,0 +1,46 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+func TestGetPruneCandidates(t *testing.T) {
+	previousImages := []string{"sha256:app", "sha256:base", "sha256:app", "", "sha256:old"}
+
+	// sha256:base is still used by another stack that shares the base image
+	users := map[string]string{
+		"sha256:base":  "other-stack",
+		"sha256:proxy": "proxy",
+	}
+
+	prune, keep := getPruneCandidates(previousImages, users)
+
+	expectedPrune := []string{"sha256:app", "sha256:old"}
+	if !reflect.DeepEqual(prune, expectedPrune) {
+		t.Errorf("expected images to prune to be %v, got %v", expectedPrune, prune)
+	}
+
+	expectedKeep := map[string]string{"sha256:base": "other-stack"}
+	if !reflect.DeepEqual(keep, expectedKeep) {
+		t.Errorf("expected kept images to be %v, got %v", expectedKeep, keep)
+	}
+}
+
+func TestHasBuild(t *testing.T) {
+	project := &types.Project{Services: types.Services{
+		"web": {Name: "web", Image: "nginx:latest"},
+	}}
+
+	if HasBuild(project) {
+		t.Error("expected project without build sections to have no build")
+	}
+
+	project.Services["app"] = types.ServiceConfig{Name: "app", Build: &types.BuildConfig{Context: "."}}
+
+	if !HasBuild(project) {
+		t.Error("expected project with build section to have a build")
+	}
+}
@@ -0,0 +1,66 @@
+package docker
+
+import (
+	"context"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/kimdre/doco-cd/internal/prometheus"
+)
+
+// pullGroup coalesces concurrent pulls of the same image reference by stacks that are deployed in parallel
+var pullGroup singleflight.Group
+
+// getImageServices returns a map of image references to the names of the services that use them
+func getImageServices(project *types.Project) map[string][]string {
+	images := make(map[string][]string)
+
+	for _, name := range project.ServiceNames() {
+		image := project.Services[name].Image
+		if image == "" {
+			continue
+		}
+
+		images[image] = append(images[image], name)
+	}
+
+	return images
+}
+
+// pullImages pulls the images of a project one image reference at a time.
+// If another deployment is already pulling the same image, it waits for the result of that pull instead.
+// The time of all pulls, including the waits for the pulls of other deployments, is recorded for the stack.
+func pullImages(ctx context.Context, service api.Service, project *types.Project) error {
+	start := time.Now()
+
+	for image, services := range getImageServices(project) {
+		imageProject, err := project.WithSelectedServices(services, types.IgnoreDependencies)
+		if err != nil {
+			return err
+		}
+
+		pulled := false
+
+		_, err, _ = pullGroup.Do(image, func() (interface{}, error) {
+			pulled = true
+
+			return nil, service.Pull(ctx, imageProject, api.PullOptions{
+				Quiet: true,
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		if !pulled {
+			prometheus.DeduplicatedImagePulls.Inc()
+		}
+	}
+
+	prometheus.ImagePullDuration.WithLabelValues(project.Name).Observe(time.Since(start).Seconds())
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package docker
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+func TestGetImageServices(t *testing.T) {
+	project := &types.Project{
+		Name: "test",
+		Services: types.Services{
+			"web":    {Name: "web", Image: "nginx:latest"},
+			"proxy":  {Name: "proxy", Image: "nginx:latest"},
+			"db":     {Name: "db", Image: "postgres:17"},
+			"worker": {Name: "worker", Build: &types.BuildConfig{Context: "."}},
+		},
+	}
+
+	images := getImageServices(project)
+
+	if len(images) != 2 {
+		t.Fatalf("expected 2 images, got %d: %v", len(images), images)
+	}
+
+	if !slices.Equal(images["nginx:latest"], []string{"proxy", "web"}) {
+		t.Errorf("expected services [proxy web] for nginx:latest, got %v", images["nginx:latest"])
+	}
+
+	if !slices.Equal(images["postgres:17"], []string{"db"}) {
+		t.Errorf("expected services [db] for postgres:17, got %v", images["postgres:17"])
+	}
+}
@@ -0,0 +1,196 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrPathOutsideContext = errors.New("path is outside of the context root")
+
+/*
+CheckComposeReferences checks that the compose files and all files they reference with include (path, project_directory
+and env_file) and extends (file) are inside the context root. Referenced compose files are checked recursively,
+relative references are resolved against the directory of the file that contains them.
+References that do not exist are skipped, they are reported when the project gets loaded.
+*/
+func CheckComposeReferences(workingDir string, composeFiles []string, contextRoot string) error {
+	return walkComposeFiles(workingDir, composeFiles, func(file, referencedBy string) error {
+		if isInside(contextRoot, file) {
+			return nil
+		}
+
+		if referencedBy == "" {
+			return fmt.Errorf("%w: %s", ErrPathOutsideContext, file)
+		}
+
+		return fmt.Errorf("%w: %s referenced in %s", ErrPathOutsideContext, file, referencedBy)
+	})
+}
+
+/*
+GetComposeReferences returns the sorted paths of the compose files and of all files they reference with include and extends,
+including the files referenced by the base files of extends and by included files, e.g. ../common/compose.yaml.
+Changes to any of these files change the project, even if the compose files themselves did not change.
+*/
+func GetComposeReferences(workingDir string, composeFiles []string) ([]string, error) {
+	var files []string
+
+	err := walkComposeFiles(workingDir, composeFiles, func(file, _ string) error {
+		if !slices.Contains(files, file) {
+			files = append(files, file)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(files)
+
+	return files, nil
+}
+
+// walkComposeFiles calls visit for each compose file and for each file it references before the referenced compose files are walked,
+// referencedBy is empty for the compose files themselves
+func walkComposeFiles(workingDir string, composeFiles []string, visit func(file, referencedBy string) error) error {
+	walked := make(map[string]bool)
+
+	for _, f := range composeFiles {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(workingDir, f)
+		}
+
+		if err := visit(f, ""); err != nil {
+			return err
+		}
+
+		if err := walkComposeFile(f, walked, visit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walkComposeFile visits the files referenced by a single compose file and walks the compose files it references
+func walkComposeFile(file string, walked map[string]bool, visit func(file, referencedBy string) error) error {
+	if walked[file] {
+		return nil
+	}
+
+	walked[file] = true
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	var doc map[string]any
+
+	if err = yaml.Unmarshal(content, &doc); err != nil {
+		// Syntax errors are reported when the project gets loaded
+		return nil
+	}
+
+	dir := filepath.Dir(file)
+	composeRefs, otherRefs := getComposeReferences(doc)
+
+	for _, ref := range otherRefs {
+		if err = visit(resolveReference(dir, ref), file); err != nil {
+			return err
+		}
+	}
+
+	for _, ref := range composeRefs {
+		ref = resolveReference(dir, ref)
+
+		if err = visit(ref, file); err != nil {
+			return err
+		}
+
+		if err = walkComposeFile(ref, walked, visit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getComposeReferences returns the compose files and the other files and directories that a compose file references
+func getComposeReferences(doc map[string]any) ([]string, []string) {
+	var composeRefs, otherRefs []string
+
+	includes, _ := doc["include"].([]any)
+
+	for _, i := range includes {
+		switch include := i.(type) {
+		case string:
+			composeRefs = append(composeRefs, include)
+		case map[string]any:
+			composeRefs = append(composeRefs, toStrings(include["path"])...)
+			otherRefs = append(otherRefs, toStrings(include["project_directory"])...)
+			otherRefs = append(otherRefs, toStrings(include["env_file"])...)
+		}
+	}
+
+	services, _ := doc["services"].(map[string]any)
+
+	for _, s := range services {
+		service, _ := s.(map[string]any)
+		extends, _ := service["extends"].(map[string]any)
+
+		// Extending a service of the same file is done with the service name only
+		composeRefs = append(composeRefs, toStrings(extends["file"])...)
+	}
+
+	return composeRefs, otherRefs
+}
+
+// toStrings converts a YAML value that is either a string or a list of strings into a slice
+func toStrings(v any) []string {
+	switch value := v.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		var list []string
+
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+
+		return list
+	}
+
+	return nil
+}
+
+func resolveReference(dir, ref string) string {
+	if filepath.IsAbs(ref) {
+		return filepath.Clean(ref)
+	}
+
+	return filepath.Join(dir, ref)
+}
+
+// isInside checks if the path is equal to or inside the base directory
+func isInside(base, p string) bool {
+	rel, err := filepath.Rel(base, p)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, "../")
+}
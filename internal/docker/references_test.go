@@ -0,0 +1,127 @@
+package docker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCheckComposeReferences(t *testing.T) {
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	stackDir := filepath.Join(dirName, "stacks", "app", "prod")
+	commonDir := filepath.Join(dirName, "common")
+
+	for _, dir := range []string{stackDir, commonDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	createComposeFile(t, filepath.Join(commonDir, "compose.yaml"), `services:
+  base:
+    image: nginx:latest
+`)
+	createComposeFile(t, filepath.Join(commonDir, "escape.yaml"), `services:
+  base:
+    extends:
+      file: ../../outside.yaml
+      service: base
+`)
+	createComposeFile(t, filepath.Join(stackDir, "extends.yaml"), `services:
+  test:
+    extends:
+      file: ../../../common/compose.yaml
+      service: base
+`)
+	createComposeFile(t, filepath.Join(stackDir, "include.yaml"), `include:
+  - path: ../../../common/escape.yaml
+services:
+  test:
+    image: nginx:latest
+`)
+	createComposeFile(t, filepath.Join(stackDir, "env.yaml"), `include:
+  - path: ../../../common/compose.yaml
+    env_file: /etc/environment
+`)
+
+	testCases := []struct {
+		name        string
+		composeFile string
+		contextRoot string
+		expectedErr error
+	}{
+		{"Parent-relative Extends", "extends.yaml", dirName, nil},
+		{"Extends Outside Context Root", "extends.yaml", stackDir, ErrPathOutsideContext},
+		{"Nested Reference Outside Repository", "include.yaml", dirName, ErrPathOutsideContext},
+		{"Absolute Env File", "env.yaml", dirName, ErrPathOutsideContext},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckComposeReferences(stackDir, []string{tc.composeFile}, tc.contextRoot)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestGetComposeReferences(t *testing.T) {
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	stackDir := filepath.Join(dirName, "stacks", "app", "prod")
+	commonDir := filepath.Join(dirName, "common")
+
+	for _, dir := range []string{stackDir, commonDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	createComposeFile(t, filepath.Join(commonDir, "base.yaml"), `services:
+  base:
+    image: nginx:latest
+`)
+	createComposeFile(t, filepath.Join(commonDir, "compose.yaml"), `services:
+  app:
+    extends:
+      file: base.yaml
+      service: base
+`)
+	createComposeFile(t, filepath.Join(stackDir, "compose.yaml"), `services:
+  test:
+    extends:
+      file: ../../../common/compose.yaml
+      service: app
+`)
+
+	files, err := GetComposeReferences(stackDir, []string{"compose.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		filepath.Join(commonDir, "base.yaml"),
+		filepath.Join(commonDir, "compose.yaml"),
+		filepath.Join(stackDir, "compose.yaml"),
+	}
+
+	if !slices.Equal(files, expected) {
+		t.Errorf("expected files %v, got %v", expected, files)
+	}
+}
@@ -0,0 +1,202 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/docker/cli/cli/command"
+	"github.com/docker/cli/cli/config/configfile"
+	clitypes "github.com/docker/cli/cli/config/types"
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/client"
+
+	"github.com/kimdre/doco-cd/internal/config"
+)
+
+const (
+	dockerHubRegistry = "docker.io"
+	dockerHubAuthKey  = "https://index.docker.io/v1/" // dockerHubAuthKey is the key of the Docker Hub credentials in the docker config file
+)
+
+var ErrRegistryRateLimited = errors.New("registry rate limit exceeded")
+
+// DeployedImage is the image a service of a deployed project runs
+type DeployedImage struct {
+	Service     string   `json:"service"`
+	Image       string   `json:"image"`                  // Image is the image reference of the service, e.g. nginx:latest
+	ID          string   `json:"id"`                     // ID is the ID of the image the containers of the service were created from
+	RepoDigests []string `json:"repo_digests,omitempty"` // RepoDigests are the repository digests of the image, empty for locally built images
+}
+
+// GetDeployedImages returns the images of the services of a deployed project, one per service
+func GetDeployedImages(ctx context.Context, apiClient client.APIClient, projectName string) ([]DeployedImage, error) {
+	containers, err := GetProjectContainers(ctx, apiClient, projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []DeployedImage
+
+	seen := make(map[string]bool)
+
+	for _, c := range containers {
+		name := c.Labels[api.ServiceLabel]
+		if seen[name] {
+			// All replicas of a service are created from the same image
+			continue
+		}
+
+		seen[name] = true
+
+		inspect, err := apiClient.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect container %s: %w", c.ID, err)
+		}
+
+		if inspect.Config == nil || inspect.Config.Image == "" {
+			continue
+		}
+
+		image, _, err := apiClient.ImageInspectWithRaw(ctx, inspect.Image)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect image %s: %w", inspect.Config.Image, err)
+		}
+
+		images = append(images, DeployedImage{
+			Service:     name,
+			Image:       inspect.Config.Image,
+			ID:          inspect.Image,
+			RepoDigests: image.RepoDigests,
+		})
+	}
+
+	return images, nil
+}
+
+// HasDigest checks if the image was pulled with the manifest digest, e.g. sha256:...
+func (i DeployedImage) HasDigest(digest string) bool {
+	for _, d := range i.RepoDigests {
+		if strings.HasSuffix(d, "@"+digest) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getRegistryHost returns the registry of an image reference, e.g. ghcr.io for ghcr.io/kimdre/doco-cd:latest
+func getRegistryHost(image string) string {
+	host, _, found := strings.Cut(image, "/")
+	if !found || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		return dockerHubRegistry
+	}
+
+	return host
+}
+
+// getRegistryAuth returns the encoded credentials for the registry of the image from the docker config file
+func getRegistryAuth(dockerCli command.Cli, image string) (string, error) {
+	key := getRegistryHost(image)
+	if key == dockerHubRegistry {
+		key = dockerHubAuthKey
+	}
+
+	authConfig, err := dockerCli.ConfigFile().GetAuthConfig(key)
+	if err != nil {
+		return "", err
+	}
+
+	return registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      authConfig.Username,
+		Password:      authConfig.Password,
+		Auth:          authConfig.Auth,
+		ServerAddress: authConfig.ServerAddress,
+		IdentityToken: authConfig.IdentityToken,
+		RegistryToken: authConfig.RegistryToken,
+	})
+}
+
+// getRegistryAuthKey returns the key of the credentials of a registry host in the docker config file
+func getRegistryAuthKey(host string) string {
+	switch host {
+	case dockerHubRegistry, "index.docker.io", "registry-1.docker.io":
+		return dockerHubAuthKey
+	default:
+		return host
+	}
+}
+
+// registryAuthCli is a docker cli whose config file contains the registry credentials of a stack
+type registryAuthCli struct {
+	command.Cli
+	configFile *configfile.ConfigFile
+}
+
+func (c *registryAuthCli) ConfigFile() *configfile.ConfigFile {
+	return c.configFile
+}
+
+/*
+WithRegistryAuth returns a docker cli that pulls and builds the images of a stack with the registry credentials of its
+deploy config, the passwords of the credentials have to be resolved already. The credentials take precedence over the
+ones of the docker config file of the host, including its credential helpers, the config file itself is not changed.
+*/
+func WithRegistryAuth(dockerCli command.Cli, auths []config.RegistryAuth) command.Cli {
+	if len(auths) == 0 {
+		return dockerCli
+	}
+
+	configFile := *dockerCli.ConfigFile()
+	configFile.AuthConfigs = maps.Clone(configFile.AuthConfigs)
+	configFile.CredentialHelpers = maps.Clone(configFile.CredentialHelpers)
+
+	if configFile.AuthConfigs == nil {
+		configFile.AuthConfigs = make(map[string]clitypes.AuthConfig)
+	}
+
+	if configFile.CredentialHelpers == nil {
+		configFile.CredentialHelpers = make(map[string]string)
+	}
+
+	for _, auth := range auths {
+		key := getRegistryAuthKey(auth.Registry)
+
+		configFile.AuthConfigs[key] = clitypes.AuthConfig{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			ServerAddress: key,
+		}
+
+		// An empty helper reads the credentials of the registry from AuthConfigs instead of the credentials store
+		configFile.CredentialHelpers[key] = ""
+	}
+
+	return &registryAuthCli{Cli: dockerCli, configFile: &configFile}
+}
+
+/*
+GetRegistryDigest returns the manifest digest that an image tag points to in the registry without pulling the image,
+using the credentials of the registry from the docker config file. Manifest requests do not count towards the pull
+rate limit of Docker Hub, but registries can still limit them, in which case ErrRegistryRateLimited is returned.
+*/
+func GetRegistryDigest(ctx context.Context, dockerCli command.Cli, image string) (string, error) {
+	auth, err := getRegistryAuth(dockerCli, image)
+	if err != nil {
+		return "", fmt.Errorf("failed to get credentials for %s: %w", image, err)
+	}
+
+	inspect, err := dockerCli.Client().DistributionInspect(ctx, image, auth)
+	if err != nil {
+		if strings.Contains(err.Error(), "toomanyrequests") {
+			return "", fmt.Errorf("%w: %s: %v", ErrRegistryRateLimited, getRegistryHost(image), err)
+		}
+
+		return "", fmt.Errorf("failed to get digest of %s: %w", image, err)
+	}
+
+	return inspect.Descriptor.Digest.String(), nil
+}
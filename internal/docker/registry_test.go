@@ -0,0 +1,97 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/cli/cli/command"
+
+	"github.com/kimdre/doco-cd/internal/config"
+)
+
+func TestGetRegistryHost(t *testing.T) {
+	testCases := []struct {
+		image    string
+		expected string
+	}{
+		{"nginx:latest", "docker.io"},
+		{"kimdre/doco-cd:latest", "docker.io"},
+		{"ghcr.io/kimdre/doco-cd:latest", "ghcr.io"},
+		{"localhost/app", "localhost"},
+		{"registry.example.com:5000/app:1.0", "registry.example.com:5000"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.image, func(t *testing.T) {
+			if host := getRegistryHost(tc.image); host != tc.expected {
+				t.Errorf("expected registry %s, got %s", tc.expected, host)
+			}
+		})
+	}
+}
+
+func TestDeployedImage_HasDigest(t *testing.T) {
+	image := DeployedImage{Image: "nginx:latest", RepoDigests: []string{"nginx@sha256:abc"}}
+
+	if !image.HasDigest("sha256:abc") {
+		t.Error("expected image to have digest sha256:abc")
+	}
+
+	if image.HasDigest("sha256:def") {
+		t.Error("expected image to not have digest sha256:def")
+	}
+}
+
+func TestWithRegistryAuth(t *testing.T) {
+	dir := t.TempDir()
+
+	// The credentials store of the host must not be asked for the registries of the stack
+	err := os.WriteFile(filepath.Join(dir, "config.json"),
+		[]byte(`{"auths":{"ghcr.io":{"auth":"aG9zdDpzZWNyZXQ="}},"credsStore":"does-not-exist"}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("DOCKER_CONFIG", dir)
+
+	dockerCli, err := command.NewDockerCli()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authCli := WithRegistryAuth(dockerCli, []config.RegistryAuth{
+		{Registry: "ghcr.io", Username: "stack", Password: "token"},
+		{Registry: "docker.io", Username: "hub", Password: "hub-token"},
+	})
+
+	testCases := []struct {
+		key      string
+		username string
+		password string
+	}{
+		{"ghcr.io", "stack", "token"},
+		{dockerHubAuthKey, "hub", "hub-token"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.key, func(t *testing.T) {
+			auth, err := authCli.ConfigFile().GetAuthConfig(tc.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if auth.Username != tc.username || auth.Password != tc.password {
+				t.Errorf("expected credentials %s:%s, got %s:%s", tc.username, tc.password, auth.Username, auth.Password)
+			}
+		})
+	}
+
+	if _, ok := dockerCli.ConfigFile().CredentialHelpers["ghcr.io"]; ok {
+		t.Error("expected the config file of the host to be unchanged")
+	}
+
+	if WithRegistryAuth(dockerCli, nil) != dockerCli {
+		t.Error("expected the docker cli to be returned without credentials")
+	}
+}
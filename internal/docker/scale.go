@@ -0,0 +1,77 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/cli/cli/command"
+	"github.com/docker/compose/v2/pkg/api"
+
+	"github.com/kimdre/doco-cd/internal/config"
+	"github.com/kimdre/doco-cd/internal/webhook"
+)
+
+/*
+ScaleService sets the number of containers of a service of a deployed project, e.g. to run more workers during an incident,
+and returns the number of containers the service had before. The project has to be loaded from the commit it was deployed
+from, so that docker compose only adds or removes containers of the service and does not recreate the existing ones.
+The next deployment of the stack applies its scale again.
+*/
+func ScaleService(
+	ctx context.Context, dockerCli command.Cli, project *types.Project, deployConfig *config.DeployConfig,
+	payload webhook.ParsedPayload, service string, replicas int,
+) (int, error) {
+	if replicas < 0 {
+		return 0, fmt.Errorf("%w: replicas of service %s must not be negative, got %d", ErrInvalidScale, service, replicas)
+	}
+
+	if _, ok := project.Services[service]; !ok {
+		return 0, fmt.Errorf("%w: service %s does not exist in project %s", ErrInvalidScale, service, project.Name)
+	}
+
+	current, err := countServiceContainers(ctx, dockerCli, project.Name, service)
+	if err != nil {
+		return 0, err
+	}
+
+	err = prepareProject(project, deployConfig, payload)
+	if err != nil {
+		return current, err
+	}
+
+	err = applyScale(project, map[string]int{service: replicas})
+	if err != nil {
+		return current, err
+	}
+
+	composeService, err := newComposeService(dockerCli, project, deployConfig)
+	if err != nil {
+		return current, err
+	}
+
+	err = composeService.Scale(ctx, project, api.ScaleOptions{Services: []string{service}})
+	if err != nil {
+		return current, fmt.Errorf("failed to scale service %s: %w", service, err)
+	}
+
+	return current, nil
+}
+
+// countServiceContainers returns the number of containers of a service of a project without one-off containers
+func countServiceContainers(ctx context.Context, dockerCli command.Cli, projectName, service string) (int, error) {
+	containers, err := GetProjectContainers(ctx, dockerCli.Client(), projectName)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	for _, c := range containers {
+		if c.Labels[api.ServiceLabel] == service && c.Labels[api.OneoffLabel] != "True" {
+			count++
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,145 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/docker/compose/v2/pkg/compose"
+
+	"github.com/kimdre/doco-cd/internal/config"
+	"github.com/kimdre/doco-cd/internal/webhook"
+)
+
+func TestScaleService_Invalid(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+
+	createComposeFile(t, filePath, `services:
+  worker:
+    image: nginx:latest
+`)
+
+	testCases := []struct {
+		name     string
+		service  string
+		replicas int
+	}{
+		{"Negative Replicas", "worker", -1},
+		{"Unknown Service", "unknown", 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			project, err := LoadCompose(ctx, dirName, projectName, []string{filePath})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The request is rejected before the docker daemon is contacted
+			_, err = ScaleService(ctx, nil, project, config.DefaultDeployConfig(projectName), webhook.ParsedPayload{}, tc.service, tc.replicas)
+			if !errors.Is(err, ErrInvalidScale) {
+				t.Fatalf("expected error to be %v, got %v", ErrInvalidScale, err)
+			}
+		})
+	}
+}
+
+func TestScaleService(t *testing.T) {
+	c, err := config.GetAppConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := webhook.ParsedPayload{
+		Ref:       "refs/heads/test",
+		CommitSHA: "26263c2b44133367927cd1423d8c8457b5befce5",
+		Name:      "doco-cd",
+		FullName:  "kimdre/doco-cd",
+		CloneURL:  "https://github.com/kimdre/doco-cd",
+	}
+
+	err = VerifySocketConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err = os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filePath := filepath.Join(dirName, "test.compose.yaml")
+
+	createComposeFile(t, filePath, `services:
+  worker:
+    image: nginx:latest
+`)
+
+	dockerCli, err := CreateDockerCli(c.DockerQuietDeploy, !c.SkipTLSVerification)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deployConfig := config.DefaultDeployConfig(projectName)
+
+	project, err := LoadCompose(ctx, dirName, projectName, []string{filePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		err = compose.NewComposeService(dockerCli).Down(ctx, projectName, api.DownOptions{RemoveOrphans: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	err = DeployCompose(ctx, dockerCli, project, deployConfig, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct{ replicas, previous int }{{3, 1}, {1, 3}} {
+		// The project is loaded again like from the deployed commit
+		project, err = LoadCompose(ctx, dirName, projectName, []string{filePath})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		previous, err := ScaleService(ctx, dockerCli, project, deployConfig, p, "worker", tc.replicas)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if previous != tc.previous {
+			t.Errorf("expected %d previous replicas, got %d", tc.previous, previous)
+		}
+
+		current, err := countServiceContainers(ctx, dockerCli, projectName, "worker")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if current != tc.replicas {
+			t.Errorf("expected %d replicas, got %d", tc.replicas, current)
+		}
+	}
+}
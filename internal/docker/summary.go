@@ -0,0 +1,135 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/docker/docker/client"
+)
+
+const (
+	ServiceCreated   = "created"   // ServiceCreated means the service had no containers before the deployment
+	ServiceRecreated = "recreated" // ServiceRecreated means the containers of the service were replaced
+	ServiceScaled    = "scaled"    // ServiceScaled means containers of the service were added or removed while the others were kept
+	ServiceStarted   = "started"   // ServiceStarted means the stopped containers of the service were started again
+	ServiceUnchanged = "unchanged" // ServiceUnchanged means the containers of the service were kept as they were
+	ServiceRemoved   = "removed"   // ServiceRemoved means the containers of the service were removed, e.g. as orphans
+)
+
+// summaryOrder is the order of the outcomes in the summary of a deployment
+var summaryOrder = []string{ServiceCreated, ServiceRecreated, ServiceScaled, ServiceStarted, ServiceUnchanged, ServiceRemoved}
+
+// serviceContainers are the containers of a service at a point in time
+type serviceContainers struct {
+	ids     []string
+	running int
+}
+
+// ProjectState contains the containers of each service of a project
+type ProjectState map[string]serviceContainers
+
+// DeploySummary maps the services of a project to the outcome of a deployment, e.g. recreated
+type DeploySummary map[string]string
+
+// GetProjectState returns the current containers of each service of a project
+func GetProjectState(ctx context.Context, apiClient client.APIClient, projectName string) (ProjectState, error) {
+	containers, err := GetProjectContainers(ctx, apiClient, projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	state := make(ProjectState)
+
+	for _, c := range containers {
+		name := c.Labels[api.ServiceLabel]
+
+		s := state[name]
+		s.ids = append(s.ids, c.ID)
+
+		if c.State == "running" {
+			s.running++
+		}
+
+		state[name] = s
+	}
+
+	return state, nil
+}
+
+// SummarizeDeployment compares the containers of a project before and after a deployment
+func SummarizeDeployment(before, after ProjectState) DeploySummary {
+	summary := make(DeploySummary)
+
+	for name, a := range after {
+		b, ok := before[name]
+
+		switch {
+		case !ok || len(b.ids) == 0:
+			summary[name] = ServiceCreated
+		case !containsAll(a.ids, b.ids) && !containsAll(b.ids, a.ids):
+			summary[name] = ServiceRecreated
+		case len(a.ids) != len(b.ids):
+			summary[name] = ServiceScaled
+		case a.running > b.running:
+			summary[name] = ServiceStarted
+		default:
+			summary[name] = ServiceUnchanged
+		}
+	}
+
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			summary[name] = ServiceRemoved
+		}
+	}
+
+	return summary
+}
+
+// containsAll checks if all items of sub are contained in list
+func containsAll(list, sub []string) bool {
+	for _, item := range sub {
+		if !slices.Contains(list, item) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Unchanged checks if the deployment kept all services as they were
+func (s DeploySummary) Unchanged() bool {
+	for _, outcome := range s {
+		if outcome != ServiceUnchanged {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String returns the number of services per outcome, e.g. 2 recreated, 1 started, 3 unchanged
+func (s DeploySummary) String() string {
+	counts := make(map[string]int)
+
+	for _, outcome := range s {
+		counts[outcome]++
+	}
+
+	var parts []string
+
+	for _, outcome := range summaryOrder {
+		if counts[outcome] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[outcome], outcome))
+		}
+	}
+
+	if len(parts) == 0 {
+		return "no services"
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,50 @@
+package docker
+
+import "testing"
+
+func TestSummarizeDeployment(t *testing.T) {
+	before := ProjectState{
+		"recreated": {ids: []string{"a"}, running: 1},
+		"scaled":    {ids: []string{"b"}, running: 1},
+		"started":   {ids: []string{"c"}, running: 0},
+		"unchanged": {ids: []string{"d"}, running: 1},
+		"removed":   {ids: []string{"e"}, running: 1},
+	}
+
+	after := ProjectState{
+		"created":   {ids: []string{"f"}, running: 1},
+		"recreated": {ids: []string{"g"}, running: 1},
+		"scaled":    {ids: []string{"b", "h"}, running: 2},
+		"started":   {ids: []string{"c"}, running: 1},
+		"unchanged": {ids: []string{"d"}, running: 1},
+	}
+
+	summary := SummarizeDeployment(before, after)
+
+	for name, outcome := range summary {
+		if name != outcome {
+			t.Errorf("expected service %s to be %s, got %s", name, name, outcome)
+		}
+	}
+
+	if len(summary) != 6 {
+		t.Errorf("expected 6 services in summary, got %d", len(summary))
+	}
+
+	expected := "1 created, 1 recreated, 1 scaled, 1 started, 1 unchanged, 1 removed"
+	if summary.String() != expected {
+		t.Errorf("expected summary %q, got %q", expected, summary.String())
+	}
+
+	if summary.Unchanged() {
+		t.Error("expected summary with changed services to not be unchanged")
+	}
+
+	if !(DeploySummary{"web": ServiceUnchanged}).Unchanged() {
+		t.Error("expected summary with only unchanged services to be unchanged")
+	}
+
+	if s := (DeploySummary{}).String(); s != "no services" {
+		t.Errorf("expected empty summary to be %q, got %q", "no services", s)
+	}
+}
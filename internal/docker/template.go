@@ -0,0 +1,78 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/template"
+)
+
+/*
+TemplateData contains the variables that are available in compose file templates:
+
+	{{ .Repository }}  full name of the repository, e.g. kimdre/doco-cd
+	{{ .Reference }}   git reference of the deployment, e.g. refs/heads/main
+	{{ .CommitSHA }}   commit SHA of the deployment
+	{{ .Stack }}       name of the stack/compose project
+	{{ .Target }}      custom target of the webhook, empty if none was used
+
+The environment of doco-cd is intentionally not available, as it contains its own secrets.
+*/
+type TemplateData struct {
+	Repository string
+	Reference  string
+	CommitSHA  string
+	Stack      string
+	Target     string
+}
+
+// RenderComposeTemplates renders the compose files as Go templates into a new temporary directory outside
+// the repository and returns the paths of the rendered files in the same order as the compose files.
+// The returned directory must be removed by the caller after the project has been loaded.
+func RenderComposeTemplates(workingDir string, composeFiles []string, data TemplateData) ([]string, string, error) {
+	renderDir, err := os.MkdirTemp("", "doco-cd-render-*")
+	if err != nil {
+		return nil, "", err
+	}
+
+	rendered := make([]string, len(composeFiles))
+
+	for i, f := range composeFiles {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(workingDir, f)
+		}
+
+		content, err := os.ReadFile(f)
+		if err != nil {
+			_ = os.RemoveAll(renderDir)
+			return nil, "", err
+		}
+
+		tmpl, err := template.New(filepath.Base(f)).Option("missingkey=error").Parse(string(content))
+		if err != nil {
+			_ = os.RemoveAll(renderDir)
+			return nil, "", fmt.Errorf("failed to parse template %s: %w", f, err)
+		}
+
+		var buf bytes.Buffer
+
+		err = tmpl.Execute(&buf, data)
+		if err != nil {
+			_ = os.RemoveAll(renderDir)
+			return nil, "", fmt.Errorf("failed to render template %s: %w", f, err)
+		}
+
+		// Prefix the files with their index to keep files with the same name from different directories apart
+		rendered[i] = filepath.Join(renderDir, strconv.Itoa(i)+"-"+filepath.Base(f))
+
+		err = os.WriteFile(rendered[i], buf.Bytes(), 0o600)
+		if err != nil {
+			_ = os.RemoveAll(renderDir)
+			return nil, "", err
+		}
+	}
+
+	return rendered, renderDir, nil
+}
@@ -0,0 +1,69 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderComposeTemplates(t *testing.T) {
+	ctx := context.Background()
+
+	dirName := createTmpDir(t)
+	t.Cleanup(func() {
+		err := os.RemoveAll(dirName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	createComposeFile(t, filepath.Join(dirName, "test.compose.yaml"), `services:
+  test:
+    image: nginx:latest
+    environment:
+      COMMIT: "{{ .CommitSHA }}"
+{{- if eq .Target "prod" }}
+  monitoring:
+    image: prom/node-exporter:latest
+{{- end }}
+`)
+
+	data := TemplateData{
+		Repository: "kimdre/doco-cd",
+		Reference:  "refs/heads/main",
+		CommitSHA:  "26263c2b44133367927cd1423d8c8457b5befce5",
+		Stack:      projectName,
+		Target:     "prod",
+	}
+
+	files, renderDir, err := RenderComposeTemplates(dirName, []string{"test.compose.yaml"}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		err = os.RemoveAll(renderDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if strings.HasPrefix(files[0], dirName) {
+		t.Fatalf("expected rendered file to be outside of the repository, got %s", files[0])
+	}
+
+	project, err := LoadCompose(ctx, dirName, projectName, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(project.Services) != 2 {
+		t.Fatalf("expected 2 services, got %d", len(project.Services))
+	}
+
+	if commit := project.Services["test"].Environment["COMMIT"]; commit == nil || *commit != data.CommitSHA {
+		t.Errorf("expected COMMIT to be %s, got %v", data.CommitSHA, commit)
+	}
+}
@@ -0,0 +1,180 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// cacheRef is the reference that fetched commits are stored in, so that fetching never updates a checked out branch
+const cacheRef = "refs/doco-cd/cache"
+
+var (
+	ErrCacheLockFailed = errors.New("failed to lock cached repository")
+	ErrCommitNotCached = errors.New("commit is not in the repository cache")
+)
+
+/*
+CachedRepository is a checkout of a reference in a repository cache that is shared between multiple instances.
+Each checkout is protected by a lock file next to it: The instance that gets the exclusive lock fetches and checks out
+the reference, all other instances wait for it and then deploy from the same checkout while holding a shared lock,
+so that the checkout doesn't change during their deployments. The lock must be released with Release.
+*/
+type CachedRepository struct {
+	Dir  string
+	lock *os.File
+}
+
+// Release releases the shared lock of the cached repository
+func (r *CachedRepository) Release() error {
+	err := syscall.Flock(int(r.lock.Fd()), syscall.LOCK_UN)
+	if err != nil {
+		_ = r.lock.Close()
+		return err
+	}
+
+	return r.lock.Close()
+}
+
+// CheckoutCachedRepository updates the checkout of a reference in the repository cache to the given commit
+// (or the head of the reference if commitSHA is empty) and returns it with a shared lock held
+func CheckoutCachedRepository(cacheDir, name, url, ref, commitSHA string, skipTLSVerify bool, headers map[string]string) (*CachedRepository, error) {
+	dir := filepath.Join(cacheDir, name+"@"+NormalizeReference(ref))
+
+	err := os.MkdirAll(filepath.Dir(dir), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := os.OpenFile(dir+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCacheLockFailed, err)
+	}
+
+	err = syscall.Flock(int(lock.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		_ = lock.Close()
+		return nil, fmt.Errorf("%w: %v", ErrCacheLockFailed, err)
+	}
+
+	err = updateCachedRepository(dir, url, ref, commitSHA, skipTLSVerify, headers)
+	if err != nil {
+		_ = lock.Close()
+		return nil, err
+	}
+
+	// Downgrade to a shared lock, so that other instances can deploy from the checkout at the same time
+	err = syscall.Flock(int(lock.Fd()), syscall.LOCK_SH)
+	if err != nil {
+		_ = lock.Close()
+		return nil, fmt.Errorf("%w: %v", ErrCacheLockFailed, err)
+	}
+
+	return &CachedRepository{Dir: dir, lock: lock}, nil
+}
+
+/*
+OpenCachedRepository returns the checkout of a reference in a read-only repository cache (e.g. a volume that is
+mounted read-only and updated by another instance) with a shared lock held, without fetching or updating it.
+It returns ErrCommitNotCached if the reference is not cached or its checkout is not at the given commit.
+*/
+func OpenCachedRepository(cacheDir, name, ref, commitSHA string) (*CachedRepository, error) {
+	dir := filepath.Join(cacheDir, name+"@"+NormalizeReference(ref))
+
+	// A read-only file descriptor is sufficient for a shared lock
+	lock, err := os.Open(dir + ".lock")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrCommitNotCached, ref)
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCacheLockFailed, err)
+	}
+
+	err = syscall.Flock(int(lock.Fd()), syscall.LOCK_SH)
+	if err != nil {
+		_ = lock.Close()
+		return nil, fmt.Errorf("%w: %v", ErrCacheLockFailed, err)
+	}
+
+	cached := &CachedRepository{Dir: dir, lock: lock}
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		_ = cached.Release()
+		return nil, fmt.Errorf("%w: %v", ErrCommitNotCached, err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		_ = cached.Release()
+		return nil, fmt.Errorf("%w: %v", ErrCommitNotCached, err)
+	}
+
+	if commitSHA != "" && head.Hash().String() != commitSHA {
+		_ = cached.Release()
+		return nil, fmt.Errorf("%w: %s is checked out at %s", ErrCommitNotCached, ref, head.Hash().String())
+	}
+
+	return cached, nil
+}
+
+// updateCachedRepository clones the repository to the directory or fetches and checks out the reference if it already exists,
+// network errors of the clone and the fetch are retried according to the retry policy
+func updateCachedRepository(dir, url, ref, commitSHA string, skipTLSVerify bool, headers map[string]string) error {
+	repo, err := git.PlainOpen(dir)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return withRetry(func() error {
+			_, err := git.PlainClone(dir, false, &git.CloneOptions{
+				URL:             url,
+				Auth:            newHeaderAuth(url, headers),
+				SingleBranch:    true,
+				ReferenceName:   plumbing.ReferenceName(ref),
+				Tags:            git.NoTags,
+				Depth:           cloneDepth,
+				InsecureSkipTLS: skipTLSVerify,
+			})
+
+			return err
+		})
+	} else if err != nil {
+		return err
+	}
+
+	head, err := repo.Head()
+	if err == nil && commitSHA != "" && head.Hash().String() == commitSHA {
+		// Another instance already checked out the commit
+		return nil
+	}
+
+	err = withRetry(func() error {
+		return repo.Fetch(&git.FetchOptions{
+			RemoteURL:       url,
+			Auth:            newHeaderAuth(url, headers),
+			RefSpecs:        []gitconfig.RefSpec{gitconfig.RefSpec("+" + ref + ":" + cacheRef)},
+			Tags:            git.NoTags,
+			Depth:           cloneDepth,
+			Force:           true,
+			InsecureSkipTLS: skipTLSVerify,
+		})
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to fetch %s: %w", ref, err)
+	}
+
+	fetched, err := repo.Reference(cacheRef, true)
+	if err != nil {
+		return err
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	return worktree.Checkout(&git.CheckoutOptions{Hash: fetched.Hash(), Force: true})
+}
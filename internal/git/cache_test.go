@@ -0,0 +1,130 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/google/uuid"
+)
+
+func TestCheckoutCachedRepository(t *testing.T) {
+	cloneUrl := "https://github.com/kimdre/doco-cd.git"
+	ref := "refs/heads/main"
+	cacheDir := t.TempDir()
+	name := uuid.New().String()
+
+	cached, err := CheckoutCachedRepository(cacheDir, name, cloneUrl, ref, "", true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := cached.Dir
+
+	commit, err := GetHeadCommit(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cached.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second checkout reuses the cached repository instead of cloning it again
+	cached, err = CheckoutCachedRepository(cacheDir, name, cloneUrl, ref, commit.Hash.String(), true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		err = cached.Release()
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if cached.Dir != dir {
+		t.Errorf("expected cached repository in %s, got %s", dir, cached.Dir)
+	}
+
+	if _, err = os.Stat(dir + ".lock"); err != nil {
+		t.Errorf("expected lock file to exist: %v", err)
+	}
+}
+
+func TestCheckoutCachedRepository_Depth(t *testing.T) {
+	cloneUrl := "https://github.com/kimdre/doco-cd.git"
+	ref := "refs/heads/main"
+	cacheDir := t.TempDir()
+	name := uuid.New().String()
+
+	SetCloneDepth(2)
+	t.Cleanup(func() {
+		SetCloneDepth(1)
+	})
+
+	cached, err := CheckoutCachedRepository(cacheDir, name, cloneUrl, ref, "", true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		err = cached.Release()
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	repo, err := gogit.PlainOpen(cached.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := countCommits(t, repo); count != 2 {
+		t.Fatalf("expected 2 commits, got %d", count)
+	}
+}
+
+func TestOpenCachedRepository(t *testing.T) {
+	cloneUrl := "https://github.com/kimdre/doco-cd.git"
+	ref := "refs/heads/main"
+	cacheDir := t.TempDir()
+	name := uuid.New().String()
+
+	_, err := OpenCachedRepository(cacheDir, name, ref, "")
+	if !errors.Is(err, ErrCommitNotCached) {
+		t.Fatalf("expected error %v, got %v", ErrCommitNotCached, err)
+	}
+
+	cached, err := CheckoutCachedRepository(cacheDir, name, cloneUrl, ref, "", true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commit, err := GetHeadCommit(cached.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cached.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cached, err = OpenCachedRepository(cacheDir, name, ref, commit.Hash.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cached.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = OpenCachedRepository(cacheDir, name, ref, "0000000000000000000000000000000000000000")
+	if !errors.Is(err, ErrCommitNotCached) {
+		t.Fatalf("expected error %v, got %v", ErrCommitNotCached, err)
+	}
+}
@@ -1,16 +1,134 @@
 package git
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
 )
 
-// CloneRepository clones a repository from a given URL and reference to a temporary directory
-func CloneRepository(name, url, ref string, skipTLSVerify bool) (*git.Repository, error) {
+var (
+	ErrCommitAuthorNotAllowed = errors.New("commit author is not allowed to trigger deployments")
+	ErrInvalidClonePath       = errors.New("invalid clone path")
+)
+
+const (
+	CloneLayoutName = "name" // CloneLayoutName clones repositories to a directory named after the full name of the repository, e.g. kimdre/doco-cd
+	CloneLayoutHost = "host" // CloneLayoutHost prefixes the full name of the repository with the host of the clone URL, e.g. github.com/kimdre/doco-cd
+	CloneLayoutHash = "hash" // CloneLayoutHash uses the SHA256 hash of the clone URL (without credentials) as directory name
+)
+
+// GetCloneName returns the path relative to the temporary directory that a repository is cloned to
+func GetCloneName(layout, fullName, cloneUrl string) (string, error) {
+	var name string
+
+	switch layout {
+	case CloneLayoutName, "":
+		name = fullName
+	case CloneLayoutHost:
+		u, err := url.Parse(cloneUrl)
+		if err != nil || u.Hostname() == "" {
+			return "", fmt.Errorf("%w: failed to get host of clone url", ErrInvalidClonePath)
+		}
+
+		name = path.Join(u.Hostname(), fullName)
+	case CloneLayoutHash:
+		sum := sha256.Sum256([]byte(GetUrlWithoutAuth(cloneUrl)))
+		name = hex.EncodeToString(sum[:])
+	default:
+		return "", fmt.Errorf("%w: unknown clone layout %s", ErrInvalidClonePath, layout)
+	}
+
+	// The full name comes from the webhook payload, so it must not be able to escape the temporary directory
+	name = filepath.Clean(name)
+	if name == "." || filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidClonePath, name)
+	}
+
+	return name, nil
+}
+
+// headerAuth adds custom HTTP headers to the requests of git operations. As go-git ignores the
+// credentials of the clone URL if an auth method is set, it also sets them as basic auth.
+type headerAuth struct {
+	basic   *githttp.BasicAuth
+	headers map[string]string
+}
+
+func (a *headerAuth) Name() string {
+	return "http-header-auth"
+}
+
+// String returns the names of the headers without their values, as they may contain credentials
+func (a *headerAuth) String() string {
+	names := make([]string, 0, len(a.headers))
+	for k := range a.headers {
+		names = append(names, k)
+	}
+
+	slices.Sort(names)
+
+	return fmt.Sprintf("%s - %s", a.Name(), strings.Join(names, ", "))
+}
+
+func (a *headerAuth) SetAuth(r *http.Request) {
+	if a.basic != nil {
+		a.basic.SetAuth(r)
+	}
+
+	for k, v := range a.headers {
+		r.Header.Set(k, v)
+	}
+}
+
+// newHeaderAuth returns an auth method that sends the headers with each request or nil if there are no headers
+func newHeaderAuth(cloneUrl string, headers map[string]string) transport.AuthMethod {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	auth := &headerAuth{headers: headers}
+
+	if u, err := url.Parse(cloneUrl); err == nil && u.User != nil {
+		password, _ := u.User.Password()
+		auth.basic = &githttp.BasicAuth{Username: u.User.Username(), Password: password}
+	}
+
+	return auth
+}
+
+// cloneDepth is the number of commits that are fetched when a repository is cloned or fetched, 0 fetches the complete history
+var cloneDepth = 1
+
+// SetCloneDepth sets the number of commits that are fetched when a repository is cloned, 0 fetches the complete history.
+// It applies to the clones of deployments, the repository cache and the worktrees of single commits.
+// Deployments only need the commit of the reference, the changed files of a push are taken from the webhook payload.
+// It has to be called before the first deployment
+func SetCloneDepth(depth int) {
+	cloneDepth = max(depth, 0)
+}
+
+// CloneRepository clones a repository from a given URL and reference to a temporary directory,
+// the headers are added to all HTTP requests to the git server. If proxyURL is empty, the proxy
+// of the environment (HTTP_PROXY, HTTPS_PROXY and NO_PROXY) is used.
+// Network errors are retried according to the retry policy (see SetRetryPolicy) and
+// only the last commits of the reference are fetched (see SetCloneDepth).
+func CloneRepository(name, url, ref string, skipTLSVerify bool, proxyURL string, headers map[string]string) (*git.Repository, error) {
 	path := filepath.Join(os.TempDir(), name)
 
 	err := os.MkdirAll(path, os.ModePerm)
@@ -18,14 +136,27 @@ func CloneRepository(name, url, ref string, skipTLSVerify bool) (*git.Repository
 		return nil, err
 	}
 
-	return git.PlainClone(path, false, &git.CloneOptions{
-		URL:             url,
-		SingleBranch:    true,
-		ReferenceName:   plumbing.ReferenceName(ref),
-		Tags:            git.NoTags,
-		Depth:           1,
-		InsecureSkipTLS: skipTLSVerify,
+	var repo *git.Repository
+
+	err = withRetry(func() error {
+		// A failed clone removes the contents of the directory again, so the next attempt starts from scratch
+		var err error
+
+		repo, err = git.PlainClone(path, false, &git.CloneOptions{
+			URL:             url,
+			Auth:            newHeaderAuth(url, headers),
+			SingleBranch:    true,
+			ReferenceName:   plumbing.ReferenceName(ref),
+			Tags:            git.NoTags,
+			Depth:           cloneDepth,
+			InsecureSkipTLS: skipTLSVerify,
+			ProxyOptions:    transport.ProxyOptions{URL: proxyURL},
+		})
+
+		return err
 	})
+
+	return repo, err
 }
 
 // GetAuthUrl returns a clone URL with an access token for private repositories
@@ -34,3 +165,130 @@ func GetAuthUrl(url, authType, token string) string {
 	protocol := regexp.MustCompile("^(https?|git)://").FindString(url)
 	return protocol + authType + ":" + token + "@" + url[len(protocol):]
 }
+
+// GetUrlWithoutAuth removes the credentials and query parameters from a clone URL
+func GetUrlWithoutAuth(cloneUrl string) string {
+	u, err := url.Parse(cloneUrl)
+	if err != nil {
+		return ""
+	}
+
+	u.User = nil
+	u.RawQuery = ""
+
+	return u.String()
+}
+
+// NormalizeReference converts a reference (e.g. refs/heads/main) into a string that can safely be used as a directory name
+func NormalizeReference(ref string) string {
+	ref = strings.TrimPrefix(ref, "refs/")
+
+	return strings.Trim(regexp.MustCompile(`[^a-zA-Z0-9_.-]+`).ReplaceAllString(ref, "-"), ".-")
+}
+
+// CloneReferenceWorktree clones a reference of a repository into its own directory next to the
+// main checkout of the repository and returns the path of the worktree and the commit SHA of the reference
+func CloneReferenceWorktree(name, url, ref string, skipTLSVerify bool, proxyURL string, headers map[string]string) (string, string, error) {
+	repo, err := CloneRepository(name+"@"+NormalizeReference(ref), url, ref, skipTLSVerify, proxyURL, headers)
+	if err != nil {
+		return "", "", err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", "", err
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return "", "", err
+	}
+
+	return worktree.Filesystem.Root(), head.Hash().String(), nil
+}
+
+/*
+CloneCommitWorktree fetches a single commit of a repository into its own directory next to the main checkout of the
+repository and returns the path of the worktree, e.g. to deploy the commit that was deployed before a failed deployment.
+The git server has to allow fetching commits by their SHA, which the common providers do.
+*/
+func CloneCommitWorktree(name, url, commitSHA string, skipTLSVerify bool, proxyURL string, headers map[string]string) (string, error) {
+	path := filepath.Join(os.TempDir(), name+"@"+commitSHA)
+
+	err := os.RemoveAll(path)
+	if err != nil {
+		return "", err
+	}
+
+	repo, err := git.PlainInit(path, false)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = repo.CreateRemote(&gitconfig.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{url}})
+	if err != nil {
+		return path, err
+	}
+
+	err = withRetry(func() error {
+		return repo.Fetch(&git.FetchOptions{
+			Auth:            newHeaderAuth(url, headers),
+			RefSpecs:        []gitconfig.RefSpec{gitconfig.RefSpec(commitSHA + ":" + cacheRef)},
+			Tags:            git.NoTags,
+			Depth:           cloneDepth,
+			InsecureSkipTLS: skipTLSVerify,
+			ProxyOptions:    transport.ProxyOptions{URL: proxyURL},
+		})
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return path, fmt.Errorf("failed to fetch commit %s: %w", commitSHA, err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return path, err
+	}
+
+	err = worktree.Checkout(&git.CheckoutOptions{Hash: plumbing.NewHash(commitSHA), Force: true})
+	if err != nil {
+		return path, fmt.Errorf("failed to check out commit %s: %w", commitSHA, err)
+	}
+
+	return path, nil
+}
+
+// GetHeadCommit returns the commit that the repository in the directory is checked out at
+func GetHeadCommit(dir string) (*object.Commit, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.CommitObject(head.Hash())
+}
+
+// GetCommitSubject returns the first line of the message of a commit
+func GetCommitSubject(commit *object.Commit) string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+
+	return strings.TrimSpace(subject)
+}
+
+// VerifyCommitAuthor checks if the email address of the author or committer of a commit matches
+// one of the patterns (e.g. ci-bot@example.com or *@example.com)
+func VerifyCommitAuthor(commit *object.Commit, patterns []string) error {
+	for _, pattern := range patterns {
+		for _, email := range []string{commit.Author.Email, commit.Committer.Email} {
+			if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(email)); ok {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("%w: author %s, committer %s", ErrCommitAuthorNotAllowed, commit.Author.Email, commit.Committer.Email)
+}
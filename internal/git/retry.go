@@ -0,0 +1,87 @@
+package git
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// retryPolicy controls how often the clones and fetches of repositories are attempted, set it with SetRetryPolicy
+var retryPolicy = struct {
+	maxAttempts int
+	baseDelay   time.Duration // baseDelay is the delay before the first retry, it doubles with each further retry
+}{maxAttempts: 3, baseDelay: time.Second}
+
+// SetRetryPolicy sets how often a clone or fetch is attempted if the git server is not reachable and the delay before
+// the first retry, it has to be called before the first deployment
+func SetRetryPolicy(maxAttempts int, baseDelay time.Duration) {
+	retryPolicy.maxAttempts = max(maxAttempts, 1)
+	retryPolicy.baseDelay = baseDelay
+}
+
+// isPermanent checks if a clone or fetch failed for a reason that a retry can not fix, e.g. an unknown reference
+func isPermanent(err error) bool {
+	return errors.Is(err, transport.ErrAuthenticationRequired) ||
+		errors.Is(err, transport.ErrAuthorizationFailed) ||
+		errors.Is(err, transport.ErrRepositoryNotFound) ||
+		errors.Is(err, transport.ErrEmptyRemoteRepository) ||
+		errors.Is(err, plumbing.ErrReferenceNotFound) ||
+		errors.Is(err, git.NoMatchingRefSpecError{})
+}
+
+// isTransient checks if a clone or fetch failed because of a network error or a temporary error of the git server
+func isTransient(err error) bool {
+	if err == nil || isPermanent(err) {
+		return false
+	}
+
+	// The HTTP transport wraps the errors of the requests without unwrapping them
+	var unexpected *plumbing.UnexpectedError
+	if errors.As(err, &unexpected) && unexpected.Err != nil {
+		err = unexpected.Err
+	}
+
+	var httpErr *githttp.Err
+	if errors.As(err, &httpErr) && httpErr.Response != nil {
+		return httpErr.Response.StatusCode == http.StatusTooManyRequests || httpErr.Response.StatusCode >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// withRetry calls fn until it succeeds, fails with an error that is not transient or all attempts of the retry policy are used up.
+// The delays between the attempts grow exponentially and are randomized, so that instances do not retry at the same time
+func withRetry(fn func() error) error {
+	policy := retryPolicy
+	delay := policy.baseDelay
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if !isTransient(err) || attempt >= policy.maxAttempts {
+			return err
+		}
+
+		time.Sleep(jitter(delay))
+
+		delay *= 2
+	}
+}
+
+// jitter returns a random delay between half and all of the delay
+func jitter(delay time.Duration) time.Duration {
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + rand.N(delay/2+1)
+}
@@ -0,0 +1,100 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+func TestIsTransient(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"No Error", nil, false},
+		{"Network Error", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"Wrapped Network Error", plumbing.NewUnexpectedError(&net.DNSError{Err: "no such host", IsTemporary: true}), true},
+		{"Unexpected EOF", fmt.Errorf("failed to read pack: %w", io.ErrUnexpectedEOF), true},
+		{"Server Error", plumbing.NewUnexpectedError(&githttp.Err{Response: &http.Response{StatusCode: http.StatusBadGateway}}), true},
+		{"Rate Limited", plumbing.NewUnexpectedError(&githttp.Err{Response: &http.Response{StatusCode: http.StatusTooManyRequests}}), true},
+		{"Client Error", plumbing.NewUnexpectedError(&githttp.Err{Response: &http.Response{StatusCode: http.StatusBadRequest}}), false},
+		{"Authentication Required", transport.ErrAuthenticationRequired, false},
+		{"Authorization Failed", transport.ErrAuthorizationFailed, false},
+		{"Repository Not Found", transport.ErrRepositoryNotFound, false},
+		{"Reference Not Found", plumbing.ErrReferenceNotFound, false},
+		{"Other Error", errors.New("invalid pack"), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isTransient(tc.err); got != tc.expected {
+				t.Errorf("expected transient to be %v for %v, got %v", tc.expected, tc.err, got)
+			}
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	defaultPolicy := retryPolicy
+
+	t.Cleanup(func() {
+		retryPolicy = defaultPolicy
+	})
+
+	SetRetryPolicy(3, time.Millisecond)
+
+	transientErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	testCases := []struct {
+		name             string
+		errs             []error
+		expectedAttempts int
+		expectedErr      error
+	}{
+		{"Success", []error{nil}, 1, nil},
+		{"Success After Retry", []error{transientErr, transientErr, nil}, 3, nil},
+		{"Attempts Used Up", []error{transientErr, transientErr, transientErr, nil}, 3, transientErr},
+		{"Permanent Error", []error{transport.ErrAuthenticationRequired, nil}, 1, transport.ErrAuthenticationRequired},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+
+			err := withRetry(func() error {
+				err := tc.errs[attempts]
+				attempts++
+
+				return err
+			})
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("expected error %v, got %v", tc.expectedErr, err)
+			}
+
+			if attempts != tc.expectedAttempts {
+				t.Errorf("expected %d attempts, got %d", tc.expectedAttempts, attempts)
+			}
+		})
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for range 100 {
+		if d := jitter(time.Second); d < 500*time.Millisecond || d > time.Second {
+			t.Fatalf("expected jitter of 1s to be between 500ms and 1s, got %s", d)
+		}
+	}
+
+	if d := jitter(0); d != 0 {
+		t.Errorf("expected no jitter without delay, got %s", d)
+	}
+}
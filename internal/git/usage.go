@@ -0,0 +1,153 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var ErrQuotaExceeded = errors.New("repository exceeds its disk quota")
+
+// checkoutSize is the size of a checkout in the repository cache at the time its HEAD had the given content
+type checkoutSize struct {
+	head string
+	size int64
+}
+
+/*
+CacheUsage tracks the disk usage of the repositories in a repository cache. The size of a checkout is only computed
+again after its HEAD changed (e.g. after a new commit was checked out), so that periodic updates don't have to walk
+unchanged checkouts.
+*/
+type CacheUsage struct {
+	dir       string
+	mu        sync.RWMutex
+	usage     map[string]int64
+	checkouts map[string]checkoutSize
+}
+
+// NewCacheUsage returns a CacheUsage for the repository cache in dir, the usage is empty until it gets updated
+func NewCacheUsage(dir string) *CacheUsage {
+	return &CacheUsage{
+		dir:       dir,
+		usage:     make(map[string]int64),
+		checkouts: make(map[string]checkoutSize),
+	}
+}
+
+// Update computes the disk usage of all repositories in the cache and returns it by repository name
+func (u *CacheUsage) Update() (map[string]int64, error) {
+	u.mu.RLock()
+	previous := u.checkouts
+	u.mu.RUnlock()
+
+	usage := make(map[string]int64)
+	checkouts := make(map[string]checkoutSize)
+
+	err := filepath.WalkDir(u.dir, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == u.dir {
+			// Nothing was cached yet
+			return filepath.SkipDir
+		} else if err != nil {
+			return err
+		}
+
+		// Checkouts are stored as <name>@<reference> directories
+		if !d.IsDir() || !strings.Contains(d.Name(), "@") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(u.dir, p)
+		if err != nil {
+			return err
+		}
+
+		head, _ := os.ReadFile(filepath.Join(p, ".git", "HEAD"))
+
+		checkout, ok := previous[rel]
+		if !ok || checkout.head != string(head) {
+			size, err := dirSize(p)
+			if err != nil {
+				return err
+			}
+
+			checkout = checkoutSize{head: string(head), size: size}
+		}
+
+		checkouts[rel] = checkout
+		name := filepath.ToSlash(rel[:strings.LastIndex(rel, "@")])
+		usage[name] += checkout.size
+
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute repository cache usage: %w", err)
+	}
+
+	u.mu.Lock()
+	u.usage = usage
+	u.checkouts = checkouts
+	u.mu.Unlock()
+
+	return u.All(), nil
+}
+
+// All returns the disk usage of all repositories of the last update by repository name
+func (u *CacheUsage) All() map[string]int64 {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	usage := make(map[string]int64, len(u.usage))
+	for name, size := range u.usage {
+		usage[name] = size
+	}
+
+	return usage
+}
+
+// CheckQuota returns ErrQuotaExceeded if the repository used more than quota bytes at the last update, 0 disables the quota
+func (u *CacheUsage) CheckQuota(name string, quota int64) error {
+	if quota <= 0 {
+		return nil
+	}
+
+	u.mu.RLock()
+	size := u.usage[name]
+	u.mu.RUnlock()
+
+	if size > quota {
+		return fmt.Errorf("%w: %s uses %d of %d bytes", ErrQuotaExceeded, name, size, quota)
+	}
+
+	return nil
+}
+
+// dirSize returns the total size of the regular files in a directory
+func dirSize(dir string) (int64, error) {
+	var size int64
+
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		size += info.Size()
+
+		return nil
+	})
+
+	return size, err
+}
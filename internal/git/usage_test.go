@@ -0,0 +1,105 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createCheckout(t *testing.T, dir, head string, files map[string]int) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Join(dir, ".git"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte(head), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, size := range files {
+		err = os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCacheUsage(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	createCheckout(t, filepath.Join(cacheDir, "kimdre", "doco-cd@heads-main"), "aaa", map[string]int{"compose.yaml": 100})
+	createCheckout(t, filepath.Join(cacheDir, "kimdre", "doco-cd@heads-staging"), "bbb", map[string]int{"compose.yaml": 50})
+	createCheckout(t, filepath.Join(cacheDir, "kimdre", "other@heads-main"), "ccc", map[string]int{"compose.yaml": 10})
+
+	// Lock files next to the checkouts are not part of the usage
+	err := os.WriteFile(filepath.Join(cacheDir, "kimdre", "doco-cd@heads-main.lock"), make([]byte, 1000), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := NewCacheUsage(cacheDir)
+
+	usage, err := u.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The HEAD files (3 bytes each) are part of the checkouts
+	if usage["kimdre/doco-cd"] != 156 || usage["kimdre/other"] != 13 || len(usage) != 2 {
+		t.Fatalf("unexpected usage: %v", usage)
+	}
+
+	// Unchanged checkouts are not walked again
+	err = os.WriteFile(filepath.Join(cacheDir, "kimdre", "other@heads-main", "new.txt"), make([]byte, 1000), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err = u.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if usage["kimdre/other"] != 13 {
+		t.Errorf("expected cached size of unchanged checkout, got %d", usage["kimdre/other"])
+	}
+
+	// A new commit in the checkout changes its HEAD
+	createCheckout(t, filepath.Join(cacheDir, "kimdre", "other@heads-main"), "ddd", nil)
+
+	usage, err = u.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if usage["kimdre/other"] != 1013 {
+		t.Errorf("expected size of updated checkout to be computed again, got %d", usage["kimdre/other"])
+	}
+
+	if err = u.CheckQuota("kimdre/other", 1000); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected error %v, got %v", ErrQuotaExceeded, err)
+	}
+
+	if err = u.CheckQuota("kimdre/doco-cd", 1000); err != nil {
+		t.Errorf("expected repository within quota, got %v", err)
+	}
+
+	if err = u.CheckQuota("kimdre/other", 0); err != nil {
+		t.Errorf("expected disabled quota, got %v", err)
+	}
+}
+
+func TestCacheUsage_MissingCacheDir(t *testing.T) {
+	usage, err := NewCacheUsage(filepath.Join(t.TempDir(), "missing")).Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(usage) != 0 {
+		t.Errorf("expected no usage, got %v", usage)
+	}
+}
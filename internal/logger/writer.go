@@ -0,0 +1,62 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Writer is an io.Writer that logs each line written to it, e.g. to attribute the output of a
+// docker build to the job that started it instead of interleaving it on stdout
+type Writer struct {
+	log   *slog.Logger
+	level slog.Level
+	msg   string
+	mu    sync.Mutex
+	buf   []byte
+}
+
+// NewWriter returns a Writer that logs each line with the given level and message in the output attribute
+func NewWriter(log *slog.Logger, level slog.Level, msg string) *Writer {
+	return &Writer{log: log, level: level, msg: msg}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+
+		w.logLine(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Close logs the remaining output that did not end with a newline
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.logLine(w.buf)
+	w.buf = nil
+
+	return nil
+}
+
+func (w *Writer) logLine(line []byte) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+
+	w.log.Log(context.Background(), w.level, w.msg, slog.String("output", string(line)))
+}
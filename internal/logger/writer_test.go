@@ -0,0 +1,50 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(slog.New(slog.NewJSONHandler(&buf, nil)), slog.LevelInfo, "build output")
+
+	for _, chunk := range []string{"#1 [internal] load ", "build definition\n#2 DONE 0.1s\r\n\n", "#3 unfinished"} {
+		n, err := w.Write([]byte(chunk))
+		if err != nil || n != len(chunk) {
+			t.Fatalf("expected %d bytes to be written, got %d, %v", len(chunk), n, err)
+		}
+	}
+
+	err := w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"#1 [internal] load build definition", "#2 DONE 0.1s", "#3 unfinished"}
+
+	dec := json.NewDecoder(&buf)
+
+	for _, e := range expected {
+		var entry struct {
+			Msg    string `json:"msg"`
+			Output string `json:"output"`
+		}
+
+		err = dec.Decode(&entry)
+		if err != nil {
+			t.Fatalf("expected log entry for %q, got %v", e, err)
+		}
+
+		if entry.Msg != "build output" || entry.Output != e {
+			t.Errorf("expected output %q, got %+v", e, entry)
+		}
+	}
+
+	if dec.More() {
+		t.Error("expected no more log entries")
+	}
+}
@@ -0,0 +1,155 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kimdre/doco-cd/internal/webhook"
+)
+
+const (
+	ChannelWebhook = "webhook" // ChannelWebhook posts the Notification as JSON, signed with the secret of the channel if it is set
+	ChannelSlack   = "slack"   // ChannelSlack posts a message to a Slack incoming webhook URL
+	ChannelNtfy    = "ntfy"    // ChannelNtfy publishes a message to the topic URL of a ntfy server, authenticated with the token of the channel if it is set
+)
+
+var ErrInvalidChannel = errors.New("invalid notification channel")
+
+// Channel is a backend that deployment notifications are delivered to
+type Channel struct {
+	Type   string `json:"type"`
+	URL    string `json:"url"`
+	Token  string `json:"token,omitempty"`  // Token is sent as bearer token to ntfy channels
+	Secret string `json:"secret,omitempty"` // Secret is used to sign the notifications of webhook channels, see SignatureHeader
+}
+
+// Validate checks that the channel has a known type and an absolute URL
+func (c Channel) Validate() error {
+	switch c.Type {
+	case ChannelWebhook, ChannelSlack, ChannelNtfy:
+	default:
+		return fmt.Errorf("%w: type must be one of %s, %s or %s, got %q", ErrInvalidChannel, ChannelWebhook, ChannelSlack, ChannelNtfy, c.Type)
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%w: %s channel needs an absolute url", ErrInvalidChannel, c.Type)
+	}
+
+	return nil
+}
+
+// Channels is a list of notification channels that can be parsed from a JSON array,
+// e.g. [{"type":"slack","url":"https://hooks.slack.com/services/..."},{"type":"ntfy","url":"https://ntfy.sh/deployments"}]
+type Channels []Channel
+
+func (c *Channels) UnmarshalText(text []byte) error {
+	var channels []Channel
+
+	err := json.Unmarshal(text, &channels)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidChannel, err)
+	}
+
+	for _, channel := range channels {
+		err = channel.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	*c = channels
+
+	return nil
+}
+
+// newChannelRequest returns the request that delivers the notification to the channel
+func newChannelRequest(c Channel, n Notification) (*http.Request, error) {
+	switch c.Type {
+	case ChannelSlack:
+		body, err := json.Marshal(map[string]string{"text": fmt.Sprintf("*%s* %s: %s", n.Level, n.Metadata.Repository, n.Message)})
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+
+		return req, nil
+	case ChannelNtfy:
+		req, err := http.NewRequest(http.MethodPost, c.URL, strings.NewReader(n.Message))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Title", fmt.Sprintf("doco-cd %s: %s", n.Level, n.Metadata.Repository))
+		req.Header.Set("Tags", string(n.Level))
+
+		if n.Level == Failure {
+			req.Header.Set("Priority", "high")
+		}
+
+		if c.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.Token)
+		}
+
+		return req, nil
+	default:
+		body, err := json.Marshal(n)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+
+		if c.Secret != "" {
+			req.Header.Set(SignatureHeader, "sha256="+webhook.GenerateHMAC(body, c.Secret))
+		}
+
+		return req, nil
+	}
+}
+
+// sendToChannel delivers the notification to a single channel
+func sendToChannel(c Channel, n Notification) error {
+	req, err := newChannelRequest(c, n)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSendFailed, err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL is left out of the error, as it can contain a token, e.g. for Slack
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+
+		return fmt.Errorf("%w: %v", ErrSendFailed, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: unexpected status code %d", ErrSendFailed, resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestChannels_UnmarshalText(t *testing.T) {
+	testCases := []struct {
+		name             string
+		value            string
+		expectedChannels int
+		expectedErr      error
+	}{
+		{"Multiple Channels", `[{"type":"slack","url":"https://hooks.slack.com/services/T0/B0/x"},{"type":"ntfy","url":"https://ntfy.sh/deployments","token":"tk_1"}]`, 2, nil},
+		{"Empty List", `[]`, 0, nil},
+		{"Invalid JSON", `slack`, 0, ErrInvalidChannel},
+		{"Unknown Type", `[{"type":"email","url":"https://example.com"}]`, 0, ErrInvalidChannel},
+		{"Relative URL", `[{"type":"webhook","url":"/notify"}]`, 0, ErrInvalidChannel},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var channels Channels
+
+			err := channels.UnmarshalText([]byte(tc.value))
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectedErr, err)
+			}
+
+			if len(channels) != tc.expectedChannels {
+				t.Errorf("expected %d channels, got %d", tc.expectedChannels, len(channels))
+			}
+		})
+	}
+}
+
+func TestNewChannelRequest(t *testing.T) {
+	n := Notification{Level: Failure, Message: "web: deployment failed", Metadata: Metadata{Repository: "kimdre/doco-cd"}}
+
+	t.Run("Slack", func(t *testing.T) {
+		req, err := newChannelRequest(Channel{Type: ChannelSlack, URL: "https://hooks.slack.com/services/T0/B0/x"}, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var body map[string]string
+
+		err = json.NewDecoder(req.Body).Decode(&body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := "*failure* kimdre/doco-cd: web: deployment failed"; body["text"] != expected {
+			t.Errorf("expected text %q, got %q", expected, body["text"])
+		}
+	})
+
+	t.Run("Ntfy", func(t *testing.T) {
+		req, err := newChannelRequest(Channel{Type: ChannelNtfy, URL: "https://ntfy.sh/deployments", Token: "tk_1"}, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(body) != n.Message {
+			t.Errorf("expected body %q, got %q", n.Message, body)
+		}
+
+		if req.Header.Get("Authorization") != "Bearer tk_1" {
+			t.Errorf("expected bearer token, got %q", req.Header.Get("Authorization"))
+		}
+
+		if req.Header.Get("Priority") != "high" {
+			t.Errorf("expected high priority for failures, got %q", req.Header.Get("Priority"))
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SignatureHeader contains the HMAC-SHA256 signature of the notification body,
+// using the same scheme as GitHub webhooks (sha256=<hex encoded hmac>)
+const SignatureHeader = "X-Doco-CD-Signature-256"
+
+type Level string
+
+const (
+	Success Level = "success"
+	Failure Level = "failure"
+	Pending Level = "pending" // Pending is only used for commit statuses of deployments that have started
+	Started Level = "started" // Started is sent when the deployment of a stack starts, if enabled with NOTIFY_ON_START
+)
+
+var ErrSendFailed = errors.New("failed to send notification")
+
+// Metadata contains information about the deployment the notification is about
+type Metadata struct {
+	JobID      string `json:"job_id"`
+	Repository string `json:"repository"`
+	Stack      string `json:"stack,omitempty"`
+	Revision   string `json:"revision,omitempty"`
+
+	CommitAuthor  string     `json:"commit_author,omitempty"`  // CommitAuthor is the name of the author of the deployed commit
+	CommitMessage string     `json:"commit_message,omitempty"` // CommitMessage is the first line of the message of the deployed commit
+	CommitTime    *time.Time `json:"commit_time,omitempty"`    // CommitTime is the time the deployed commit was authored
+}
+
+// shortRevisionLength is the length of the abbreviated revision in commit summaries
+const shortRevisionLength = 7
+
+// CommitSummary describes the deployed commit, e.g. abc1234 'fix nginx config' by Jane, or returns an empty string if it is unknown
+func (m Metadata) CommitSummary() string {
+	if m.Revision == "" {
+		return ""
+	}
+
+	summary := m.Revision[:min(len(m.Revision), shortRevisionLength)]
+
+	if m.CommitMessage != "" {
+		summary += fmt.Sprintf(" '%s'", m.CommitMessage)
+	}
+
+	if m.CommitAuthor != "" {
+		summary += " by " + m.CommitAuthor
+	}
+
+	return summary
+}
+
+// Notification is the JSON body sent to the notification endpoint
+type Notification struct {
+	Level    Level     `json:"level"`
+	Message  string    `json:"message"`
+	Time     time.Time `json:"time"`
+	Metadata Metadata  `json:"metadata"`
+}
+
+/*
+Send delivers a notification to all channels, e.g. a webhook endpoint that receives the Notification as JSON.
+A channel that fails does not keep the notification from the other channels, the errors of all failed channels are returned together.
+*/
+func Send(channels []Channel, level Level, message string, metadata Metadata) error {
+	n := Notification{
+		Level:    level,
+		Message:  message,
+		Time:     time.Now().UTC(),
+		Metadata: metadata,
+	}
+
+	var errs []error
+
+	for i, c := range channels {
+		err := sendToChannel(c, n)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s channel %d: %w", c.Type, i+1, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
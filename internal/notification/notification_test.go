@@ -0,0 +1,119 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kimdre/doco-cd/internal/webhook"
+)
+
+const testSecret = "test_Secret1"
+
+func TestSend(t *testing.T) {
+	metadata := Metadata{
+		JobID:      "1234",
+		Repository: "kimdre/doco-cd",
+		Stack:      "test",
+		Revision:   "26263c2b44133367927cd1423d8c8457b5befce5",
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signature := strings.TrimPrefix(r.Header.Get(SignatureHeader), "sha256=")
+		if signature != webhook.GenerateHMAC(body, testSecret) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var n Notification
+
+		err = json.Unmarshal(body, &n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n.Level != Success || n.Metadata != metadata {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Run("Signed Notification", func(t *testing.T) {
+		err := Send([]Channel{{Type: ChannelWebhook, URL: server.URL, Secret: testSecret}}, Success, "deployment successful", metadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Invalid Signature", func(t *testing.T) {
+		err := Send([]Channel{{Type: ChannelWebhook, URL: server.URL, Secret: "invalid"}}, Success, "deployment successful", metadata)
+		if !errors.Is(err, ErrSendFailed) {
+			t.Fatalf("expected error to be %v, got %v", ErrSendFailed, err)
+		}
+	})
+
+	t.Run("Failing Channel", func(t *testing.T) {
+		received := 0
+
+		other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received++
+			w.WriteHeader(http.StatusOK)
+		}))
+		t.Cleanup(other.Close)
+
+		channels := []Channel{
+			{Type: ChannelWebhook, URL: server.URL, Secret: "invalid"},
+			{Type: ChannelSlack, URL: other.URL},
+			{Type: ChannelNtfy, URL: other.URL},
+		}
+
+		err := Send(channels, Success, "deployment successful", metadata)
+		if !errors.Is(err, ErrSendFailed) {
+			t.Fatalf("expected error to be %v, got %v", ErrSendFailed, err)
+		}
+
+		if !strings.HasPrefix(err.Error(), "webhook channel 1:") {
+			t.Errorf("expected error to name the failed channel, got %v", err)
+		}
+
+		if received != 2 {
+			t.Errorf("expected the other channels to receive the notification, got %d of 2", received)
+		}
+	})
+}
+
+func TestMetadata_CommitSummary(t *testing.T) {
+	testCases := []struct {
+		name     string
+		metadata Metadata
+		expected string
+	}{
+		{"Unknown Commit", Metadata{JobID: "1234"}, ""},
+		{"Revision Only", Metadata{Revision: "26263c2b44133367927cd1423d8c8457b5befce5"}, "26263c2"},
+		{
+			"Message And Author",
+			Metadata{Revision: "26263c2b44133367927cd1423d8c8457b5befce5", CommitMessage: "fix nginx config", CommitAuthor: "Jane"},
+			"26263c2 'fix nginx config' by Jane",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.metadata.CommitSummary(); got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
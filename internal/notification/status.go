@@ -0,0 +1,109 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kimdre/doco-cd/internal/webhook"
+)
+
+// maxStatusDescriptionLength is the maximum length of commit status descriptions accepted by GitHub
+const maxStatusDescriptionLength = 140
+
+var ErrCommitStatusNotSupported = errors.New("commit statuses are not supported for this payload")
+
+// CommitStatus is the state of a deployment that gets reported to the git provider
+type CommitStatus struct {
+	Level       Level
+	Name        string // Name is the context (GitHub, Gitea) or name (GitLab) of the status, e.g. doco-cd/my-stack
+	Description string
+	TargetURL   string // TargetURL is linked in the status, e.g. the URL of the deployed stack
+}
+
+// getStatusBody returns the JSON body of the commit status request for the provider
+func getStatusBody(provider string, status CommitStatus) ([]byte, error) {
+	description := status.Description
+	if len(description) > maxStatusDescriptionLength {
+		description = description[:maxStatusDescriptionLength-3] + "..."
+	}
+
+	switch provider {
+	case "github", "gitea":
+		return json.Marshal(map[string]string{
+			"state":       string(status.Level),
+			"context":     status.Name,
+			"description": description,
+			"target_url":  status.TargetURL,
+		})
+	case "gitlab":
+		state := string(status.Level)
+		if status.Level == Failure {
+			state = "failed"
+		}
+
+		return json.Marshal(map[string]string{
+			"state":       state,
+			"name":        status.Name,
+			"description": description,
+			"target_url":  status.TargetURL,
+		})
+	}
+
+	return nil, fmt.Errorf("%w: unknown provider %q", ErrCommitStatusNotSupported, provider)
+}
+
+// setStatusAuth sets the authentication header of the provider for the access token
+func setStatusAuth(req *http.Request, provider, token string) {
+	switch provider {
+	case "github":
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", "application/vnd.github+json")
+	case "gitea":
+		req.Header.Set("Authorization", "token "+token)
+	case "gitlab":
+		req.Header.Set("PRIVATE-TOKEN", token)
+	}
+}
+
+// SendCommitStatus reports the status of a deployment for the commit of the payload to the API of its git provider,
+// authenticated with the access token that is also used to clone the repository
+func SendCommitStatus(p webhook.ParsedPayload, token string, status CommitStatus) error {
+	if p.StatusesURL == "" || p.CommitSHA == "" {
+		return ErrCommitStatusNotSupported
+	}
+
+	body, err := getStatusBody(p.Provider, status)
+	if err != nil {
+		return err
+	}
+
+	url := strings.ReplaceAll(p.StatusesURL, "{sha}", p.CommitSHA)
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSendFailed, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	setStatusAuth(req, p.Provider, token)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSendFailed, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: unexpected status code %d", ErrSendFailed, resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kimdre/doco-cd/internal/webhook"
+)
+
+const (
+	testToken     = "test_token"
+	testCommitSHA = "26263c2b44133367927cd1423d8c8457b5befce5"
+)
+
+func TestSendCommitStatus(t *testing.T) {
+	testCases := []struct {
+		provider      string
+		authHeader    string
+		authValue     string
+		expectedState string
+		nameKey       string
+	}{
+		{"github", "Authorization", "Bearer " + testToken, "failure", "context"},
+		{"gitea", "Authorization", "token " + testToken, "failure", "context"},
+		{"gitlab", "PRIVATE-TOKEN", testToken, "failed", "name"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.provider, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/statuses/"+testCommitSHA {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+
+				if r.Header.Get(tc.authHeader) != tc.authValue {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+
+				var body map[string]string
+
+				err := json.NewDecoder(r.Body).Decode(&body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if body["state"] != tc.expectedState || body[tc.nameKey] != "doco-cd/test" || body["target_url"] != "https://example.com" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				if len(body["description"]) != maxStatusDescriptionLength {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+					return
+				}
+
+				w.WriteHeader(http.StatusCreated)
+			}))
+			t.Cleanup(server.Close)
+
+			p := webhook.ParsedPayload{
+				CommitSHA:   testCommitSHA,
+				Provider:    tc.provider,
+				StatusesURL: server.URL + "/statuses/{sha}",
+			}
+
+			status := CommitStatus{
+				Level:       Failure,
+				Name:        "doco-cd/test",
+				Description: strings.Repeat("a", 200),
+				TargetURL:   "https://example.com",
+			}
+
+			err := SendCommitStatus(p, testToken, status)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = SendCommitStatus(p, "invalid", status)
+			if !errors.Is(err, ErrSendFailed) {
+				t.Fatalf("expected error %v, got %v", ErrSendFailed, err)
+			}
+		})
+	}
+
+	t.Run("Unknown statuses URL", func(t *testing.T) {
+		err := SendCommitStatus(webhook.ParsedPayload{CommitSHA: testCommitSHA, Provider: "github"}, testToken, CommitStatus{Level: Success})
+		if !errors.Is(err, ErrCommitStatusNotSupported) {
+			t.Fatalf("expected error %v, got %v", ErrCommitStatusNotSupported, err)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package notification
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	ThrottleKeyError = "error" // ThrottleKeyError coalesces the failures of a stack with the same message
+	ThrottleKeyStack = "stack" // ThrottleKeyStack coalesces all failures of a stack, regardless of their message
+)
+
+// Throttle coalesces repeated failure notifications of a stack, e.g. of a stack that fails to deploy again and again
+type Throttle struct {
+	window time.Duration
+	key    string
+	now    func() time.Time
+
+	mu       sync.Mutex
+	failures map[string]*throttledFailure
+}
+
+// throttledFailure is a failure notification that was sent and the number of times it occurred since
+type throttledFailure struct {
+	stack string
+	sent  time.Time
+	count int // count is the number of failures since the last sent notification
+}
+
+// NewThrottle returns a Throttle that sends a repeated failure at most once per window, a window of 0 disables the throttling
+func NewThrottle(window time.Duration, key string) *Throttle {
+	return &Throttle{
+		window:   window,
+		key:      key,
+		now:      time.Now,
+		failures: make(map[string]*throttledFailure),
+	}
+}
+
+// getStack returns the repository and stack of a notification
+func getStack(metadata Metadata) string {
+	return metadata.Repository + "/" + metadata.Stack
+}
+
+/*
+Filter returns the message to send for a notification and false if the notification is suppressed.
+The first failure is sent as it is, repeated failures within the window after the last sent one are suppressed and
+the next failure after the window is sent as "still failing (N times since the last notification): <message>".
+A success resets the failures of the stack.
+*/
+func (t *Throttle) Filter(level Level, message string, metadata Metadata) (string, bool) {
+	if t == nil || t.window <= 0 {
+		return message, true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stack := getStack(metadata)
+
+	if level != Failure {
+		if level == Success {
+			for key, f := range t.failures {
+				if f.stack == stack {
+					delete(t.failures, key)
+				}
+			}
+		}
+
+		return message, true
+	}
+
+	key := stack
+	if t.key != ThrottleKeyStack {
+		key += "\x00" + message
+	}
+
+	now := t.now()
+
+	f, ok := t.failures[key]
+	if !ok {
+		t.failures[key] = &throttledFailure{stack: stack, sent: now}
+
+		return message, true
+	}
+
+	f.count++
+
+	if now.Sub(f.sent) < t.window {
+		return "", false
+	}
+
+	count := f.count
+
+	f.sent = now
+	f.count = 0
+
+	return fmt.Sprintf("still failing (%d times since the last notification): %s", count, message), true
+}
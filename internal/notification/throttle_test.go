@@ -0,0 +1,74 @@
+package notification
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottle_Filter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	throttle := NewThrottle(10*time.Minute, ThrottleKeyError)
+	throttle.now = func() time.Time {
+		return now
+	}
+
+	web := Metadata{Repository: "kimdre/doco-cd", Stack: "web"}
+	db := Metadata{Repository: "kimdre/doco-cd", Stack: "db"}
+
+	steps := []struct {
+		name            string
+		after           time.Duration
+		level           Level
+		message         string
+		metadata        Metadata
+		expectedMessage string
+		expectedSend    bool
+	}{
+		{"First Failure", 0, Failure, "pull failed", web, "pull failed", true},
+		{"Repeated Failure", time.Minute, Failure, "pull failed", web, "", false},
+		{"Other Error", 0, Failure, "build failed", web, "build failed", true},
+		{"Repeated Failure After Window", 10 * time.Minute, Failure, "pull failed", web, "still failing (2 times since the last notification): pull failed", true},
+		{"Other Stack", 0, Failure, "pull failed", db, "pull failed", true},
+		{"Repeated Failure In New Window", time.Minute, Failure, "pull failed", web, "", false},
+		{"Started", 0, Started, "deployment started", web, "deployment started", true},
+		{"Repeated Failure After Start", 0, Failure, "pull failed", web, "", false},
+		{"Success", 0, Success, "deployment successful", web, "deployment successful", true},
+		{"Failure After Success", 0, Failure, "pull failed", web, "pull failed", true},
+		{"Failure Of Other Stack Is Kept", 0, Failure, "pull failed", db, "", false},
+		{"Repeated Failure After Success", time.Minute, Failure, "pull failed", web, "", false},
+		{"Count Since Last Notification", 10 * time.Minute, Failure, "pull failed", web, "still failing (2 times since the last notification): pull failed", true},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.after)
+
+		message, send := throttle.Filter(step.level, step.message, step.metadata)
+		if send != step.expectedSend || message != step.expectedMessage {
+			t.Errorf("%s: expected (%q, %v), got (%q, %v)", step.name, step.expectedMessage, step.expectedSend, message, send)
+		}
+	}
+}
+
+func TestThrottle_FilterByStack(t *testing.T) {
+	throttle := NewThrottle(time.Hour, ThrottleKeyStack)
+	metadata := Metadata{Repository: "kimdre/doco-cd", Stack: "web"}
+
+	if _, send := throttle.Filter(Failure, "pull failed", metadata); !send {
+		t.Fatal("expected the first failure to be sent")
+	}
+
+	if _, send := throttle.Filter(Failure, "build failed", metadata); send {
+		t.Error("expected failures with another message to be coalesced by stack")
+	}
+}
+
+func TestThrottle_Disabled(t *testing.T) {
+	throttle := NewThrottle(0, ThrottleKeyError)
+
+	for range 3 {
+		if _, send := throttle.Filter(Failure, "pull failed", Metadata{Stack: "web"}); !send {
+			t.Fatal("expected all notifications to be sent without a throttle window")
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package prometheus
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	MetricsPath = "/metrics"
+	namespace   = "doco_cd"
+)
+
+// ActiveDeployments is the number of stack deployments that are currently running
+var ActiveDeployments = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "active_deployments",
+	Help:      "Number of stack deployments that are currently running",
+})
+
+// StackDeployedInfo contains the images and commit of the last successful deployment of each stack
+var StackDeployedInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "stack_deployed_info",
+	Help:      "Images and commit of the last successful deployment of a stack",
+}, []string{"stack", "image", "commit"})
+
+// SetStackDeployedInfo replaces the deployed info of a stack with the images and commit of its latest deployment
+func SetStackDeployedInfo(stack, commit string, images []string) {
+	StackDeployedInfo.DeletePartialMatch(prometheus.Labels{"stack": stack})
+
+	for _, image := range images {
+		StackDeployedInfo.WithLabelValues(stack, image, commit).Set(1)
+	}
+}
+
+// BuildCacheReclaimedBytes is the total amount of disk space reclaimed by pruning the build cache after deployments
+var BuildCacheReclaimedBytes = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "build_cache_reclaimed_bytes_total",
+	Help:      "Total amount of disk space in bytes reclaimed by pruning the build cache",
+})
+
+// DeduplicatedImagePulls is the number of image pulls that waited for a pull of the same image by another deployment
+var DeduplicatedImagePulls = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "deduplicated_image_pulls_total",
+	Help:      "Number of image pulls that were coalesced with a concurrent pull of the same image",
+})
+
+// ImagePullDuration is the time the images of a stack were pulled before its deployment, if force_image_pull is enabled
+var ImagePullDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "image_pull_duration_seconds",
+	Help:      "Time spent pulling the images of a stack before its deployment",
+	Buckets:   prometheus.ExponentialBuckets(0.5, 2, 10),
+}, []string{"stack"})
+
+// RepositoryDiskUsage is the disk space used by the checkouts of each repository in the repository cache
+var RepositoryDiskUsage = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "repository_disk_usage_bytes",
+	Help:      "Disk space in bytes used by the checkouts of a repository in the repository cache",
+}, []string{"repository"})
+
+// SetRepositoryDiskUsage replaces the disk usage of all repositories with the latest computed usage
+func SetRepositoryDiskUsage(usage map[string]int64) {
+	RepositoryDiskUsage.Reset()
+
+	for repository, size := range usage {
+		RepositoryDiskUsage.WithLabelValues(repository).Set(float64(size))
+	}
+}
+
+// ImageUpdateAvailable contains the digests of pulled images that differ from the images the services of a stack run
+var ImageUpdateAvailable = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "image_update_available",
+	Help:      "Pulled image digest of a service that differs from the image the service runs",
+}, []string{"stack", "service", "digest"})
+
+// SetImageUpdates replaces the available image updates of a stack with the pulled digests of its services
+func SetImageUpdates(stack string, digests map[string]string) {
+	ImageUpdateAvailable.DeletePartialMatch(prometheus.Labels{"stack": stack})
+
+	for service, digest := range digests {
+		ImageUpdateAvailable.WithLabelValues(stack, service, digest).Set(1)
+	}
+}
+
+// ImageUpdateRedeploys is the number of redeployments of stacks that were triggered by changed image digests
+var ImageUpdateRedeploys = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "image_update_redeploys_total",
+	Help:      "Number of stack redeployments triggered by a changed digest of a pulled image",
+}, []string{"stack"})
+
+// RegistryImageUpdates is the number of changed image digests that were detected by querying the registries
+var RegistryImageUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "registry_image_updates_total",
+	Help:      "Number of changed image digests of the services of a stack detected by querying the registry",
+}, []string{"stack"})
+
+// TriggeredRedeploys is the number of redeployments of stacks that were triggered by the deployment of another stack
+var TriggeredRedeploys = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "triggered_redeploys_total",
+	Help:      "Number of stack redeployments triggered by the deployment of another stack",
+}, []string{"stack"})
+
+// SuppressedNotifications is the number of repeated failure notifications that were coalesced by the notification throttle
+var SuppressedNotifications = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "suppressed_notifications_total",
+	Help:      "Number of repeated failure notifications suppressed by the notification throttle",
+})
+
+// SuppressedRedeploys is the number of deployments of stacks that were suppressed because the stack was deployed at the same commit again and again
+var SuppressedRedeploys = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "suppressed_redeploys_total",
+	Help:      "Number of deployments suppressed because the stack was redeployed at the same commit in a loop",
+}, []string{"stack"})
+
+// QueuedBuilds is the number of image builds that wait for a build slot, builds queue up if MAX_CONCURRENT_BUILDS is saturated
+var QueuedBuilds = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "queued_builds",
+	Help:      "Number of image builds that wait for a free build slot",
+})
+
+// RunningBuilds is the number of image builds that are currently running across all deployment jobs
+var RunningBuilds = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "running_builds",
+	Help:      "Number of image builds that are currently running",
+})
+
+// BackgroundJobsInFlight is the number of deployment jobs without a waiting client (e.g. image update redeployments) that are currently running
+var BackgroundJobsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "background_jobs_in_flight",
+	Help:      "Number of background deployment jobs that are currently running",
+})
+
+// BackgroundJobQueueWait is the time background deployment jobs waited for a free job slot, jobs queue up if MAX_BACKGROUND_JOBS is saturated
+var BackgroundJobQueueWait = promauto.NewHistogram(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "background_job_queue_wait_seconds",
+	Help:      "Time background deployment jobs waited for a free job slot",
+	Buckets:   prometheus.ExponentialBuckets(0.1, 4, 8),
+})
+
+// Handler returns the HTTP handler that exposes the registered metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,78 @@
+package prometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	ActiveDeployments.Inc()
+	defer ActiveDeployments.Dec()
+
+	req, err := http.NewRequest(http.MethodGet, MetricsPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	expected := "doco_cd_active_deployments 1"
+	if !strings.Contains(rr.Body.String(), expected) {
+		t.Errorf("expected metrics to contain '%s', got:\n%s", expected, rr.Body.String())
+	}
+}
+
+func TestSetStackDeployedInfo(t *testing.T) {
+	SetStackDeployedInfo("test", "abc", []string{"nginx:1.26", "redis:7"})
+	SetStackDeployedInfo("test", "def", []string{"nginx:1.27"})
+
+	req, err := http.NewRequest(http.MethodGet, MetricsPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+
+	expected := `doco_cd_stack_deployed_info{commit="def",image="nginx:1.27",stack="test"} 1`
+	if !strings.Contains(body, expected) {
+		t.Errorf("expected metrics to contain '%s', got:\n%s", expected, body)
+	}
+
+	if strings.Contains(body, `commit="abc"`) {
+		t.Errorf("expected info of the previous deployment to be removed, got:\n%s", body)
+	}
+}
+
+func TestSetImageUpdates(t *testing.T) {
+	SetImageUpdates("test", map[string]string{"web": "nginx@sha256:abc"})
+	SetImageUpdates("test", map[string]string{"db": "postgres@sha256:def"})
+
+	req, err := http.NewRequest(http.MethodGet, MetricsPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+
+	expected := `doco_cd_image_update_available{digest="postgres@sha256:def",service="db",stack="test"} 1`
+	if !strings.Contains(body, expected) {
+		t.Errorf("expected metrics to contain '%s', got:\n%s", expected, body)
+	}
+
+	if strings.Contains(body, `service="web"`) {
+		t.Errorf("expected previous image updates to be removed, got:\n%s", body)
+	}
+}
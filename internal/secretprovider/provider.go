@@ -0,0 +1,32 @@
+package secretprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+const ProviderVault = "vault"
+
+var (
+	ErrUnknownProvider = errors.New("unknown secret provider")
+	ErrSecretNotFound  = errors.New("secret not found")
+	ErrInvalidRef      = errors.New("invalid secret reference")
+	ErrAccessDenied    = errors.New("access to secret denied")
+)
+
+// Provider retrieves the content of secrets from an external secret store
+type Provider interface {
+	// GetSecret returns the content of the secret the reference points to
+	GetSecret(ctx context.Context, ref string) (string, error)
+}
+
+// New returns the secret provider with the given name
+func New(name, vaultAddr, vaultToken string) (Provider, error) {
+	switch name {
+	case ProviderVault:
+		return NewVault(vaultAddr, vaultToken), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+}
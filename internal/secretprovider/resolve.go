@@ -0,0 +1,78 @@
+package secretprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+var ErrUnresolvedSecrets = errors.New("failed to resolve secrets")
+
+// retryDelay is the delay before the first retry, it doubles with each further retry
+var retryDelay = time.Second
+
+// isPermanent checks if resolving a secret failed for a reason that a retry can not fix
+func isPermanent(err error) bool {
+	return errors.Is(err, ErrSecretNotFound) || errors.Is(err, ErrInvalidRef) || errors.Is(err, ErrAccessDenied)
+}
+
+// getSecret gets a secret from the provider with a timeout for each attempt and retries transient errors
+func getSecret(ctx context.Context, provider Provider, ref string, timeout time.Duration, retries int) (string, error) {
+	delay := retryDelay
+
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		value, err := provider.GetSecret(attemptCtx, ref)
+
+		cancel()
+
+		if err == nil || isPermanent(err) || attempt >= retries {
+			return value, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+/*
+ResolveSecrets returns the contents of the secrets that the references (name: reference) point to.
+Each attempt to get a secret is aborted after timeout, transient errors (e.g. the provider is not reachable)
+are retried up to retries times, while secrets that do not exist or can not be accessed fail immediately.
+The returned error names all secrets that could not be resolved.
+*/
+func ResolveSecrets(ctx context.Context, provider Provider, refs map[string]string, timeout time.Duration, retries int) (map[string]string, error) {
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	contents := make(map[string]string, len(refs))
+
+	var errs []error
+
+	for _, name := range names {
+		value, err := getSecret(ctx, provider, refs[name], timeout, retries)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("secret %s (%s): %w", name, refs[name], err))
+			continue
+		}
+
+		contents[name] = value
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w: %w", ErrUnresolvedSecrets, errors.Join(errs...))
+	}
+
+	return contents, nil
+}
@@ -0,0 +1,102 @@
+package secretprovider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// flakyProvider fails a number of times before returning the secret
+type flakyProvider struct {
+	failures map[string]int
+	err      error
+	calls    map[string]int
+}
+
+func (p *flakyProvider) GetSecret(ctx context.Context, ref string) (string, error) {
+	p.calls[ref]++
+
+	if ref == "missing" {
+		return "", ErrSecretNotFound
+	}
+
+	if ref == "slow" {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+
+	if p.calls[ref] <= p.failures[ref] {
+		return "", p.err
+	}
+
+	return "value-" + ref, nil
+}
+
+func TestResolveSecrets(t *testing.T) {
+	defaultDelay := retryDelay
+	retryDelay = time.Millisecond
+
+	t.Cleanup(func() {
+		retryDelay = defaultDelay
+	})
+
+	transientErr := errors.New("connection refused")
+
+	t.Run("Retry Transient Errors", func(t *testing.T) {
+		p := &flakyProvider{failures: map[string]int{"db": 2}, err: transientErr, calls: map[string]int{}}
+
+		contents, err := ResolveSecrets(context.Background(), p, map[string]string{"db_password": "db"}, time.Second, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if contents["db_password"] != "value-db" || p.calls["db"] != 3 {
+			t.Errorf("expected secret after 3 attempts, got %v after %d attempts", contents, p.calls["db"])
+		}
+	})
+
+	t.Run("Retries Exhausted", func(t *testing.T) {
+		p := &flakyProvider{failures: map[string]int{"db": 5}, err: transientErr, calls: map[string]int{}}
+
+		_, err := ResolveSecrets(context.Background(), p, map[string]string{"db_password": "db"}, time.Second, 2)
+		if !errors.Is(err, ErrUnresolvedSecrets) || !errors.Is(err, transientErr) {
+			t.Fatalf("expected unresolved secrets error, got %v", err)
+		}
+
+		if p.calls["db"] != 3 {
+			t.Errorf("expected 3 attempts, got %d", p.calls["db"])
+		}
+	})
+
+	t.Run("Not Found Fails Fast", func(t *testing.T) {
+		p := &flakyProvider{calls: map[string]int{}}
+
+		_, err := ResolveSecrets(context.Background(), p, map[string]string{"api_key": "missing", "db_password": "db"}, time.Second, 3)
+		if !errors.Is(err, ErrSecretNotFound) {
+			t.Fatalf("expected secret not found error, got %v", err)
+		}
+
+		if p.calls["missing"] != 1 {
+			t.Errorf("expected missing secret not to be retried, got %d attempts", p.calls["missing"])
+		}
+
+		expected := "failed to resolve secrets: secret api_key (missing): secret not found"
+		if err.Error() != expected {
+			t.Errorf("expected error %q, got %q", expected, err.Error())
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		p := &flakyProvider{calls: map[string]int{}}
+
+		_, err := ResolveSecrets(context.Background(), p, map[string]string{"token": "slow"}, 10*time.Millisecond, 1)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded error, got %v", err)
+		}
+
+		if p.calls["slow"] != 2 {
+			t.Errorf("expected timed out attempt to be retried once, got %d attempts", p.calls["slow"])
+		}
+	})
+}
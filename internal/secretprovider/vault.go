@@ -0,0 +1,93 @@
+package secretprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const vaultTokenHeader = "X-Vault-Token"
+
+// Vault reads secrets from the key/value secrets engine (version 1 or 2) of HashiCorp Vault or OpenBao
+type Vault struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+func NewVault(addr, token string) *Vault {
+	return &Vault{
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		client: http.DefaultClient,
+	}
+}
+
+// GetSecret returns the value of a key of a secret, the reference has the format <path>#<key>,
+// e.g. secret/data/app#password for the kv-v2 engine mounted at secret/
+func (v *Vault) GetSecret(ctx context.Context, ref string) (string, error) {
+	secretPath, key, ok := strings.Cut(ref, "#")
+	if !ok || secretPath == "" || key == "" {
+		return "", fmt.Errorf("%w: %s, expected <path>#<key>", ErrInvalidRef, ref)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.addr+"/v1/"+strings.TrimPrefix(secretPath, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set(vaultTokenHeader, v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %w", secretPath, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, secretPath)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return "", fmt.Errorf("%w: %s", ErrAccessDenied, secretPath)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to read secret %s: unexpected status code %d", secretPath, resp.StatusCode)
+	}
+
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode secret %s: %w", secretPath, err)
+	}
+
+	// The kv-v2 engine nests the key/value pairs in data.data
+	data := body.Data
+	if nested, ok := data["data"].(map[string]any); ok {
+		data = nested
+	}
+
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("%w: key %s in %s", ErrSecretNotFound, key, secretPath)
+	}
+
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+
+	// Non-string values are provided as JSON
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,59 @@
+package secretprovider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testToken = "test_Token1"
+
+func TestVault_GetSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(vaultTokenHeader) != testToken {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/app":
+			_, _ = w.Write([]byte(`{"data":{"data":{"password":"s3cr3t","port":5432},"metadata":{"version":1}}}`))
+		case "/v1/kv/app":
+			_, _ = w.Write([]byte(`{"data":{"password":"v1-s3cr3t"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	vault := NewVault(server.URL+"/", testToken)
+
+	testCases := []struct {
+		name          string
+		ref           string
+		expected      string
+		expectedError error
+	}{
+		{"KV Version 2", "secret/data/app#password", "s3cr3t", nil},
+		{"KV Version 1", "kv/app#password", "v1-s3cr3t", nil},
+		{"Non String Value", "secret/data/app#port", "5432", nil},
+		{"Missing Key", "secret/data/app#user", "", ErrSecretNotFound},
+		{"Missing Secret", "secret/data/other#password", "", ErrSecretNotFound},
+		{"Invalid Reference", "secret/data/app", "", ErrInvalidRef},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := vault.GetSecret(context.Background(), tc.ref)
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("expected error to be %v, got %v", tc.expectedError, err)
+			}
+
+			if value != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package semver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidVersion = errors.New("invalid semantic version")
+	ErrInvalidRange   = errors.New("invalid version range")
+)
+
+// Version is a semantic version, e.g. v1.2.3 or 1.2.3-rc.1
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+}
+
+// Parse parses a semantic version with an optional v prefix, build metadata is ignored
+func Parse(s string) (Version, error) {
+	var v Version
+
+	version := strings.TrimPrefix(s, "v")
+	version, _, _ = strings.Cut(version, "+")
+	version, v.Prerelease, _ = strings.Cut(version, "-")
+
+	fields := strings.Split(version, ".")
+	if len(fields) != 3 {
+		return v, fmt.Errorf("%w: %s", ErrInvalidVersion, s)
+	}
+
+	parts := make([]int, len(fields))
+
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("%w: %s", ErrInvalidVersion, s)
+		}
+
+		parts[i] = n
+	}
+
+	v.Major, v.Minor, v.Patch = parts[0], parts[1], parts[2]
+
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 if v is lower than, equal to or greater than o.
+// Prereleases are lower than the release of the same version.
+func (v Version) Compare(o Version) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d != 0 {
+			if d < 0 {
+				return -1
+			}
+
+			return 1
+		}
+	}
+
+	switch {
+	case v.Prerelease == o.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case o.Prerelease == "":
+		return -1
+	default:
+		return strings.Compare(v.Prerelease, o.Prerelease)
+	}
+}
+
+// constraint compares a version with a fixed version
+type constraint struct {
+	op      string
+	version Version
+}
+
+func (c constraint) matches(v Version) bool {
+	cmp := v.Compare(c.version)
+
+	switch c.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case "!=":
+		return cmp != 0
+	default:
+		return cmp == 0
+	}
+}
+
+// Range is a set of version constraints, e.g. ">=1.2.0 <2.0.0 || >=3.0.0".
+// Constraints separated by spaces must all match, groups separated by || are alternatives.
+type Range [][]constraint
+
+// ParseRange parses a version range
+func ParseRange(s string) (Range, error) {
+	var r Range
+
+	for _, group := range strings.Split(s, "||") {
+		var constraints []constraint
+
+		for _, field := range strings.Fields(group) {
+			op := ""
+
+			for _, prefix := range []string{">=", "<=", "!=", ">", "<", "="} {
+				if strings.HasPrefix(field, prefix) {
+					op = prefix
+					break
+				}
+			}
+
+			v, err := Parse(strings.TrimPrefix(field, op))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrInvalidRange, s, err)
+			}
+
+			constraints = append(constraints, constraint{op: op, version: v})
+		}
+
+		if len(constraints) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidRange, s)
+		}
+
+		r = append(r, constraints)
+	}
+
+	return r, nil
+}
+
+// Contains checks if the version is in the range, prereleases are never in a range
+func (r Range) Contains(v Version) bool {
+	if v.Prerelease != "" {
+		return false
+	}
+
+	for _, constraints := range r {
+		matches := true
+
+		for _, c := range constraints {
+			if !c.matches(v) {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			return true
+		}
+	}
+
+	return false
+}
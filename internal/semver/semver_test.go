@@ -0,0 +1,100 @@
+package semver
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		version       string
+		expected      Version
+		expectedError error
+	}{
+		{"1.2.3", Version{Major: 1, Minor: 2, Patch: 3}, nil},
+		{"v1.2.3", Version{Major: 1, Minor: 2, Patch: 3}, nil},
+		{"v2.0.0-rc.1+build.5", Version{Major: 2, Prerelease: "rc.1"}, nil},
+		{"1.2", Version{}, ErrInvalidVersion},
+		{"latest", Version{}, ErrInvalidVersion},
+		{"v1.x.0", Version{}, ErrInvalidVersion},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.version, func(t *testing.T) {
+			v, err := Parse(tc.version)
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("expected error %v, got %v", tc.expectedError, err)
+			}
+
+			if err == nil && v != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, v)
+			}
+		})
+	}
+}
+
+func TestVersion_Compare(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2.3", "1.10.0", -1},
+		{"2.0.0", "1.99.99", 1},
+		{"1.0.0-rc.1", "1.0.0", -1},
+		{"1.0.0-rc.2", "1.0.0-rc.1", 1},
+	}
+
+	for _, tc := range testCases {
+		a, _ := Parse(tc.a)
+		b, _ := Parse(tc.b)
+
+		if result := a.Compare(b); result != tc.expected {
+			t.Errorf("expected %s compared to %s to be %d, got %d", tc.a, tc.b, tc.expected, result)
+		}
+	}
+}
+
+func TestRange_Contains(t *testing.T) {
+	testCases := []struct {
+		r        string
+		version  string
+		expected bool
+	}{
+		{">=1.2.0 <2.0.0", "v1.2.0", true},
+		{">=1.2.0 <2.0.0", "v1.9.7", true},
+		{">=1.2.0 <2.0.0", "v2.0.0", false},
+		{">=1.2.0 <2.0.0", "v1.1.9", false},
+		{">=1.2.0 <2.0.0", "v1.5.0-rc.1", false},
+		{"1.4.2", "1.4.2", true},
+		{">=1.0.0 !=1.3.0", "1.3.0", false},
+		{"<1.0.0 || >=3.0.0", "3.1.0", true},
+		{"<1.0.0 || >=3.0.0", "2.0.0", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.r+"/"+tc.version, func(t *testing.T) {
+			r, err := ParseRange(tc.r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			v, err := Parse(tc.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result := r.Contains(v); result != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseRange_Invalid(t *testing.T) {
+	for _, r := range []string{"", ">=1.2", "1.0.0 ||", "~1.2.0"} {
+		if _, err := ParseRange(r); !errors.Is(err, ErrInvalidRange) {
+			t.Errorf("expected invalid range error for %q, got %v", r, err)
+		}
+	}
+}
@@ -10,8 +10,23 @@ import (
 var (
 	ErrInvalidHTTPMethod = errors.New("invalid http method")
 	ErrParsingPayload    = errors.New("failed to parse payload")
+	ErrUnsupportedEvent  = errors.New("unsupported webhook event")
 )
 
+const (
+	GiteaEventHeader   = "X-Gitea-Event"
+	ForgejoEventHeader = "X-Forgejo-Event"
+)
+
+// getGiteaEvent returns the event type of a webhook request of Gitea or Forgejo, e.g. push, or an empty string if the header is missing
+func getGiteaEvent(r *http.Request) string {
+	if event := r.Header.Get(ForgejoEventHeader); event != "" {
+		return event
+	}
+
+	return r.Header.Get(GiteaEventHeader)
+}
+
 // Parse parses the payload and returns the parsed payload data
 func Parse(r *http.Request, secretKey string) (ParsedPayload, error) {
 	if r.Body == nil {
@@ -37,5 +52,10 @@ func Parse(r *http.Request, secretKey string) (ParsedPayload, error) {
 		return ParsedPayload{}, err
 	}
 
+	// Gitea and Forgejo send other events (e.g. create or delete) to the same webhook, only push events have a push payload
+	if event := getGiteaEvent(r); provider == "gitea" && event != "" && event != "push" {
+		return ParsedPayload{}, fmt.Errorf("%w: %s", ErrUnsupportedEvent, event)
+	}
+
 	return parsePayload(payload, provider)
 }
@@ -26,6 +26,7 @@ func TestParse(t *testing.T) {
 	}{
 		{"Github Push Payload", githubPayloadFile, nil},
 		{"Gitea Push Payload", giteaPayloadFile, nil},
+		{"Forgejo Push Payload", giteaPayloadFile, nil},
 		{"Gitlab Push Payload", gitlabPayloadFile, nil},
 		{"Invalid Signature", githubPayloadFile, ErrHMACVerificationFailed},
 		{"Missing Signature", githubPayloadFile, ErrMissingSecurityHeader},
@@ -54,6 +55,9 @@ func TestParse(t *testing.T) {
 					r.Header.Set(GithubSignatureHeader, "sha256="+GenerateHMAC(payload, testSecret))
 				case "Gitea Push Payload":
 					r.Header.Set(GiteaSignatureHeader, GenerateHMAC(payload, testSecret))
+				case "Forgejo Push Payload":
+					r.Header.Set(ForgejoSignatureHeader, GenerateHMAC(payload, testSecret))
+					r.Header.Set(ForgejoEventHeader, "push")
 				case "Gitlab Push Payload":
 					r.Header.Set(GitlabTokenHeader, testSecret)
 				}
@@ -83,3 +87,101 @@ func TestParse(t *testing.T) {
 		})
 	}
 }
+
+func TestParse_GiteaEvent(t *testing.T) {
+	payload, err := os.ReadFile(giteaPayloadFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name          string
+		eventHeader   string
+		event         string
+		expectedError error
+	}{
+		{"Gitea Push", GiteaEventHeader, "push", nil},
+		{"Gitea Create", GiteaEventHeader, "create", ErrUnsupportedEvent},
+		{"Forgejo Delete", ForgejoEventHeader, "delete", ErrUnsupportedEvent},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, webhookPath, bytes.NewReader(payload))
+			r.Header.Set(GiteaSignatureHeader, GenerateHMAC(payload, testSecret))
+			r.Header.Set(tc.eventHeader, tc.event)
+
+			p, err := Parse(r, testSecret)
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("expected error %v, got %v", tc.expectedError, err)
+			}
+
+			if err == nil && p.Provider != "gitea" {
+				t.Errorf("expected provider gitea, got %s", p.Provider)
+			}
+		})
+	}
+}
+
+func TestParse_DeletionEvent(t *testing.T) {
+	const zeroSHA = "0000000000000000000000000000000000000000"
+
+	testCases := []struct {
+		name     string
+		filePath string
+		fields   map[string]any
+		expected bool
+	}{
+		{"Github Push", githubPayloadFile, nil, false},
+		{"Github Branch Deletion", githubPayloadFile, map[string]any{"after": zeroSHA, "deleted": true, "commits": []any{}}, true},
+		{"Github Empty Commits", githubPayloadFile, map[string]any{"commits": []any{}}, false},
+		{"Gitea Zero SHA", giteaPayloadFile, map[string]any{"after": zeroSHA, "commits": []any{}}, true},
+		{"Gitlab Push", gitlabPayloadFile, nil, false},
+		{"Gitlab Tag Deletion", gitlabPayloadFile, map[string]any{"after": zeroSHA, "checkout_sha": nil, "commits": []any{}}, true},
+		{"Gitlab Empty Commits", gitlabPayloadFile, map[string]any{"commits": []any{}, "total_commits_count": 0}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			content, err := os.ReadFile(tc.filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var fields map[string]any
+
+			if err = json.Unmarshal(content, &fields); err != nil {
+				t.Fatal(err)
+			}
+
+			for k, v := range tc.fields {
+				fields[k] = v
+			}
+
+			payload, err := json.Marshal(fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, webhookPath, bytes.NewReader(payload))
+
+			switch tc.filePath {
+			case githubPayloadFile:
+				r.Header.Set(GithubSignatureHeader, "sha256="+GenerateHMAC(payload, testSecret))
+			case giteaPayloadFile:
+				r.Header.Set(GiteaSignatureHeader, GenerateHMAC(payload, testSecret))
+			case gitlabPayloadFile:
+				r.Header.Set(GitlabTokenHeader, testSecret)
+			}
+
+			p, err := Parse(r, testSecret)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if got := p.IsBranchOrTagDeletionEvent(); got != tc.expected {
+				t.Errorf("expected IsBranchOrTagDeletionEvent to be %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
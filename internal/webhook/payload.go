@@ -2,40 +2,140 @@ package webhook
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
 )
 
-// GithubPushPayload is a struct that represents the payload sent by GitHub or Gitea, as they have the same structure
+// PushCommit contains the files changed by a commit in a push payload
+type PushCommit struct {
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Removed  []string `json:"removed"`
+}
+
+// GithubPushPayload is a struct that represents the payload sent by GitHub, Gitea or Forgejo, as they have the same structure
 type GithubPushPayload struct {
-	Ref        string `json:"ref"`
-	CommitSHA  string `json:"after"`
-	Repository struct {
-		Name     string `json:"name"`
-		FullName string `json:"full_name"`
-		CloneURL string `json:"clone_url"`
-		Private  bool   `json:"private"`
+	Ref          string       `json:"ref"`
+	CommitSHA    string       `json:"after"`
+	Deleted      bool         `json:"deleted"` // Deleted is not sent by all versions of Gitea, deletions are also detected by the zero commit SHA
+	Commits      []PushCommit `json:"commits"`
+	TotalCommits int          `json:"total_commits"` // TotalCommits is only sent by Gitea
+	Repository   struct {
+		Name        string `json:"name"`
+		FullName    string `json:"full_name"`
+		CloneURL    string `json:"clone_url"`
+		Private     bool   `json:"private"`
+		URL         string `json:"url"`          // URL is the API URL of the repository on Gitea and the web URL on GitHub
+		StatusesURL string `json:"statuses_url"` // StatusesURL is only sent by GitHub
 	} `json:"repository"`
 }
 
 // GitlabPushPayload is a struct that represents the payload sent by GitLab
 type GitlabPushPayload struct {
-	Ref        string `json:"ref"`
-	CommitSHA  string `json:"after"`
-	Repository struct {
+	Ref          string       `json:"ref"`
+	CommitSHA    string       `json:"after"`
+	Commits      []PushCommit `json:"commits"`
+	TotalCommits int          `json:"total_commits_count"`
+	ProjectID    int64        `json:"project_id"`
+	Repository   struct {
 		Name              string `json:"name"`
 		PathWithNamespace string `json:"path_with_namespace"`
 		CloneURL          string `json:"http_url"`
+		WebURL            string `json:"web_url"`
 		VisibilityLevel   int64  `json:"visibility_level"`
 	} `json:"project"`
 }
 
 // ParsedPayload is a struct that contains the parsed payload data
 type ParsedPayload struct {
-	Ref       string
-	CommitSHA string
-	Name      string
-	FullName  string
-	CloneURL  string
-	Private   bool
+	Ref          string
+	CommitSHA    string
+	Name         string
+	FullName     string
+	CloneURL     string
+	Private      bool
+	ChangedFiles []string // ChangedFiles are the files changed by the pushed commits, nil if the payload does not contain the complete list
+	Provider     string   // Provider is the git provider that sent the payload, one of github, gitea (also for Forgejo) or gitlab
+	StatusesURL  string   // StatusesURL is the API endpoint for commit statuses of the repository with a {sha} placeholder, empty if unknown
+	Deleted      bool     // Deleted is true if the push deleted the branch or tag of Ref
+}
+
+// isZeroCommitSHA checks if the commit SHA consists of zeros only, which providers send as the commit after a push
+// that deleted the branch or tag (40 zeros for SHA-1 and 64 for SHA-256 repositories)
+func isZeroCommitSHA(sha string) bool {
+	return sha != "" && strings.Trim(sha, "0") == ""
+}
+
+// IsBranchOrTagDeletionEvent checks if the push deleted the branch or tag, in which case there is no commit to deploy.
+// Pushes without commits, e.g. of a new tag or branch that points to an existing commit, are no deletions and get deployed.
+func (p ParsedPayload) IsBranchOrTagDeletionEvent() bool {
+	return p.Deleted
+}
+
+// getChangedFiles returns the sorted files changed by the commits of a push payload.
+// Providers only send a limited number of commits, so nil is returned if commits are missing from the payload.
+func getChangedFiles(commits []PushCommit, totalCommits int) []string {
+	if len(commits) == 0 || totalCommits > len(commits) {
+		return nil
+	}
+
+	var files []string
+
+	for _, c := range commits {
+		for _, f := range slices.Concat(c.Added, c.Modified, c.Removed) {
+			if !slices.Contains(files, f) {
+				files = append(files, f)
+			}
+		}
+	}
+
+	slices.Sort(files)
+
+	return files
+}
+
+// cleanRepoPath normalizes a path relative to the repository root (e.g. ./stacks/web/, /stacks/web or
+// stacks/api/../web to stacks/web), parent elements cannot leave the root and the root itself is an empty string
+func cleanRepoPath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// HasChangesIn checks if any of the changed files is one of the paths or inside one of them.
+// Both are compared as cleaned paths relative to the repository root, so that only complete path elements match.
+// It returns true if the changed files are unknown.
+func (p ParsedPayload) HasChangesIn(paths []string) bool {
+	if p.ChangedFiles == nil {
+		return true
+	}
+
+	for _, dir := range paths {
+		dir = cleanRepoPath(dir)
+		if dir == "" {
+			return true
+		}
+
+		for _, f := range p.ChangedFiles {
+			f = cleanRepoPath(f)
+			if f == dir || strings.HasPrefix(f, dir+"/") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// getGitlabStatusesURL returns the commit statuses API endpoint of a GitLab project on the host of its web URL
+func getGitlabStatusesURL(webURL string, projectID int64) string {
+	u, err := url.Parse(webURL)
+	if err != nil || u.Host == "" || projectID == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%s://%s/api/v4/projects/%d/statuses/{sha}", u.Scheme, u.Host, projectID)
 }
 
 // ParsePayload parses the payload and returns a ParsedPayload struct
@@ -53,12 +153,21 @@ func parsePayload(payload []byte, provider string) (ParsedPayload, error) {
 		}
 
 		parsedPayload := ParsedPayload{
-			Ref:       githubPayload.Ref,
-			CommitSHA: githubPayload.CommitSHA,
-			Name:      githubPayload.Repository.Name,
-			FullName:  githubPayload.Repository.FullName,
-			CloneURL:  githubPayload.Repository.CloneURL,
-			Private:   githubPayload.Repository.Private,
+			Ref:          githubPayload.Ref,
+			CommitSHA:    githubPayload.CommitSHA,
+			Name:         githubPayload.Repository.Name,
+			FullName:     githubPayload.Repository.FullName,
+			CloneURL:     githubPayload.Repository.CloneURL,
+			Private:      githubPayload.Repository.Private,
+			ChangedFiles: getChangedFiles(githubPayload.Commits, githubPayload.TotalCommits),
+			Provider:     provider,
+			StatusesURL:  githubPayload.Repository.StatusesURL,
+			Deleted:      githubPayload.Deleted || isZeroCommitSHA(githubPayload.CommitSHA),
+		}
+
+		// Gitea does not send the statuses URL, but the API URL of the repository
+		if parsedPayload.StatusesURL == "" && provider == "gitea" && githubPayload.Repository.URL != "" {
+			parsedPayload.StatusesURL = strings.TrimSuffix(githubPayload.Repository.URL, "/") + "/statuses/{sha}"
 		}
 
 		return parsedPayload, nil
@@ -69,12 +178,16 @@ func parsePayload(payload []byte, provider string) (ParsedPayload, error) {
 		}
 
 		parsedPayload := ParsedPayload{
-			Ref:       gitlabPayload.Ref,
-			CommitSHA: gitlabPayload.CommitSHA,
-			Name:      gitlabPayload.Repository.Name,
-			FullName:  gitlabPayload.Repository.PathWithNamespace,
-			CloneURL:  gitlabPayload.Repository.CloneURL,
-			Private:   gitlabPayload.Repository.VisibilityLevel == 0,
+			Ref:          gitlabPayload.Ref,
+			CommitSHA:    gitlabPayload.CommitSHA,
+			Name:         gitlabPayload.Repository.Name,
+			FullName:     gitlabPayload.Repository.PathWithNamespace,
+			CloneURL:     gitlabPayload.Repository.CloneURL,
+			Private:      gitlabPayload.Repository.VisibilityLevel == 0,
+			ChangedFiles: getChangedFiles(gitlabPayload.Commits, gitlabPayload.TotalCommits),
+			Provider:     provider,
+			StatusesURL:  getGitlabStatusesURL(gitlabPayload.Repository.WebURL, gitlabPayload.ProjectID),
+			Deleted:      isZeroCommitSHA(gitlabPayload.CommitSHA),
 		}
 
 		return parsedPayload, nil
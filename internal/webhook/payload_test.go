@@ -0,0 +1,175 @@
+package webhook
+
+import (
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestParsePayload_ChangedFiles(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filePath string
+		provider string
+		expected []string
+	}{
+		{"Github", githubPayloadFile, "github", []string{
+			".github/workflows/test.yaml", "cmd/doco-cd/main.go", "internal/config/app_config.go",
+			"internal/config/app_config_test.go", "internal/config/deploy_config.go", "internal/docker/compose.go",
+			"internal/docker/compose_test.go", "internal/git/git_test.go", "internal/logger/logger_test.go",
+			"internal/webhook/payload.go",
+		}},
+		{"Gitea", giteaPayloadFile, "gitea", []string{".compose-deploy.yaml"}},
+		{"Gitlab", gitlabPayloadFile, "gitlab", []string{"README.md"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload, err := os.ReadFile(tc.filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := parsePayload(payload, tc.provider)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(p.ChangedFiles, tc.expected) {
+				t.Errorf("expected changed files %v, got %v", tc.expected, p.ChangedFiles)
+			}
+		})
+	}
+}
+
+func TestGetChangedFiles(t *testing.T) {
+	commits := []PushCommit{
+		{Added: []string{"app/compose.yaml"}, Modified: []string{"README.md"}},
+		{Modified: []string{"README.md"}, Removed: []string{"old/compose.yaml"}},
+	}
+
+	expected := []string{"README.md", "app/compose.yaml", "old/compose.yaml"}
+
+	if files := getChangedFiles(commits, 0); !slices.Equal(files, expected) {
+		t.Errorf("expected %v, got %v", expected, files)
+	}
+
+	if files := getChangedFiles(commits, 30); files != nil {
+		t.Errorf("expected unknown changed files for truncated commits, got %v", files)
+	}
+
+	if files := getChangedFiles(nil, 0); files != nil {
+		t.Errorf("expected unknown changed files without commits, got %v", files)
+	}
+}
+
+func TestParsedPayload_HasChangesIn(t *testing.T) {
+	p := ParsedPayload{ChangedFiles: []string{"README.md", "stacks/web/compose.yaml"}}
+
+	testCases := []struct {
+		name     string
+		paths    []string
+		expected bool
+	}{
+		{"Directory", []string{"stacks/web"}, true},
+		{"Directory With Slashes", []string{"/stacks/web/"}, true},
+		{"File", []string{"README.md"}, true},
+		{"Root", []string{"."}, true},
+		{"Relative Directory", []string{"./stacks/web"}, true},
+		{"Parent Directory Elements", []string{"stacks/api/../web"}, true},
+		{"Other Directory", []string{"stacks/api"}, false},
+		{"Prefix Of Directory Name", []string{"stacks/we"}, false},
+		{"Suffix Of Directory", []string{"web"}, false},
+		{"Parent Of Root", []string{"../stacks/web"}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if result := p.HasChangesIn(tc.paths); result != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, result)
+			}
+		})
+	}
+
+	if !(ParsedPayload{}).HasChangesIn([]string{"stacks/api"}) {
+		t.Error("expected unknown changed files to count as changed")
+	}
+}
+
+func TestParsedPayload_HasChangesIn_Nested(t *testing.T) {
+	p := ParsedPayload{ChangedFiles: []string{"infra/hosts/prod/stacks/web/compose.yaml"}}
+
+	testCases := []struct {
+		name     string
+		paths    []string
+		expected bool
+	}{
+		{"Compose File", []string{"infra/hosts/prod/stacks/web/compose.yaml"}, true},
+		{"Working Directory", []string{"infra/hosts/prod/stacks/web"}, true},
+		{"Parent Directory", []string{"infra/hosts"}, true},
+		{"Same Suffix In Other Host", []string{"infra/hosts/staging/stacks/web"}, false},
+		{"Partial Suffix", []string{"prod/stacks/web/compose.yaml"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if result := p.HasChangesIn(tc.paths); result != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestParsedPayload_HasChangesIn_RenamedDirectory(t *testing.T) {
+	// A renamed working directory shows up as removed files in the old and added files in the new directory
+	commits := []PushCommit{
+		{Added: []string{"stacks/web-v2/compose.yaml"}, Removed: []string{"stacks/web/compose.yaml"}},
+	}
+
+	p := ParsedPayload{ChangedFiles: getChangedFiles(commits, 0)}
+
+	for _, dir := range []string{"stacks/web", "stacks/web-v2"} {
+		if !p.HasChangesIn([]string{dir}) {
+			t.Errorf("expected changes in %s", dir)
+		}
+	}
+
+	if p.HasChangesIn([]string{"stacks/web-v"}) {
+		t.Error("expected no changes in stacks/web-v")
+	}
+}
+
+func TestParsePayload_StatusesURL(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filePath string
+		provider string
+		expected string
+	}{
+		{"Github", githubPayloadFile, "github", "https://api.github.com/repos/kimdre/doco-cd/statuses/{sha}"},
+		{"Gitea", giteaPayloadFile, "gitea", "https://gitea.com/api/v1/repos/kimdre/doco-cd/statuses/{sha}"},
+		{"Gitlab", gitlabPayloadFile, "gitlab", "https://gitlab.com/api/v4/projects/60609370/statuses/{sha}"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload, err := os.ReadFile(tc.filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := parsePayload(payload, tc.provider)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if p.Provider != tc.provider {
+				t.Errorf("expected provider %s, got %s", tc.provider, p.Provider)
+			}
+
+			if p.StatusesURL != tc.expected {
+				t.Errorf("expected statuses URL %s, got %s", tc.expected, p.StatusesURL)
+			}
+		})
+	}
+}
@@ -16,9 +16,10 @@ var (
 )
 
 const (
-	GithubSignatureHeader = "X-Hub-Signature-256"
-	GiteaSignatureHeader  = "X-Gitea-Signature"
-	GitlabTokenHeader     = "X-Gitlab-Token"
+	GithubSignatureHeader  = "X-Hub-Signature-256"
+	GiteaSignatureHeader   = "X-Gitea-Signature"
+	ForgejoSignatureHeader = "X-Forgejo-Signature" // ForgejoSignatureHeader is sent by Forgejo, which uses the same signature and payloads as Gitea
+	GitlabTokenHeader      = "X-Gitlab-Token"
 )
 
 func GenerateHMAC(payload []byte, secretKey string) string {
@@ -48,6 +49,11 @@ func verifyProviderSecret(r *http.Request, payload []byte, secretKey string) (st
 		signature := r.Header.Get(GiteaSignatureHeader)
 		return "gitea", verifySignature(payload, signature, secretKey)
 
+	case r.Header.Get(ForgejoSignatureHeader) != "":
+		// Forgejo is a fork of Gitea with the same API, so its payloads and commit statuses are handled as Gitea
+		signature := r.Header.Get(ForgejoSignatureHeader)
+		return "gitea", verifySignature(payload, signature, secretKey)
+
 	case r.Header.Get(GitlabTokenHeader) != "":
 		if secretKey != r.Header.Get(GitlabTokenHeader) {
 			return "", ErrGitlabTokenVerificationFailed